@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+
+	"stamp-backend/internal/config"
+	"stamp-backend/internal/database"
+	"stamp-backend/internal/export"
+	"stamp-backend/internal/handlers"
+)
+
+// filterFlags 寺社の絞り込みのフラグと、対応する GET /api/v1/temples のクエリパラメータ名
+// 空のフラグは指定しなかったものとして扱います
+var filterFlags = []struct {
+	flag, param, usage string
+}{
+	{"q", "q", "寺社名の部分一致検索"},
+	{"bbox", "bbox", "範囲指定 minLng,minLat,maxLng,maxLat"},
+	{"prefecture", "prefecture", "都道府県で絞り込み"},
+	{"kind", "kind", "種別で絞り込み (temple, shrine)"},
+	{"reservation-required", "reservation_required", "御朱印に予約が必要か (true, false)"},
+	{"kakioki-only", "kakioki_only", "書き置きのみか (true, false)"},
+	{"book-drop-off", "book_drop_off", "御朱印帳を預けるか (true, false)"},
+	{"cash-only", "cash_only", "現金のみか (true, false)"},
+	{"photography", "photography", "撮影 (allowed, restricted, prohibited)"},
+}
+
+func main() {
+	formatName := flag.String("format", "geojson", "出力フォーマット (geojson, csv, kml)")
+	output := flag.String("o", "", "出力ファイル (省略時は標準出力)")
+	includeInactive := flag.Bool("include-inactive", false, "非アクティブな寺社も出力する")
+	values := make([]*string, len(filterFlags))
+	for i, f := range filterFlags {
+		values[i] = flag.String(f.flag, "", f.usage)
+	}
+	flag.Parse()
+
+	query := url.Values{}
+	for i, f := range filterFlags {
+		if *values[i] != "" {
+			query.Set(f.param, *values[i])
+		}
+	}
+	if *includeInactive {
+		query.Set("include_inactive", "true")
+	}
+	if err := run(*formatName, *output, query); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run 条件に合う寺社を出力します。条件は一覧APIと同じクエリパラメータで受け取ります
+func run(formatName, output string, query url.Values) (err error) {
+	format, err := export.LookupFormat(formatName)
+	if err != nil {
+		return err
+	}
+	filter, err := handlers.ParseTempleFilter(query)
+	if err != nil {
+		return fmt.Errorf("invalid filter: %v", err)
+	}
+
+	// 環境変数の読み込み
+	if err := config.Load(); err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+
+	// データベース接続の初期化
+	db, err := database.Init()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %v", err)
+		}
+		defer func() {
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = fmt.Errorf("failed to write output file: %v", cerr)
+			}
+		}()
+		w = f
+	}
+
+	if err := export.WriteTemples(context.Background(), db.Temple.Query().Filter(filter), format, w); err != nil {
+		return fmt.Errorf("failed to export temples: %v", err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 
+	"stamp-backend/internal/badges"
 	"stamp-backend/internal/config"
 	"stamp-backend/internal/database"
 	"stamp-backend/internal/server"
@@ -14,6 +15,9 @@ func main() {
 	if err := config.Load(); err != nil {
 		log.Fatal("Failed to load config:", err)
 	}
+	if err := config.CheckJWTSecret(); err != nil {
+		log.Fatal("Invalid config: ", err)
+	}
 
 	// データベース接続の初期化
 	db, err := database.Init()
@@ -22,8 +26,14 @@ func main() {
 	}
 	defer db.Close()
 
+	// バッジ定義の読み込み
+	defs, err := badges.LoadDefinitions(config.GetBadgesFile())
+	if err != nil {
+		log.Fatal("Failed to load badge definitions:", err)
+	}
+
 	// サーバーの初期化と起動
-	srv := server.New(db)
+	srv := server.New(db, server.WithBadges(badges.New(db, defs)))
 	
 	port := os.Getenv("PORT")
 	if port == "" {
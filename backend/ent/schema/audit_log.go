@@ -0,0 +1,71 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// AuditLog holds the schema definition for the AuditLog entity.
+// Entries are append-only and chained by hash.
+type AuditLog struct {
+	ent.Schema
+}
+
+// Fields of the AuditLog.
+func (AuditLog) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int64("id"),
+		field.String("actor").
+			Comment("操作したユーザーID（バックグラウンド処理は system）").
+			Immutable(),
+		field.String("actor_role").
+			Comment("操作したユーザーのロール").
+			Optional().
+			Immutable(),
+		field.String("on_behalf_of").
+			Comment("操作が反映した提案の提案者（承認された修正提案など）").
+			Optional().
+			Immutable(),
+		field.String("action").
+			Comment("create / update / delete / restore / purge").
+			Immutable(),
+		field.String("entity_type").
+			Comment("対象エンティティの種類").
+			Immutable(),
+		field.Int("entity_id").
+			Comment("対象エンティティのID").
+			Immutable(),
+		field.Text("diff").
+			Comment("変更前後の差分（JSON）").
+			Immutable(),
+		field.String("request_id").
+			Comment("リクエストID").
+			Optional().
+			Immutable(),
+		field.String("ip").
+			Comment("クライアントのIPアドレス").
+			Optional().
+			Immutable(),
+		field.Time("created_at").
+			Comment("記録日時").
+			Immutable(),
+		field.String("prev_hash").
+			Comment("直前のエントリのハッシュ").
+			Immutable(),
+		field.String("hash").
+			Comment("このエントリのハッシュ（SHA-256）").
+			Unique().
+			Immutable(),
+	}
+}
+
+// Indexes of the AuditLog.
+func (AuditLog) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("entity_type", "entity_id"),
+		index.Fields("actor", "created_at"),
+		index.Fields("request_id"),
+		index.Fields("created_at"),
+	}
+}
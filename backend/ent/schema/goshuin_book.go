@@ -0,0 +1,61 @@
+package schema
+
+import (
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+)
+
+// GoshuinBook holds the schema definition for the GoshuinBook entity.
+type GoshuinBook struct {
+	ent.Schema
+}
+
+// Fields of the GoshuinBook.
+func (GoshuinBook) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("user_id").
+			Comment("所有ユーザーID").
+			NotEmpty(),
+		field.String("title").
+			Comment("御朱印帳の名前").
+			NotEmpty(),
+		field.String("cover_image_url").
+			Comment("表紙の画像URL").
+			Optional(),
+		field.Enum("type").
+			Comment("種別（神社用・寺院用・兼用）").
+			Values("shrine", "temple", "mixed").
+			Default("mixed"),
+		field.Int("capacity").
+			Comment("ページ数").
+			NonNegative().
+			Default(0),
+		field.Time("started_on").
+			Comment("使い始めた日").
+			Optional().
+			Nillable(),
+		field.Time("ended_on").
+			Comment("使い終えた日").
+			Optional().
+			Nillable(),
+		field.Time("created_at").
+			Comment("作成日時").
+			Default(time.Now).
+			Immutable(),
+		field.Time("updated_at").
+			Comment("更新日時").
+			Default(time.Now).
+			UpdateDefault(time.Now),
+	}
+}
+
+// Edges of the GoshuinBook.
+func (GoshuinBook) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("goshuin_collections", GoshuinCollection.Type).
+			Comment("この御朱印帳に入っている御朱印"),
+	}
+}
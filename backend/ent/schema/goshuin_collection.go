@@ -6,6 +6,7 @@ import (
 	"entgo.io/ent"
 	"entgo.io/ent/schema/field"
 	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/index"
 )
 
 // GoshuinCollection holds the schema definition for the GoshuinCollection entity.
@@ -16,18 +17,51 @@ type GoshuinCollection struct {
 // Fields of the GoshuinCollection.
 func (GoshuinCollection) Fields() []ent.Field {
 	return []ent.Field{
+		field.String("user_id").
+			Comment("所有ユーザーID").
+			Default(""),
+		field.String("client_id").
+			Comment("端末が生成したUUID（オフラインで作成した御朱印の同期に使う。ユーザーごとに一意）").
+			Optional(),
 		field.Int("temple_id").
 			Comment("寺社ID").
 			Positive(),
 		field.String("image_url").
-			Comment("御朱印の画像URL").
+			Comment("表紙の写真のURL（goshuin_photos の表紙と同期）").
 			Optional(),
 		field.String("notes").
-			Comment("メモ").
+			Comment("メモ（Markdown）").
+			Optional(),
+		field.Int("rating").
+			Comment("評価（1〜5）").
+			Optional().
+			Range(1, 5),
+		field.Int("fee_paid").
+			Comment("納めた金額（円）").
+			Optional().
+			NonNegative(),
+		field.Int("waiting_minutes").
+			Comment("待ち時間（分）").
+			Optional().
+			NonNegative(),
+		field.String("hall_name").
+			Comment("授与所・御堂の名前").
 			Optional(),
+		field.Int("book_id").
+			Comment("御朱印帳ID").
+			Optional().
+			Nillable(),
+		field.Int("page").
+			Comment("御朱印帳のページ").
+			Optional().
+			Positive(),
 		field.Time("collected_at").
-			Comment("収集日時").
+			Comment("収集日時（UTC）").
 			Default(time.Now),
+		field.Int("collected_tz_offset").
+			Comment("収集日時を記録したときのUTCからのオフセット（分）").
+			Optional().
+			Range(-14*60, 14*60),
 		field.Time("created_at").
 			Comment("作成日時").
 			Default(time.Now).
@@ -36,6 +70,10 @@ func (GoshuinCollection) Fields() []ent.Field {
 			Comment("更新日時").
 			Default(time.Now).
 			UpdateDefault(time.Now),
+		field.Time("deleted_at").
+			Comment("ゴミ箱に入れた日時（保持期間を過ぎると完全に削除される）").
+			Optional().
+			Nillable(),
 	}
 }
 
@@ -48,5 +86,21 @@ func (GoshuinCollection) Edges() []ent.Edge {
 			Unique().
 			Required().
 			Comment("この御朱印が属する寺社"),
+		edge.From("book", GoshuinBook.Type).
+			Ref("goshuin_collections").
+			Field("book_id").
+			Unique().
+			Comment("この御朱印が入っている御朱印帳"),
+		edge.To("tags", GoshuinCollectionTag.Type).
+			Comment("タグ"),
+		edge.To("photos", GoshuinPhoto.Type).
+			Comment("写真"),
+	}
+}
+
+// Indexes of the GoshuinCollection.
+func (GoshuinCollection) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("user_id", "client_id").Unique(),
 	}
 }
@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// GoshuinCollectionTag holds the schema definition for the GoshuinCollectionTag entity.
+type GoshuinCollectionTag struct {
+	ent.Schema
+}
+
+// Fields of the GoshuinCollectionTag.
+func (GoshuinCollectionTag) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("collection_id").
+			Comment("御朱印ID"),
+		field.String("tag").
+			Comment("タグ（小文字・前後の空白を除去）").
+			NotEmpty().
+			MaxLen(64),
+	}
+}
+
+// Edges of the GoshuinCollectionTag.
+func (GoshuinCollectionTag) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("collection", GoshuinCollection.Type).
+			Ref("tags").
+			Field("collection_id").
+			Unique().
+			Required(),
+	}
+}
+
+// Indexes of the GoshuinCollectionTag.
+func (GoshuinCollectionTag) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("collection_id", "tag").Unique(),
+		index.Fields("tag"),
+	}
+}
@@ -0,0 +1,65 @@
+package schema
+
+import (
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// GoshuinPhoto holds the schema definition for the GoshuinPhoto entity.
+type GoshuinPhoto struct {
+	ent.Schema
+}
+
+// Fields of the GoshuinPhoto.
+func (GoshuinPhoto) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("collection_id").
+			Comment("御朱印ID"),
+		field.Int("position").
+			Comment("表示順").
+			NonNegative().
+			Default(0),
+		field.String("caption").
+			Comment("キャプション").
+			Optional(),
+		field.Enum("kind").
+			Comment("種別（御朱印・風景・領収書）").
+			Values("stamp", "scenery", "receipt").
+			Default("stamp"),
+		field.String("storage_key").
+			Comment("ストレージのキー（外部URLの場合は空）").
+			Optional(),
+		field.String("url").
+			Comment("画像URL").
+			NotEmpty(),
+		field.Bool("is_cover").
+			Comment("表紙の写真か（URLは御朱印の image_url にも反映）").
+			Default(false),
+		field.Time("created_at").
+			Comment("作成日時").
+			Default(time.Now).
+			Immutable(),
+	}
+}
+
+// Edges of the GoshuinPhoto.
+func (GoshuinPhoto) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("collection", GoshuinCollection.Type).
+			Ref("photos").
+			Field("collection_id").
+			Unique().
+			Required(),
+	}
+}
+
+// Indexes of the GoshuinPhoto.
+func (GoshuinPhoto) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("collection_id", "position"),
+	}
+}
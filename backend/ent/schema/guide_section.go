@@ -0,0 +1,115 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// guideFields 節とヒントに共通の項目
+func guideFields() []ent.Field {
+	return []ent.Field{
+		field.String("slug").
+			Comment("言語をまたいで同じ項目を表す識別子").
+			MaxLen(100).
+			NotEmpty(),
+		field.String("locale").
+			Comment("言語タグ（BCP 47、例: zh-TW）").
+			MaxLen(35),
+		field.Int("position").
+			Comment("表示順").
+			Default(0),
+		field.Int("version").
+			Comment("最新の版").
+			Default(0),
+		field.Int("published_version").
+			Comment("公開中の版（未公開の場合は空）").
+			Optional().
+			Nillable(),
+		field.Time("created_at").
+			Comment("作成日時"),
+		field.Time("updated_at").
+			Comment("更新日時"),
+		field.Time("published_at").
+			Comment("公開日時").
+			Optional().
+			Nillable(),
+	}
+}
+
+// GuideSection holds the schema definition for the GuideSection entity.
+type GuideSection struct {
+	ent.Schema
+}
+
+// Fields of the GuideSection.
+func (GuideSection) Fields() []ent.Field {
+	return guideFields()
+}
+
+// Indexes of the GuideSection.
+func (GuideSection) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("slug", "locale").
+			Unique(),
+		index.Fields("locale", "position"),
+	}
+}
+
+// GuideTip holds the schema definition for the GuideTip entity.
+type GuideTip struct {
+	ent.Schema
+}
+
+// Fields of the GuideTip.
+func (GuideTip) Fields() []ent.Field {
+	return guideFields()
+}
+
+// Indexes of the GuideTip.
+func (GuideTip) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("slug", "locale").
+			Unique(),
+		index.Fields("locale", "position"),
+	}
+}
+
+// GuideVersion holds the schema definition for the GuideVersion entity.
+type GuideVersion struct {
+	ent.Schema
+}
+
+// Fields of the GuideVersion.
+func (GuideVersion) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("entity_type").
+			Comment("版の対象（GuideSection または GuideTip）").
+			NotEmpty(),
+		field.Int("entity_id").
+			Comment("節またはヒントのID"),
+		field.Int("version").
+			Comment("版の番号（1から順に増えます）"),
+		field.String("title").
+			Comment("見出し（ヒントは空）").
+			Optional(),
+		field.Text("body").
+			Comment("本文（Markdown）"),
+		field.Text("media").
+			Comment("画像・動画（JSON）").
+			Optional(),
+		field.String("author_id").
+			Comment("編集したユーザーID").
+			Optional(),
+		field.Time("created_at").
+			Comment("作成日時"),
+	}
+}
+
+// Indexes of the GuideVersion.
+func (GuideVersion) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("entity_type", "entity_id", "version").
+			Unique(),
+	}
+}
@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// IdempotencyKey holds the schema definition for the IdempotencyKey entity.
+type IdempotencyKey struct {
+	ent.Schema
+}
+
+// Fields of the IdempotencyKey.
+func (IdempotencyKey) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("scope").
+			Comment("キーの持ち主（user:ユーザーID、未認証なら addr:クライアントのアドレス）").
+			NotEmpty(),
+		field.String("idempotency_key").
+			Comment("Idempotency-Key ヘッダーの値").
+			NotEmpty().
+			MaxLen(255),
+		field.String("fingerprint").
+			Comment("メソッド・パス・ボディの SHA-256。同じキーで異なるリクエストが来たら 422 を返す"),
+		field.Int("status").
+			Comment("保存した応答のステータスコード（実行中は NULL）").
+			Optional().
+			Nillable(),
+		field.Text("header").
+			Comment("保存した応答のヘッダー（JSON）").
+			Optional(),
+		field.Bytes("body").
+			Comment("保存した応答のボディ").
+			Optional(),
+		field.Time("created_at").
+			Comment("受け付けた日時").
+			Default(time.Now).
+			Immutable(),
+		field.Time("expires_at").
+			Comment("有効期限。実行中は短いロック期限、応答の保存後は保持期間の終わり"),
+	}
+}
+
+// Indexes of the IdempotencyKey.
+func (IdempotencyKey) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("scope", "idempotency_key").Unique(),
+		index.Fields("expires_at"),
+	}
+}
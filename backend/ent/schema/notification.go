@@ -0,0 +1,48 @@
+package schema
+
+import (
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// Notification holds the schema definition for the Notification entity.
+type Notification struct {
+	ent.Schema
+}
+
+// Fields of the Notification.
+func (Notification) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("user_id").
+			Comment("通知先のユーザーID").
+			NotEmpty(),
+		field.String("kind").
+			Comment("通知の種類（temple_correction_approved など）"),
+		field.String("title").
+			Comment("タイトル"),
+		field.Text("body").
+			Comment("本文").
+			Optional(),
+		field.Text("data").
+			Comment("種類ごとの付加情報（JSON）").
+			Optional(),
+		field.Time("read_at").
+			Comment("既読日時").
+			Optional().
+			Nillable(),
+		field.Time("created_at").
+			Comment("作成日時").
+			Default(time.Now).
+			Immutable(),
+	}
+}
+
+// Indexes of the Notification.
+func (Notification) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("user_id", "read_at", "created_at"),
+	}
+}
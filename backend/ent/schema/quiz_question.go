@@ -0,0 +1,124 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// QuizQuestion holds the schema definition for the QuizQuestion entity.
+type QuizQuestion struct {
+	ent.Schema
+}
+
+// Fields of the QuizQuestion.
+func (QuizQuestion) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("section_slug").
+			Comment("問題が属するガイドの節の slug").
+			MaxLen(100).
+			NotEmpty(),
+		field.String("locale").
+			Comment("問題集の言語タグ（BCP 47）").
+			MaxLen(35),
+		field.Enum("kind").
+			Comment("問題の種類（選択・並べ替え）").
+			Values("choice", "order"),
+		field.Text("prompt").
+			Comment("問題文"),
+		field.Text("choices").
+			Comment("選択肢（JSON）"),
+		field.String("answer").
+			Comment("正解の選択肢の番号、または正しい順に並べた番号（JSON）"),
+		field.Text("explanation").
+			Comment("解説").
+			Optional(),
+		field.Int("position").
+			Comment("表示順").
+			Default(0),
+		field.Bool("active").
+			Comment("出題するかどうか").
+			Default(true),
+		field.Time("created_at").
+			Comment("作成日時"),
+		field.Time("updated_at").
+			Comment("更新日時"),
+	}
+}
+
+// Indexes of the QuizQuestion.
+func (QuizQuestion) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("section_slug", "locale", "position"),
+	}
+}
+
+// QuizAttempt holds the schema definition for the QuizAttempt entity.
+type QuizAttempt struct {
+	ent.Schema
+}
+
+// Fields of the QuizAttempt.
+func (QuizAttempt) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("user_id").
+			Comment("回答したユーザーID"),
+		field.String("section_slug").
+			Comment("ガイドの節の slug"),
+		field.String("locale").
+			Comment("回答した問題集の言語"),
+		field.Text("answers").
+			Comment("回答（JSON）"),
+		field.Float("score").
+			Comment("得点（百分率）"),
+		field.Bool("passed").
+			Comment("合格したかどうか"),
+		field.Time("created_at").
+			Comment("回答日時"),
+	}
+}
+
+// Indexes of the QuizAttempt.
+func (QuizAttempt) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("user_id", "section_slug"),
+	}
+}
+
+// QuizProgress holds the schema definition for the QuizProgress entity.
+type QuizProgress struct {
+	ent.Schema
+}
+
+// Fields of the QuizProgress.
+func (QuizProgress) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("user_id").
+			Comment("ユーザーID"),
+		field.String("section_slug").
+			Comment("ガイドの節の slug"),
+		field.Int("attempts").
+			Comment("回答した回数").
+			Default(0),
+		field.Float("best_score").
+			Comment("最高得点（百分率）").
+			Default(0),
+		field.Bool("passed").
+			Comment("合格したかどうか（一度合格すると変わりません）").
+			Default(false),
+		field.Time("passed_at").
+			Comment("最初に合格した日時").
+			Optional().
+			Nillable(),
+		field.Time("updated_at").
+			Comment("更新日時"),
+	}
+}
+
+// Indexes of the QuizProgress.
+func (QuizProgress) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("user_id", "section_slug").
+			Unique(),
+	}
+}
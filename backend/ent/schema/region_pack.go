@@ -0,0 +1,37 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// RegionPack holds the schema definition for the RegionPack entity.
+type RegionPack struct {
+	ent.Schema
+}
+
+// Fields of the RegionPack.
+func (RegionPack) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("region_key").
+			Comment("地域のキー（prefecture:京都府、bbox:minLng,minLat,maxLng,maxLat）").
+			NotEmpty(),
+		field.Int("version").
+			Comment("パックのバージョン（内容が変わるたびに1つ増えます）"),
+		field.String("content_hash").
+			Comment("ファイルの一覧とハッシュから計算した内容のハッシュ（SHA-256）"),
+		field.Text("manifest").
+			Comment("パックのファイルとハッシュの一覧（JSON）。差分の計算に使います"),
+		field.Time("created_at").
+			Comment("作成日時"),
+	}
+}
+
+// Indexes of the RegionPack.
+func (RegionPack) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("region_key", "version").
+			Unique(),
+	}
+}
@@ -0,0 +1,115 @@
+package schema
+
+import (
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// SyncChange holds the schema definition for the SyncChange entity.
+type SyncChange struct {
+	ent.Schema
+}
+
+// Fields of the SyncChange.
+func (SyncChange) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int64("id").
+			StorageKey("seq").
+			Comment("単調増加する変更番号。端末は最後に受け取った番号以降の変更を取得する"),
+		field.String("user_id").
+			Comment("御朱印の所有ユーザーID").
+			NotEmpty(),
+		field.String("client_id").
+			Comment("変更された御朱印のUUID").
+			NotEmpty(),
+		field.Int("collection_id").
+			Comment("変更された御朱印のID（完全削除後は NULL）").
+			Optional().
+			Nillable(),
+		field.Enum("op").
+			Comment("変更の種類").
+			Values("upsert", "delete"),
+		field.String("fields").
+			Comment("変更された項目（カンマ区切り）"),
+		field.String("mutation_id").
+			Comment("適用した端末の変更のUUID（REST API による変更は NULL）").
+			Optional().
+			Nillable(),
+		field.Time("created_at").
+			Comment("記録日時").
+			Default(time.Now).
+			Immutable(),
+	}
+}
+
+// Indexes of the SyncChange.
+func (SyncChange) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("user_id", "id"),
+		index.Fields("user_id", "client_id", "id"),
+	}
+}
+
+// SyncFieldClock holds the schema definition for the SyncFieldClock entity.
+type SyncFieldClock struct {
+	ent.Schema
+}
+
+// Fields of the SyncFieldClock.
+func (SyncFieldClock) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("user_id").
+			Comment("御朱印の所有ユーザーID").
+			NotEmpty(),
+		field.String("client_id").
+			Comment("御朱印のUUID（完全削除後も残し、古い変更で復活しないようにする）").
+			NotEmpty(),
+		field.String("field").
+			Comment("項目名（deleted は削除・復元の日時）").
+			NotEmpty(),
+		field.Time("changed_at").
+			Comment("項目を最後に変更した日時。項目単位の後勝ちの判定に使う"),
+		field.Int64("seq").
+			Comment("最後に変更した変更番号"),
+	}
+}
+
+// Indexes of the SyncFieldClock.
+func (SyncFieldClock) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("user_id", "client_id", "field").Unique(),
+	}
+}
+
+// SyncMutation holds the schema definition for the SyncMutation entity.
+type SyncMutation struct {
+	ent.Schema
+}
+
+// Fields of the SyncMutation.
+func (SyncMutation) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("user_id").
+			Comment("送信したユーザーID").
+			NotEmpty(),
+		field.String("mutation_id").
+			Comment("端末が生成した変更のUUID").
+			NotEmpty(),
+		field.Text("result").
+			Comment("適用結果（JSON）。同じ変更の再送にはこれをそのまま返す"),
+		field.Time("created_at").
+			Comment("適用日時").
+			Default(time.Now).
+			Immutable(),
+	}
+}
+
+// Indexes of the SyncMutation.
+func (SyncMutation) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("user_id", "mutation_id").Unique(),
+	}
+}
@@ -35,6 +35,13 @@ func (Temple) Fields() []ent.Field {
 		field.String("address").
 			Comment("住所").
 			Optional(),
+		field.String("prefecture").
+			Comment("都道府県").
+			Default(""),
+		field.Enum("kind").
+			Comment("種別（寺院・神社）").
+			Values("temple", "shrine").
+			Default("temple"),
 		field.String("phone").
 			Comment("電話番号").
 			Optional(),
@@ -56,9 +63,39 @@ func (Temple) Fields() []ent.Field {
 		field.String("goshuin_office").
 			Comment("御朱印所の場所").
 			Optional(),
+		field.Bool("reservation_required").
+			Comment("御朱印の予約が必要かどうか（不明な場合は空）").
+			Optional().
+			Nillable(),
+		field.Bool("kakioki_only").
+			Comment("書き置きのみかどうか（不明な場合は空）").
+			Optional().
+			Nillable(),
+		field.Bool("book_drop_off").
+			Comment("御朱印帳を預けて参拝後に受け取るかどうか（不明な場合は空）").
+			Optional().
+			Nillable(),
+		field.Bool("cash_only").
+			Comment("現金のみかどうか（不明な場合は空）").
+			Optional().
+			Nillable(),
+		field.Enum("photography").
+			Comment("撮影のルール（allowed: 可、restricted: 堂内・御朱印の授与中は不可、prohibited: 境内全体で不可）").
+			Values("allowed", "restricted", "prohibited").
+			Optional(),
+		field.Text("procedure_notes").
+			Comment("御朱印の手続きに関する補足").
+			Optional(),
 		field.Bool("is_active").
 			Comment("アクティブかどうか").
 			Default(true),
+		field.Time("deleted_at").
+			Comment("削除日時（削除されても御朱印からは参照できる）").
+			Optional().
+			Nillable(),
+		field.String("contributed_by").
+			Comment("提案により寺社を登録したユーザーID").
+			Optional(),
 	}
 }
 
@@ -0,0 +1,73 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// TempleCorrection holds the schema definition for the TempleCorrection entity.
+type TempleCorrection struct {
+	ent.Schema
+}
+
+// Fields of the TempleCorrection.
+func (TempleCorrection) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("temple_id").
+			Comment("修正対象の寺社ID"),
+		field.String("user_id").
+			Comment("提案したユーザーID").
+			NotEmpty(),
+		field.Text("changes").
+			Comment("項目ごとの提案時の値と新しい値（JSON）"),
+		field.Text("comment").
+			Comment("提案者のコメント").
+			Optional(),
+		field.String("photo_key").
+			Comment("証拠写真のストレージキー").
+			Optional(),
+		field.String("photo_url").
+			Comment("証拠写真のURL").
+			Optional(),
+		field.Enum("status").
+			Comment("審査状態").
+			Values("pending", "approved", "merged", "rejected").
+			Default("pending"),
+		field.String("reviewer_id").
+			Comment("審査した編集者のユーザーID").
+			Optional(),
+		field.Text("review_note").
+			Comment("審査コメント").
+			Optional(),
+		field.Text("applied_changes").
+			Comment("寺社に反映した値（JSON）").
+			Optional(),
+		field.Time("created_at").
+			Comment("提案日時"),
+		field.Time("reviewed_at").
+			Comment("審査日時").
+			Optional().
+			Nillable(),
+	}
+}
+
+// Edges of the TempleCorrection.
+func (TempleCorrection) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("temple", Temple.Type).
+			Field("temple_id").
+			Unique().
+			Required().
+			Comment("修正対象の寺社"),
+	}
+}
+
+// Indexes of the TempleCorrection.
+func (TempleCorrection) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("status", "created_at"),
+		index.Fields("user_id"),
+	}
+}
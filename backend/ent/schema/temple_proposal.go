@@ -0,0 +1,154 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// TempleProposal holds the schema definition for the TempleProposal entity.
+type TempleProposal struct {
+	ent.Schema
+}
+
+// Fields of the TempleProposal.
+func (TempleProposal) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("user_id").
+			Comment("提案したユーザーID").
+			NotEmpty(),
+		field.String("name").
+			Comment("寺社名").
+			NotEmpty(),
+		field.String("name_en").
+			Comment("英語名").
+			Optional(),
+		field.Float("latitude").
+			Comment("緯度"),
+		field.Float("longitude").
+			Comment("経度"),
+		field.String("prefecture").
+			Comment("都道府県").
+			Default(""),
+		field.Enum("kind").
+			Comment("寺院か神社か").
+			Values("temple", "shrine").
+			Default("temple"),
+		field.String("address").
+			Comment("住所").
+			Optional(),
+		field.Text("description").
+			Comment("説明").
+			Optional(),
+		field.String("website").
+			Comment("ウェブサイト").
+			Optional(),
+		field.String("opening_hours").
+			Comment("拝観時間").
+			Optional(),
+		field.String("goshuin_fee").
+			Comment("御朱印の初穂料").
+			Optional(),
+		field.String("photo_key").
+			Comment("写真のストレージキー").
+			Optional(),
+		field.String("photo_url").
+			Comment("写真のURL").
+			Optional(),
+		field.Text("comment").
+			Comment("提案者のコメント").
+			Optional(),
+		field.Enum("status").
+			Comment("審査状態（approved は新規作成、merged は既存の寺社に統合）").
+			Values("pending", "approved", "merged", "rejected").
+			Default("pending"),
+		field.String("reviewer_id").
+			Comment("審査した編集者のユーザーID").
+			Optional(),
+		field.Text("review_note").
+			Comment("審査コメント").
+			Optional(),
+		field.Int("temple_id").
+			Comment("作成または統合された寺社ID").
+			Optional().
+			Nillable(),
+		field.Time("created_at").
+			Comment("提案日時"),
+		field.Time("reviewed_at").
+			Comment("審査日時").
+			Optional().
+			Nillable(),
+	}
+}
+
+// Edges of the TempleProposal.
+func (TempleProposal) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("temple", Temple.Type).
+			Field("temple_id").
+			Unique().
+			Comment("作成または統合された寺社"),
+		edge.To("entries", TempleProposalEntry.Type).
+			Comment("提案中の寺社で記録された御朱印"),
+	}
+}
+
+// Indexes of the TempleProposal.
+func (TempleProposal) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("status", "created_at"),
+		index.Fields("user_id"),
+		index.Fields("latitude", "longitude"),
+	}
+}
+
+// TempleProposalEntry holds the schema definition for the TempleProposalEntry entity.
+type TempleProposalEntry struct {
+	ent.Schema
+}
+
+// Fields of the TempleProposalEntry.
+func (TempleProposalEntry) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("proposal_id").
+			Comment("提案ID"),
+		field.String("user_id").
+			Comment("御朱印をいただいたユーザーID").
+			NotEmpty(),
+		field.String("image_url").
+			Comment("御朱印の画像URL").
+			Optional(),
+		field.Text("notes").
+			Comment("メモ（Markdown）").
+			Optional(),
+		field.Time("collected_at").
+			Comment("いただいた日時（UTC）").
+			Optional().
+			Nillable(),
+		field.Int("collected_tz_offset").
+			Comment("いただいた日時のUTCオフセット（分）").
+			Default(0),
+		field.Int("collection_id").
+			Comment("承認後に作成された御朱印コレクションID").
+			Optional().
+			Nillable(),
+		field.Time("created_at").
+			Comment("記録日時"),
+	}
+}
+
+// Edges of the TempleProposalEntry.
+func (TempleProposalEntry) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("proposal", TempleProposal.Type).
+			Ref("entries").
+			Field("proposal_id").
+			Unique().
+			Required(),
+		edge.To("collection", GoshuinCollection.Type).
+			Field("collection_id").
+			Unique().
+			Comment("承認後に作成された御朱印コレクション"),
+	}
+}
@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// Translation holds the schema definition for the Translation entity.
+type Translation struct {
+	ent.Schema
+}
+
+// Fields of the Translation.
+func (Translation) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("entity_type").
+			Comment("翻訳対象のエンティティ（Temple、Guide など）").
+			NotEmpty(),
+		field.Int("entity_id").
+			Comment("翻訳対象のエンティティID"),
+		field.String("field").
+			Comment("翻訳対象の項目").
+			NotEmpty(),
+		field.String("locale").
+			Comment("言語タグ（BCP 47、例: zh-TW）").
+			MaxLen(35),
+		field.Text("value").
+			Comment("翻訳した値"),
+		field.Time("created_at").
+			Comment("作成日時"),
+		field.Time("updated_at").
+			Comment("更新日時"),
+	}
+}
+
+// Indexes of the Translation.
+func (Translation) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("entity_type", "entity_id", "field", "locale").
+			Unique(),
+		index.Fields("entity_type", "locale"),
+	}
+}
@@ -0,0 +1,37 @@
+package schema
+
+import (
+	"time"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema/field"
+	"entgo.io/ent/schema/index"
+)
+
+// UserBadge holds the schema definition for the UserBadge entity.
+type UserBadge struct {
+	ent.Schema
+}
+
+// Fields of the UserBadge.
+func (UserBadge) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("user_id").
+			Comment("獲得したユーザーID").
+			NotEmpty(),
+		field.String("badge_id").
+			Comment("バッジ定義のID").
+			NotEmpty(),
+		field.Time("earned_at").
+			Comment("獲得日時").
+			Default(time.Now).
+			Immutable(),
+	}
+}
+
+// Indexes of the UserBadge.
+func (UserBadge) Indexes() []ent.Index {
+	return []ent.Index{
+		index.Fields("user_id", "badge_id").Unique(),
+	}
+}
@@ -0,0 +1,166 @@
+// Package audit ent クライアントの変更を監査ログに記録します
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/ent"
+)
+
+// アクター
+const (
+	// ActorSystem リクエスト外（定期処理など）の変更
+	ActorSystem = "system"
+	// ActorAnonymous 未認証のリクエストによる変更
+	ActorAnonymous = "anonymous"
+)
+
+// Logger 変更を監査ログに追記します
+type Logger struct {
+	client *ent.Client
+	clock  clock.Clock
+}
+
+// New 監査ロガーを作成します
+func New(client *ent.Client, clk clock.Clock) *Logger {
+	if clk == nil {
+		clk = clock.System
+	}
+	return &Logger{client: client, clock: clk}
+}
+
+// Hook すべての変更を監査ログに記録するフックを返します
+// 変更と同じトランザクションで記録し、記録できなければ変更ごとロールバックします
+// アクター・リクエストID・IPはコンテキストから取得します
+func (l *Logger) Hook() ent.TxHook {
+	return func(ctx context.Context, m *ent.Mutation) error {
+		if _, err := l.Record(ctx, m); err != nil {
+			return fmt.Errorf("failed to write audit log for %s %s %d: %v", m.Op, m.Type, m.ID, err)
+		}
+		return nil
+	}
+}
+
+// Record 変更を1件記録します
+func (l *Logger) Record(ctx context.Context, m *ent.Mutation) (*ent.AuditLog, error) {
+	diff, err := Diff(m.Old, m.New)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &ent.AuditLog{
+		Action:     string(m.Op),
+		EntityType: m.Type,
+		EntityID:   m.ID,
+		OnBehalfOf: m.OnBehalfOf,
+		Diff:       diff,
+		CreatedAt:  l.clock.Now().UTC().Format(time.RFC3339),
+	}
+
+	info, inRequest := requestFromContext(ctx)
+	entry.RequestID, entry.IP = info.id, info.ip
+	switch user, ok := auth.FromContext(ctx); {
+	case ok:
+		entry.Actor, entry.ActorRole = user.ID, user.Role
+	case inRequest:
+		entry.Actor = ActorAnonymous
+	default:
+		entry.Actor = ActorSystem
+	}
+
+	return l.client.AuditLog.Append(ctx, entry)
+}
+
+// change 1項目の変更前後の値
+type change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Diff 変更前後のエンティティを比較し、変わった項目ごとの before/after をJSONで返します
+// 作成では before が、削除では after が null になります。edges（関連の読み込み結果）は比較しません
+func Diff(oldValue, newValue interface{}) (json.RawMessage, error) {
+	before, err := fields(oldValue)
+	if err != nil {
+		return nil, err
+	}
+	after, err := fields(newValue)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]change{}
+	for k, v := range before {
+		if w, ok := after[k]; !ok || !reflect.DeepEqual(v, w) {
+			changes[k] = change{Before: v, After: after[k]}
+		}
+	}
+	for k, w := range after {
+		if _, ok := before[k]; !ok {
+			changes[k] = change{After: w}
+		}
+	}
+
+	// map のキーは json.Marshal で整列されるため、同じ変更は同じJSONになる
+	return json.Marshal(changes)
+}
+
+// fields エンティティをJSONの項目に分解します。オブジェクトでない値は value として扱います
+func fields(v interface{}) (map[string]interface{}, error) {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return map[string]interface{}{}, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"value": value}, nil
+	}
+	delete(m, "edges")
+	return m, nil
+}
+
+// requestInfo 監査ログに残すリクエストの情報
+type requestInfo struct {
+	id string
+	ip string
+}
+
+type contextKey struct{}
+
+// WithRequest コンテキストにリクエストIDとクライアントIPを設定します
+func WithRequest(ctx context.Context, requestID, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestInfo{id: requestID, ip: ip})
+}
+
+// RequestID コンテキストのリクエストIDを返します
+func RequestID(ctx context.Context) string {
+	info, _ := requestFromContext(ctx)
+	return info.id
+}
+
+// ClientIP コンテキストのクライアントIPを返します。TRUST_PROXY が有効な場合は X-Forwarded-For から求めたIPです
+func ClientIP(ctx context.Context) string {
+	info, _ := requestFromContext(ctx)
+	return info.ip
+}
+
+// requestFromContext コンテキストのリクエスト情報を返します
+func requestFromContext(ctx context.Context) (requestInfo, bool) {
+	info, ok := ctx.Value(contextKey{}).(requestInfo)
+	return info, ok
+}
@@ -0,0 +1,142 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/database"
+	"stamp-backend/internal/ent"
+)
+
+// testNow テストの現在時刻
+var testNow = time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	// マイグレーションのログでテストの出力が埋もれないようにします
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestDiff(t *testing.T) {
+	type entity struct {
+		Name  string   `json:"name"`
+		Tags  []string `json:"tags"`
+		Edges struct {
+			Temple string `json:"temple"`
+		} `json:"edges"`
+	}
+	before := &entity{Name: "浅草寺", Tags: []string{"a"}}
+	after := &entity{Name: "浅草寺", Tags: []string{"a", "b"}}
+	after.Edges.Temple = "loaded"
+
+	cases := []struct {
+		name          string
+		before, after interface{}
+		want          string
+	}{
+		{"update", before, after, `{"tags":{"before":["a"],"after":["a","b"]}}`},
+		{"create", nil, before, `{"name":{"before":null,"after":"浅草寺"},"tags":{"before":null,"after":["a"]}}`},
+		{"delete", before, (*entity)(nil), `{"name":{"before":"浅草寺","after":null},"tags":{"before":["a"],"after":null}}`},
+		{"unchanged", before, before, `{}`},
+		{"value", 1, 2, `{"value":{"before":1,"after":2}}`},
+	}
+	for _, c := range cases {
+		got, err := Diff(c.before, c.after)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if string(got) != c.want {
+			t.Errorf("%s: Diff = %s; want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestHashChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+	client, err := database.OpenWithClock(map[string]string{"driver": "sqlite", "name": path}, clock.Fixed(testNow))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer client.Close()
+	logger := New(client, clock.Fixed(testNow))
+
+	ctx := context.Background()
+	requestCtx := WithRequest(ctx, "req-1", "192.0.2.1")
+	userCtx := auth.WithUser(requestCtx, &auth.User{ID: "admin-1", Role: "admin"})
+	mutations := []struct {
+		ctx       context.Context
+		m         *ent.Mutation
+		wantActor string
+	}{
+		{ctx, &ent.Mutation{Op: ent.OpCreate, Type: ent.TypeTemple, ID: 1, New: map[string]string{"name": "a"}}, ActorSystem},
+		{requestCtx, &ent.Mutation{Op: ent.OpUpdate, Type: ent.TypeTemple, ID: 1, Old: map[string]string{"name": "a"}, New: map[string]string{"name": "b"}}, ActorAnonymous},
+		{userCtx, &ent.Mutation{Op: ent.OpDelete, Type: ent.TypeTemple, ID: 1, Old: map[string]string{"name": "b"}}, "admin-1"},
+	}
+
+	prev := ""
+	var entries []*ent.AuditLog
+	for _, c := range mutations {
+		entry, err := logger.Record(c.ctx, c.m)
+		if err != nil {
+			t.Fatalf("Record %s: %v", c.m.Op, err)
+		}
+		if entry.Actor != c.wantActor {
+			t.Errorf("%s actor = %q; want %q", c.m.Op, entry.Actor, c.wantActor)
+		}
+		if entry.PrevHash != prev || entry.Hash == "" || entry.Hash == prev {
+			t.Errorf("%s prev_hash = %q, hash = %q; want chained to %q", c.m.Op, entry.PrevHash, entry.Hash, prev)
+		}
+		if entry.CreatedAt != "2024-06-01T03:00:00Z" {
+			t.Errorf("%s created_at = %q", c.m.Op, entry.CreatedAt)
+		}
+		prev = entry.Hash
+		entries = append(entries, entry)
+	}
+
+	got, err := client.AuditLog.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != (ent.AuditVerification{Valid: true, Checked: 3}) {
+		t.Fatalf("Verify = %+v; want valid with 3 entries", got)
+	}
+
+	// 書き換えた行、末尾から削除された場合の残った最後の行、削除した行の次の行を検出します
+	// 書き換えを元に戻せば再び検証に通ります
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, c := range []struct {
+		name string
+		stmt string
+		args []interface{}
+		want int64
+	}{
+		{"edited", `UPDATE audit_logs SET actor = ? WHERE id = ?`, []interface{}{"someone", entries[1].ID}, entries[1].ID},
+		{"restored", `UPDATE audit_logs SET actor = ? WHERE id = ?`, []interface{}{entries[1].Actor, entries[1].ID}, 0},
+		{"truncated", `DELETE FROM audit_logs WHERE id = ?`, []interface{}{entries[2].ID}, entries[1].ID},
+		{"removed", `DELETE FROM audit_logs WHERE id = ?`, []interface{}{entries[0].ID}, entries[1].ID},
+	} {
+		if _, err := db.Exec(c.stmt, c.args...); err != nil {
+			t.Fatal(err)
+		}
+		got, err := client.AuditLog.Verify(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Valid != (c.want == 0) || got.BrokenID != c.want {
+			t.Errorf("%s: Verify = %+v; want broken at %d", c.name, got, c.want)
+		}
+	}
+}
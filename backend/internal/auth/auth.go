@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ロール
+const (
+	RoleUser   = "user"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// ErrInvalidToken トークンが不正な場合のエラー
+var ErrInvalidToken = errors.New("invalid token")
+
+// User 認証済みユーザー
+type User struct {
+	ID   string
+	Role string
+}
+
+// HasRole ユーザーが指定ロール以上の権限を持つか判定します
+func (u *User) HasRole(role string) bool {
+	rank := map[string]int{RoleUser: 0, RoleEditor: 1, RoleAdmin: 2}
+	return rank[u.Role] >= rank[role]
+}
+
+// claims JWTのペイロード
+type claims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// jwtHeader HS256固定のJWTヘッダー
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// NewToken HS256で署名したJWTを発行します
+func NewToken(secret string, u User, ttl time.Duration) (string, error) {
+	c := claims{Subject: u.ID, Role: u.Role}
+	if ttl > 0 {
+		c.ExpiresAt = time.Now().Add(ttl).Unix()
+	}
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + sign(secret, signingInput), nil
+}
+
+// ParseToken JWTを検証してユーザーを返します
+func ParseToken(secret, token string) (*User, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil || h.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	expected := sign(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if c.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	if c.ExpiresAt != 0 && time.Now().Unix() >= c.ExpiresAt {
+		return nil, errors.New("token expired")
+	}
+
+	role := c.Role
+	if role == "" {
+		role = RoleUser
+	}
+	return &User{ID: c.Subject, Role: role}, nil
+}
+
+// sign HMAC-SHA256署名を計算します
+func sign(secret, input string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+type contextKey struct{}
+
+// WithUser コンテキストにユーザーを設定します
+func WithUser(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, contextKey{}, u)
+}
+
+// FromContext コンテキストからユーザーを取得します
+func FromContext(ctx context.Context) (*User, bool) {
+	u, ok := ctx.Value(contextKey{}).(*User)
+	return u, ok && u != nil
+}
@@ -0,0 +1,335 @@
+package badges
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/fuzzy"
+)
+
+//go:embed default_badges.json
+var defaultDefinitions []byte
+
+// jst 日付条件（初詣など）の判定に使うタイムゾーン
+var jst = time.FixedZone("JST", 9*60*60)
+
+// Definition バッジの定義
+type Definition struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	NameEn      string   `json:"name_en,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Criteria    Criteria `json:"criteria"`
+}
+
+// Criteria バッジの獲得条件
+// 指定された条件をすべて満たす御朱印を数え、MinCount 以上で獲得となります
+// RequireAll の場合は TempleIDs と TempleNames のすべての寺社の御朱印が必要です
+type Criteria struct {
+	Kinds       []string    `json:"kinds,omitempty"`
+	Prefectures []string    `json:"prefectures,omitempty"`
+	TempleIDs   []int       `json:"temple_ids,omitempty"`
+	TempleNames []string    `json:"temple_names,omitempty"`
+	DateRanges  []DateRange `json:"date_ranges,omitempty"`
+	MinCount    int         `json:"min_count,omitempty"`
+	// UniqueTemples 同じ寺社の御朱印を1件として数える
+	UniqueTemples bool `json:"unique_temples,omitempty"`
+	RequireAll    bool `json:"require_all,omitempty"`
+}
+
+// DateRange 毎年の期間（MM-DD、年をまたぐ指定も可）
+type DateRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Status ユーザーごとのバッジの獲得状況
+type Status struct {
+	Definition
+	Earned   bool   `json:"earned"`
+	EarnedAt string `json:"earned_at,omitempty"`
+	Progress int    `json:"progress"`
+	Target   int    `json:"target"`
+}
+
+// DefaultDefinitions 組み込みのバッジ定義を返します
+func DefaultDefinitions() []Definition {
+	defs, err := ParseDefinitions(defaultDefinitions)
+	if err != nil {
+		panic(err)
+	}
+	return defs
+}
+
+// LoadDefinitions バッジ定義をJSONファイルから読み込みます
+// パスが空の場合は組み込みの定義を返します
+func LoadDefinitions(path string) ([]Definition, error) {
+	if path == "" {
+		return DefaultDefinitions(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read badge definitions: %v", err)
+	}
+	return ParseDefinitions(data)
+}
+
+// ParseDefinitions バッジ定義のJSONを解析し、内容を検証します
+func ParseDefinitions(data []byte) ([]Definition, error) {
+	var defs []Definition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("invalid badge definitions: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, d := range defs {
+		if d.ID == "" || d.Name == "" {
+			return nil, fmt.Errorf("badge definition requires id and name")
+		}
+		if seen[d.ID] {
+			return nil, fmt.Errorf("duplicate badge id: %s", d.ID)
+		}
+		seen[d.ID] = true
+
+		c := d.Criteria
+		if c.RequireAll && len(c.TempleIDs)+len(c.TempleNames) == 0 {
+			return nil, fmt.Errorf("badge %s: require_all needs temple_ids or temple_names", d.ID)
+		}
+		for _, r := range c.DateRanges {
+			if !validMonthDay(r.From) || !validMonthDay(r.To) {
+				return nil, fmt.Errorf("badge %s: invalid date range %s..%s", d.ID, r.From, r.To)
+			}
+		}
+	}
+	return defs, nil
+}
+
+// validMonthDay MM-DD形式か判定します
+func validMonthDay(s string) bool {
+	_, err := time.Parse("01-02", s)
+	return err == nil
+}
+
+// Engine 御朱印コレクションからバッジの獲得状況を判定します
+type Engine struct {
+	client *ent.Client
+	defs   []Definition
+}
+
+// New バッジエンジンを作成します
+func New(client *ent.Client, defs []Definition) *Engine {
+	return &Engine{client: client, defs: defs}
+}
+
+// Definitions バッジ定義の一覧を返します
+func (e *Engine) Definitions() []Definition {
+	return e.defs
+}
+
+// Hook 御朱印の登録・削除（ゴミ箱への移動）・復元のたびにバッジを再判定するフックを返します
+func (e *Engine) Hook() ent.Hook {
+	return func(ctx context.Context, m *ent.Mutation) {
+		if m.Type != ent.TypeGoshuinCollection || m.UserID == "" {
+			return
+		}
+		if m.Op != ent.OpCreate && m.Op != ent.OpDelete && m.Op != ent.OpRestore {
+			return
+		}
+		if _, err := e.Evaluate(ctx, m.UserID); err != nil {
+			log.Printf("Failed to evaluate badges for %s: %v", m.UserID, err)
+		}
+	}
+}
+
+// Evaluate ユーザーのバッジを判定し、新たに条件を満たしたバッジを付与します
+// 御朱印の削除で条件を満たさなくなったバッジは取り消します
+func (e *Engine) Evaluate(ctx context.Context, userID string) ([]Status, error) {
+	collections, err := e.client.GoshuinCollection.Query().
+		Filter(ent.GoshuinCollectionFilter{UserID: userID}).
+		WithTemple().
+		All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stamps := newStamps(collections)
+
+	earned, err := e.client.UserBadge.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	earnedAt := map[string]string{}
+	for _, b := range earned {
+		earnedAt[b.BadgeID] = b.EarnedAt
+	}
+
+	statuses := make([]Status, 0, len(e.defs))
+	for _, d := range e.defs {
+		s := evaluate(d, stamps)
+
+		if at, ok := earnedAt[d.ID]; ok {
+			if !s.Earned {
+				if err := e.client.UserBadge.Revoke(ctx, userID, d.ID); err != nil {
+					return nil, err
+				}
+			} else {
+				s.EarnedAt = at
+			}
+		} else if s.Earned {
+			at, _ := time.Parse(time.RFC3339, s.EarnedAt)
+			if err := e.client.UserBadge.Award(ctx, userID, d.ID, at); err != nil {
+				return nil, err
+			}
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
+
+// stamp 判定に使う御朱印1件分の情報
+type stamp struct {
+	templeID    int
+	templeName  string
+	kind        string
+	prefecture  string
+	collectedAt time.Time
+}
+
+// newStamps コレクションを収集日時の古い順に並べます
+func newStamps(collections []*ent.GoshuinCollection) []stamp {
+	stamps := make([]stamp, 0, len(collections))
+	for _, gc := range collections {
+		s := stamp{templeID: gc.TempleID}
+		if t := gc.Edges.Temple; t != nil {
+			s.templeName, s.kind, s.prefecture = t.Name, t.Kind, t.Prefecture
+		}
+		if at, err := time.Parse(time.RFC3339, gc.CollectedAt); err == nil {
+			s.collectedAt = at
+		}
+		stamps = append(stamps, s)
+	}
+	sort.SliceStable(stamps, func(i, j int) bool {
+		return stamps[i].collectedAt.Before(stamps[j].collectedAt)
+	})
+	return stamps
+}
+
+// evaluate 1つのバッジ定義を判定します
+// 獲得日時は条件を満たした時点の御朱印の収集日時です
+func evaluate(d Definition, stamps []stamp) Status {
+	c := d.Criteria
+	s := Status{Definition: d, Target: max(c.MinCount, 1)}
+
+	// require_all の場合は寺社ごとに、それ以外は御朱印（または寺社）ごとに数える
+	required := map[string]bool{}
+	if c.RequireAll {
+		for _, id := range c.TempleIDs {
+			required[fmt.Sprintf("id:%d", id)] = true
+		}
+		for _, name := range c.TempleNames {
+			required["name:"+fuzzy.Normalize(name)] = true
+		}
+		s.Target = len(required)
+	}
+
+	counted := map[string]bool{}
+	for _, st := range stamps {
+		if !c.matches(st) {
+			continue
+		}
+
+		if c.RequireAll {
+			for _, key := range []string{fmt.Sprintf("id:%d", st.templeID), "name:" + fuzzy.Normalize(st.templeName)} {
+				if required[key] && !counted[key] {
+					counted[key] = true
+					s.Progress++
+				}
+			}
+		} else if c.UniqueTemples {
+			key := fmt.Sprintf("id:%d", st.templeID)
+			if counted[key] {
+				continue
+			}
+			counted[key] = true
+			s.Progress++
+		} else {
+			s.Progress++
+		}
+
+		if !s.Earned && s.Progress >= s.Target {
+			s.Earned = true
+			s.EarnedAt = st.collectedAt.Format(time.RFC3339)
+		}
+	}
+	s.Progress = min(s.Progress, s.Target)
+	return s
+}
+
+// matches 御朱印が寺社・日付の条件に一致するか判定します
+// require_all の寺社の指定は evaluate で扱うため、ここでは RequireAll でない場合のみ判定します
+func (c Criteria) matches(st stamp) bool {
+	if len(c.Kinds) > 0 && !contains(c.Kinds, st.kind) {
+		return false
+	}
+	if len(c.Prefectures) > 0 && !contains(c.Prefectures, st.prefecture) {
+		return false
+	}
+	if !c.RequireAll && len(c.TempleIDs)+len(c.TempleNames) > 0 && !c.matchesTemple(st) {
+		return false
+	}
+	if len(c.DateRanges) > 0 {
+		day := st.collectedAt.In(jst).Format("01-02")
+		inRange := false
+		for _, r := range c.DateRanges {
+			if r.contains(day) {
+				inRange = true
+				break
+			}
+		}
+		if !inRange {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesTemple 御朱印の寺社が TempleIDs か TempleNames のいずれかに一致するか判定します
+func (c Criteria) matchesTemple(st stamp) bool {
+	for _, id := range c.TempleIDs {
+		if id == st.templeID {
+			return true
+		}
+	}
+	name := fuzzy.Normalize(st.templeName)
+	for _, n := range c.TempleNames {
+		if fuzzy.Normalize(n) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// contains 期間に日付（MM-DD）が含まれるか判定します
+func (r DateRange) contains(day string) bool {
+	if r.From <= r.To {
+		return r.From <= day && day <= r.To
+	}
+	// 12-31〜01-03 のように年をまたぐ期間
+	return day >= r.From || day <= r.To
+}
+
+// contains スライスに値が含まれるか判定します
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
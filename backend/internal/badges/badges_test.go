@@ -0,0 +1,149 @@
+package badges
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/database"
+)
+
+// testNow テストの現在時刻
+var testNow = time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	// マイグレーションのログでテストの出力が埋もれないようにします
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestParseDefinitions(t *testing.T) {
+	if defs := DefaultDefinitions(); len(defs) == 0 {
+		t.Errorf("no default definitions")
+	}
+
+	cases := []struct {
+		name string
+		data string
+	}{
+		{"json", `{"id":"a"}`},
+		{"name", `[{"id":"a"}]`},
+		{"duplicate", `[{"id":"a","name":"A"},{"id":"a","name":"B"}]`},
+		{"require all", `[{"id":"a","name":"A","criteria":{"require_all":true}}]`},
+		{"date range", `[{"id":"a","name":"A","criteria":{"date_ranges":[{"from":"13-01","to":"01-03"}]}}]`},
+	}
+	for _, c := range cases {
+		if _, err := ParseDefinitions([]byte(c.data)); err == nil {
+			t.Errorf("%s: ParseDefinitions(%s) returned no error", c.name, c.data)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	// day 日本時間の日付の正午に収集した時刻を返します
+	day := func(date string) time.Time {
+		at, err := time.ParseInLocation("2006-01-02 15:04", date+" 12:00", jst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return at.UTC()
+	}
+	stamps := []stamp{
+		{templeID: 1, templeName: "浅草寺", kind: "temple", prefecture: "東京都", collectedAt: day("2023-12-30")},
+		{templeID: 2, templeName: "明治神宮", kind: "shrine", prefecture: "東京都", collectedAt: day("2024-01-02")},
+		{templeID: 1, templeName: "浅草寺", kind: "temple", prefecture: "東京都", collectedAt: day("2024-01-05")},
+		{templeID: 3, templeName: "金閣寺", kind: "temple", prefecture: "京都府", collectedAt: day("2024-03-01")},
+		{templeID: 4, templeName: "護国院", kind: "temple", prefecture: "東京都", collectedAt: day("2024-04-01")},
+	}
+
+	cases := []struct {
+		name         string
+		criteria     Criteria
+		wantProgress int
+		wantTarget   int
+		wantEarnedAt string
+	}{
+		{"count", Criteria{MinCount: 3}, 3, 3, "2024-01-05T03:00:00Z"},
+		{"unique temples", Criteria{MinCount: 3, UniqueTemples: true}, 3, 3, "2024-03-01T03:00:00Z"},
+		{"kind", Criteria{Kinds: []string{"shrine"}, MinCount: 2}, 1, 2, ""},
+		{"prefecture", Criteria{Prefectures: []string{"京都府"}}, 1, 1, "2024-03-01T03:00:00Z"},
+		// 年をまたぐ期間は日本時間の日付で判定します
+		{"new year", Criteria{DateRanges: []DateRange{{From: "12-31", To: "01-03"}}}, 1, 1, "2024-01-02T03:00:00Z"},
+		// 名前は呼称の違いを無視して比べます
+		{"temple names", Criteria{TempleNames: []string{"金閣", "明治神宮"}, MinCount: 2}, 2, 2, "2024-03-01T03:00:00Z"},
+		{"require all", Criteria{TempleIDs: []int{1}, TempleNames: []string{"護国院", "東覚寺"}, RequireAll: true}, 2, 3, ""},
+		{"require all earned", Criteria{TempleIDs: []int{1, 3}, TempleNames: []string{"護国院"}, RequireAll: true}, 3, 3, "2024-04-01T03:00:00Z"},
+	}
+	for _, c := range cases {
+		got := evaluate(Definition{ID: c.name, Criteria: c.criteria}, stamps)
+		if got.Progress != c.wantProgress || got.Target != c.wantTarget || got.EarnedAt != c.wantEarnedAt || got.Earned != (c.wantEarnedAt != "") {
+			t.Errorf("%s: status = %d/%d earned %v at %q; want %d/%d at %q",
+				c.name, got.Progress, got.Target, got.Earned, got.EarnedAt, c.wantProgress, c.wantTarget, c.wantEarnedAt)
+		}
+	}
+}
+
+func TestEngineAwardsAndRevokes(t *testing.T) {
+	client, err := database.OpenWithClock(map[string]string{"driver": "sqlite", "name": ":memory:"}, clock.Fixed(testNow))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	defs, err := ParseDefinitions([]byte(`[{"id":"first","name":"最初の御朱印","criteria":{"min_count":1}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := New(client, defs)
+	client.Use(engine.Hook())
+
+	temple, err := client.Temple.Create().
+		SetName("護国寺").SetPrefecture("東京都").SetKind("temple").
+		SetLatitude(35.7179).SetLongitude(139.7271).SetActive(true).
+		Save(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// earned 付与されているバッジの獲得日時を返します
+	earned := func() []string {
+		t.Helper()
+		badges, err := client.UserBadge.ListByUser(ctx, "user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var at []string
+		for _, b := range badges {
+			at = append(at, b.EarnedAt)
+		}
+		return at
+	}
+
+	// 御朱印の登録・削除・復元のフックで付与と取り消しを行います
+	gc, err := client.GoshuinCollection.Create().
+		SetUserID("user-1").SetTempleID(temple.ID).SetCollectedAt(testNow.Add(-time.Hour)).
+		Save(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := earned(); len(got) != 1 || got[0] != "2024-06-01T02:00:00Z" {
+		t.Errorf("after create: badges earned at %q; want 2024-06-01T02:00:00Z", got)
+	}
+	if err := client.GoshuinCollection.DeleteOneID(gc.ID).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := earned(); len(got) != 0 {
+		t.Errorf("after delete: badges earned at %q; want none", got)
+	}
+	if _, err := client.GoshuinCollection.Restore(ctx, gc.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := earned(); len(got) != 1 {
+		t.Errorf("after restore: badges earned at %q; want one", got)
+	}
+}
@@ -0,0 +1,39 @@
+package clock
+
+import "time"
+
+// Clock 現在時刻を返します
+// ハンドラーやテストがコンテナのタイムゾーン（TZ）に依存しないよう、時刻は常にUTCで扱います
+type Clock interface {
+	Now() time.Time
+}
+
+// System システム時計（UTC）
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// Fixed 常に同じ時刻を返す時計（テスト用）
+type Fixed time.Time
+
+func (f Fixed) Now() time.Time {
+	return time.Time(f).UTC()
+}
+
+// Zone UTCからのオフセット（分）を固定のタイムゾーンに変換します
+func Zone(offsetMinutes int) *time.Location {
+	if offsetMinutes == 0 {
+		return time.UTC
+	}
+	return time.FixedZone("", offsetMinutes*60)
+}
+
+// OffsetMinutes 時刻のUTCからのオフセット（分）を返します
+func OffsetMinutes(t time.Time) int {
+	_, offset := t.Zone()
+	return offset / 60
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
@@ -18,19 +20,39 @@ func Load() error {
 }
 
 // GetDBConfig データベース設定を取得します
+// DB_DRIVER は mysql・sqlite・postgres・memory のいずれかで、sqlite の場合 DB_NAME はファイルのパスです（:memory: でメモリ上）
+// memory はデータベースを使わないデモモードです
 func GetDBConfig() map[string]string {
+	driver := getEnv("DB_DRIVER", "mysql")
+	port := "3306"
+	if driver == "postgres" {
+		port = "5432"
+	}
 	return map[string]string{
+		"driver":   driver,
 		"host":     getEnv("DB_HOST", "localhost"),
-		"port":     getEnv("DB_PORT", "3306"),
+		"port":     getEnv("DB_PORT", port),
 		"name":     getEnv("DB_NAME", "stamp_db"),
 		"user":     getEnv("DB_USER", "stamp_user"),
 		"password": getEnv("DB_PASSWORD", "stamp_password"),
 	}
 }
 
+// defaultJWTSecret JWT_SECRET を設定しないデモモード（DB_DRIVER=memory）とテストで使うシークレット
+const defaultJWTSecret = "default-secret-key"
+
 // GetJWTSecret JWTシークレットを取得します
 func GetJWTSecret() string {
-	return getEnv("JWT_SECRET", "default-secret-key")
+	return getEnv("JWT_SECRET", defaultJWTSecret)
+}
+
+// CheckJWTSecret JWT_SECRET が設定されているか確認します
+// 既定のシークレットでは誰でも管理者のトークンを作れるため、デモモード以外では起動できません
+func CheckJWTSecret() error {
+	if os.Getenv("JWT_SECRET") != "" || GetDBConfig()["driver"] == "memory" {
+		return nil
+	}
+	return errors.New("JWT_SECRET must be set (only DB_DRIVER=memory runs with the default secret)")
 }
 
 // GetS3Config S3設定を取得します
@@ -43,6 +65,48 @@ func GetS3Config() map[string]string {
 	}
 }
 
+// GetStorageConfig 画像ストレージ設定を取得します
+func GetStorageConfig() map[string]string {
+	return map[string]string{
+		"dir":      getEnv("STORAGE_DIR", "uploads"),
+		"base_url": getEnv("STORAGE_BASE_URL", "/uploads/"),
+	}
+}
+
+// GetBadgesFile バッジ定義ファイルのパスを取得します（空の場合は組み込みの定義を使用）
+func GetBadgesFile() string {
+	return getEnv("BADGES_FILE", "")
+}
+
+// GetTrashRetentionDays ゴミ箱に入れた御朱印を完全に削除するまでの日数を取得します
+func GetTrashRetentionDays() int {
+	days, err := strconv.Atoi(getEnv("TRASH_RETENTION_DAYS", "30"))
+	if err != nil || days <= 0 {
+		return 30
+	}
+	return days
+}
+
+// GetIdempotencyRetentionHours Idempotency-Key の応答を保存しておく時間を取得します
+func GetIdempotencyRetentionHours() int {
+	hours, err := strconv.Atoi(getEnv("IDEMPOTENCY_RETENTION_HOURS", "24"))
+	if err != nil || hours <= 0 {
+		return 24
+	}
+	return hours
+}
+
+// GetLegacyOwner 認証の導入前に登録された（持ち主のない）御朱印を割り当てるユーザーIDを取得します
+func GetLegacyOwner() string {
+	return getEnv("LEGACY_OWNER", "")
+}
+
+// GetTrustProxy X-Forwarded-For のクライアントIPを信頼するか取得します（リバースプロキシ配下で true にする）
+func GetTrustProxy() bool {
+	v, _ := strconv.ParseBool(getEnv("TRUST_PROXY", "false"))
+	return v
+}
+
 // getEnv 環境変数を取得し、デフォルト値を設定します
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
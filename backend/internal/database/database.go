@@ -1,54 +1,177 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
+	"time"
 
+	"stamp-backend/internal/clock"
 	"stamp-backend/internal/config"
+	"stamp-backend/internal/dialect"
 	"stamp-backend/internal/ent"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
 // Init データベース接続を初期化します
 func Init() (*ent.Client, error) {
-	dbConfig := config.GetDBConfig()
+	client, err := Open(config.GetDBConfig())
+	if err != nil {
+		return nil, err
+	}
 
-	// DSN (Data Source Name) の構築
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		dbConfig["user"],
-		dbConfig["password"],
-		dbConfig["host"],
-		dbConfig["port"],
-		dbConfig["name"],
-	)
+	log.Println("Database connection established successfully")
+	return client, nil
+}
+
+// Open dbConfig（config.GetDBConfig の形式）のデータベースに接続し、テーブル作成とマイグレーションを適用します
+// driver が sqlite で name が :memory: の場合はメモリ上のデータベースを使うため、外部のサービスなしで動かせます
+// driver が memory の場合はデータベースを使わず、寺社と御朱印をメモリ上に保持するデモモードになります
+func Open(dbConfig map[string]string) (*ent.Client, error) {
+	return OpenWithClock(dbConfig, clock.System)
+}
+
+// OpenWithClock Open と同じですが、サンプルデータなどの登録日時とクライアントが書き込む日時を clk から取ります
+func OpenWithClock(dbConfig map[string]string, clk clock.Clock) (*ent.Client, error) {
+	if dbConfig["driver"] == DriverMemory {
+		return openMemory(clk)
+	}
+
+	d, err := dialect.Get(dbConfig["driver"])
+	if err != nil {
+		return nil, err
+	}
 
-	// 実際のMySQL接続
-	db, err := sql.Open("mysql", dsn)
+	db, err := sql.Open(d.Driver(), dsn(d, dbConfig))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
+	if d.Name() == dialect.NameSQLite {
+		// 書き込みは1接続ずつ。メモリ上のデータベースは接続ごとに別になるため、接続を1つに保つ
+		db.SetMaxOpenConns(1)
+	}
 
 	// 接続テスト
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %v", err)
 	}
 
 	// テーブル作成
-	if err := createTables(db); err != nil {
+	if err := createTables(db, d); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to create tables: %v", err)
 	}
 
+	// マイグレーション適用
+	now := clk.Now().UTC().Truncate(time.Second)
+	if err := migrate(db, d, now); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	// 認証の導入前に登録された御朱印の持ち主を設定
+	if err := assignLegacyCollections(db, d, config.GetLegacyOwner(), now); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to assign legacy collections: %v", err)
+	}
+
+	// サンプルデータの挿入
+	if err := insertSampleData(db, d, now); err != nil {
+		log.Printf("Warning: failed to insert sample data: %v", err)
+	}
+
 	// Entクライアントの作成（実際のDB接続付き）
-	client := ent.NewClientWithDB(db)
+	client := ent.NewClientWithDialect(db, d)
+	client.SetClock(clk)
+	return client, nil
+}
 
-	log.Println("Database connection established successfully")
+// assignLegacyCollections 認証の導入前に登録され、user_id が空のままの御朱印を owner に割り当てます
+// 起動のたびに確認するため、LEGACY_OWNER をマイグレーションの後から設定しても割り当てられます
+// owner が空の場合は、持ち主のない御朱印が残っていることをログに出します
+func assignLegacyCollections(db *sql.DB, d dialect.Dialect, owner string, now time.Time) error {
+	if owner == "" {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM goshuin_collections WHERE user_id = ''`).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("Warning: %d goshuin collections have no owner; set LEGACY_OWNER to assign them to a user", n)
+		}
+		return nil
+	}
+
+	result, err := db.Exec(d.Rebind(`UPDATE goshuin_collections SET user_id = ?, updated_at = ? WHERE user_id = ''`), owner, now)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Assigned %d goshuin collections without an owner to %s", n, owner)
+	}
+	return nil
+}
+
+// DriverMemory データベースを使わないデモモードの driver
+const DriverMemory = "memory"
+
+// openMemory 寺社と御朱印をメモリ上に保持するクライアントを作成し、サンプル寺社を登録します
+// 御朱印帳・写真・バッジなど他のデータは保存できないため、それらの API は 501 を返します
+func openMemory(clk clock.Clock) (*ent.Client, error) {
+	client := ent.NewClient()
+	client.SetClock(clk)
+	for _, temple := range sampleTemples {
+		_, err := client.Temple.Create().
+			SetName(temple.name).
+			SetNameEn(temple.nameEn).
+			SetDescription(temple.description).
+			SetLatitude(temple.lat).
+			SetLongitude(temple.lng).
+			SetPrefecture(temple.prefecture).
+			SetKind(temple.kind).
+			SetActive(true).
+			Save(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert temple %s: %v", temple.name, err)
+		}
+	}
 	return client, nil
 }
 
+// dsn DSN (Data Source Name) を構築します
+// 日時はUTCで保存・読み込みし、CURRENT_TIMESTAMP などもセッションのタイムゾーンをUTCにして扱う
+func dsn(d dialect.Dialect, dbConfig map[string]string) string {
+	switch d.Name() {
+	case dialect.NameSQLite:
+		return fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite", dbConfig["name"])
+	case dialect.NamePostgres:
+		// パスワードなどに空白や記号が含まれても壊れないよう、URL として組み立てます
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(dbConfig["user"], dbConfig["password"]),
+			Host:     net.JoinHostPort(dbConfig["host"], dbConfig["port"]),
+			Path:     "/" + dbConfig["name"],
+			RawQuery: url.Values{"sslmode": {"disable"}, "timezone": {"UTC"}}.Encode(),
+		}
+		return u.String()
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC&time_zone=%%27%%2B00%%3A00%%27",
+		dbConfig["user"],
+		dbConfig["password"],
+		dbConfig["host"],
+		dbConfig["port"],
+		dbConfig["name"],
+	)
+}
+
 // createTables 必要なテーブルを作成します
-func createTables(db *sql.DB) error {
+func createTables(db *sql.DB, d dialect.Dialect) error {
 	// templesテーブル
 	templeSQL := `
 	CREATE TABLE IF NOT EXISTS temples (
@@ -88,24 +211,55 @@ func createTables(db *sql.DB) error {
 	`
 
 	// テーブル作成実行
-	if _, err := db.Exec(templeSQL); err != nil {
+	if err := execSchema(db, d, templeSQL); err != nil {
 		return fmt.Errorf("failed to create temples table: %v", err)
 	}
 
-	if _, err := db.Exec(goshuinSQL); err != nil {
+	if err := execSchema(db, d, goshuinSQL); err != nil {
 		return fmt.Errorf("failed to create goshuin_collections table: %v", err)
 	}
 
-	// サンプルデータの挿入
-	if err := insertSampleData(db); err != nil {
-		log.Printf("Warning: failed to insert sample data: %v", err)
-	}
-
 	return nil
 }
 
-// insertSampleData サンプルデータを挿入します
-func insertSampleData(db *sql.DB) error {
+// sampleTemples サンプル寺社データ
+var sampleTemples = []struct {
+	name, nameEn, description string
+	lat, lng                  float64
+	prefecture, kind          string
+}{
+	{
+		name:        "浅草寺",
+		nameEn:      "Senso-ji Temple",
+		description: "東京最古の寺院で、雷門と五重塔が有名",
+		lat:         35.7148,
+		lng:         139.7967,
+		prefecture:  "東京都",
+		kind:        ent.TempleKindTemple,
+	},
+	{
+		name:        "明治神宮",
+		nameEn:      "Meiji Shrine",
+		description: "明治天皇と昭憲皇太后を祀る神社",
+		lat:         35.6764,
+		lng:         139.6993,
+		prefecture:  "東京都",
+		kind:        ent.TempleKindShrine,
+	},
+	{
+		name:        "金閣寺",
+		nameEn:      "Kinkaku-ji",
+		description: "京都の有名な禅寺、金箔で覆われた建物",
+		lat:         35.0394,
+		lng:         135.7292,
+		prefecture:  "京都府",
+		kind:        ent.TempleKindTemple,
+	},
+}
+
+// insertSampleData 寺社が1件もなければサンプルデータを now に登録した寺社として挿入します
+// 都道府県と種別の列を使うため、マイグレーションの後に実行します
+func insertSampleData(db *sql.DB, d dialect.Dialect, now time.Time) error {
 	// 既存データをチェック
 	var count int
 	err := db.QueryRow("SELECT COUNT(*) FROM temples").Scan(&count)
@@ -117,39 +271,13 @@ func insertSampleData(db *sql.DB) error {
 		return nil // 既にデータがある場合はスキップ
 	}
 
-	// サンプル寺社データ
-	sampleTemples := []struct {
-		name, nameEn, description string
-		lat, lng                  float64
-	}{
-		{
-			name:        "浅草寺",
-			nameEn:      "Senso-ji Temple",
-			description: "東京最古の寺院で、雷門と五重塔が有名",
-			lat:         35.7148,
-			lng:         139.7967,
-		},
-		{
-			name:        "明治神宮",
-			nameEn:      "Meiji Shrine",
-			description: "明治天皇と昭憲皇太后を祀る神社",
-			lat:         35.6764,
-			lng:         139.6993,
-		},
-		{
-			name:        "金閣寺",
-			nameEn:      "Kinkaku-ji",
-			description: "京都の有名な禅寺、金箔で覆われた建物",
-			lat:         35.0394,
-			lng:         135.7292,
-		},
-	}
-
 	for _, temple := range sampleTemples {
-		_, err := db.Exec(`
-			INSERT INTO temples (name, name_en, description, latitude, longitude, is_active)
-			VALUES (?, ?, ?, ?, ?, ?)
-		`, temple.name, temple.nameEn, temple.description, temple.lat, temple.lng, true)
+		_, err := db.Exec(d.Rebind(`
+			INSERT INTO temples (name, name_en, description, latitude, longitude, prefecture, kind, is_active,
+			                     created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`), temple.name, temple.nameEn, temple.description, temple.lat, temple.lng, temple.prefecture, temple.kind, true,
+			now, now)
 
 		if err != nil {
 			return fmt.Errorf("failed to insert temple %s: %v", temple.name, err)
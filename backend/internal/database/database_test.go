@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/dialect"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestPostgresDSN(t *testing.T) {
+	got := dsn(dialect.Postgres, map[string]string{
+		"host":     "db",
+		"port":     "5432",
+		"user":     "stamp user",
+		"password": "p@ss word=1'/?",
+		"name":     "stamp",
+	})
+
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatalf("dsn %q is not a URL: %v", got, err)
+	}
+	password, _ := u.User.Password()
+	if u.Scheme != "postgres" || u.Host != "db:5432" || u.Path != "/stamp" ||
+		u.User.Username() != "stamp user" || password != "p@ss word=1'/?" {
+		t.Errorf("dsn %q parsed to %#v", got, u)
+	}
+	if q := u.Query(); q.Get("sslmode") != "disable" || q.Get("timezone") != "UTC" {
+		t.Errorf("dsn %q query = %v", got, q)
+	}
+}
+
+func TestApplyMigrationRollsBack(t *testing.T) {
+	db, err := sql.Open("sqlite", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if err := createTables(db, dialect.SQLite); err != nil {
+		t.Fatalf("createTables: %v", err)
+	}
+	now := time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+	if err := migrate(db, dialect.SQLite, now); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	failed := migration{
+		version:    1000,
+		name:       "fails after a statement",
+		statements: []string{`CREATE TABLE half_applied (id INT PRIMARY KEY)`},
+		run: func(db querier, d dialect.Dialect, now time.Time) error {
+			if _, err := db.Exec(`INSERT INTO half_applied (id) VALUES (1)`); err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	}
+	if err := applyMigration(db, dialect.SQLite, failed, now); err == nil {
+		t.Fatal("applyMigration returned no error")
+	}
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = 1000`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("schema_migrations has %d rows for the failed migration (err %v)", n, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_applied'`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("table of the failed migration was kept (err %v)", err)
+	}
+
+	failed.run = nil
+	if err := applyMigration(db, dialect.SQLite, failed, now); err != nil {
+		t.Fatalf("retrying the migration: %v", err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = 1000`).Scan(&n); err != nil || n != 1 {
+		t.Errorf("schema_migrations has %d rows for the retried migration (err %v)", n, err)
+	}
+}
+
+func TestAssignLegacyCollections(t *testing.T) {
+	db, err := sql.Open("sqlite", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	now := time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+	if err := createTables(db, dialect.SQLite); err != nil {
+		t.Fatalf("createTables: %v", err)
+	}
+	if err := migrate(db, dialect.SQLite, now); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := insertSampleData(db, dialect.SQLite, now); err != nil {
+		t.Fatalf("insertSampleData: %v", err)
+	}
+	for clientID, owner := range map[string]string{"legacy": "", "owned": "user-1"} {
+		_, err := db.Exec(`INSERT INTO goshuin_collections (user_id, client_id, temple_id, collected_at) VALUES (?, ?, 1, ?)`,
+			owner, clientID, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 持ち主が設定されていなければ何も変えません
+	if err := assignLegacyCollections(db, dialect.SQLite, "", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := assignLegacyCollections(db, dialect.SQLite, "owner-1", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query(`SELECT client_id, user_id FROM goshuin_collections`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	got := map[string]string{}
+	for rows.Next() {
+		var clientID, userID string
+		if err := rows.Scan(&clientID, &userID); err != nil {
+			t.Fatal(err)
+		}
+		got[clientID] = userID
+	}
+	want := map[string]string{"legacy": "owner-1", "owned": "user-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("owners = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"stamp-backend/internal/dialect"
+)
+
+// guideSeed 初期のガイドの節・ヒント（英語、公開済みで登録します）
+// translations に GuideSection・GuideTip として登録されていた翻訳は、id（1始まり）が並び順に対応します
+type guideSeed struct {
+	slug  string
+	title string
+	body  string
+}
+
+var guideSectionSeeds = []guideSeed{
+	{
+		slug:  "what-is-goshuin",
+		title: "What is Goshuin?",
+		body:  "Goshuin (御朱印) are special stamps or calligraphy that you can receive at Japanese temples and shrines. They serve as proof of your visit and are considered sacred items.",
+	},
+	{
+		slug:  "how-to-receive-goshuin",
+		title: "How to Receive Goshuin",
+		body:  "1. Visit the temple or shrine during opening hours\n2. Look for the goshuin office (御朱印所)\n3. Pay the fee (usually 300-500 yen)\n4. Present your goshuin book or paper\n5. Wait while the priest writes the goshuin",
+	},
+	{
+		slug:  "etiquette-and-manners",
+		title: "Etiquette and Manners",
+		body:  "- Dress modestly and respectfully\n- Be quiet and respectful in sacred areas\n- Don't take photos of the goshuin writing process\n- Handle your goshuin book with care\n- Don't rush the priest while they're writing",
+	},
+	{
+		slug:  "goshuin-book",
+		title: "Goshuin Book (御朱印帳)",
+		body:  "A goshuin book is a special notebook designed to collect goshuin. You can purchase one at most temples and shrines, or bring your own. Traditional books are made of washi paper and have beautiful covers.",
+	},
+	{
+		slug:  "best-practices",
+		title: "Best Practices",
+		body:  "- Start with famous temples in your area\n- Visit during weekdays to avoid crowds\n- Check temple websites for special goshuin\n- Keep your goshuin book in a protective case\n- Document your visits with photos",
+	},
+}
+
+var guideTipSeeds = []guideSeed{
+	{slug: "seasonal-goshuin", body: "Some temples offer special goshuin for different seasons"},
+	{slug: "multiple-designs", body: "Many temples have multiple goshuin designs"},
+	{slug: "reservations", body: "Some temples require advance reservations for goshuin"},
+	{slug: "sacred-items", body: "Goshuin are considered sacred items, so treat them with respect"},
+	{slug: "temples-and-shrines", body: "You can collect goshuin at both temples (寺) and shrines (神社)"},
+}
+
+// seedGuide ガイドの初期内容を登録し、translations にあった節・ヒントの翻訳を各言語の節・ヒントに移します
+func seedGuide(db querier, d dialect.Dialect, now time.Time) error {
+	for _, kind := range []struct {
+		entityType string
+		table      string
+		seeds      []guideSeed
+		// titleField・bodyField translations での項目名
+		titleField string
+		bodyField  string
+	}{
+		{"GuideSection", "guide_sections", guideSectionSeeds, "title", "content"},
+		{"GuideTip", "guide_tips", guideTipSeeds, "", "text"},
+	} {
+		for i, seed := range kind.seeds {
+			position := i + 1
+			if err := insertGuideEntry(db, d, kind.entityType, kind.table, seed, "en", position, now); err != nil {
+				return err
+			}
+
+			translated, err := guideTranslations(db, d, kind.entityType, position)
+			if err != nil {
+				return err
+			}
+			for locale, fields := range translated {
+				entry := seed
+				if v := fields[kind.titleField]; kind.titleField != "" && v != "" {
+					entry.title = v
+				}
+				if v := fields[kind.bodyField]; v != "" {
+					entry.body = v
+				}
+				if err := insertGuideEntry(db, d, kind.entityType, kind.table, entry, locale, position, now); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := db.Exec(d.Rebind(`DELETE FROM translations WHERE entity_type = ?`), kind.entityType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertGuideEntry 節またはヒントを最初の版とともに、now に公開済みで登録します
+func insertGuideEntry(db querier, d dialect.Dialect, entityType, table string, seed guideSeed, locale string, position int, now time.Time) error {
+	id, err := dialect.InsertID(context.Background(), db, d, "id", `INSERT INTO `+table+` (slug, locale, position, version, published_version, published_at,
+		created_at, updated_at)
+		VALUES (?, ?, ?, 1, 1, ?, ?, ?)`, seed.slug, locale, position, now, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to seed %s %s (%s): %v", entityType, seed.slug, locale, err)
+	}
+
+	var title interface{}
+	if seed.title != "" {
+		title = seed.title
+	}
+	_, err = db.Exec(d.Rebind(`INSERT INTO guide_versions (entity_type, entity_id, version, title, body, media, created_at)
+		VALUES (?, ?, 1, ?, ?, '[]', ?)`), entityType, id, title, seed.body, now)
+	return err
+}
+
+// guideTranslations translations に登録された節・ヒントの翻訳を言語・項目ごとに返します
+func guideTranslations(db querier, d dialect.Dialect, entityType string, id int) (map[string]map[string]string, error) {
+	rows, err := db.Query(d.Rebind(`SELECT locale, field, value FROM translations WHERE entity_type = ? AND entity_id = ?`), entityType, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translated := map[string]map[string]string{}
+	for rows.Next() {
+		var locale, field, value string
+		if err := rows.Scan(&locale, &field, &value); err != nil {
+			return nil, err
+		}
+		if translated[locale] == nil {
+			translated[locale] = map[string]string{}
+		}
+		translated[locale][field] = value
+	}
+	return translated, rows.Err()
+}
@@ -0,0 +1,648 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"stamp-backend/internal/dialect"
+	"stamp-backend/internal/ent"
+)
+
+// migration 既存テーブルに対するスキーマ変更
+// statements は MySQL の構文で書き、SQLite・PostgreSQL では dialect.Dialect.Schema で書き換えて適用します
+type migration struct {
+	version    int
+	name       string
+	statements []string
+	// run はSQLだけでは表せない変更を statements の後に適用します
+	// now は適用する時刻で、登録するデータの日時に使います
+	run func(db querier, d dialect.Dialect, now time.Time) error
+}
+
+// querier *sql.DB と *sql.Tx に共通のメソッド。マイグレーションは1つずつトランザクションの中で適用します
+type querier interface {
+	dialect.Execer
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// migrations createTables 以降のスキーマ変更（追加のみ、順番を変えないこと）
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "add user_id to goshuin_collections",
+		statements: []string{
+			`ALTER TABLE goshuin_collections ADD COLUMN user_id VARCHAR(64) NOT NULL DEFAULT '' AFTER id`,
+			`CREATE INDEX idx_goshuin_collections_user ON goshuin_collections (user_id, collected_at)`,
+		},
+	},
+	{
+		version: 2,
+		name:    "add prefecture and kind to temples",
+		statements: []string{
+			`ALTER TABLE temples ADD COLUMN prefecture VARCHAR(50) NOT NULL DEFAULT '' AFTER address`,
+			`ALTER TABLE temples ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'temple' AFTER prefecture`,
+			`CREATE INDEX idx_temples_prefecture ON temples (prefecture)`,
+			`UPDATE temples SET prefecture = '東京都' WHERE name IN ('浅草寺', '明治神宮')`,
+			`UPDATE temples SET prefecture = '京都府' WHERE name = '金閣寺'`,
+			`UPDATE temples SET kind = 'shrine' WHERE name LIKE '%神社' OR name LIKE '%神宮' OR name LIKE '%大社'`,
+		},
+	},
+	{
+		version: 3,
+		name:    "create user_badges",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS user_badges (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id VARCHAR(64) NOT NULL,
+				badge_id VARCHAR(64) NOT NULL,
+				earned_at TIMESTAMP NOT NULL,
+				UNIQUE KEY uq_user_badges (user_id, badge_id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 4,
+		name:    "create goshuin_books",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS goshuin_books (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id VARCHAR(64) NOT NULL,
+				title VARCHAR(255) NOT NULL,
+				cover_image_url VARCHAR(500),
+				type VARCHAR(20) NOT NULL DEFAULT 'mixed',
+				capacity INT NOT NULL DEFAULT 0,
+				started_on DATE,
+				ended_on DATE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				INDEX idx_goshuin_books_user (user_id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			`ALTER TABLE goshuin_collections ADD COLUMN book_id INT NULL AFTER notes`,
+			`ALTER TABLE goshuin_collections ADD COLUMN page INT NULL AFTER book_id`,
+			`ALTER TABLE goshuin_collections ADD CONSTRAINT fk_goshuin_collections_book
+				FOREIGN KEY (book_id) REFERENCES goshuin_books(id) ON DELETE SET NULL`,
+			`CREATE INDEX idx_goshuin_collections_book ON goshuin_collections (book_id, page)`,
+		},
+	},
+	{
+		version: 5,
+		name:    "add tags and visit details to goshuin_collections",
+		statements: []string{
+			`ALTER TABLE goshuin_collections
+				ADD COLUMN rating TINYINT NULL AFTER notes,
+				ADD COLUMN fee_paid INT NULL AFTER rating,
+				ADD COLUMN waiting_minutes INT NULL AFTER fee_paid,
+				ADD COLUMN hall_name VARCHAR(255) NULL AFTER waiting_minutes`,
+			`CREATE INDEX idx_goshuin_collections_rating ON goshuin_collections (user_id, rating)`,
+			`CREATE TABLE IF NOT EXISTS goshuin_collection_tags (
+				collection_id INT NOT NULL,
+				tag VARCHAR(64) NOT NULL,
+				PRIMARY KEY (collection_id, tag),
+				INDEX idx_goshuin_collection_tags_tag (tag),
+				FOREIGN KEY (collection_id) REFERENCES goshuin_collections(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 6,
+		name:    "create goshuin_photos",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS goshuin_photos (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				collection_id INT NOT NULL,
+				position INT NOT NULL DEFAULT 0,
+				caption VARCHAR(255),
+				kind VARCHAR(20) NOT NULL DEFAULT 'stamp',
+				storage_key VARCHAR(500),
+				url VARCHAR(500) NOT NULL,
+				is_cover BOOLEAN NOT NULL DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_goshuin_photos_collection (collection_id, position),
+				INDEX idx_goshuin_photos_storage_key (storage_key(191)),
+				FOREIGN KEY (collection_id) REFERENCES goshuin_collections(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			// 既存の image_url を最初の写真（表紙）として移行する
+			`INSERT INTO goshuin_photos (collection_id, position, kind, url, is_cover, created_at)
+				SELECT id, 0, 'stamp', image_url, TRUE, created_at
+				FROM goshuin_collections
+				WHERE image_url IS NOT NULL AND image_url <> ''`,
+		},
+	},
+	{
+		version: 7,
+		name:    "add collected_tz_offset to goshuin_collections",
+		statements: []string{
+			// collected_at はUTCで保存し、記録時のUTCからのオフセット（分）を別に持つ
+			`ALTER TABLE goshuin_collections ADD COLUMN collected_tz_offset SMALLINT NULL AFTER collected_at`,
+		},
+	},
+	{
+		version: 8,
+		name:    "add soft delete to goshuin_collections and temples",
+		statements: []string{
+			`ALTER TABLE goshuin_collections ADD COLUMN deleted_at TIMESTAMP NULL AFTER updated_at`,
+			`CREATE INDEX idx_goshuin_collections_deleted ON goshuin_collections (deleted_at)`,
+			`ALTER TABLE temples ADD COLUMN deleted_at TIMESTAMP NULL AFTER updated_at`,
+			`CREATE INDEX idx_temples_deleted ON temples (deleted_at)`,
+		},
+		// 寺社の削除でユーザーの御朱印が消えないよう、CASCADE の外部キーを RESTRICT に張り替える
+		run: restrictTempleDelete,
+	},
+	{
+		version: 9,
+		name:    "create audit_logs",
+		statements: []string{
+			// 追記のみ。hash は prev_hash と各項目から計算し、改ざんされると連鎖が切れる
+			`CREATE TABLE IF NOT EXISTS audit_logs (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				actor VARCHAR(64) NOT NULL,
+				actor_role VARCHAR(20),
+				action VARCHAR(20) NOT NULL,
+				entity_type VARCHAR(64) NOT NULL,
+				entity_id INT NOT NULL,
+				diff MEDIUMTEXT NOT NULL,
+				request_id VARCHAR(64),
+				ip VARCHAR(64),
+				created_at TIMESTAMP NOT NULL,
+				prev_hash CHAR(64) NOT NULL,
+				hash CHAR(64) NOT NULL,
+				UNIQUE KEY uq_audit_logs_hash (hash),
+				INDEX idx_audit_logs_entity (entity_type, entity_id),
+				INDEX idx_audit_logs_actor (actor, created_at),
+				INDEX idx_audit_logs_request (request_id),
+				INDEX idx_audit_logs_created (created_at)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 10,
+		name:    "create temple_corrections and notifications",
+		statements: []string{
+			`ALTER TABLE audit_logs ADD COLUMN on_behalf_of VARCHAR(64) NULL AFTER actor_role`,
+			`CREATE TABLE IF NOT EXISTS temple_corrections (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				temple_id INT NOT NULL,
+				user_id VARCHAR(64) NOT NULL,
+				changes MEDIUMTEXT NOT NULL,
+				comment TEXT,
+				photo_key VARCHAR(500),
+				photo_url VARCHAR(500),
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				reviewer_id VARCHAR(64),
+				review_note TEXT,
+				applied_changes MEDIUMTEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				reviewed_at TIMESTAMP NULL,
+				INDEX idx_temple_corrections_status (status, created_at),
+				INDEX idx_temple_corrections_user (user_id),
+				FOREIGN KEY (temple_id) REFERENCES temples(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			`CREATE TABLE IF NOT EXISTS notifications (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id VARCHAR(64) NOT NULL,
+				kind VARCHAR(64) NOT NULL,
+				title VARCHAR(255) NOT NULL,
+				body TEXT,
+				data TEXT,
+				read_at TIMESTAMP NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_notifications_user (user_id, read_at, created_at)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 11,
+		name:    "create temple_proposals",
+		statements: []string{
+			`ALTER TABLE temples ADD COLUMN contributed_by VARCHAR(64) NULL`,
+			`CREATE TABLE IF NOT EXISTS temple_proposals (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id VARCHAR(64) NOT NULL,
+				name VARCHAR(255) NOT NULL,
+				name_en VARCHAR(255),
+				latitude DOUBLE NOT NULL,
+				longitude DOUBLE NOT NULL,
+				prefecture VARCHAR(50) NOT NULL DEFAULT '',
+				kind VARCHAR(20) NOT NULL DEFAULT 'temple',
+				address VARCHAR(500),
+				description TEXT,
+				website VARCHAR(500),
+				opening_hours VARCHAR(500),
+				goshuin_fee VARCHAR(500),
+				photo_key VARCHAR(500),
+				photo_url VARCHAR(500),
+				comment TEXT,
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				reviewer_id VARCHAR(64),
+				review_note TEXT,
+				temple_id INT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				reviewed_at TIMESTAMP NULL,
+				INDEX idx_temple_proposals_status (status, created_at),
+				INDEX idx_temple_proposals_user (user_id),
+				INDEX idx_temple_proposals_location (latitude, longitude),
+				FOREIGN KEY (temple_id) REFERENCES temples(id) ON DELETE SET NULL
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			`CREATE TABLE IF NOT EXISTS temple_proposal_entries (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				proposal_id INT NOT NULL,
+				user_id VARCHAR(64) NOT NULL,
+				image_url VARCHAR(500),
+				notes TEXT,
+				collected_at TIMESTAMP NULL,
+				collected_tz_offset SMALLINT NOT NULL DEFAULT 0,
+				collection_id INT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_temple_proposal_entries_user (user_id),
+				FOREIGN KEY (proposal_id) REFERENCES temple_proposals(id) ON DELETE CASCADE,
+				FOREIGN KEY (collection_id) REFERENCES goshuin_collections(id) ON DELETE SET NULL
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 12,
+		name:    "create translations",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS translations (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				entity_type VARCHAR(64) NOT NULL,
+				entity_id INT NOT NULL,
+				field VARCHAR(64) NOT NULL,
+				locale VARCHAR(35) NOT NULL,
+				value MEDIUMTEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				UNIQUE KEY uk_translations (entity_type, entity_id, field, locale),
+				INDEX idx_translations_locale (entity_type, locale)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 13,
+		name:    "create guide sections and tips",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS guide_sections (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				slug VARCHAR(100) NOT NULL,
+				locale VARCHAR(35) NOT NULL,
+				position INT NOT NULL DEFAULT 0,
+				version INT NOT NULL DEFAULT 0,
+				published_version INT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				published_at TIMESTAMP NULL,
+				UNIQUE KEY uk_guide_sections (slug, locale),
+				INDEX idx_guide_sections_locale (locale, position)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			`CREATE TABLE IF NOT EXISTS guide_tips (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				slug VARCHAR(100) NOT NULL,
+				locale VARCHAR(35) NOT NULL,
+				position INT NOT NULL DEFAULT 0,
+				version INT NOT NULL DEFAULT 0,
+				published_version INT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				published_at TIMESTAMP NULL,
+				UNIQUE KEY uk_guide_tips (slug, locale),
+				INDEX idx_guide_tips_locale (locale, position)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			`CREATE TABLE IF NOT EXISTS guide_versions (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				entity_type VARCHAR(32) NOT NULL,
+				entity_id INT NOT NULL,
+				version INT NOT NULL,
+				title VARCHAR(255),
+				body MEDIUMTEXT NOT NULL,
+				media TEXT,
+				author_id VARCHAR(64),
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE KEY uk_guide_versions (entity_type, entity_id, version)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+		run: seedGuide,
+	},
+	{
+		version: 14,
+		name:    "create guide quizzes",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS quiz_questions (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				section_slug VARCHAR(100) NOT NULL,
+				locale VARCHAR(35) NOT NULL,
+				kind VARCHAR(16) NOT NULL,
+				prompt TEXT NOT NULL,
+				choices TEXT NOT NULL,
+				answer VARCHAR(255) NOT NULL,
+				explanation TEXT,
+				position INT NOT NULL DEFAULT 0,
+				active BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				INDEX idx_quiz_questions_section (section_slug, locale, position)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			`CREATE TABLE IF NOT EXISTS quiz_attempts (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				user_id VARCHAR(64) NOT NULL,
+				section_slug VARCHAR(100) NOT NULL,
+				locale VARCHAR(35) NOT NULL,
+				answers TEXT NOT NULL,
+				score DOUBLE NOT NULL,
+				passed BOOLEAN NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_quiz_attempts_user (user_id, section_slug)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			`CREATE TABLE IF NOT EXISTS quiz_progress (
+				user_id VARCHAR(64) NOT NULL,
+				section_slug VARCHAR(100) NOT NULL,
+				attempts INT NOT NULL DEFAULT 0,
+				best_score DOUBLE NOT NULL DEFAULT 0,
+				passed BOOLEAN NOT NULL DEFAULT FALSE,
+				passed_at TIMESTAMP NULL,
+				updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+				PRIMARY KEY (user_id, section_slug)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+		run: seedQuiz,
+	},
+	{
+		version: 15,
+		name:    "add goshuin procedure to temples",
+		statements: []string{
+			`ALTER TABLE temples
+				ADD COLUMN reservation_required BOOLEAN NULL,
+				ADD COLUMN kakioki_only BOOLEAN NULL,
+				ADD COLUMN book_drop_off BOOLEAN NULL,
+				ADD COLUMN cash_only BOOLEAN NULL,
+				ADD COLUMN photography VARCHAR(16) NULL,
+				ADD COLUMN procedure_notes TEXT NULL`,
+		},
+	},
+	{
+		version: 16,
+		name:    "create region packs",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS region_packs (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				region_key VARCHAR(255) NOT NULL,
+				version INT NOT NULL,
+				content_hash CHAR(64) NOT NULL,
+				manifest MEDIUMTEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE KEY uk_region_packs (region_key, version)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+	},
+	{
+		version: 17,
+		name:    "add client ids and the sync change log",
+		statements: []string{
+			// オフラインの端末が作成した御朱印を識別する UUID。既存の御朱印にも振っておく
+			`ALTER TABLE goshuin_collections ADD COLUMN client_id CHAR(36) NULL AFTER user_id`,
+			`CREATE UNIQUE INDEX uk_goshuin_collections_client ON goshuin_collections (user_id, client_id)`,
+			// seq は単調増加し、端末は最後に受け取った seq 以降の変更だけを取得する
+			`CREATE TABLE IF NOT EXISTS sync_changes (
+				seq BIGINT AUTO_INCREMENT PRIMARY KEY,
+				user_id VARCHAR(64) NOT NULL,
+				client_id CHAR(36) NOT NULL,
+				collection_id INT NULL,
+				op VARCHAR(10) NOT NULL,
+				fields VARCHAR(255) NOT NULL,
+				mutation_id CHAR(36) NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_sync_changes_user (user_id, seq),
+				INDEX idx_sync_changes_client (user_id, client_id, seq)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			// 項目ごとの最終更新日時。項目単位の後勝ちの判定に使い、完全削除後も残す
+			`CREATE TABLE IF NOT EXISTS sync_field_clocks (
+				user_id VARCHAR(64) NOT NULL,
+				client_id CHAR(36) NOT NULL,
+				field VARCHAR(32) NOT NULL,
+				changed_at TIMESTAMP(3) NOT NULL,
+				seq BIGINT NOT NULL,
+				PRIMARY KEY (user_id, client_id, field)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			// 適用済みの端末の変更と結果。同じ変更を再送しても二重に適用せず同じ結果を返す
+			`CREATE TABLE IF NOT EXISTS sync_mutations (
+				user_id VARCHAR(64) NOT NULL,
+				mutation_id CHAR(36) NOT NULL,
+				result TEXT NOT NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (user_id, mutation_id)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+		},
+		run: backfillClientIDs,
+	},
+	{
+		version: 18,
+		name:    "create idempotency_keys",
+		statements: []string{
+			// status が NULL の間は実行中。応答を保存したら expires_at を保持期間の終わりに延ばす
+			`CREATE TABLE IF NOT EXISTS idempotency_keys (
+				scope VARCHAR(100) NOT NULL,
+				idempotency_key VARCHAR(255) NOT NULL,
+				fingerprint CHAR(64) NOT NULL,
+				status SMALLINT NULL,
+				header TEXT NULL,
+				body MEDIUMBLOB NULL,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				expires_at TIMESTAMP NOT NULL,
+				PRIMARY KEY (scope, idempotency_key),
+				INDEX idx_idempotency_keys_expires (expires_at)
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin`,
+		},
+	},
+	{
+		version: 19,
+		name:    "create audit_log_head",
+		statements: []string{
+			// 監査ログの末尾のハッシュ。1行だけの行ロックで追記を直列化する（空のログでもロックできる）
+			`CREATE TABLE IF NOT EXISTS audit_log_head (
+				id INT PRIMARY KEY,
+				hash VARCHAR(64) NOT NULL
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			`INSERT INTO audit_log_head (id, hash)
+				SELECT 1, COALESCE((SELECT hash FROM audit_logs ORDER BY id DESC LIMIT 1), '')`,
+		},
+	},
+	{
+		version: 20,
+		name:    "create sync_sequence",
+		statements: []string{
+			// sync_changes の seq の採番。行ロックをトランザクションの終わりまで保持し、seq の順に変更が見えるようにする
+			`CREATE TABLE IF NOT EXISTS sync_sequence (
+				id INT PRIMARY KEY,
+				seq BIGINT NOT NULL
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`,
+			`INSERT INTO sync_sequence (id, seq) SELECT 1, COALESCE(MAX(seq), 0) FROM sync_changes`,
+		},
+	},
+}
+
+// restrictTempleDelete goshuin_collections.temple_id の ON DELETE CASCADE を ON DELETE RESTRICT に変更します
+// createTables の外部キーは名前が自動生成されるため、information_schema・pg_constraint から探して削除します
+// SQLite は外部キーを削除できないため、RESTRICT のトリガーを CASCADE より先に判定させます
+func restrictTempleDelete(db querier, d dialect.Dialect, now time.Time) error {
+	var query, drop string
+	switch d.Name() {
+	case dialect.NameMySQL:
+		query = `
+		SELECT CONSTRAINT_NAME FROM information_schema.REFERENTIAL_CONSTRAINTS
+		WHERE CONSTRAINT_SCHEMA = DATABASE()
+		  AND TABLE_NAME = 'goshuin_collections'
+		  AND REFERENCED_TABLE_NAME = 'temples'
+	`
+		drop = "ALTER TABLE goshuin_collections DROP FOREIGN KEY `%s`"
+	case dialect.NamePostgres:
+		query = `
+		SELECT conname FROM pg_constraint
+		WHERE conrelid = 'goshuin_collections'::regclass
+		  AND confrelid = 'temples'::regclass
+		  AND contype = 'f'
+	`
+		drop = `ALTER TABLE goshuin_collections DROP CONSTRAINT "%s"`
+	}
+
+	var names []string
+	if query != "" {
+		rows, err := db.Query(query)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			names = append(names, name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		if _, err := db.Exec(fmt.Sprintf(drop, name)); err != nil {
+			return err
+		}
+	}
+	return execSchema(db, d, `ALTER TABLE goshuin_collections ADD CONSTRAINT fk_goshuin_collections_temple
+		FOREIGN KEY (temple_id) REFERENCES temples(id) ON DELETE RESTRICT`)
+}
+
+// backfillClientIDs client_id のない既存の御朱印に UUID を振ります
+func backfillClientIDs(db querier, d dialect.Dialect, now time.Time) error {
+	rows, err := db.Query(`SELECT id FROM goshuin_collections WHERE client_id IS NULL`)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := db.Exec(d.Rebind(`UPDATE goshuin_collections SET client_id = ? WHERE id = ?`), ent.NewUUID(), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execSchema MySQL で書いたスキーマ変更の文を方言に合わせて書き換えて実行します
+func execSchema(db querier, d dialect.Dialect, stmt string) error {
+	for _, s := range d.Schema(stmt) {
+		if _, err := db.Exec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate 未適用のマイグレーションを順番に適用します
+// 各マイグレーションは schema_migrations への記録とともに1つのトランザクションで適用するため、
+// 途中で失敗しても適用済みとして記録されず、次の起動で再び適用されます
+// （MySQL ではDDLが暗黙にコミットされるため、データの変更だけがロールバックされます）
+func migrate(db *sql.DB, d dialect.Dialect, now time.Time) error {
+	err := execSchema(db, d, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	applied := map[int]bool{}
+	rows, err := db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return fmt.Errorf("failed to scan schema_migrations: %v", err)
+		}
+		applied[v] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+		if err := applyMigration(db, d, m, now); err != nil {
+			return err
+		}
+		log.Printf("Applied migration %d: %s", m.version, m.name)
+	}
+
+	return nil
+}
+
+// applyMigration マイグレーションを now に適用したものとして、schema_migrations に記録します
+func applyMigration(db *sql.DB, d dialect.Dialect, m migration, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %v", m.version, m.name, err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.statements {
+		if err := execSchema(tx, d, stmt); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", m.version, m.name, err)
+		}
+	}
+	if m.run != nil {
+		if err := m.run(tx, d, now); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", m.version, m.name, err)
+		}
+	}
+	if _, err := tx.Exec(d.Rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"), m.version, m.name, now); err != nil {
+		return fmt.Errorf("failed to record migration %d: %v", m.version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to record migration %d: %v", m.version, err)
+	}
+	return nil
+}
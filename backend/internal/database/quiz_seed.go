@@ -0,0 +1,90 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"stamp-backend/internal/dialect"
+)
+
+// quizSeed クイズの初期問題
+// answer は正解の選択肢の番号、並べ替え問題では正しい順に並べた選択肢の番号です
+type quizSeed struct {
+	section     string
+	kind        string
+	prompt      string
+	choices     []string
+	answer      []int
+	explanation string
+}
+
+// quizSeeds ガイドの節ごとの初期問題（英語）
+var quizSeeds = []quizSeed{
+	{
+		section:     "what-is-goshuin",
+		kind:        "choice",
+		prompt:      "What is a goshuin?",
+		choices:     []string{"A souvenir stamp sold at train stations", "A sacred stamp and calligraphy received as proof of a visit", "An entrance ticket to the temple grounds"},
+		answer:      []int{1},
+		explanation: "Goshuin are written by the temple or shrine as proof of your visit and are treated as sacred items.",
+	},
+	{
+		section: "how-to-receive-goshuin",
+		kind:    "order",
+		prompt:  "Put the steps of receiving a goshuin in order.",
+		choices: []string{
+			"Pay the fee",
+			"Visit during opening hours",
+			"Wait while the goshuin is written",
+			"Find the goshuin office (御朱印所)",
+			"Present your goshuin book",
+		},
+		answer:      []int{1, 3, 4, 0, 2},
+		explanation: "Find the office during opening hours, hand over your book with the fee, then wait quietly.",
+	},
+	{
+		section: "etiquette-and-manners",
+		kind:    "order",
+		prompt:  "Put the steps of temizu (purifying at the water basin) in order.",
+		choices: []string{
+			"Pour water into your cupped left hand and rinse your mouth",
+			"Hold the ladle in your right hand and rinse your left hand",
+			"Tilt the ladle upright so the water rinses the handle",
+			"Switch hands and rinse your right hand",
+			"Rinse your left hand again",
+		},
+		answer:      []int{1, 3, 0, 4, 2},
+		explanation: "Left hand, right hand, mouth, left hand again, then rinse the handle. Never drink directly from the ladle.",
+	},
+	{
+		section:     "etiquette-and-manners",
+		kind:        "choice",
+		prompt:      "Which of these are good manners at the goshuin office?",
+		choices:     []string{"Waiting patiently while the priest writes", "Photographing the priest as they write", "Handling your goshuin book with care", "Asking the priest to hurry"},
+		answer:      []int{0, 2},
+		explanation: "Writing a goshuin is a religious act: don't rush or photograph it, and treat the book with respect.",
+	},
+}
+
+// seedQuiz クイズの初期問題を登録します
+func seedQuiz(db querier, d dialect.Dialect, now time.Time) error {
+	for i, seed := range quizSeeds {
+		choices, err := json.Marshal(seed.choices)
+		if err != nil {
+			return err
+		}
+		answer, err := json.Marshal(seed.answer)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(d.Rebind(`INSERT INTO quiz_questions (section_slug, locale, kind, prompt, choices, answer, explanation, position,
+			created_at, updated_at)
+			VALUES (?, 'en', ?, ?, ?, ?, ?, ?, ?, ?)`), seed.section, seed.kind, seed.prompt, string(choices), string(answer), seed.explanation, i+1,
+			now, now)
+		if err != nil {
+			return fmt.Errorf("failed to seed quiz question for %s: %v", seed.section, err)
+		}
+	}
+	return nil
+}
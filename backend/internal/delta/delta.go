@@ -0,0 +1,499 @@
+// Package delta オフラインの端末と御朱印コレクションを差分同期します
+//
+// 端末は御朱印を UUID（client_id）で識別し、オフライン中の変更を送信待ちの列に溜めておきます。
+// サーバーは変更を単調増加する seq 付きの変更ログに記録し、端末は最後に受け取った seq 以降の
+// 変更だけを取得します。競合は項目単位の後勝ち（changed_at が新しい方）で解決し、負けた項目を
+// 競合レポートとして返します。
+package delta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/ent"
+)
+
+// MaxBatch 一度に送信できる変更の数
+const MaxBatch = 500
+
+// 変更の適用結果
+const (
+	// StatusApplied すべての項目を適用しました
+	StatusApplied = "applied"
+	// StatusConflict サーバーの方が新しい項目があり、その項目は適用しませんでした
+	StatusConflict = "conflict"
+	// StatusInvalid 変更が不正なため適用しませんでした
+	StatusInvalid = "invalid"
+)
+
+// Mutation 端末が送信する御朱印1件への変更
+type Mutation struct {
+	// ID 変更ごとに端末が生成する UUID。同じ ID の再送は一度しか適用しません
+	ID       string `json:"id"`
+	ClientID string `json:"client_id"`
+	// Op upsert（作成・更新）または delete
+	Op string `json:"op"`
+	// ChangedAt 端末で変更した日時（RFC 3339）。項目単位の後勝ちの判定に使います
+	ChangedAt string `json:"changed_at"`
+	// TempleID 作成時のみ必要です
+	TempleID int                        `json:"temple_id,omitempty"`
+	Fields   map[string]json.RawMessage `json:"fields,omitempty"`
+}
+
+// Conflict サーバーの値が残った項目
+type Conflict struct {
+	MutationID      string      `json:"mutation_id"`
+	ClientID        string      `json:"client_id"`
+	Field           string      `json:"field"`
+	ClientValue     interface{} `json:"client_value"`
+	ServerValue     interface{} `json:"server_value"`
+	ServerChangedAt string      `json:"server_changed_at"`
+}
+
+// Result 変更1件の適用結果
+type Result struct {
+	MutationID   string `json:"id"`
+	ClientID     string `json:"client_id"`
+	Status       string `json:"status"`
+	CollectionID int    `json:"collection_id,omitempty"`
+	// Applied 適用した項目
+	Applied   []string   `json:"applied"`
+	Conflicts []Conflict `json:"conflicts,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	// Seq 変更を記録した seq（何も変わらなかった場合は0）
+	Seq int64 `json:"seq,omitempty"`
+	// Replayed 適用済みの変更の再送で、保存しておいた結果を返したことを示します
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+// Change 取得する変更1件。upsert には御朱印の現在の状態と項目ごとの変更日時を含みます
+type Change struct {
+	*ent.SyncChange
+	Collection *ent.GoshuinCollection `json:"collection,omitempty"`
+	Clocks     map[string]string      `json:"clocks,omitempty"`
+}
+
+// Page 取得した変更。Cursor を次の since に指定します
+type Page struct {
+	Changes []*Change `json:"changes"`
+	Cursor  int64     `json:"cursor"`
+	HasMore bool      `json:"has_more"`
+	// Reset since がサーバーの変更ログより新しかったため、最初から返したことを示します
+	// 端末は手元のデータを捨てて取り直す必要があります
+	Reset bool `json:"reset,omitempty"`
+}
+
+// Engine 同期の変更ログの記録と変更の適用を行います
+type Engine struct {
+	client *ent.Client
+	clock  clock.Clock
+}
+
+// New 同期エンジンを作成します
+func New(client *ent.Client, clk clock.Clock) *Engine {
+	if clk == nil {
+		clk = clock.System
+	}
+	return &Engine{client: client, clock: clk}
+}
+
+// pushKey 端末の変更を適用中であることを示すコンテキストのキー
+type pushKey struct{}
+
+// Hook REST API などによる御朱印の変更を変更ログに記録するフックを返します
+// 変更と同じトランザクションで記録するため、変更ログから漏れた変更は残りません
+// 変更した項目の日時はサーバーの現在時刻になります。端末の変更の適用は Push が記録します
+func (e *Engine) Hook() ent.TxHook {
+	return func(ctx context.Context, m *ent.Mutation) error {
+		if m.Type != ent.TypeGoshuinCollection || ctx.Value(pushKey{}) != nil {
+			return nil
+		}
+		change := changeFromMutation(m)
+		if change == nil {
+			return nil
+		}
+		now := e.clock.Now()
+		if _, err := e.client.Sync.Record(ctx, change, now, now); err != nil {
+			return fmt.Errorf("failed to record sync change for %s %d: %v", m.Op, m.ID, err)
+		}
+		return nil
+	}
+}
+
+// changeFromMutation 御朱印の変更を変更ログの1件に変換します。記録するものがなければ nil を返します
+func changeFromMutation(m *ent.Mutation) *ent.SyncChange {
+	old, _ := m.Old.(*ent.GoshuinCollection)
+	gc, _ := m.New.(*ent.GoshuinCollection)
+	switch m.Op {
+	case ent.OpCreate:
+		if gc == nil {
+			return nil
+		}
+		return &ent.SyncChange{UserID: gc.UserID, ClientID: gc.ClientID, CollectionID: gc.ID, Op: ent.SyncOpUpsert, Fields: fieldNames()}
+	case ent.OpUpdate:
+		if old == nil || gc == nil {
+			return nil
+		}
+		names := changedFields(old, gc)
+		if len(names) == 0 {
+			return nil
+		}
+		return &ent.SyncChange{UserID: gc.UserID, ClientID: gc.ClientID, CollectionID: gc.ID, Op: ent.SyncOpUpsert, Fields: names}
+	case ent.OpRestore:
+		if gc == nil {
+			return nil
+		}
+		return &ent.SyncChange{UserID: gc.UserID, ClientID: gc.ClientID, CollectionID: gc.ID, Op: ent.SyncOpUpsert, Fields: []string{ent.SyncFieldDeleted}}
+	case ent.OpDelete:
+		if old == nil {
+			return nil
+		}
+		return &ent.SyncChange{UserID: old.UserID, ClientID: old.ClientID, CollectionID: old.ID, Op: ent.SyncOpDelete, Fields: []string{ent.SyncFieldDeleted}}
+	case ent.OpPurge:
+		// 削除の日時はゴミ箱に入れたときのまま残し、御朱印がなくなったことだけを記録します
+		if old == nil {
+			return nil
+		}
+		return &ent.SyncChange{UserID: old.UserID, ClientID: old.ClientID, Op: ent.SyncOpDelete, Fields: []string{}}
+	}
+	return nil
+}
+
+// Pull since より後の変更を最大 limit 件取得します。御朱印ごとに最新の変更だけを返します
+func (e *Engine) Pull(ctx context.Context, userID string, since int64, limit int) (*Page, error) {
+	page := &Page{Changes: []*Change{}, Cursor: since}
+
+	latest, err := e.client.Sync.LatestSeq(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if since > latest {
+		since, page.Cursor, page.Reset = 0, 0, true
+	}
+
+	changes, err := e.client.Sync.Changes(ctx, userID, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > limit {
+		changes, page.HasMore = changes[:limit], true
+	}
+
+	for _, sc := range changes {
+		change := &Change{SyncChange: sc}
+		if sc.Op == ent.SyncOpUpsert {
+			gc, err := e.client.GoshuinCollection.GetByClientID(ctx, userID, sc.ClientID)
+			if err != nil {
+				return nil, err
+			}
+			if gc == nil || gc.DeletedAt != "" {
+				// 記録と読み取りの間に削除された場合は、次の取得で削除として届きます
+				sc.Op = ent.SyncOpDelete
+			} else {
+				change.Collection = gc
+				clocks, err := e.client.Sync.Clocks(ctx, userID, sc.ClientID)
+				if err != nil {
+					return nil, err
+				}
+				change.Clocks = formatClocks(clocks)
+			}
+		}
+		page.Changes = append(page.Changes, change)
+		page.Cursor = sc.Seq
+	}
+	return page, nil
+}
+
+// formatClocks 項目ごとの変更日時を formatClock の文字列にします
+func formatClocks(clocks map[string]time.Time) map[string]string {
+	formatted := make(map[string]string, len(clocks))
+	for name, at := range clocks {
+		formatted[name] = formatClock(at)
+	}
+	return formatted
+}
+
+// formatClock 変更日時を RFC 3339（UTC、ミリ秒まで）の文字列にします
+func formatClock(at time.Time) string {
+	return at.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// Push 端末の変更を順番に適用し、1件ごとの結果を返します
+// 変更1件ごとに、適用・変更ログへの記録・結果の保存を1つのトランザクションで行います
+// 適用済みの ID の変更は再び適用せず、保存しておいた結果を返すため、同じ送信を何度繰り返しても
+// 結果は変わりません。エラーで中断した場合も、それまでの結果は保存されているので再送できます
+func (e *Engine) Push(ctx context.Context, userID string, mutations []Mutation) ([]*Result, error) {
+	ctx = context.WithValue(ctx, pushKey{}, true)
+	results := make([]*Result, 0, len(mutations))
+	for _, m := range mutations {
+		if !ent.ValidUUID(m.ID) {
+			results = append(results, invalid(m, "id must be a lower-case UUID"))
+			continue
+		}
+
+		var res *Result
+		err := e.client.WithTx(ctx, func(tx *ent.Client) error {
+			var err error
+			res, err = e.pushOne(ctx, tx, userID, m)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// pushOne 変更1件をトランザクションのクライアント tx で適用し、結果を保存します
+// 適用済みの変更であれば、保存しておいた結果を返します
+// 変更の ID を先に記録するため、同じ変更が別のインスタンスに並行して再送されても、
+// 後のトランザクションは先のトランザクションの終了を待ち、保存された結果を返します
+func (e *Engine) pushOne(ctx context.Context, tx *ent.Client, userID string, m Mutation) (*Result, error) {
+	claimed, err := tx.Sync.ClaimMutation(ctx, userID, m.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		stored, _, err := tx.Sync.MutationResult(ctx, userID, m.ID)
+		if err != nil {
+			return nil, err
+		}
+		var res Result
+		if err := json.Unmarshal([]byte(stored), &res); err != nil {
+			return nil, fmt.Errorf("failed to decode sync mutation result: %v", err)
+		}
+		res.Replayed = true
+		return &res, nil
+	}
+
+	res, err := e.apply(ctx, tx, userID, m)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sync mutation result: %v", err)
+	}
+	if err := tx.Sync.SaveMutationResult(ctx, userID, m.ID, string(encoded)); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// invalid 不正な変更の結果を返します
+func invalid(m Mutation, msg string) *Result {
+	return &Result{MutationID: m.ID, ClientID: m.ClientID, Status: StatusInvalid, Applied: []string{}, Error: msg}
+}
+
+// apply 変更1件を適用します
+func (e *Engine) apply(ctx context.Context, tx *ent.Client, userID string, m Mutation) (*Result, error) {
+	if !ent.ValidUUID(m.ClientID) {
+		return invalid(m, "client_id must be a lower-case UUID"), nil
+	}
+	changedAt, err := parseTime(m.ChangedAt)
+	if err != nil {
+		return invalid(m, "changed_at must be RFC 3339 with a UTC offset"), nil
+	}
+	// 時計が進んでいる端末の変更が、以降のすべての変更に勝ち続けないようにします
+	now := e.clock.Now()
+	if changedAt.After(now) {
+		changedAt = now
+	}
+
+	clocks, err := tx.Sync.Clocks(ctx, userID, m.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	gc, err := tx.GoshuinCollection.GetByClientID(ctx, userID, m.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch m.Op {
+	case ent.SyncOpDelete:
+		return e.applyDelete(ctx, tx, userID, m, gc, clocks, changedAt)
+	case ent.SyncOpUpsert:
+		values := map[string]interface{}{}
+		for name, raw := range m.Fields {
+			f, ok := fieldByName(name)
+			if !ok {
+				return invalid(m, fmt.Sprintf("unknown field %q", name)), nil
+			}
+			v, err := f.parse(raw, now)
+			if err != nil {
+				return invalid(m, fmt.Sprintf("%s %v", name, err)), nil
+			}
+			values[name] = v
+		}
+		if gc == nil {
+			return e.applyCreate(ctx, tx, userID, m, values, clocks, changedAt)
+		}
+		return e.applyUpdate(ctx, tx, userID, m, gc, values, clocks, changedAt)
+	}
+	return invalid(m, "op must be upsert or delete"), nil
+}
+
+// applyCreate 端末で作成された御朱印を作成します
+func (e *Engine) applyCreate(ctx context.Context, tx *ent.Client, userID string, m Mutation, values map[string]interface{}, clocks map[string]time.Time, changedAt time.Time) (*Result, error) {
+	// 完全に削除された御朱印への、削除より前の変更では作り直しません
+	if deletedAt, ok := clocks[ent.SyncFieldDeleted]; ok && !changedAt.After(deletedAt) {
+		return deletedConflict(m, deletedAt), nil
+	}
+	if m.TempleID <= 0 {
+		return invalid(m, "temple_id is required to create a collection"), nil
+	}
+	if _, err := tx.Temple.Get(ctx, m.TempleID); err != nil {
+		return invalid(m, "temple not found"), nil
+	}
+
+	gc := &ent.GoshuinCollection{Tags: []string{}, CollectedAt: changedAt.Format(time.RFC3339)}
+	for _, f := range fields {
+		if v, ok := values[f.name]; ok {
+			f.put(gc, v)
+		}
+	}
+	collectedAt, _ := time.Parse(time.RFC3339, gc.CollectedAt)
+
+	created, err := tx.GoshuinCollection.Create().
+		SetUserID(userID).
+		SetClientID(m.ClientID).
+		SetTempleID(m.TempleID).
+		SetImageURL(gc.ImageURL).
+		SetNotes(gc.Notes).
+		SetTags(gc.Tags).
+		SetDetails(gc.Rating, gc.FeePaid, gc.WaitingMinutes, gc.HallName).
+		SetCollectedAt(collectedAt).
+		Save(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 作成時の値は送られなかった項目も含めてすべて端末の変更日時のものです
+	return e.record(ctx, tx, userID, m, created, ent.SyncOpUpsert, fieldNames(), nil, changedAt)
+}
+
+// applyUpdate 既存の御朱印に、サーバーより新しい項目だけを適用します
+func (e *Engine) applyUpdate(ctx context.Context, tx *ent.Client, userID string, m Mutation, gc *ent.GoshuinCollection, values map[string]interface{}, clocks map[string]time.Time, changedAt time.Time) (*Result, error) {
+	if m.TempleID != 0 && m.TempleID != gc.TempleID {
+		return invalid(m, "temple_id cannot be changed"), nil
+	}
+
+	var applied []string
+	if gc.DeletedAt != "" {
+		deletedAt := clocks[ent.SyncFieldDeleted]
+		if !changedAt.After(deletedAt) {
+			return deletedConflict(m, deletedAt), nil
+		}
+		// 削除より後の変更なので、ゴミ箱から戻してから適用します
+		restored, err := tx.GoshuinCollection.Restore(ctx, gc.ID)
+		if err != nil {
+			return nil, err
+		}
+		gc, applied = restored, append(applied, ent.SyncFieldDeleted)
+	}
+
+	var conflicts []Conflict
+	update := tx.GoshuinCollection.UpdateOneID(gc.ID)
+	changed := false
+	for _, f := range fields {
+		v, ok := values[f.name]
+		if !ok {
+			continue
+		}
+		current := f.value(gc)
+		// 同じ日時の場合はサーバーの値を残します
+		if at, ok := clocks[f.name]; ok && !changedAt.After(at) {
+			if !reflect.DeepEqual(current, v) {
+				conflicts = append(conflicts, Conflict{
+					MutationID: m.ID, ClientID: m.ClientID, Field: f.name,
+					ClientValue: v, ServerValue: current, ServerChangedAt: formatClock(at),
+				})
+			}
+			continue
+		}
+		applied = append(applied, f.name)
+		if !reflect.DeepEqual(current, v) {
+			f.set(update, v)
+			changed = true
+		}
+	}
+
+	updated := gc
+	if changed {
+		var err error
+		if updated, err = update.Save(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return e.record(ctx, tx, userID, m, updated, ent.SyncOpUpsert, applied, conflicts, changedAt)
+}
+
+// applyDelete 御朱印をゴミ箱に入れます。削除より後にサーバーで変更された項目があれば削除しません
+func (e *Engine) applyDelete(ctx context.Context, tx *ent.Client, userID string, m Mutation, gc *ent.GoshuinCollection, clocks map[string]time.Time, changedAt time.Time) (*Result, error) {
+	if gc == nil || gc.DeletedAt != "" {
+		// すでに削除されています
+		return &Result{MutationID: m.ID, ClientID: m.ClientID, Status: StatusApplied, Applied: []string{}}, nil
+	}
+
+	var newest time.Time
+	for name, at := range clocks {
+		if name != ent.SyncFieldDeleted && at.After(newest) {
+			newest = at
+		}
+	}
+	if !newest.IsZero() && !changedAt.After(newest) {
+		return &Result{
+			MutationID: m.ID, ClientID: m.ClientID, Status: StatusConflict, CollectionID: gc.ID, Applied: []string{},
+			Conflicts: []Conflict{{
+				MutationID: m.ID, ClientID: m.ClientID, Field: ent.SyncFieldDeleted,
+				ClientValue: true, ServerValue: false, ServerChangedAt: formatClock(newest),
+			}},
+		}, nil
+	}
+
+	if err := tx.GoshuinCollection.DeleteOneID(gc.ID).Exec(ctx); err != nil {
+		return nil, err
+	}
+	return e.record(ctx, tx, userID, m, gc, ent.SyncOpDelete, []string{ent.SyncFieldDeleted}, nil, changedAt)
+}
+
+// deletedConflict 削除より前の変更を適用しなかった結果を返します
+func deletedConflict(m Mutation, deletedAt time.Time) *Result {
+	return &Result{
+		MutationID: m.ID, ClientID: m.ClientID, Status: StatusConflict, Applied: []string{},
+		Conflicts: []Conflict{{
+			MutationID: m.ID, ClientID: m.ClientID, Field: ent.SyncFieldDeleted,
+			ClientValue: false, ServerValue: true, ServerChangedAt: formatClock(deletedAt),
+		}},
+	}
+}
+
+// record 適用した項目を変更ログに記録し、結果を返します
+func (e *Engine) record(ctx context.Context, tx *ent.Client, userID string, m Mutation, gc *ent.GoshuinCollection, op string, applied []string, conflicts []Conflict, changedAt time.Time) (*Result, error) {
+	res := &Result{MutationID: m.ID, ClientID: m.ClientID, Status: StatusApplied, CollectionID: gc.ID, Applied: applied, Conflicts: conflicts}
+	if res.Applied == nil {
+		res.Applied = []string{}
+	}
+	if len(conflicts) > 0 {
+		res.Status = StatusConflict
+	}
+	if len(applied) == 0 {
+		return res, nil
+	}
+
+	sort.Strings(res.Applied)
+	change, err := tx.Sync.Record(ctx, &ent.SyncChange{
+		UserID: userID, ClientID: m.ClientID, CollectionID: gc.ID, Op: op, Fields: res.Applied, MutationID: m.ID,
+	}, changedAt, e.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	res.Seq = change.Seq
+	return res, nil
+}
@@ -0,0 +1,268 @@
+package delta
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/database"
+	"stamp-backend/internal/ent"
+)
+
+// testNow テストのサーバーの現在時刻
+var testNow = time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+
+const (
+	testUser   = "user-1"
+	testClient = "3f1c2b7e-8a4d-4c3b-9e2f-1a2b3c4d5e6f"
+)
+
+func TestMain(m *testing.M) {
+	// マイグレーションのログでテストの出力が埋もれないようにします
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestEngine メモリ上の SQLite と寺社1件で同期エンジンを作成し、寺社IDを返します
+func newTestEngine(t *testing.T) (*Engine, *ent.Client, int) {
+	t.Helper()
+
+	client, err := database.OpenWithClock(map[string]string{"driver": "sqlite", "name": ":memory:"}, clock.Fixed(testNow))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	temple, err := client.Temple.Create().
+		SetName("浅草寺").
+		SetPrefecture("東京都").
+		SetKind("temple").
+		SetLatitude(35.7148).
+		SetLongitude(139.7967).
+		SetActive(true).
+		Save(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create temple: %v", err)
+	}
+	return New(client, clock.Fixed(testNow)), client, temple.ID
+}
+
+// notes notes だけを変更する upsert を作ります
+func notes(id string, changedAt time.Time, value string) Mutation {
+	raw, _ := json.Marshal(value)
+	return Mutation{
+		ID: id, ClientID: testClient, Op: ent.SyncOpUpsert,
+		ChangedAt: changedAt.Format(time.RFC3339), Fields: map[string]json.RawMessage{"notes": raw},
+	}
+}
+
+// push 変更1件を送信して結果を返します
+func push(t *testing.T, e *Engine, m Mutation) *Result {
+	t.Helper()
+
+	results, err := e.Push(context.Background(), testUser, []Mutation{m})
+	if err != nil {
+		t.Fatalf("push %s: %v", m.ID, err)
+	}
+	return results[0]
+}
+
+func TestPushLastWriterWins(t *testing.T) {
+	e, client, templeID := newTestEngine(t)
+	ctx := context.Background()
+	base := testNow.Add(-time.Hour)
+
+	create := notes("00000000-0000-4000-8000-000000000001", base, "first")
+	create.TempleID = templeID
+	created := push(t, e, create)
+	if created.Status != StatusApplied || created.Seq == 0 {
+		t.Fatalf("create = %+v; want applied with a seq", created)
+	}
+
+	newer := push(t, e, notes("00000000-0000-4000-8000-000000000002", base.Add(10*time.Minute), "newer"))
+	if newer.Status != StatusApplied || !reflect.DeepEqual(newer.Applied, []string{"notes"}) {
+		t.Errorf("newer = %+v; want notes applied", newer)
+	}
+	if newer.Seq <= created.Seq {
+		t.Errorf("newer seq = %d; want more than %d", newer.Seq, created.Seq)
+	}
+
+	// 古い変更と同じ日時の変更はサーバーの値を残します
+	for _, m := range []Mutation{
+		notes("00000000-0000-4000-8000-000000000003", base.Add(5*time.Minute), "older"),
+		notes("00000000-0000-4000-8000-000000000004", base.Add(10*time.Minute), "same time"),
+	} {
+		res := push(t, e, m)
+		if res.Status != StatusConflict || res.Seq != 0 || len(res.Applied) != 0 {
+			t.Errorf("%s = %+v; want a conflict without a seq", m.Fields["notes"], res)
+			continue
+		}
+		var value string
+		json.Unmarshal(m.Fields["notes"], &value)
+		want := Conflict{
+			MutationID: m.ID, ClientID: testClient, Field: "notes",
+			ClientValue: value, ServerValue: "newer",
+			ServerChangedAt: "2024-06-01T02:10:00.000Z",
+		}
+		if !reflect.DeepEqual(res.Conflicts, []Conflict{want}) {
+			t.Errorf("%s conflicts = %+v; want %+v", m.Fields["notes"], res.Conflicts, want)
+		}
+	}
+
+	gc, err := client.GoshuinCollection.GetByClientID(ctx, testUser, testClient)
+	if err != nil || gc == nil {
+		t.Fatalf("collection not found: %v", err)
+	}
+	if gc.Notes != "newer" {
+		t.Errorf("notes = %q; want newer", gc.Notes)
+	}
+
+	// 未来の変更日時はサーバーの現在時刻として扱います
+	future := push(t, e, notes("00000000-0000-4000-8000-000000000005", testNow.Add(24*time.Hour), "future"))
+	if future.Status != StatusApplied {
+		t.Fatalf("future = %+v; want applied", future)
+	}
+	clocks, err := client.Sync.Clocks(ctx, testUser, testClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !clocks["notes"].Equal(testNow) {
+		t.Errorf("notes clock = %s; want %s", clocks["notes"], testNow)
+	}
+}
+
+func TestPushReplaysAppliedMutation(t *testing.T) {
+	e, _, templeID := newTestEngine(t)
+
+	m := notes("00000000-0000-4000-8000-000000000001", testNow.Add(-time.Hour), "first")
+	m.TempleID = templeID
+	first := push(t, e, m)
+
+	// 適用後に内容を変えて再送しても、保存しておいた結果を返します
+	m.Fields["notes"] = json.RawMessage(`"changed"`)
+	replayed := push(t, e, m)
+	if !replayed.Replayed {
+		t.Errorf("replayed = %+v; want Replayed", replayed)
+	}
+	replayed.Replayed = false
+	if !reflect.DeepEqual(replayed, first) {
+		t.Errorf("replayed = %+v; want %+v", replayed, first)
+	}
+
+	page, err := e.Pull(context.Background(), testUser, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Changes) != 1 || page.Cursor != first.Seq {
+		t.Fatalf("page = %d changes, cursor %d; want 1 change, cursor %d", len(page.Changes), page.Cursor, first.Seq)
+	}
+	if got := page.Changes[0].Collection.Notes; got != "first" {
+		t.Errorf("pulled notes = %q; want first", got)
+	}
+}
+
+func TestPushConcurrentReplay(t *testing.T) {
+	e, _, templeID := newTestEngine(t)
+
+	m := notes("00000000-0000-4000-8000-000000000001", testNow.Add(-time.Hour), "first")
+	m.TempleID = templeID
+
+	// 同じ変更を並行して送信しても、適用は1回で、もう一方は保存された結果を返します
+	results := make([]*Result, 4)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := e.Push(context.Background(), testUser, []Mutation{m})
+			if err != nil {
+				t.Errorf("push: %v", err)
+				return
+			}
+			results[i] = res[0]
+		}(i)
+	}
+	wg.Wait()
+
+	applied := 0
+	for _, res := range results {
+		if res == nil {
+			t.FailNow()
+		}
+		if !res.Replayed {
+			applied++
+		}
+		if res.Status != StatusApplied || res.Seq != results[0].Seq {
+			t.Errorf("result = %+v; want applied with seq %d", res, results[0].Seq)
+		}
+	}
+	if applied != 1 {
+		t.Errorf("applied %d times; want 1", applied)
+	}
+}
+
+func TestPushDeleteAndRecreate(t *testing.T) {
+	e, client, templeID := newTestEngine(t)
+	base := testNow.Add(-time.Hour)
+
+	m := notes("00000000-0000-4000-8000-000000000001", base, "first")
+	m.TempleID = templeID
+	push(t, e, m)
+
+	// サーバーの変更より前の削除は適用しません
+	early := Mutation{ID: "00000000-0000-4000-8000-000000000002", ClientID: testClient, Op: ent.SyncOpDelete, ChangedAt: base.Format(time.RFC3339)}
+	if res := push(t, e, early); res.Status != StatusConflict {
+		t.Errorf("early delete = %+v; want conflict", res)
+	}
+
+	del := early
+	del.ID, del.ChangedAt = "00000000-0000-4000-8000-000000000003", base.Add(10*time.Minute).Format(time.RFC3339)
+	if res := push(t, e, del); res.Status != StatusApplied {
+		t.Fatalf("delete = %+v; want applied", res)
+	}
+
+	// 削除より前の変更は戻さず、後の変更はゴミ箱から戻して適用します
+	if res := push(t, e, notes("00000000-0000-4000-8000-000000000004", base.Add(5*time.Minute), "stale")); res.Status != StatusConflict {
+		t.Errorf("stale = %+v; want conflict", res)
+	}
+	res := push(t, e, notes("00000000-0000-4000-8000-000000000005", base.Add(20*time.Minute), "restored"))
+	if res.Status != StatusApplied || !reflect.DeepEqual(res.Applied, []string{ent.SyncFieldDeleted, "notes"}) {
+		t.Errorf("restore = %+v; want deleted and notes applied", res)
+	}
+	gc, err := client.GoshuinCollection.GetByClientID(context.Background(), testUser, testClient)
+	if err != nil || gc == nil || gc.DeletedAt != "" || gc.Notes != "restored" {
+		t.Errorf("collection = %+v, %v; want restored", gc, err)
+	}
+}
+
+func TestPushInvalid(t *testing.T) {
+	e, _, templeID := newTestEngine(t)
+	at := testNow.Add(-time.Hour).Format(time.RFC3339)
+
+	cases := []struct {
+		name string
+		m    Mutation
+	}{
+		{"id", Mutation{ID: "not-a-uuid", ClientID: testClient, Op: ent.SyncOpUpsert, ChangedAt: at}},
+		{"client id", Mutation{ID: "00000000-0000-4000-8000-000000000001", ClientID: "X", Op: ent.SyncOpUpsert, ChangedAt: at}},
+		{"changed at", Mutation{ID: "00000000-0000-4000-8000-000000000002", ClientID: testClient, Op: ent.SyncOpUpsert, ChangedAt: "2024-06-01 02:00"}},
+		{"op", Mutation{ID: "00000000-0000-4000-8000-000000000003", ClientID: testClient, Op: "merge", ChangedAt: at}},
+		{"field", Mutation{ID: "00000000-0000-4000-8000-000000000004", ClientID: testClient, Op: ent.SyncOpUpsert, ChangedAt: at, TempleID: templeID,
+			Fields: map[string]json.RawMessage{"user_id": json.RawMessage(`"other"`)}}},
+		{"rating", Mutation{ID: "00000000-0000-4000-8000-000000000005", ClientID: testClient, Op: ent.SyncOpUpsert, ChangedAt: at, TempleID: templeID,
+			Fields: map[string]json.RawMessage{"rating": json.RawMessage(`6`)}}},
+		{"temple", Mutation{ID: "00000000-0000-4000-8000-000000000006", ClientID: testClient, Op: ent.SyncOpUpsert, ChangedAt: at}},
+	}
+	for _, c := range cases {
+		if res := push(t, e, c.m); res.Status != StatusInvalid || res.Error == "" {
+			t.Errorf("%s: result = %+v; want invalid", c.name, res)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package delta
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"stamp-backend/internal/ent"
+)
+
+// maxClockSkew 端末の時計のずれとして許容する未来方向の誤差
+const maxClockSkew = 5 * time.Minute
+
+// field 同期できる御朱印の項目
+type field struct {
+	name string
+	// value 御朱印の現在の値を parse と同じ型で返します
+	value func(gc *ent.GoshuinCollection) interface{}
+	// parse 端末から送られた値を検証して正規化します
+	parse func(raw json.RawMessage, now time.Time) (interface{}, error)
+	// set 正規化した値を更新に設定します
+	set func(u *ent.GoshuinCollectionUpdateOneID, v interface{})
+	// put 正規化した値を作成する御朱印に設定します
+	put func(gc *ent.GoshuinCollection, v interface{})
+}
+
+// fields 同期できる項目（temple_id は作成時のみ指定でき、御朱印帳は REST API で扱います）
+var fields = []field{
+	{
+		name:  "image_url",
+		value: func(gc *ent.GoshuinCollection) interface{} { return gc.ImageURL },
+		parse: parseString,
+		set:   func(u *ent.GoshuinCollectionUpdateOneID, v interface{}) { u.SetImageURL(v.(string)) },
+		put:   func(gc *ent.GoshuinCollection, v interface{}) { gc.ImageURL = v.(string) },
+	},
+	{
+		name:  "notes",
+		value: func(gc *ent.GoshuinCollection) interface{} { return gc.Notes },
+		parse: parseString,
+		set:   func(u *ent.GoshuinCollectionUpdateOneID, v interface{}) { u.SetNotes(v.(string)) },
+		put:   func(gc *ent.GoshuinCollection, v interface{}) { gc.Notes = v.(string) },
+	},
+	{
+		name:  "tags",
+		value: func(gc *ent.GoshuinCollection) interface{} { return ent.NormalizeTags(gc.Tags) },
+		parse: func(raw json.RawMessage, _ time.Time) (interface{}, error) {
+			var tags []string
+			if err := json.Unmarshal(raw, &tags); err != nil {
+				return nil, fmt.Errorf("must be a list of strings")
+			}
+			return ent.NormalizeTags(tags), nil
+		},
+		set: func(u *ent.GoshuinCollectionUpdateOneID, v interface{}) { u.SetTags(v.([]string)) },
+		put: func(gc *ent.GoshuinCollection, v interface{}) { gc.Tags = v.([]string) },
+	},
+	{
+		name:  "rating",
+		value: func(gc *ent.GoshuinCollection) interface{} { return gc.Rating },
+		parse: parseInt(0, 5),
+		set:   func(u *ent.GoshuinCollectionUpdateOneID, v interface{}) { u.SetRating(v.(int)) },
+		put:   func(gc *ent.GoshuinCollection, v interface{}) { gc.Rating = v.(int) },
+	},
+	{
+		name:  "fee_paid",
+		value: func(gc *ent.GoshuinCollection) interface{} { return gc.FeePaid },
+		parse: parseInt(0, -1),
+		set:   func(u *ent.GoshuinCollectionUpdateOneID, v interface{}) { u.SetFeePaid(v.(int)) },
+		put:   func(gc *ent.GoshuinCollection, v interface{}) { gc.FeePaid = v.(int) },
+	},
+	{
+		name:  "waiting_minutes",
+		value: func(gc *ent.GoshuinCollection) interface{} { return gc.WaitingMinutes },
+		parse: parseInt(0, -1),
+		set:   func(u *ent.GoshuinCollectionUpdateOneID, v interface{}) { u.SetWaitingMinutes(v.(int)) },
+		put:   func(gc *ent.GoshuinCollection, v interface{}) { gc.WaitingMinutes = v.(int) },
+	},
+	{
+		name:  "hall_name",
+		value: func(gc *ent.GoshuinCollection) interface{} { return gc.HallName },
+		parse: func(raw json.RawMessage, now time.Time) (interface{}, error) {
+			s, err := parseString(raw, now)
+			if err != nil {
+				return nil, err
+			}
+			return strings.TrimSpace(s.(string)), nil
+		},
+		set: func(u *ent.GoshuinCollectionUpdateOneID, v interface{}) { u.SetHallName(v.(string)) },
+		put: func(gc *ent.GoshuinCollection, v interface{}) { gc.HallName = v.(string) },
+	},
+	{
+		name:  "collected_at",
+		value: func(gc *ent.GoshuinCollection) interface{} { return gc.CollectedAt },
+		parse: func(raw json.RawMessage, now time.Time) (interface{}, error) {
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return nil, fmt.Errorf("must be a string")
+			}
+			t, err := parseTime(s)
+			if err != nil {
+				return nil, fmt.Errorf("must be RFC 3339 with a UTC offset")
+			}
+			if t.After(now.Add(maxClockSkew)) {
+				return nil, fmt.Errorf("must not be in the future")
+			}
+			if t.Year() < 1970 {
+				return nil, fmt.Errorf("is too old")
+			}
+			// 秒未満は保存されないため、比較できるよう切り捨てておく
+			return t.Truncate(time.Second).Format(time.RFC3339), nil
+		},
+		set: func(u *ent.GoshuinCollectionUpdateOneID, v interface{}) {
+			t, _ := time.Parse(time.RFC3339, v.(string))
+			u.SetCollectedAt(t)
+		},
+		put: func(gc *ent.GoshuinCollection, v interface{}) { gc.CollectedAt = v.(string) },
+	},
+}
+
+// fieldByName 項目名から同期できる項目を探します
+func fieldByName(name string) (field, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// fieldNames 同期できる項目名の一覧を返します
+func fieldNames() []string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	return names
+}
+
+// changedFields 変更前後で値が変わった項目名を返します
+func changedFields(before, after *ent.GoshuinCollection) []string {
+	var names []string
+	for _, f := range fields {
+		if !reflect.DeepEqual(f.value(before), f.value(after)) {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// parseString 文字列の値を読み取ります
+func parseString(raw json.RawMessage, _ time.Time) (interface{}, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("must be a string")
+	}
+	return s, nil
+}
+
+// parseInt lo 以上 hi 以下（hi が負なら上限なし）の整数を読み取る関数を返します
+func parseInt(lo, hi int) func(json.RawMessage, time.Time) (interface{}, error) {
+	return func(raw json.RawMessage, _ time.Time) (interface{}, error) {
+		var n int
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		if n < lo || (hi >= 0 && n > hi) {
+			if hi < 0 {
+				return nil, fmt.Errorf("must not be negative")
+			}
+			return nil, fmt.Errorf("must be between %d and %d", lo, hi)
+		}
+		return n, nil
+	}
+}
+
+// parseTime オフセット付きの RFC 3339 の日時（秒未満も可）を読み取ります
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
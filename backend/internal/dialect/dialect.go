@@ -0,0 +1,256 @@
+// Package dialect データベースごとのSQLの違いを吸収します
+//
+// クエリとマイグレーションは MySQL の構文で書き、ここで SQLite・PostgreSQL 向けに書き換えます。
+// 関数や構文が方言ごとに異なる箇所は、クエリを組み立てるときに Dialect のメソッドで生成します。
+package dialect
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 方言の名前（DB_DRIVER に指定する値）
+const (
+	NameMySQL    = "mysql"
+	NameSQLite   = "sqlite"
+	NamePostgres = "postgres"
+)
+
+// Dialect データベースごとのSQLの違い
+type Dialect interface {
+	// Name 方言の名前
+	Name() string
+	// Driver database/sql のドライバー名
+	Driver() string
+	// Rebind ? のプレースホルダーをこの方言の書き方に変えます
+	Rebind(query string) string
+	// Schema MySQL で書いたスキーマ変更の文を、この方言で実行する文に書き換えます
+	Schema(stmt string) []string
+	// Returning 自動採番した値を INSERT ... RETURNING で受け取るか（LastInsertId が使えない方言）
+	Returning() bool
+	// ForUpdate SELECT で読んだ行をトランザクションの終わりまでロックする句（不要な方言では空）
+	ForUpdate() string
+	// Greatest 2つの値の大きい方
+	Greatest(a, b string) string
+	// GroupConcat グループの expr を orderBy の順に sep でつないだ文字列
+	GroupConcat(expr, orderBy, sep string) string
+	// InsertIgnore INSERT 文を、一意キーが重複する行は挿入せずに無視する文にします
+	InsertIgnore(insert string) string
+	// Upsert INSERT 文を、keys が重複する場合は updates の列を挿入する値で更新する文にします
+	Upsert(insert string, keys, updates []string) string
+	// Like 大文字・小文字を区別しない LIKE 演算子
+	Like() string
+	// FormatDate 日時を layout（%Y・%m・%d）の文字列にする式
+	FormatDate(expr, layout string) string
+	// AddMinutes 日時に minutes 分を足す式
+	AddMinutes(expr, minutes string) string
+}
+
+// MySQL・SQLite・PostgreSQL の方言
+var (
+	MySQL    Dialect = mysql{}
+	SQLite   Dialect = sqlite{}
+	Postgres Dialect = postgres{}
+)
+
+// Get 名前から方言を返します。空の場合は MySQL です
+func Get(name string) (Dialect, error) {
+	switch strings.ToLower(name) {
+	case "", NameMySQL:
+		return MySQL, nil
+	case NameSQLite, "sqlite3":
+		return SQLite, nil
+	case NamePostgres, "postgresql", "pgx":
+		return Postgres, nil
+	}
+	return nil, fmt.Errorf("unknown database driver %q (use mysql, sqlite or postgres)", name)
+}
+
+// Execer *sql.DB と *sql.Tx に共通のメソッド
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// InsertID INSERT 文を実行し、自動採番された key 列の値を返します
+// 行が挿入されなかった場合（InsertIgnore で無視された場合）は 0 を返します
+func InsertID(ctx context.Context, db Execer, d Dialect, key, query string, args ...interface{}) (int64, error) {
+	if d.Returning() {
+		var id int64
+		err := db.QueryRowContext(ctx, d.Rebind(query+" RETURNING "+key), args...).Scan(&id)
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return id, err
+	}
+
+	result, err := db.ExecContext(ctx, d.Rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return 0, nil
+	}
+	return result.LastInsertId()
+}
+
+// rebindDollar ? を $1, $2, ... に置き換えます。文字列リテラルと識別子の引用符の中は置き換えません
+func rebindDollar(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// dateLayout %Y・%m・%d の書式を置き換えます
+func dateLayout(layout string, year, month, day string) string {
+	return strings.NewReplacer("%Y", year, "%m", month, "%d", day).Replace(layout)
+}
+
+// mysql MySQL 8.0 の方言。クエリは MySQL で書いているため、書き換えません
+type mysql struct{}
+
+func (mysql) Name() string                { return NameMySQL }
+func (mysql) Driver() string              { return "mysql" }
+func (mysql) Rebind(query string) string  { return query }
+func (mysql) Schema(stmt string) []string { return []string{stmt} }
+func (mysql) Returning() bool             { return false }
+func (mysql) ForUpdate() string           { return " FOR UPDATE" }
+func (mysql) Like() string                { return "LIKE" }
+
+func (mysql) Greatest(a, b string) string {
+	return "GREATEST(" + a + ", " + b + ")"
+}
+
+func (mysql) GroupConcat(expr, orderBy, sep string) string {
+	return "GROUP_CONCAT(" + expr + " ORDER BY " + orderBy + " SEPARATOR " + quote(sep) + ")"
+}
+
+func (mysql) InsertIgnore(insert string) string {
+	return "INSERT IGNORE" + strings.TrimPrefix(strings.TrimSpace(insert), "INSERT")
+}
+
+func (mysql) Upsert(insert string, keys, updates []string) string {
+	sets := make([]string, len(updates))
+	for i, col := range updates {
+		sets[i] = col + " = VALUES(" + col + ")"
+	}
+	return insert + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+func (mysql) FormatDate(expr, layout string) string {
+	return "DATE_FORMAT(" + expr + ", " + quote(layout) + ")"
+}
+
+func (mysql) AddMinutes(expr, minutes string) string {
+	return "DATE_ADD(" + expr + ", INTERVAL " + minutes + " MINUTE)"
+}
+
+// sqlite SQLite 3.45 の方言（modernc.org/sqlite）。書き込みは1接続ずつのため行ロックは不要です
+type sqlite struct{}
+
+func (sqlite) Name() string                { return NameSQLite }
+func (sqlite) Driver() string              { return "sqlite" }
+func (sqlite) Rebind(query string) string  { return query }
+func (sqlite) Schema(stmt string) []string { return translateSchema(stmt, sqliteSchema) }
+func (sqlite) Returning() bool             { return false }
+func (sqlite) ForUpdate() string           { return "" }
+func (sqlite) Like() string                { return "LIKE" }
+
+func (sqlite) Greatest(a, b string) string {
+	return "MAX(" + a + ", " + b + ")"
+}
+
+func (sqlite) GroupConcat(expr, orderBy, sep string) string {
+	return "GROUP_CONCAT(" + expr + ", " + quote(sep) + " ORDER BY " + orderBy + ")"
+}
+
+func (sqlite) InsertIgnore(insert string) string {
+	return insert + " ON CONFLICT DO NOTHING"
+}
+
+func (sqlite) Upsert(insert string, keys, updates []string) string {
+	return upsertExcluded(insert, keys, updates)
+}
+
+func (sqlite) FormatDate(expr, layout string) string {
+	return "strftime(" + quote(layout) + ", " + expr + ")"
+}
+
+func (sqlite) AddMinutes(expr, minutes string) string {
+	return "datetime(" + expr + ", (" + minutes + ") || ' minutes')"
+}
+
+// postgres PostgreSQL 13 以降の方言（github.com/lib/pq）
+type postgres struct{}
+
+func (postgres) Name() string                { return NamePostgres }
+func (postgres) Driver() string              { return "postgres" }
+func (postgres) Rebind(query string) string  { return rebindDollar(query) }
+func (postgres) Schema(stmt string) []string { return translateSchema(stmt, postgresSchema) }
+func (postgres) Returning() bool             { return true }
+func (postgres) ForUpdate() string           { return " FOR UPDATE" }
+func (postgres) Like() string                { return "ILIKE" }
+
+func (postgres) Greatest(a, b string) string {
+	return "GREATEST(" + a + ", " + b + ")"
+}
+
+func (postgres) GroupConcat(expr, orderBy, sep string) string {
+	return "STRING_AGG(" + expr + ", " + quote(sep) + " ORDER BY " + orderBy + ")"
+}
+
+func (postgres) InsertIgnore(insert string) string {
+	return insert + " ON CONFLICT DO NOTHING"
+}
+
+func (postgres) Upsert(insert string, keys, updates []string) string {
+	return upsertExcluded(insert, keys, updates)
+}
+
+func (postgres) FormatDate(expr, layout string) string {
+	return "to_char(" + expr + ", " + quote(dateLayout(layout, "YYYY", "MM", "DD")) + ")"
+}
+
+func (postgres) AddMinutes(expr, minutes string) string {
+	return "(" + expr + " + (" + minutes + ") * INTERVAL '1 minute')"
+}
+
+// upsertExcluded SQLite・PostgreSQL の ON CONFLICT ... DO UPDATE を付けます
+func upsertExcluded(insert string, keys, updates []string) string {
+	sets := make([]string, len(updates))
+	for i, col := range updates {
+		sets[i] = col + " = excluded." + col
+	}
+	return insert + " ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+// quote 文字列リテラルにします
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,231 @@
+package dialect
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// compact 比較のために空白の連続を1つの空白にします
+func compact(stmts []string) []string {
+	out := make([]string, len(stmts))
+	for i, s := range stmts {
+		out[i] = strings.Join(strings.Fields(s), " ")
+	}
+	return out
+}
+
+func TestGet(t *testing.T) {
+	cases := []struct {
+		name string
+		want Dialect
+	}{
+		{"", MySQL},
+		{"mysql", MySQL},
+		{"SQLite", SQLite},
+		{"sqlite3", SQLite},
+		{"postgres", Postgres},
+		{"postgresql", Postgres},
+		{"pgx", Postgres},
+	}
+	for _, c := range cases {
+		got, err := Get(c.name)
+		if err != nil || got != c.want {
+			t.Errorf("Get(%q) = %v, %v; want %v", c.name, got, err, c.want)
+		}
+	}
+	if _, err := Get("oracle"); err == nil {
+		t.Error("Get(oracle) returned no error")
+	}
+}
+
+func TestRebind(t *testing.T) {
+	cases := []struct {
+		d     Dialect
+		query string
+		want  string
+	}{
+		{MySQL, "SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = ? AND b = ?"},
+		{SQLite, "SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = ? AND b = ?"},
+		{Postgres, "SELECT * FROM t WHERE a = ? AND b = ?", "SELECT * FROM t WHERE a = $1 AND b = $2"},
+		{Postgres, "SELECT * FROM t", "SELECT * FROM t"},
+		// 引用符の中の ? はプレースホルダーではありません
+		{Postgres, `SELECT '?', "a?b", ? FROM t WHERE c = 'it''s ?' AND d = ?`, `SELECT '?', "a?b", $1 FROM t WHERE c = 'it''s ?' AND d = $2`},
+	}
+	for _, c := range cases {
+		if got := c.d.Rebind(c.query); got != c.want {
+			t.Errorf("%s Rebind(%q) = %q; want %q", c.d.Name(), c.query, got, c.want)
+		}
+	}
+}
+
+func TestSchemaCreateTable(t *testing.T) {
+	stmt := `
+	CREATE TABLE IF NOT EXISTS photos (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		collection_id INT NOT NULL,
+		storage_key VARCHAR(255),
+		ratio DOUBLE,
+		kind TINYINT NOT NULL DEFAULT 0,
+		data LONGBLOB,
+		taken_at DATETIME,
+		created_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		UNIQUE KEY uniq_photos_key (storage_key(191)),
+		INDEX idx_photos_collection (collection_id, created_at),
+		FOREIGN KEY (collection_id) REFERENCES goshuin_collections(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+	cases := []struct {
+		d    Dialect
+		want []string
+	}{
+		{MySQL, []string{strings.Join(strings.Fields(stmt), " ")}},
+		{SQLite, []string{
+			"CREATE TABLE IF NOT EXISTS photos ( " +
+				"id INTEGER PRIMARY KEY AUTOINCREMENT, collection_id INT NOT NULL, storage_key VARCHAR(255), ratio DOUBLE, " +
+				"kind TINYINT NOT NULL DEFAULT 0, data LONGBLOB, taken_at DATETIME, created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, " +
+				"updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, CONSTRAINT uniq_photos_key UNIQUE (storage_key), " +
+				"FOREIGN KEY (collection_id) REFERENCES goshuin_collections(id) ON DELETE CASCADE )",
+			"CREATE INDEX IF NOT EXISTS idx_photos_collection ON photos (collection_id, created_at)",
+		}},
+		{Postgres, []string{
+			"CREATE TABLE IF NOT EXISTS photos ( " +
+				"id BIGSERIAL PRIMARY KEY, collection_id INT NOT NULL, storage_key VARCHAR(255), ratio DOUBLE PRECISION, " +
+				"kind SMALLINT NOT NULL DEFAULT 0, data BYTEA, taken_at TIMESTAMP, created_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP, " +
+				"updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, CONSTRAINT uniq_photos_key UNIQUE (storage_key), " +
+				"FOREIGN KEY (collection_id) REFERENCES goshuin_collections(id) ON DELETE CASCADE )",
+			"CREATE INDEX IF NOT EXISTS idx_photos_collection ON photos (collection_id, created_at)",
+		}},
+	}
+	for _, c := range cases {
+		if got := compact(c.d.Schema(stmt)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s Schema:\n got %q\nwant %q", c.d.Name(), got, c.want)
+		}
+	}
+}
+
+func TestSchemaAlterTable(t *testing.T) {
+	cases := []struct {
+		name string
+		stmt string
+		d    Dialect
+		want []string
+	}{
+		{
+			name: "columns",
+			stmt: `ALTER TABLE temples ADD COLUMN prefecture VARCHAR(16) NOT NULL DEFAULT '' AFTER address,
+				ADD COLUMN ratio DOUBLE`,
+			d: SQLite,
+			want: []string{
+				"ALTER TABLE temples ADD COLUMN prefecture VARCHAR(16) NOT NULL DEFAULT ''",
+				"ALTER TABLE temples ADD COLUMN ratio DOUBLE",
+			},
+		},
+		{
+			name: "columns",
+			stmt: `ALTER TABLE temples ADD COLUMN prefecture VARCHAR(16) NOT NULL DEFAULT '' AFTER address,
+				ADD COLUMN ratio DOUBLE`,
+			d:    Postgres,
+			want: []string{"ALTER TABLE temples ADD COLUMN prefecture VARCHAR(16) NOT NULL DEFAULT '', ADD COLUMN ratio DOUBLE PRECISION"},
+		},
+		{
+			name: "on update column",
+			stmt: `ALTER TABLE quiz_progress ADD COLUMN updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP`,
+			d:    SQLite,
+			want: []string{"ALTER TABLE quiz_progress ADD COLUMN updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP"},
+		},
+		{
+			name: "restrict foreign key",
+			stmt: `ALTER TABLE goshuin_collections ADD CONSTRAINT fk_goshuin_collections_temple
+				FOREIGN KEY (temple_id) REFERENCES temples(id) ON DELETE RESTRICT`,
+			d: SQLite,
+			want: []string{
+				"CREATE TRIGGER IF NOT EXISTS fk_goshuin_collections_temple BEFORE DELETE ON temples FOR EACH ROW " +
+					"WHEN EXISTS (SELECT 1 FROM goshuin_collections WHERE temple_id = OLD.id) BEGIN " +
+					"SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed'); END",
+			},
+		},
+		{
+			name: "set null foreign key",
+			stmt: `ALTER TABLE goshuin_collections ADD CONSTRAINT fk_goshuin_collections_book
+				FOREIGN KEY (book_id) REFERENCES goshuin_books(id) ON DELETE SET NULL`,
+			d: SQLite,
+			want: []string{
+				"CREATE TRIGGER IF NOT EXISTS fk_goshuin_collections_book AFTER DELETE ON goshuin_books FOR EACH ROW BEGIN " +
+					"UPDATE goshuin_collections SET book_id = NULL WHERE book_id = OLD.id; END",
+			},
+		},
+		{
+			name: "foreign key",
+			stmt: `ALTER TABLE goshuin_collections ADD CONSTRAINT fk_goshuin_collections_book
+				FOREIGN KEY (book_id) REFERENCES goshuin_books(id) ON DELETE SET NULL`,
+			d: Postgres,
+			want: []string{"ALTER TABLE goshuin_collections ADD CONSTRAINT fk_goshuin_collections_book " +
+				"FOREIGN KEY (book_id) REFERENCES goshuin_books(id) ON DELETE SET NULL"},
+		},
+		{
+			name: "other statements",
+			stmt: `CREATE INDEX idx_temples_prefecture ON temples (prefecture);`,
+			d:    Postgres,
+			want: []string{"CREATE INDEX idx_temples_prefecture ON temples (prefecture)"},
+		},
+	}
+	for _, c := range cases {
+		if got := compact(c.d.Schema(c.stmt)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s %s:\n got %q\nwant %q", c.d.Name(), c.name, got, c.want)
+		}
+	}
+}
+
+func TestQueryFragments(t *testing.T) {
+	const insert = "INSERT INTO translations (entity_type, entity_id, locale, value) VALUES (?, ?, ?, ?)"
+	keys, updates := []string{"entity_type", "entity_id", "locale"}, []string{"value"}
+
+	cases := []struct {
+		d                                           Dialect
+		ignore, upsert, concat, month, add, greater string
+	}{
+		{
+			d:       MySQL,
+			ignore:  "INSERT IGNORE INTO translations (entity_type, entity_id, locale, value) VALUES (?, ?, ?, ?)",
+			upsert:  insert + " ON DUPLICATE KEY UPDATE value = VALUES(value)",
+			concat:  "GROUP_CONCAT(tag ORDER BY tag SEPARATOR ',')",
+			month:   "DATE_FORMAT(collected_at, '%Y-%m')",
+			add:     "DATE_ADD(created_at, INTERVAL waiting_minutes MINUTE)",
+			greater: "GREATEST(a, b)",
+		},
+		{
+			d:       SQLite,
+			ignore:  insert + " ON CONFLICT DO NOTHING",
+			upsert:  insert + " ON CONFLICT (entity_type, entity_id, locale) DO UPDATE SET value = excluded.value",
+			concat:  "GROUP_CONCAT(tag, ',' ORDER BY tag)",
+			month:   "strftime('%Y-%m', collected_at)",
+			add:     "datetime(created_at, (waiting_minutes) || ' minutes')",
+			greater: "MAX(a, b)",
+		},
+		{
+			d:       Postgres,
+			ignore:  insert + " ON CONFLICT DO NOTHING",
+			upsert:  insert + " ON CONFLICT (entity_type, entity_id, locale) DO UPDATE SET value = excluded.value",
+			concat:  "STRING_AGG(tag, ',' ORDER BY tag)",
+			month:   "to_char(collected_at, 'YYYY-MM')",
+			add:     "(created_at + (waiting_minutes) * INTERVAL '1 minute')",
+			greater: "GREATEST(a, b)",
+		},
+	}
+	for _, c := range cases {
+		for _, got := range []struct{ name, got, want string }{
+			{"InsertIgnore", c.d.InsertIgnore(insert), c.ignore},
+			{"Upsert", c.d.Upsert(insert, keys, updates), c.upsert},
+			{"GroupConcat", c.d.GroupConcat("tag", "tag", ","), c.concat},
+			{"FormatDate", c.d.FormatDate("collected_at", "%Y-%m"), c.month},
+			{"AddMinutes", c.d.AddMinutes("created_at", "waiting_minutes"), c.add},
+			{"Greatest", c.d.Greatest("a", "b"), c.greater},
+		} {
+			if got.got != got.want {
+				t.Errorf("%s %s = %q; want %q", c.d.Name(), got.name, got.got, got.want)
+			}
+		}
+	}
+}
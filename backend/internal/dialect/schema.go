@@ -0,0 +1,187 @@
+package dialect
+
+import (
+	"regexp"
+	"strings"
+)
+
+// schemaRules MySQL のスキーマ変更を書き換える方言ごとの規則
+type schemaRules struct {
+	// types 列の型の書き換え（順に適用）
+	types []typeRule
+	// splitAlter ALTER TABLE の複数の変更を1つずつの文に分けるか
+	splitAlter bool
+	// foreignKey ALTER TABLE ... ADD CONSTRAINT ... FOREIGN KEY を書き換えます（nil の場合はそのまま）
+	foreignKey func(fk foreignKey) []string
+}
+
+// typeRule 列の定義の書き換え
+type typeRule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// foreignKey ALTER TABLE で追加する外部キー
+type foreignKey struct {
+	name, table, column, refTable, refColumn, onDelete string
+}
+
+var (
+	createTableRe = regexp.MustCompile(`(?is)^CREATE TABLE (IF NOT EXISTS )?(\w+) \((.*)\)[^)]*$`)
+	alterTableRe  = regexp.MustCompile(`(?is)^ALTER TABLE (\w+)\s+(.*)$`)
+	indexRe       = regexp.MustCompile(`(?is)^(INDEX|KEY) (\w+) \((.*)\)$`)
+	uniqueKeyRe   = regexp.MustCompile(`(?is)^UNIQUE (KEY|INDEX) (\w+) \((.*)\)$`)
+	foreignKeyRe  = regexp.MustCompile(`(?is)^ADD CONSTRAINT (\w+)\s+FOREIGN KEY \((\w+)\) REFERENCES (\w+)\s*\((\w+)\)(?:\s+ON DELETE (RESTRICT|CASCADE|SET NULL))?$`)
+	afterRe       = regexp.MustCompile(`(?i)\s+AFTER \w+$`)
+	onUpdateRe    = regexp.MustCompile(`(?i)\s+ON UPDATE CURRENT_TIMESTAMP`)
+	prefixLenRe   = regexp.MustCompile(`(\w+)\(\d+\)`)
+	spaceRe       = regexp.MustCompile(`\s+`)
+)
+
+var sqliteSchema = schemaRules{
+	types: []typeRule{
+		// INTEGER PRIMARY KEY だけが rowid の別名になり、自動採番されます
+		{regexp.MustCompile(`(?i)\b(BIG)?INT AUTO_INCREMENT PRIMARY KEY\b`), "INTEGER PRIMARY KEY AUTOINCREMENT"},
+		// ドライバーは宣言型が TIMESTAMP の列だけを time.Time として読みます
+		{regexp.MustCompile(`(?i)\bTIMESTAMP\(\d\)`), "TIMESTAMP"},
+	},
+	splitAlter: true,
+	// 既存のテーブルに外部キーを追加できないため、親の行を削除するときのトリガーで代わりにします
+	foreignKey: func(fk foreignKey) []string {
+		switch fk.onDelete {
+		case "SET NULL":
+			return []string{`CREATE TRIGGER IF NOT EXISTS ` + fk.name + ` AFTER DELETE ON ` + fk.refTable + ` FOR EACH ROW BEGIN
+				UPDATE ` + fk.table + ` SET ` + fk.column + ` = NULL WHERE ` + fk.column + ` = OLD.` + fk.refColumn + `;
+			END`}
+		case "CASCADE":
+			return []string{`CREATE TRIGGER IF NOT EXISTS ` + fk.name + ` AFTER DELETE ON ` + fk.refTable + ` FOR EACH ROW BEGIN
+				DELETE FROM ` + fk.table + ` WHERE ` + fk.column + ` = OLD.` + fk.refColumn + `;
+			END`}
+		}
+		// RESTRICT はテーブル作成時の外部キー（CASCADE など）より先に判定されるよう BEFORE にします
+		return []string{`CREATE TRIGGER IF NOT EXISTS ` + fk.name + ` BEFORE DELETE ON ` + fk.refTable + ` FOR EACH ROW
+			WHEN EXISTS (SELECT 1 FROM ` + fk.table + ` WHERE ` + fk.column + ` = OLD.` + fk.refColumn + `) BEGIN
+				SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+			END`}
+	},
+}
+
+var postgresSchema = schemaRules{
+	types: []typeRule{
+		{regexp.MustCompile(`(?i)\bBIGINT AUTO_INCREMENT\b`), "BIGSERIAL"},
+		{regexp.MustCompile(`(?i)\bINT AUTO_INCREMENT\b`), "SERIAL"},
+		{regexp.MustCompile(`(?i)\bTINYINT\b`), "SMALLINT"},
+		{regexp.MustCompile(`(?i)\bDOUBLE\b`), "DOUBLE PRECISION"},
+		{regexp.MustCompile(`(?i)\b(MEDIUM|LONG)TEXT\b`), "TEXT"},
+		{regexp.MustCompile(`(?i)\b(MEDIUM|LONG)?BLOB\b`), "BYTEA"},
+		{regexp.MustCompile(`(?i)\bDATETIME\b`), "TIMESTAMP"},
+	},
+}
+
+// translateSchema MySQL のスキーマ変更を rules に従って書き換えます
+// CREATE TABLE と ALTER TABLE 以外の文（CREATE INDEX・UPDATE など）はそのまま返します
+func translateSchema(stmt string, rules schemaRules) []string {
+	stmt = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(stmt), ";"))
+	if m := createTableRe.FindStringSubmatch(stmt); m != nil {
+		return translateCreateTable(m[1], m[2], m[3], rules)
+	}
+	if m := alterTableRe.FindStringSubmatch(stmt); m != nil {
+		return translateAlterTable(m[1], m[2], rules)
+	}
+	return []string{stmt}
+}
+
+// translateCreateTable CREATE TABLE の列・制約を書き換え、テーブル内の INDEX は CREATE INDEX に分けます
+// ENGINE・CHARSET などのテーブルオプションは取り除きます
+func translateCreateTable(ifNotExists, table, body string, rules schemaRules) []string {
+	var defs, after []string
+	for _, def := range splitTopLevel(body) {
+		if m := indexRe.FindStringSubmatch(def); m != nil {
+			after = append(after, `CREATE INDEX `+ifNotExists+m[2]+` ON `+table+` (`+stripPrefixLengths(m[3])+`)`)
+			continue
+		}
+		if m := uniqueKeyRe.FindStringSubmatch(def); m != nil {
+			defs = append(defs, `CONSTRAINT `+m[2]+` UNIQUE (`+stripPrefixLengths(m[3])+`)`)
+			continue
+		}
+		defs = append(defs, translateColumn(def, rules))
+	}
+
+	create := `CREATE TABLE ` + ifNotExists + table + " (\n\t" + strings.Join(defs, ",\n\t") + "\n)"
+	return append([]string{create}, after...)
+}
+
+// translateAlterTable ALTER TABLE の変更を書き換えます
+func translateAlterTable(table, body string, rules schemaRules) []string {
+	var changes, stmts []string
+	for _, change := range splitTopLevel(body) {
+		if m := foreignKeyRe.FindStringSubmatch(spaceRe.ReplaceAllString(change, " ")); m != nil && rules.foreignKey != nil {
+			onDelete := strings.ToUpper(m[5])
+			if onDelete == "" {
+				onDelete = "RESTRICT"
+			}
+			stmts = append(stmts, rules.foreignKey(foreignKey{
+				name: m[1], table: table, column: m[2], refTable: m[3], refColumn: m[4], onDelete: onDelete,
+			})...)
+			continue
+		}
+		change = afterRe.ReplaceAllString(change, "")
+		changes = append(changes, translateColumn(change, rules))
+	}
+
+	if len(changes) == 0 {
+		return stmts
+	}
+	if rules.splitAlter {
+		alters := make([]string, len(changes))
+		for i, change := range changes {
+			alters[i] = `ALTER TABLE ` + table + ` ` + change
+		}
+		return append(alters, stmts...)
+	}
+	return append([]string{`ALTER TABLE ` + table + ` ` + strings.Join(changes, ", ")}, stmts...)
+}
+
+// translateColumn 列の定義の型を書き換えます
+// ON UPDATE CURRENT_TIMESTAMP は取り除きます。更新日時はクライアントが更新のたびに書き込みます
+func translateColumn(def string, rules schemaRules) string {
+	def = onUpdateRe.ReplaceAllString(def, "")
+	for _, rule := range rules.types {
+		def = rule.re.ReplaceAllString(def, rule.repl)
+	}
+	return def
+}
+
+// stripPrefixLengths INDEX の列のプレフィックス長（storage_key(191) など）を取り除きます
+func stripPrefixLengths(columns string) string {
+	return prefixLenRe.ReplaceAllString(columns, "$1")
+}
+
+// splitTopLevel 括弧の外のカンマで分け、前後の空白を取り除きます
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		parts = append(parts, rest)
+	}
+	return parts
+}
@@ -0,0 +1,268 @@
+package ent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditLog entity is an append-only record of a mutation. Each entry is chained to the
+// previous one by PrevHash, so editing or removing a row breaks the chain.
+type AuditLog struct {
+	ID        int64  `json:"id"`
+	Actor     string `json:"actor"`
+	ActorRole string `json:"actor_role,omitempty"`
+	// OnBehalfOf credits the user whose proposal the actor applied.
+	OnBehalfOf string `json:"on_behalf_of,omitempty"`
+	Action     string `json:"action"`
+	EntityType string `json:"entity_type"`
+	EntityID   int    `json:"entity_id"`
+	// Diff maps each changed field to its before and after values.
+	Diff      json.RawMessage `json:"diff"`
+	RequestID string          `json:"request_id,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	CreatedAt string          `json:"created_at"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
+
+// computeHash returns the SHA-256 of the entry's fields chained to prevHash.
+func (a *AuditLog) computeHash(prevHash string) string {
+	values := []interface{}{
+		prevHash, a.Actor, a.ActorRole, a.Action, a.EntityType, a.EntityID,
+		string(a.Diff), a.RequestID, a.IP, a.CreatedAt,
+	}
+	// on_behalf_of was added later; leaving it out when empty keeps older hashes valid.
+	if a.OnBehalfOf != "" {
+		values = append(values, a.OnBehalfOf)
+	}
+	fields, _ := json.Marshal(values)
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditLogFilter holds the search conditions for AuditLogClient.List.
+type AuditLogFilter struct {
+	Actor      string
+	Action     string
+	EntityType string
+	EntityID   int
+	RequestID  string
+	// From and To limit results to entries created in [From, To).
+	From time.Time
+	To   time.Time
+	// Limit defaults to 100; results are newest first.
+	Limit  int
+	Offset int
+}
+
+// AuditVerification is the result of checking the hash chain.
+type AuditVerification struct {
+	Valid   bool `json:"valid"`
+	Checked int  `json:"checked"`
+	// BrokenID is the first entry whose hash or link does not match. When entries were removed
+	// from the end of the log, it is the last entry left.
+	BrokenID int64 `json:"broken_id,omitempty"`
+}
+
+// AuditLogClient is a client for the AuditLog schema. It can only append and read entries.
+type AuditLogClient struct {
+	db dbtx
+}
+
+// auditLogColumns is the column list scanned by scanAuditLog.
+const auditLogColumns = `id, actor, COALESCE(actor_role, ''), COALESCE(on_behalf_of, ''), action, entity_type, entity_id, diff,
+	COALESCE(request_id, ''), COALESCE(ip, ''), created_at, prev_hash, hash`
+
+// scanAuditLog scans a row selected with auditLogColumns.
+func scanAuditLog(row rowScanner) (*AuditLog, error) {
+	var a AuditLog
+	var diff string
+	var createdAt time.Time
+	err := row.Scan(
+		&a.ID, &a.Actor, &a.ActorRole, &a.OnBehalfOf, &a.Action, &a.EntityType, &a.EntityID, &diff,
+		&a.RequestID, &a.IP, &createdAt, &a.PrevHash, &a.Hash,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan audit log: %v", err)
+	}
+	a.Diff = json.RawMessage(diff)
+	a.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	return &a, nil
+}
+
+// Append adds an entry to the end of the chain and returns it with its id and hashes.
+// CreatedAt is required and kept to the second, the precision of the column.
+//
+// The head of the chain is locked until the transaction the entry is appended in ends, so
+// appends made with a mutation's context are serialised with other mutations' appends.
+func (c *AuditLogClient) Append(ctx context.Context, entry *AuditLog) (*AuditLog, error) {
+	if entry.CreatedAt == "" {
+		return nil, fmt.Errorf("audit log time is required")
+	}
+	t, err := time.Parse(time.RFC3339, entry.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit log time: %v", err)
+	}
+	created := t.UTC().Truncate(time.Second)
+
+	a := *entry
+	a.CreatedAt = created.Format(time.RFC3339)
+	if len(a.Diff) == 0 {
+		a.Diff = json.RawMessage("{}")
+	}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	tx, err := begin(ctx, c.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin audit log transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// audit_log_head has a single row, so the lock also covers an empty log.
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_log_head WHERE id = 1`+tx.dialect().ForUpdate()).Scan(&a.PrevHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log head: %v", err)
+	}
+	a.Hash = a.computeHash(a.PrevHash)
+
+	a.ID, err = tx.insert(ctx, "id", `
+		INSERT INTO audit_logs (actor, actor_role, on_behalf_of, action, entity_type, entity_id, diff, request_id, ip, created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, a.Actor, nullString(a.ActorRole), nullString(a.OnBehalfOf), a.Action, a.EntityType, a.EntityID, string(a.Diff),
+		nullString(a.RequestID), nullString(a.IP), created, a.PrevHash, a.Hash,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append audit log: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE audit_log_head SET hash = ? WHERE id = 1`, a.Hash); err != nil {
+		return nil, fmt.Errorf("failed to move audit log head: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit audit log: %v", err)
+	}
+	return &a, nil
+}
+
+// List returns the entries matching the filter, newest first.
+func (c *AuditLogClient) List(ctx context.Context, f AuditLogFilter) ([]*AuditLog, error) {
+	logs := []*AuditLog{}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	var where []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		where = append(where, cond)
+		args = append(args, arg)
+	}
+	if f.Actor != "" {
+		add("actor = ?", f.Actor)
+	}
+	if f.Action != "" {
+		add("action = ?", f.Action)
+	}
+	if f.EntityType != "" {
+		add("entity_type = ?", f.EntityType)
+	}
+	if f.EntityID > 0 {
+		add("entity_id = ?", f.EntityID)
+	}
+	if f.RequestID != "" {
+		add("request_id = ?", f.RequestID)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= ?", f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		add("created_at < ?", f.To.UTC())
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	query := `SELECT ` + auditLogColumns + ` FROM audit_logs`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT %d", limit)
+	if f.Offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", f.Offset)
+	}
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit logs: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate audit logs: %v", err)
+	}
+	return logs, nil
+}
+
+// Verify walks the chain from the first entry and reports the first entry that was altered,
+// removed from before it, or inserted out of order. The chain must also pass through the head
+// read before the walk, so removing the newest entries is reported too; entries appended
+// during the walk come after the head and are checked like the others.
+func (c *AuditLogClient) Verify(ctx context.Context) (*AuditVerification, error) {
+	result := &AuditVerification{Valid: true}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	var head string
+	if err := c.db.QueryRowContext(ctx, `SELECT hash FROM audit_log_head WHERE id = 1`).Scan(&head); err != nil {
+		return nil, fmt.Errorf("failed to read audit log head: %v", err)
+	}
+
+	rows, err := c.db.QueryContext(ctx, `SELECT `+auditLogColumns+` FROM audit_logs ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit logs: %v", err)
+	}
+	defer rows.Close()
+
+	prev := ""
+	var last int64
+	reachedHead := head == ""
+	for rows.Next() {
+		a, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		result.Checked++
+		if a.PrevHash != prev || a.computeHash(prev) != a.Hash {
+			result.Valid = false
+			result.BrokenID = a.ID
+			return result, nil
+		}
+		prev, last = a.Hash, a.ID
+		reachedHead = reachedHead || prev == head
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate audit logs: %v", err)
+	}
+	if !reachedHead {
+		result.Valid = false
+		result.BrokenID = last
+	}
+	return result, nil
+}
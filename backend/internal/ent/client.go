@@ -3,168 +3,249 @@ package ent
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/dialect"
 )
 
 // Client is the client that holds all ent builders.
 type Client struct {
-	db *sql.DB
+	// conn is the database or transaction the sub-clients run on, or nil without a database.
+	conn  *conn
+	hooks *hooks
+	clock *clockSource
 	// Temple is the client for interacting with the Temple builders.
 	Temple *TempleClient
 	// GoshuinCollection is the client for interacting with the GoshuinCollection builders.
 	GoshuinCollection *GoshuinCollectionClient
+	// GoshuinBook is the client for interacting with the GoshuinBook builders.
+	GoshuinBook *GoshuinBookClient
+	// GoshuinPhoto is the client for interacting with the GoshuinPhoto builders.
+	GoshuinPhoto *GoshuinPhotoClient
+	// UserBadge is the client for the badges earned by users.
+	UserBadge *UserBadgeClient
+	// AuditLog is the client for the append-only audit log.
+	AuditLog *AuditLogClient
+	// TempleCorrection is the client for user-proposed temple corrections.
+	TempleCorrection *TempleCorrectionClient
+	// Notification is the client for user notifications.
+	Notification *NotificationClient
+	// TempleProposal is the client for user-proposed new temples.
+	TempleProposal *TempleProposalClient
+	// Translation is the client for translated field values.
+	Translation *TranslationClient
+	// Guide is the client for the guide sections and tips.
+	Guide *GuideClient
+	// Quiz is the client for the guide quizzes and learning progress.
+	Quiz *QuizClient
+	// RegionPack is the client for the versions of offline region packs.
+	RegionPack *RegionPackClient
+	// Sync is the client for the change log of offline goshuin collection sync.
+	Sync *SyncClient
+	// IdempotencyKey is the client for the stored responses of Idempotency-Key requests.
+	IdempotencyKey *IdempotencyKeyClient
 }
 
-// NewClient creates a new client configured with the given options.
+// NewClient creates a new client without a database. Temples and goshuin collections are kept
+// in memory; see NewMemoryRepositories.
 func NewClient() *Client {
-	return &Client{
-		Temple:            NewTempleClient(nil),
-		GoshuinCollection: NewGoshuinCollectionClient(nil),
-	}
+	return NewClientWithRepositories(NewMemoryRepositories())
 }
 
-// NewClientWithDB creates a new client with database connection.
+// NewClientWithDB creates a new client with a MySQL database connection.
+// A nil db creates a client without a database like NewClient.
 func NewClientWithDB(db *sql.DB) *Client {
+	return NewClientWithDialect(db, dialect.MySQL)
+}
+
+// NewClientWithDialect creates a new client with a database connection of the given dialect.
+// A nil db creates a client without a database like NewClient.
+func NewClientWithDialect(db *sql.DB, d dialect.Dialect) *Client {
+	if db == nil {
+		return NewClient()
+	}
+	return newClient(&conn{d: d, db: db})
+}
+
+// ErrNoDatabase is returned by the sub-clients that need a database when the client has none,
+// and by Tx. Only temples, goshuin collections and idempotency keys are kept without one.
+var ErrNoDatabase = errors.New("not supported without a database")
+
+// NewClientWithRepositories creates a new client without a database whose temples and goshuin
+// collections are stored in the given repositories. Idempotency keys are kept in memory. The
+// other sub-clients have nothing stored: their writes, and reads that would be wrong without
+// their data such as the statistics, return ErrNoDatabase. Tx returns ErrNoDatabase too.
+func NewClientWithRepositories(temples TempleRepository, collections GoshuinCollectionRepository) *Client {
+	c := newClient(nil)
+	c.Temple.repo = temples
+	c.GoshuinCollection.repo = collections
+	return c
+}
+
+// HasDatabase reports whether the client stores its data in a database. Without one, only
+// temples, goshuin collections and idempotency keys are kept; see NewClientWithRepositories.
+func (c *Client) HasDatabase() bool {
+	return c.conn != nil
+}
+
+// SetClock sets the clock the client takes the current time from for the timestamps it
+// writes, such as created_at and deleted_at. It is clock.System until set, and applies to
+// transactions started from the client as well.
+func (c *Client) SetClock(clk clock.Clock) {
+	c.clock.set(clk)
+}
+
+// clockSource is the clock shared by a client, its sub-clients and its transactions.
+type clockSource struct {
+	mu  sync.RWMutex
+	clk clock.Clock
+}
+
+func (s *clockSource) set(clk clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clk = clk
+}
+
+// now returns the current time in UTC at the precision of CURRENT_TIMESTAMP.
+func (s *clockSource) now() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clk.Now().UTC().Truncate(time.Second)
+}
+
+// newClient creates a client whose sub-clients share the connection and hooks.
+func newClient(cn *conn) *Client {
+	return buildClient(cn, &hooks{conn: cn}, &clockSource{clk: clock.System})
+}
+
+// buildClient creates a client whose sub-clients run their queries on cn and share the hooks
+// and the clock.
+func buildClient(cn *conn, h *hooks, clk *clockSource) *Client {
+	// A nil *conn must stay a nil dbtx so that the sub-clients know there is no database.
+	var db dbtx
+	if cn != nil {
+		db = cn
+	}
 	return &Client{
-		db:                db,
-		Temple:            NewTempleClient(db),
-		GoshuinCollection: NewGoshuinCollectionClient(db),
+		conn:              cn,
+		hooks:             h,
+		clock:             clk,
+		Temple:            newTempleClient(db, h, clk),
+		GoshuinCollection: newGoshuinCollectionClient(db, h, clk),
+		GoshuinBook:       &GoshuinBookClient{db: db, hooks: h, clock: clk},
+		GoshuinPhoto:      &GoshuinPhotoClient{db: db, hooks: h, clock: clk},
+		UserBadge:         &UserBadgeClient{db: db, hooks: h},
+		AuditLog:          &AuditLogClient{db: db},
+		TempleCorrection:  &TempleCorrectionClient{db: db, hooks: h, clock: clk},
+		Notification:      &NotificationClient{db: db, clock: clk},
+		TempleProposal:    &TempleProposalClient{db: db, hooks: h, clock: clk},
+		Translation:       &TranslationClient{db: db, hooks: h, clock: clk},
+		Guide:             &GuideClient{db: db, hooks: h, clock: clk},
+		Quiz:              &QuizClient{db: db, hooks: h, clock: clk},
+		RegionPack:        &RegionPackClient{db: db, clock: clk},
+		Sync:              &SyncClient{db: db},
+		IdempotencyKey:    newIdempotencyKeyClient(db),
 	}
 }
 
 // Close closes the database connection and prevents new queries from starting.
 func (c *Client) Close() error {
-	if c.db != nil {
-		return c.db.Close()
+	if c.conn != nil && c.conn.tx == nil {
+		return c.conn.db.Close()
 	}
 	return nil
 }
 
 // TempleClient is a client for the Temple schema.
 type TempleClient struct {
-	db *sql.DB
+	repo  TempleRepository
+	hooks *hooks
+	clock *clockSource
 }
 
 // NewTempleClient returns a client for the Temple from the given config.
 func NewTempleClient(db *sql.DB) *TempleClient {
-	return &TempleClient{db: db}
+	return NewClientWithDB(db).Temple
+}
+
+// newTempleClient returns a client for the Temple stored in the database db.
+func newTempleClient(db dbtx, h *hooks, clk *clockSource) *TempleClient {
+	return &TempleClient{repo: &sqlTempleRepository{db: db}, hooks: h, clock: clk}
 }
 
 // Create returns a builder for creating a Temple entity.
 func (c *TempleClient) Create() *TempleCreate {
-	return &TempleCreate{db: c.db}
+	return &TempleCreate{repo: c.repo, hooks: c.hooks, clock: c.clock}
 }
 
 // Query returns a query builder for Temple.
 func (c *TempleClient) Query() *TempleQuery {
-	return &TempleQuery{db: c.db}
+	return &TempleQuery{repo: c.repo}
 }
 
 // Get returns a Temple entity by its id.
 func (c *TempleClient) Get(ctx context.Context, id int) (*Temple, error) {
-	if c.db == nil {
-		// ダミーデータを返す
-		return &Temple{
-			ID:        id,
-			Name:      "浅草寺",
-			NameEn:    "Senso-ji Temple",
-			Latitude:  35.7148,
-			Longitude: 139.7967,
-		}, nil
-	}
-
-	query := `
-		SELECT id, name, name_en, description, description_en, latitude, longitude, 
-		       address, phone, website, instagram, twitter, opening_hours, 
-		       goshuin_fee, goshuin_office, is_active, created_at, updated_at
-		FROM temples WHERE id = ?
-	`
-
-	var temple Temple
-	var createdAt, updatedAt time.Time
-	err := c.db.QueryRowContext(ctx, query, id).Scan(
-		&temple.ID, &temple.Name, &temple.NameEn, &temple.Description, &temple.DescriptionEn,
-		&temple.Latitude, &temple.Longitude, &temple.Address, &temple.Phone,
-		&temple.Website, &temple.Instagram, &temple.Twitter, &temple.OpeningHours,
-		&temple.GoshuinFee, &temple.GoshuinOffice, &temple.IsActive, &createdAt, &updatedAt,
-	)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to get temple: %v", err)
-	}
-
-	temple.CreatedAt = createdAt.Format(time.RFC3339)
-	temple.UpdatedAt = updatedAt.Format(time.RFC3339)
-
-	return &temple, nil
+	return c.repo.Get(ctx, id)
 }
 
 // GoshuinCollectionClient is a client for the GoshuinCollection schema.
 type GoshuinCollectionClient struct {
-	db *sql.DB
+	repo GoshuinCollectionRepository
+	// db runs the statistics, tag and sync queries; nil without a database.
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
 }
 
 // NewGoshuinCollectionClient returns a client for the GoshuinCollection from the given config.
 func NewGoshuinCollectionClient(db *sql.DB) *GoshuinCollectionClient {
-	return &GoshuinCollectionClient{db: db}
+	return NewClientWithDB(db).GoshuinCollection
+}
+
+// newGoshuinCollectionClient returns a client for the GoshuinCollection stored in the database db.
+func newGoshuinCollectionClient(db dbtx, h *hooks, clk *clockSource) *GoshuinCollectionClient {
+	return &GoshuinCollectionClient{repo: &sqlGoshuinCollectionRepository{db: db}, db: db, hooks: h, clock: clk}
 }
 
 // Create returns a builder for creating a GoshuinCollection entity.
 func (c *GoshuinCollectionClient) Create() *GoshuinCollectionCreate {
-	return &GoshuinCollectionCreate{db: c.db}
+	return &GoshuinCollectionCreate{repo: c.repo, hooks: c.hooks, clock: c.clock}
 }
 
 // Query returns a query builder for GoshuinCollection.
 func (c *GoshuinCollectionClient) Query() *GoshuinCollectionQuery {
-	return &GoshuinCollectionQuery{db: c.db}
+	return &GoshuinCollectionQuery{repo: c.repo}
 }
 
 // Get returns a GoshuinCollection entity by its id.
 func (c *GoshuinCollectionClient) Get(ctx context.Context, id int) (*GoshuinCollection, error) {
-	if c.db == nil {
-		// ダミーデータを返す
-		return &GoshuinCollection{
-			ID:       id,
-			TempleID: 1,
-			ImageURL: "https://example.com/goshuin.jpg",
-			Notes:    "Beautiful goshuin stamp",
-		}, nil
-	}
-
-	query := `
-		SELECT id, temple_id, image_url, notes, collected_at, created_at, updated_at
-		FROM goshuin_collections WHERE id = ?
-	`
-
-	var collection GoshuinCollection
-	var collectedAt, createdAt, updatedAt time.Time
-	err := c.db.QueryRowContext(ctx, query, id).Scan(
-		&collection.ID, &collection.TempleID, &collection.ImageURL, &collection.Notes,
-		&collectedAt, &createdAt, &updatedAt,
-	)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to get goshuin collection: %v", err)
-	}
-
-	collection.CollectedAt = collectedAt.Format(time.RFC3339)
-	collection.CreatedAt = createdAt.Format(time.RFC3339)
-	collection.UpdatedAt = updatedAt.Format(time.RFC3339)
-
-	return &collection, nil
+	return c.repo.Get(ctx, id)
 }
 
 // UpdateOneID returns a builder for updating a GoshuinCollection entity.
 func (c *GoshuinCollectionClient) UpdateOneID(id int) *GoshuinCollectionUpdateOneID {
-	return &GoshuinCollectionUpdateOneID{db: c.db, id: id}
+	return &GoshuinCollectionUpdateOneID{repo: c.repo, hooks: c.hooks, clock: c.clock, id: id}
 }
 
-// DeleteOneID returns a builder for deleting a GoshuinCollection entity.
+// DeleteOneID returns a builder for moving a GoshuinCollection entity to the trash.
+// Use Restore to bring it back and Purge to delete it permanently.
 func (c *GoshuinCollectionClient) DeleteOneID(id int) *GoshuinCollectionDeleteOneID {
-	return &GoshuinCollectionDeleteOneID{db: c.db, id: id}
+	return &GoshuinCollectionDeleteOneID{repo: c.repo, hooks: c.hooks, clock: c.clock, id: id}
 }
 
+// Temple kinds.
+const (
+	TempleKindTemple = "temple"
+	TempleKindShrine = "shrine"
+)
+
 // Temple entity
 type Temple struct {
 	ID            int     `json:"id,omitempty"`
@@ -175,6 +256,8 @@ type Temple struct {
 	Latitude      float64 `json:"latitude,omitempty"`
 	Longitude     float64 `json:"longitude,omitempty"`
 	Address       string  `json:"address,omitempty"`
+	Prefecture    string  `json:"prefecture,omitempty"`
+	Kind          string  `json:"kind,omitempty"`
 	Phone         string  `json:"phone,omitempty"`
 	Website       string  `json:"website,omitempty"`
 	Instagram     string  `json:"instagram,omitempty"`
@@ -182,85 +265,191 @@ type Temple struct {
 	OpeningHours  string  `json:"opening_hours,omitempty"`
 	GoshuinFee    string  `json:"goshuin_fee,omitempty"`
 	GoshuinOffice string  `json:"goshuin_office,omitempty"`
-	IsActive      bool    `json:"is_active,omitempty"`
-	CreatedAt     string  `json:"created_at,omitempty"`
-	UpdatedAt     string  `json:"updated_at,omitempty"`
+	// Goshuin procedure at the temple; nil means not known yet.
+	ReservationRequired *bool `json:"reservation_required,omitempty"`
+	KakiokiOnly         *bool `json:"kakioki_only,omitempty"`
+	BookDropOff         *bool `json:"book_drop_off,omitempty"`
+	CashOnly            *bool `json:"cash_only,omitempty"`
+	// Photography is one of the Photography constants, or empty if not known.
+	Photography    string `json:"photography,omitempty"`
+	ProcedureNotes string `json:"procedure_notes,omitempty"`
+	IsActive       bool   `json:"is_active,omitempty"`
+	// ContributedBy is the user whose proposal added the temple.
+	ContributedBy string `json:"contributed_by,omitempty"`
+	CreatedAt     string `json:"created_at,omitempty"`
+	UpdatedAt     string `json:"updated_at,omitempty"`
+
+	// Localized holds the translatable fields in the requested language, set by the handlers.
+	Localized map[string]LocalizedValue `json:"localized,omitempty"`
 }
 
 // GoshuinCollection entity
 type GoshuinCollection struct {
-	ID          int    `json:"id,omitempty"`
-	TempleID    int    `json:"temple_id,omitempty"`
-	ImageURL    string `json:"image_url,omitempty"`
-	Notes       string `json:"notes,omitempty"`
-	CollectedAt string `json:"collected_at,omitempty"`
-	CreatedAt   string `json:"created_at,omitempty"`
-	UpdatedAt   string `json:"updated_at,omitempty"`
+	ID     int    `json:"id,omitempty"`
+	UserID string `json:"user_id,omitempty"`
+	// ClientID is the UUID the collection is known by on offline clients; see SyncClient.
+	ClientID string `json:"client_id,omitempty"`
+	TempleID int    `json:"temple_id,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	// Notes is Markdown.
+	Notes string `json:"notes,omitempty"`
+	// Tags are normalised with NormalizeTags and sorted.
+	Tags   []string `json:"tags"`
+	Rating int      `json:"rating,omitempty"`
+	// FeePaid is the amount actually paid in yen.
+	FeePaid        int    `json:"fee_paid,omitempty"`
+	WaitingMinutes int    `json:"waiting_minutes,omitempty"`
+	HallName       string `json:"hall_name,omitempty"`
+	BookID         int    `json:"book_id,omitempty"`
+	Page           int    `json:"page,omitempty"`
+	CollectedAt    string `json:"collected_at,omitempty"`
+	CreatedAt      string `json:"created_at,omitempty"`
+	UpdatedAt      string `json:"updated_at,omitempty"`
+	// DeletedAt is set while the collection is in the trash.
+	DeletedAt string `json:"deleted_at,omitempty"`
+
+	// Edges holds the relations loaded by the query.
+	Edges GoshuinCollectionEdges `json:"edges"`
+}
+
+// GoshuinCollectionEdges holds the relations of the GoshuinCollection entity.
+type GoshuinCollectionEdges struct {
+	// Temple is loaded by GoshuinCollectionQuery.WithTemple.
+	Temple *Temple `json:"temple,omitempty"`
+	// Photos are loaded by GoshuinPhotoClient.ListByCollection.
+	Photos []*GoshuinPhoto `json:"photos,omitempty"`
 }
 
 // TempleQuery is a query builder for Temple.
 type TempleQuery struct {
-	db *sql.DB
+	repo   TempleRepository
+	filter TempleFilter
+	limit  int
+	offset int
 }
 
-// All returns all temples.
-func (tq *TempleQuery) All(ctx context.Context) ([]*Temple, error) {
-	if tq.db == nil {
-		// ダミーデータを返す
-		return []*Temple{
-			{
-				ID:        1,
-				Name:      "浅草寺",
-				NameEn:    "Senso-ji Temple",
-				Latitude:  35.7148,
-				Longitude: 139.7967,
-			},
-			{
-				ID:        2,
-				Name:      "明治神宮",
-				NameEn:    "Meiji Shrine",
-				Latitude:  35.6764,
-				Longitude: 139.6993,
-			},
-		}, nil
-	}
-
-	query := `
-		SELECT id, name, name_en, description, description_en, latitude, longitude, 
-		       address, phone, website, instagram, twitter, opening_hours, 
-		       goshuin_fee, goshuin_office, is_active, created_at, updated_at
-		FROM temples WHERE is_active = TRUE
-		ORDER BY name
-	`
-
-	rows, err := tq.db.QueryContext(ctx, query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query temples: %v", err)
+// TempleFilter holds the search conditions for TempleQuery.
+type TempleFilter struct {
+	// Search matches name or name_en partially.
+	Search string
+	// BBox limits results to temples inside the bounding box.
+	BBox *BBox
+	// Prefecture limits results to the prefecture.
+	Prefecture string
+	// Kind limits results to temples or shrines.
+	Kind string
+	// IncludeInactive also returns temples with is_active = FALSE.
+	IncludeInactive bool
+	// Procedure limits results to temples whose procedure is known to match.
+	Procedure ProcedureFilter
+}
+
+// BBox is a latitude/longitude bounding box.
+type BBox struct {
+	MinLng float64
+	MinLat float64
+	MaxLng float64
+	MaxLat float64
+}
+
+// ParseBBox parses "minLng,minLat,maxLng,maxLat" into a BBox.
+func ParseBBox(s string) (*BBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox must be minLng,minLat,maxLng,maxLat")
 	}
-	defer rows.Close()
 
-	var temples []*Temple
-	for rows.Next() {
-		var temple Temple
-		var createdAt, updatedAt time.Time
-		err := rows.Scan(
-			&temple.ID, &temple.Name, &temple.NameEn, &temple.Description, &temple.DescriptionEn,
-			&temple.Latitude, &temple.Longitude, &temple.Address, &temple.Phone,
-			&temple.Website, &temple.Instagram, &temple.Twitter, &temple.OpeningHours,
-			&temple.GoshuinFee, &temple.GoshuinOffice, &temple.IsActive, &createdAt, &updatedAt,
-		)
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan temple: %v", err)
+			return nil, fmt.Errorf("invalid bbox value %q", p)
 		}
+		v[i] = f
+	}
 
-		temple.CreatedAt = createdAt.Format(time.RFC3339)
-		temple.UpdatedAt = updatedAt.Format(time.RFC3339)
-		temples = append(temples, &temple)
+	box := &BBox{MinLng: v[0], MinLat: v[1], MaxLng: v[2], MaxLat: v[3]}
+	if box.MinLng > box.MaxLng || box.MinLat > box.MaxLat {
+		return nil, fmt.Errorf("bbox minimum must not exceed maximum")
 	}
+	return box, nil
+}
+
+// Filter sets the search conditions of the query.
+func (tq *TempleQuery) Filter(f TempleFilter) *TempleQuery {
+	tq.filter = f
+	return tq
+}
+
+// Limit limits the number of temples returned.
+func (tq *TempleQuery) Limit(n int) *TempleQuery {
+	tq.limit = n
+	return tq
+}
+
+// Offset skips the first n temples.
+func (tq *TempleQuery) Offset(n int) *TempleQuery {
+	tq.offset = n
+	return tq
+}
 
+// All returns all temples.
+func (tq *TempleQuery) All(ctx context.Context) ([]*Temple, error) {
+	var temples []*Temple
+	err := tq.Each(ctx, func(t *Temple) error {
+		temples = append(temples, t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	return temples, nil
 }
 
+// Each calls fn for every temple without buffering the result set.
+func (tq *TempleQuery) Each(ctx context.Context, fn func(*Temple) error) error {
+	return tq.repo.Each(ctx, tq.filter, tq.limit, tq.offset, fn)
+}
+
+// templeColumns is the column list scanned by scanTemple.
+// Optional columns are coalesced because sample rows leave them NULL.
+const templeColumns = `id, name, name_en, COALESCE(description, ''), COALESCE(description_en, ''),
+		       latitude, longitude, COALESCE(address, ''), COALESCE(phone, ''), COALESCE(website, ''),
+		       COALESCE(instagram, ''), COALESCE(twitter, ''), COALESCE(opening_hours, ''),
+		       COALESCE(goshuin_fee, ''), COALESCE(goshuin_office, ''), prefecture, kind,
+		       reservation_required, kakioki_only, book_drop_off, cash_only, COALESCE(photography, ''),
+		       COALESCE(procedure_notes, ''), is_active, COALESCE(contributed_by, ''), created_at, updated_at`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// templeDest returns the scan destinations for templeColumns.
+func templeDest(temple *Temple, createdAt, updatedAt *time.Time) []interface{} {
+	return []interface{}{
+		&temple.ID, &temple.Name, &temple.NameEn, &temple.Description, &temple.DescriptionEn,
+		&temple.Latitude, &temple.Longitude, &temple.Address, &temple.Phone,
+		&temple.Website, &temple.Instagram, &temple.Twitter, &temple.OpeningHours,
+		&temple.GoshuinFee, &temple.GoshuinOffice, &temple.Prefecture, &temple.Kind,
+		&temple.ReservationRequired, &temple.KakiokiOnly, &temple.BookDropOff, &temple.CashOnly, &temple.Photography,
+		&temple.ProcedureNotes, &temple.IsActive, &temple.ContributedBy, createdAt, updatedAt,
+	}
+}
+
+// scanTemple scans a row selected with templeColumns.
+func scanTemple(row rowScanner) (*Temple, error) {
+	var temple Temple
+	var createdAt, updatedAt time.Time
+	if err := row.Scan(templeDest(&temple, &createdAt, &updatedAt)...); err != nil {
+		return nil, fmt.Errorf("failed to scan temple: %v", err)
+	}
+
+	temple.CreatedAt = createdAt.Format(time.RFC3339)
+	temple.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &temple, nil
+}
+
 // Where adds a predicate to the query.
 func (tq *TempleQuery) Where(conds ...interface{}) *TempleQuery {
 	return tq
@@ -283,46 +472,161 @@ func (tq *TempleQuery) Only(ctx context.Context) (*Temple, error) {
 
 // GoshuinCollectionQuery is a query builder for GoshuinCollection.
 type GoshuinCollectionQuery struct {
-	db *sql.DB
+	repo       GoshuinCollectionRepository
+	filter     GoshuinCollectionFilter
+	withTemple bool
+}
+
+// GoshuinCollectionFilter holds the search conditions for GoshuinCollectionQuery.
+type GoshuinCollectionFilter struct {
+	// UserID limits results to the collections owned by the user.
+	UserID string
+	// BookID limits results to the stamps in the goshuin book, ordered by page.
+	BookID int
+	// Tags limits results to the collections that have all of the tags.
+	Tags []string
+	// Rating limits results to the exact rating; MinRating to ratings at or above it.
+	Rating    int
+	MinRating int
+	// Trashed returns the collections in the trash instead, most recently deleted first.
+	Trashed bool
+	// DeletedBefore limits trashed results to those deleted before the time.
+	DeletedBefore time.Time
+}
+
+// Filter sets the search conditions of the query.
+func (gcq *GoshuinCollectionQuery) Filter(f GoshuinCollectionFilter) *GoshuinCollectionQuery {
+	gcq.filter = f
+	return gcq
+}
+
+// WithTemple eager-loads the temple of each collection into Edges.Temple.
+func (gcq *GoshuinCollectionQuery) WithTemple() *GoshuinCollectionQuery {
+	gcq.withTemple = true
+	return gcq
 }
 
 // All returns all goshuin collections.
 func (gcq *GoshuinCollectionQuery) All(ctx context.Context) ([]*GoshuinCollection, error) {
-	if gcq.db == nil {
-		return []*GoshuinCollection{}, nil
+	collections := []*GoshuinCollection{}
+	err := gcq.Each(ctx, func(gc *GoshuinCollection) error {
+		collections = append(collections, gc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return collections, nil
+}
 
-	query := `
-		SELECT id, temple_id, image_url, notes, collected_at, created_at, updated_at
-		FROM goshuin_collections
-		ORDER BY collected_at DESC
-	`
+// Each calls fn for every goshuin collection without buffering the result set.
+func (gcq *GoshuinCollectionQuery) Each(ctx context.Context, fn func(*GoshuinCollection) error) error {
+	return gcq.repo.Each(ctx, gcq.filter, gcq.withTemple, fn)
+}
 
-	rows, err := gcq.db.QueryContext(ctx, query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query goshuin collections: %v", err)
-	}
-	defer rows.Close()
-
-	var collections []*GoshuinCollection
-	for rows.Next() {
-		var collection GoshuinCollection
-		var collectedAt, createdAt, updatedAt time.Time
-		err := rows.Scan(
-			&collection.ID, &collection.TempleID, &collection.ImageURL, &collection.Notes,
-			&collectedAt, &createdAt, &updatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan goshuin collection: %v", err)
-		}
+// goshuinCollectionColumns is the column list scanned by scanGoshuinCollection.
+const goshuinCollectionColumns = `id, user_id, COALESCE(client_id, ''), temple_id, COALESCE(image_url, ''), COALESCE(notes, ''),
+		       COALESCE(rating, 0), COALESCE(fee_paid, 0), COALESCE(waiting_minutes, 0), COALESCE(hall_name, ''),
+		       COALESCE(book_id, 0), COALESCE(page, 0), collected_at, COALESCE(collected_tz_offset, 0), created_at, updated_at,
+		       deleted_at`
+
+// goshuinCollectionSelect returns goshuinCollectionColumns for the table alias followed by the tags.
+func goshuinCollectionSelect(d dialect.Dialect, alias string) string {
+	return prefixColumns(alias, goshuinCollectionColumns) + `,
+		(SELECT ` + d.GroupConcat("tag", "tag", ",") + ` FROM goshuin_collection_tags WHERE collection_id = ` + alias + `.id)`
+}
+
+// goshuinCollectionRow holds the scanned values that need converting before they are set on the entity.
+type goshuinCollectionRow struct {
+	tags                              sql.NullString
+	collectedAt, createdAt, updatedAt time.Time
+	deletedAt                         sql.NullTime
+	// offset is the UTC offset in minutes the stamp was recorded with.
+	offset int
+}
 
-		collection.CollectedAt = collectedAt.Format(time.RFC3339)
-		collection.CreatedAt = createdAt.Format(time.RFC3339)
-		collection.UpdatedAt = updatedAt.Format(time.RFC3339)
-		collections = append(collections, &collection)
+// goshuinCollectionDest returns the scan destinations for goshuinCollectionSelect.
+func goshuinCollectionDest(gc *GoshuinCollection, row *goshuinCollectionRow) []interface{} {
+	return []interface{}{
+		&gc.ID, &gc.UserID, &gc.ClientID, &gc.TempleID, &gc.ImageURL, &gc.Notes,
+		&gc.Rating, &gc.FeePaid, &gc.WaitingMinutes, &gc.HallName,
+		&gc.BookID, &gc.Page, &row.collectedAt, &row.offset, &row.createdAt, &row.updatedAt,
+		&row.deletedAt, &row.tags,
 	}
+}
 
-	return collections, nil
+// apply sets the converted values on the entity. collected_at is returned with its original offset.
+func (row *goshuinCollectionRow) apply(gc *GoshuinCollection) {
+	gc.Tags = splitTags(row.tags)
+	gc.CollectedAt = row.collectedAt.In(clock.Zone(row.offset)).Format(time.RFC3339)
+	gc.CreatedAt = row.createdAt.UTC().Format(time.RFC3339)
+	gc.UpdatedAt = row.updatedAt.UTC().Format(time.RFC3339)
+	if row.deletedAt.Valid {
+		gc.DeletedAt = row.deletedAt.Time.UTC().Format(time.RFC3339)
+	}
+}
+
+// splitTags converts the GROUP_CONCAT of the tags to a slice.
+func splitTags(tags sql.NullString) []string {
+	if !tags.Valid || tags.String == "" {
+		return []string{}
+	}
+	return strings.Split(tags.String, ",")
+}
+
+// scanGoshuinCollection scans a row selected with goshuinCollectionColumns.
+func scanGoshuinCollection(row rowScanner) (*GoshuinCollection, error) {
+	var collection GoshuinCollection
+	var values goshuinCollectionRow
+	if err := row.Scan(goshuinCollectionDest(&collection, &values)...); err != nil {
+		return nil, fmt.Errorf("failed to scan goshuin collection: %v", err)
+	}
+
+	values.apply(&collection)
+	return &collection, nil
+}
+
+// scanGoshuinCollectionWithTemple scans a row selected with goshuinCollectionColumns followed by templeColumns.
+func scanGoshuinCollectionWithTemple(row rowScanner) (*GoshuinCollection, error) {
+	var collection GoshuinCollection
+	var temple Temple
+	var values goshuinCollectionRow
+	var templeCreatedAt, templeUpdatedAt time.Time
+	dest := goshuinCollectionDest(&collection, &values)
+	dest = append(dest, templeDest(&temple, &templeCreatedAt, &templeUpdatedAt)...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, fmt.Errorf("failed to scan goshuin collection: %v", err)
+	}
+
+	values.apply(&collection)
+	temple.CreatedAt = templeCreatedAt.Format(time.RFC3339)
+	temple.UpdatedAt = templeUpdatedAt.Format(time.RFC3339)
+	collection.Edges.Temple = &temple
+	return &collection, nil
+}
+
+// prefixColumns qualifies every column of a column list with the table alias.
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, p := range parts {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "COALESCE(") {
+			p = "COALESCE(" + alias + "." + strings.TrimPrefix(p, "COALESCE(")
+		} else if !isLiteral(strings.TrimSuffix(p, ")")) {
+			p = alias + "." + p
+		}
+		parts[i] = p
+	}
+	return strings.Join(parts, ", ")
+}
+
+// isLiteral reports whether a column list item is a COALESCE default rather than a column.
+func isLiteral(s string) bool {
+	if s == "''" {
+		return true
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
 }
 
 // Where adds a predicate to the query.
@@ -347,7 +651,9 @@ func (gcq *GoshuinCollectionQuery) Only(ctx context.Context) (*GoshuinCollection
 
 // TempleCreate is a builder for creating a Temple entity.
 type TempleCreate struct {
-	db     *sql.DB
+	repo   TempleRepository
+	hooks  *hooks
+	clock  *clockSource
 	temple *Temple
 }
 
@@ -387,52 +693,139 @@ func (tc *TempleCreate) SetLongitude(lng float64) *TempleCreate {
 	return tc
 }
 
-// Save saves the temple to the database.
-func (tc *TempleCreate) Save(ctx context.Context) (*Temple, error) {
-	if tc.db == nil {
-		// ダミー実装
-		if tc.temple == nil {
-			tc.temple = &Temple{}
-		}
-		tc.temple.ID = 3 // 仮のID
-		return tc.temple, nil
+// SetPrefecture sets the prefecture field.
+func (tc *TempleCreate) SetPrefecture(prefecture string) *TempleCreate {
+	if tc.temple == nil {
+		tc.temple = &Temple{}
 	}
+	tc.temple.Prefecture = prefecture
+	return tc
+}
 
+// SetKind sets the kind field.
+func (tc *TempleCreate) SetKind(kind string) *TempleCreate {
 	if tc.temple == nil {
 		tc.temple = &Temple{}
 	}
+	tc.temple.Kind = kind
+	return tc
+}
 
-	query := `
-		INSERT INTO temples (name, name_en, description, description_en, latitude, longitude, 
-		                    address, phone, website, instagram, twitter, opening_hours, 
-		                    goshuin_fee, goshuin_office, is_active)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
+// SetDescription sets the description field.
+func (tc *TempleCreate) SetDescription(description string) *TempleCreate {
+	if tc.temple == nil {
+		tc.temple = &Temple{}
+	}
+	tc.temple.Description = description
+	return tc
+}
 
-	result, err := tc.db.ExecContext(ctx, query,
-		tc.temple.Name, tc.temple.NameEn, tc.temple.Description, tc.temple.DescriptionEn,
-		tc.temple.Latitude, tc.temple.Longitude, tc.temple.Address, tc.temple.Phone,
-		tc.temple.Website, tc.temple.Instagram, tc.temple.Twitter, tc.temple.OpeningHours,
-		tc.temple.GoshuinFee, tc.temple.GoshuinOffice, tc.temple.IsActive,
-	)
+// SetAddress sets the address field.
+func (tc *TempleCreate) SetAddress(address string) *TempleCreate {
+	if tc.temple == nil {
+		tc.temple = &Temple{}
+	}
+	tc.temple.Address = address
+	return tc
+}
 
+// SetWebsite sets the website field.
+func (tc *TempleCreate) SetWebsite(website string) *TempleCreate {
+	if tc.temple == nil {
+		tc.temple = &Temple{}
+	}
+	tc.temple.Website = website
+	return tc
+}
+
+// SetOpeningHours sets the opening_hours field.
+func (tc *TempleCreate) SetOpeningHours(openingHours string) *TempleCreate {
+	if tc.temple == nil {
+		tc.temple = &Temple{}
+	}
+	tc.temple.OpeningHours = openingHours
+	return tc
+}
+
+// SetGoshuinFee sets the goshuin_fee field.
+func (tc *TempleCreate) SetGoshuinFee(goshuinFee string) *TempleCreate {
+	if tc.temple == nil {
+		tc.temple = &Temple{}
+	}
+	tc.temple.GoshuinFee = goshuinFee
+	return tc
+}
+
+// SetActive sets the is_active field.
+func (tc *TempleCreate) SetActive(active bool) *TempleCreate {
+	if tc.temple == nil {
+		tc.temple = &Temple{}
+	}
+	tc.temple.IsActive = active
+	return tc
+}
+
+// SetContributedBy credits the user whose proposal the temple was created from.
+// The create mutation is recorded on behalf of that user.
+func (tc *TempleCreate) SetContributedBy(userID string) *TempleCreate {
+	if tc.temple == nil {
+		tc.temple = &Temple{}
+	}
+	tc.temple.ContributedBy = userID
+	return tc
+}
+
+// Save saves the temple to the repository.
+func (tc *TempleCreate) Save(ctx context.Context) (*Temple, error) {
+	if tc.temple == nil {
+		tc.temple = &Temple{}
+	}
+	if tc.temple.Kind == "" {
+		tc.temple.Kind = TempleKindTemple
+	}
+
+	ctx, mu, err := tc.hooks.begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temple: %v", err)
+		return nil, err
 	}
+	defer mu.rollback()
 
-	id, err := result.LastInsertId()
+	temple, err := tc.repo.Create(ctx, tc.temple, tc.clock.now())
 	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert id: %v", err)
+		return nil, err
 	}
 
-	tc.temple.ID = int(id)
-	return tc.temple, nil
+	if err := mu.commit(&Mutation{Op: OpCreate, Type: TypeTemple, ID: temple.ID, New: temple, OnBehalfOf: temple.ContributedBy}); err != nil {
+		return nil, err
+	}
+	return temple, nil
 }
 
 // GoshuinCollectionCreate is a builder for creating a GoshuinCollection entity.
 type GoshuinCollectionCreate struct {
-	db         *sql.DB
-	collection *GoshuinCollection
+	repo        GoshuinCollectionRepository
+	hooks       *hooks
+	clock       *clockSource
+	collection  *GoshuinCollection
+	collectedAt time.Time
+}
+
+// SetUserID sets the user_id field.
+func (gcc *GoshuinCollectionCreate) SetUserID(userID string) *GoshuinCollectionCreate {
+	if gcc.collection == nil {
+		gcc.collection = &GoshuinCollection{}
+	}
+	gcc.collection.UserID = userID
+	return gcc
+}
+
+// SetClientID sets the client_id field. A random UUID is used when unset.
+func (gcc *GoshuinCollectionCreate) SetClientID(clientID string) *GoshuinCollectionCreate {
+	if gcc.collection == nil {
+		gcc.collection = &GoshuinCollection{}
+	}
+	gcc.collection.ClientID = clientID
+	return gcc
 }
 
 // SetTempleID sets the temple_id field.
@@ -462,120 +855,225 @@ func (gcc *GoshuinCollectionCreate) SetNotes(notes string) *GoshuinCollectionCre
 	return gcc
 }
 
-// Save saves the goshuin collection to the database.
-func (gcc *GoshuinCollectionCreate) Save(ctx context.Context) (*GoshuinCollection, error) {
-	if gcc.db == nil {
-		// ダミー実装
-		if gcc.collection == nil {
-			gcc.collection = &GoshuinCollection{}
-		}
-		gcc.collection.ID = 1 // 仮のID
-		return gcc.collection, nil
+// SetTags sets the tags. They are normalised with NormalizeTags.
+func (gcc *GoshuinCollectionCreate) SetTags(tags []string) *GoshuinCollectionCreate {
+	if gcc.collection == nil {
+		gcc.collection = &GoshuinCollection{}
 	}
+	gcc.collection.Tags = NormalizeTags(tags)
+	return gcc
+}
 
+// SetDetails sets the rating, fee_paid, waiting_minutes and hall_name fields. Zero values leave the field empty.
+func (gcc *GoshuinCollectionCreate) SetDetails(rating, feePaid, waitingMinutes int, hallName string) *GoshuinCollectionCreate {
 	if gcc.collection == nil {
 		gcc.collection = &GoshuinCollection{}
 	}
+	gcc.collection.Rating = rating
+	gcc.collection.FeePaid = feePaid
+	gcc.collection.WaitingMinutes = waitingMinutes
+	gcc.collection.HallName = hallName
+	return gcc
+}
 
-	query := `
-		INSERT INTO goshuin_collections (temple_id, image_url, notes, collected_at)
-		VALUES (?, ?, ?, NOW())
-	`
+// SetBook sets the book_id and page fields. A zero value leaves the field empty.
+func (gcc *GoshuinCollectionCreate) SetBook(bookID, page int) *GoshuinCollectionCreate {
+	if gcc.collection == nil {
+		gcc.collection = &GoshuinCollection{}
+	}
+	gcc.collection.BookID = bookID
+	gcc.collection.Page = page
+	return gcc
+}
 
-	result, err := gcc.db.ExecContext(ctx, query,
-		gcc.collection.TempleID, gcc.collection.ImageURL, gcc.collection.Notes,
-	)
+// SetCollectedAt sets the collected_at field. It is stored in UTC together with the offset of t,
+// which is used when the time is read back. The client's current time in UTC is used when unset.
+func (gcc *GoshuinCollectionCreate) SetCollectedAt(t time.Time) *GoshuinCollectionCreate {
+	if gcc.collection == nil {
+		gcc.collection = &GoshuinCollection{}
+	}
+	gcc.collectedAt = t
+	gcc.collection.CollectedAt = t.Format(time.RFC3339)
+	return gcc
+}
 
+// Save saves the goshuin collection to the repository.
+func (gcc *GoshuinCollectionCreate) Save(ctx context.Context) (*GoshuinCollection, error) {
+	if gcc.collection == nil {
+		gcc.collection = &GoshuinCollection{}
+	}
+
+	now := gcc.clock.now()
+	collectedAt := gcc.collectedAt
+	if collectedAt.IsZero() {
+		collectedAt = now
+	}
+	if gcc.collection.ClientID == "" {
+		gcc.collection.ClientID = NewUUID()
+	}
+
+	ctx, mu, err := gcc.hooks.begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create goshuin collection: %v", err)
+		return nil, err
 	}
+	defer mu.rollback()
 
-	id, err := result.LastInsertId()
+	collection, err := gcc.repo.Create(ctx, gcc.collection, collectedAt, now)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert id: %v", err)
+		return nil, err
 	}
 
-	gcc.collection.ID = int(id)
-	return gcc.collection, nil
+	err = mu.commit(&Mutation{
+		Op: OpCreate, Type: TypeGoshuinCollection, ID: collection.ID, UserID: collection.UserID, New: collection,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return collection, nil
 }
 
 // GoshuinCollectionUpdateOneID is a builder for updating a GoshuinCollection entity.
 type GoshuinCollectionUpdateOneID struct {
-	db         *sql.DB
-	id         int
-	collection *GoshuinCollection
+	repo  GoshuinCollectionRepository
+	hooks *hooks
+	clock *clockSource
+	id    int
+	// change holds the fields set by the setters; only these fields are updated.
+	change GoshuinCollectionChange
 }
 
 // SetImageURL sets the image_url field.
 func (gcu *GoshuinCollectionUpdateOneID) SetImageURL(url string) *GoshuinCollectionUpdateOneID {
-	if gcu.collection == nil {
-		gcu.collection = &GoshuinCollection{}
-	}
-	gcu.collection.ImageURL = url
+	gcu.change.ImageURL = &url
 	return gcu
 }
 
 // SetNotes sets the notes field.
 func (gcu *GoshuinCollectionUpdateOneID) SetNotes(notes string) *GoshuinCollectionUpdateOneID {
-	if gcu.collection == nil {
-		gcu.collection = &GoshuinCollection{}
+	gcu.change.Notes = &notes
+	return gcu
+}
+
+// SetCollectedAt sets the collected_at field, keeping the offset of t like GoshuinCollectionCreate.SetCollectedAt.
+func (gcu *GoshuinCollectionUpdateOneID) SetCollectedAt(t time.Time) *GoshuinCollectionUpdateOneID {
+	gcu.change.CollectedAt = &t
+	return gcu
+}
+
+// SetTags replaces the tags. They are normalised with NormalizeTags.
+func (gcu *GoshuinCollectionUpdateOneID) SetTags(tags []string) *GoshuinCollectionUpdateOneID {
+	gcu.change.Tags = NormalizeTags(tags)
+	return gcu
+}
+
+// SetRating sets the rating field. Zero clears it.
+func (gcu *GoshuinCollectionUpdateOneID) SetRating(rating int) *GoshuinCollectionUpdateOneID {
+	gcu.change.Rating = &rating
+	return gcu
+}
+
+// SetFeePaid sets the fee_paid field. Zero clears it.
+func (gcu *GoshuinCollectionUpdateOneID) SetFeePaid(yen int) *GoshuinCollectionUpdateOneID {
+	gcu.change.FeePaid = &yen
+	return gcu
+}
+
+// SetWaitingMinutes sets the waiting_minutes field. Zero clears it.
+func (gcu *GoshuinCollectionUpdateOneID) SetWaitingMinutes(minutes int) *GoshuinCollectionUpdateOneID {
+	gcu.change.WaitingMinutes = &minutes
+	return gcu
+}
+
+// SetHallName sets the hall_name field.
+func (gcu *GoshuinCollectionUpdateOneID) SetHallName(name string) *GoshuinCollectionUpdateOneID {
+	gcu.change.HallName = &name
+	return gcu
+}
+
+// SetBook sets the book_id and page fields. A zero book ID removes the stamp from its book.
+func (gcu *GoshuinCollectionUpdateOneID) SetBook(bookID, page int) *GoshuinCollectionUpdateOneID {
+	if bookID == 0 {
+		page = 0
 	}
-	gcu.collection.Notes = notes
+	gcu.change.BookID = &bookID
+	gcu.change.Page = &page
 	return gcu
 }
 
-// Save saves the updated goshuin collection to the database.
+// Save saves the updated goshuin collection to the repository.
 func (gcu *GoshuinCollectionUpdateOneID) Save(ctx context.Context) (*GoshuinCollection, error) {
-	if gcu.db == nil {
-		// ダミー実装
-		if gcu.collection == nil {
-			gcu.collection = &GoshuinCollection{}
-		}
-		gcu.collection.ID = gcu.id
-		return gcu.collection, nil
+	ctx, mu, err := gcu.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
 	}
+	defer mu.rollback()
 
-	if gcu.collection == nil {
-		gcu.collection = &GoshuinCollection{}
+	var old *GoshuinCollection
+	if gcu.hooks.enabled() {
+		if old, err = gcu.repo.Get(ctx, gcu.id); err != nil {
+			return nil, err
+		}
 	}
 
-	query := `
-		UPDATE goshuin_collections 
-		SET image_url = ?, notes = ?, updated_at = NOW()
-		WHERE id = ?
-	`
-
-	_, err := gcu.db.ExecContext(ctx, query,
-		gcu.collection.ImageURL, gcu.collection.Notes, gcu.id,
-	)
+	if err := gcu.repo.Update(ctx, gcu.id, &gcu.change, gcu.clock.now()); err != nil {
+		return nil, err
+	}
 
+	collection, err := gcu.repo.Get(ctx, gcu.id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update goshuin collection: %v", err)
+		return nil, err
 	}
 
-	gcu.collection.ID = gcu.id
-	return gcu.collection, nil
+	var m *Mutation
+	if old != nil {
+		m = &Mutation{
+			Op: OpUpdate, Type: TypeGoshuinCollection, ID: gcu.id, UserID: collection.UserID, Old: old, New: collection,
+		}
+	}
+	if err := mu.commit(m); err != nil {
+		return nil, err
+	}
+	return collection, nil
 }
 
 // GoshuinCollectionDeleteOneID is a builder for deleting a GoshuinCollection entity.
 type GoshuinCollectionDeleteOneID struct {
-	db *sql.DB
-	id int
+	repo  GoshuinCollectionRepository
+	hooks *hooks
+	clock *clockSource
+	id    int
 }
 
-// Exec executes the delete operation.
+// Exec moves the collection to the trash. Its tags, photos and book page are kept for Restore.
 func (gcd *GoshuinCollectionDeleteOneID) Exec(ctx context.Context) error {
-	if gcd.db == nil {
-		// ダミー実装：何もしない
-		return nil
+	ctx, mu, err := gcd.hooks.begin(ctx)
+	if err != nil {
+		return err
 	}
+	defer mu.rollback()
 
-	query := `DELETE FROM goshuin_collections WHERE id = ?`
+	var old *GoshuinCollection
+	if gcd.hooks.enabled() {
+		if old, err = gcd.repo.Get(ctx, gcd.id); err != nil {
+			return err
+		}
+	}
 
-	_, err := gcd.db.ExecContext(ctx, query, gcd.id)
-	if err != nil {
-		return fmt.Errorf("failed to delete goshuin collection: %v", err)
+	if err := gcd.repo.Delete(ctx, gcd.id, gcd.clock.now()); err != nil {
+		return err
 	}
 
-	return nil
+	var m *Mutation
+	if old != nil {
+		m = &Mutation{Op: OpDelete, Type: TypeGoshuinCollection, ID: gcd.id, UserID: old.UserID, Old: old}
+	}
+	return mu.commit(m)
+}
+
+// nullInt converts a zero ID or number to NULL.
+func nullInt(n int) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return n
 }
@@ -0,0 +1,355 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Goshuin book types.
+const (
+	GoshuinBookTypeShrine = "shrine"
+	GoshuinBookTypeTemple = "temple"
+	GoshuinBookTypeMixed  = "mixed"
+)
+
+// dateLayout is the format of date-only fields.
+const dateLayout = "2006-01-02"
+
+// GoshuinBook entity is a physical goshuin-cho owned by a user.
+type GoshuinBook struct {
+	ID            int    `json:"id,omitempty"`
+	UserID        string `json:"user_id,omitempty"`
+	Title         string `json:"title,omitempty"`
+	CoverImageURL string `json:"cover_image_url,omitempty"`
+	Type          string `json:"type,omitempty"`
+	// Capacity is the number of pages in the book; zero means unknown.
+	Capacity  int    `json:"capacity,omitempty"`
+	StartedOn string `json:"started_on,omitempty"`
+	EndedOn   string `json:"ended_on,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+
+	// StampCount and LastPage are computed from the stamps in the book.
+	StampCount int `json:"stamp_count"`
+	LastPage   int `json:"last_page"`
+}
+
+// Accepts reports whether a stamp of the temple kind belongs in the book.
+func (b *GoshuinBook) Accepts(kind string) bool {
+	return b.Type == GoshuinBookTypeMixed || b.Type == "" || b.Type == kind
+}
+
+// GoshuinBookClient is a client for the GoshuinBook schema.
+type GoshuinBookClient struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+}
+
+// Create returns a builder for creating a GoshuinBook entity.
+func (c *GoshuinBookClient) Create() *GoshuinBookCreate {
+	return &GoshuinBookCreate{db: c.db, hooks: c.hooks, clock: c.clock, book: &GoshuinBook{Type: GoshuinBookTypeMixed}}
+}
+
+// UpdateOneID returns a builder for updating a GoshuinBook entity.
+func (c *GoshuinBookClient) UpdateOneID(id int) *GoshuinBookUpdateOneID {
+	return &GoshuinBookUpdateOneID{db: c.db, hooks: c.hooks, clock: c.clock, id: id, book: &GoshuinBook{}}
+}
+
+// DeleteOneID returns a builder for deleting a GoshuinBook entity.
+// Stamps in the book are kept and become unassigned.
+func (c *GoshuinBookClient) DeleteOneID(id int) *GoshuinBookDeleteOneID {
+	return &GoshuinBookDeleteOneID{db: c.db, hooks: c.hooks, id: id}
+}
+
+// goshuinBookSelect selects the book columns scanned by scanGoshuinBook.
+const goshuinBookSelect = `
+	SELECT b.id, b.user_id, b.title, COALESCE(b.cover_image_url, ''), b.type, b.capacity,
+	       b.started_on, b.ended_on, b.created_at, b.updated_at,
+	       COUNT(gc.id), COALESCE(MAX(gc.page), 0)
+	FROM goshuin_books b
+	LEFT JOIN goshuin_collections gc ON gc.book_id = b.id AND gc.deleted_at IS NULL
+`
+
+// scanGoshuinBook scans a row selected with goshuinBookSelect.
+func scanGoshuinBook(row rowScanner) (*GoshuinBook, error) {
+	var b GoshuinBook
+	var startedOn, endedOn sql.NullTime
+	var createdAt, updatedAt time.Time
+	err := row.Scan(
+		&b.ID, &b.UserID, &b.Title, &b.CoverImageURL, &b.Type, &b.Capacity,
+		&startedOn, &endedOn, &createdAt, &updatedAt,
+		&b.StampCount, &b.LastPage,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan goshuin book: %v", err)
+	}
+
+	if startedOn.Valid {
+		b.StartedOn = startedOn.Time.Format(dateLayout)
+	}
+	if endedOn.Valid {
+		b.EndedOn = endedOn.Time.Format(dateLayout)
+	}
+	b.CreatedAt = createdAt.Format(time.RFC3339)
+	b.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &b, nil
+}
+
+// Get returns a GoshuinBook entity by its id.
+func (c *GoshuinBookClient) Get(ctx context.Context, id int) (*GoshuinBook, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("goshuin book not found")
+	}
+
+	query := goshuinBookSelect + ` WHERE b.id = ? GROUP BY b.id`
+	book, err := scanGoshuinBook(c.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get goshuin book: %v", err)
+	}
+	return book, nil
+}
+
+// ListByUser returns the books of the user, oldest first.
+func (c *GoshuinBookClient) ListByUser(ctx context.Context, userID string) ([]*GoshuinBook, error) {
+	books := []*GoshuinBook{}
+	if c.db == nil {
+		return books, nil
+	}
+
+	query := goshuinBookSelect + ` WHERE b.user_id = ? GROUP BY b.id ORDER BY COALESCE(b.started_on, b.created_at), b.id`
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query goshuin books: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		book, err := scanGoshuinBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate goshuin books: %v", err)
+	}
+	return books, nil
+}
+
+// GoshuinBookCreate is a builder for creating a GoshuinBook entity.
+type GoshuinBookCreate struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+	book  *GoshuinBook
+}
+
+// SetUserID sets the user_id field.
+func (bc *GoshuinBookCreate) SetUserID(userID string) *GoshuinBookCreate {
+	bc.book.UserID = userID
+	return bc
+}
+
+// SetTitle sets the title field.
+func (bc *GoshuinBookCreate) SetTitle(title string) *GoshuinBookCreate {
+	bc.book.Title = title
+	return bc
+}
+
+// SetCoverImageURL sets the cover_image_url field.
+func (bc *GoshuinBookCreate) SetCoverImageURL(url string) *GoshuinBookCreate {
+	bc.book.CoverImageURL = url
+	return bc
+}
+
+// SetType sets the type field (shrine, temple or mixed).
+func (bc *GoshuinBookCreate) SetType(t string) *GoshuinBookCreate {
+	bc.book.Type = t
+	return bc
+}
+
+// SetCapacity sets the capacity field.
+func (bc *GoshuinBookCreate) SetCapacity(pages int) *GoshuinBookCreate {
+	bc.book.Capacity = pages
+	return bc
+}
+
+// SetPeriod sets the started_on and ended_on fields (YYYY-MM-DD, empty for none).
+func (bc *GoshuinBookCreate) SetPeriod(startedOn, endedOn string) *GoshuinBookCreate {
+	bc.book.StartedOn, bc.book.EndedOn = startedOn, endedOn
+	return bc
+}
+
+// Save saves the goshuin book to the database.
+func (bc *GoshuinBookCreate) Save(ctx context.Context) (*GoshuinBook, error) {
+	if bc.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	ctx, mu, err := bc.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	now := bc.clock.now()
+	id, err := bc.db.insert(ctx, "id", `
+		INSERT INTO goshuin_books (user_id, title, cover_image_url, type, capacity, started_on, ended_on,
+		                           created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, bc.book.UserID, bc.book.Title, bc.book.CoverImageURL, bc.book.Type, bc.book.Capacity,
+		nullString(bc.book.StartedOn), nullString(bc.book.EndedOn), now, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create goshuin book: %v", err)
+	}
+
+	book, err := (&GoshuinBookClient{db: bc.db}).Get(ctx, int(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mu.commit(&Mutation{Op: OpCreate, Type: TypeGoshuinBook, ID: book.ID, UserID: book.UserID, New: book}); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// GoshuinBookUpdateOneID is a builder for updating a GoshuinBook entity.
+type GoshuinBookUpdateOneID struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+	id    int
+	book  *GoshuinBook
+	sets  []string
+	args  []interface{}
+}
+
+// assign records a column assignment.
+func (bu *GoshuinBookUpdateOneID) assign(column string, value interface{}) *GoshuinBookUpdateOneID {
+	bu.sets = append(bu.sets, column+" = ?")
+	bu.args = append(bu.args, value)
+	return bu
+}
+
+// SetTitle sets the title field.
+func (bu *GoshuinBookUpdateOneID) SetTitle(title string) *GoshuinBookUpdateOneID {
+	bu.book.Title = title
+	return bu.assign("title", title)
+}
+
+// SetCoverImageURL sets the cover_image_url field.
+func (bu *GoshuinBookUpdateOneID) SetCoverImageURL(url string) *GoshuinBookUpdateOneID {
+	bu.book.CoverImageURL = url
+	return bu.assign("cover_image_url", url)
+}
+
+// SetType sets the type field.
+func (bu *GoshuinBookUpdateOneID) SetType(t string) *GoshuinBookUpdateOneID {
+	bu.book.Type = t
+	return bu.assign("type", t)
+}
+
+// SetCapacity sets the capacity field.
+func (bu *GoshuinBookUpdateOneID) SetCapacity(pages int) *GoshuinBookUpdateOneID {
+	bu.book.Capacity = pages
+	return bu.assign("capacity", pages)
+}
+
+// SetPeriod sets the started_on and ended_on fields (YYYY-MM-DD, empty for none).
+func (bu *GoshuinBookUpdateOneID) SetPeriod(startedOn, endedOn string) *GoshuinBookUpdateOneID {
+	bu.book.StartedOn, bu.book.EndedOn = startedOn, endedOn
+	bu.assign("started_on", nullString(startedOn))
+	return bu.assign("ended_on", nullString(endedOn))
+}
+
+// Save saves the updated goshuin book to the database.
+func (bu *GoshuinBookUpdateOneID) Save(ctx context.Context) (*GoshuinBook, error) {
+	if bu.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	ctx, mu, err := bu.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	client := &GoshuinBookClient{db: bu.db}
+	var old *GoshuinBook
+	if bu.hooks.enabled() {
+		if old, err = client.Get(ctx, bu.id); err != nil {
+			return nil, err
+		}
+	}
+
+	bu.assign("updated_at", bu.clock.now())
+	query := `UPDATE goshuin_books SET ` + strings.Join(bu.sets, ", ") + ` WHERE id = ?`
+	if _, err := bu.db.ExecContext(ctx, query, append(bu.args, bu.id)...); err != nil {
+		return nil, fmt.Errorf("failed to update goshuin book: %v", err)
+	}
+
+	book, err := client.Get(ctx, bu.id)
+	if err != nil {
+		return nil, err
+	}
+
+	var m *Mutation
+	if old != nil {
+		m = &Mutation{Op: OpUpdate, Type: TypeGoshuinBook, ID: bu.id, UserID: book.UserID, Old: old, New: book}
+	}
+	if err := mu.commit(m); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+// GoshuinBookDeleteOneID is a builder for deleting a GoshuinBook entity.
+type GoshuinBookDeleteOneID struct {
+	db    dbtx
+	hooks *hooks
+	id    int
+}
+
+// Exec executes the delete operation.
+func (bd *GoshuinBookDeleteOneID) Exec(ctx context.Context) error {
+	if bd.db == nil {
+		return ErrNoDatabase
+	}
+
+	ctx, mu, err := bd.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	var old *GoshuinBook
+	if bd.hooks.enabled() {
+		if old, err = (&GoshuinBookClient{db: bd.db}).Get(ctx, bd.id); err != nil {
+			return err
+		}
+	}
+
+	if _, err := bd.db.ExecContext(ctx, `DELETE FROM goshuin_books WHERE id = ?`, bd.id); err != nil {
+		return fmt.Errorf("failed to delete goshuin book: %v", err)
+	}
+
+	var m *Mutation
+	if old != nil {
+		m = &Mutation{Op: OpDelete, Type: TypeGoshuinBook, ID: bd.id, UserID: old.UserID, Old: old}
+	}
+	return mu.commit(m)
+}
+
+// nullString converts an empty string to NULL.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
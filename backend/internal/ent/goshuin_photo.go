@@ -0,0 +1,425 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Goshuin photo kinds.
+const (
+	GoshuinPhotoKindStamp   = "stamp"
+	GoshuinPhotoKindScenery = "scenery"
+	GoshuinPhotoKindReceipt = "receipt"
+)
+
+// GoshuinPhoto entity is a photo attached to a goshuin collection.
+// The URL of the cover photo is mirrored to GoshuinCollection.ImageURL.
+type GoshuinPhoto struct {
+	ID           int    `json:"id,omitempty"`
+	CollectionID int    `json:"collection_id,omitempty"`
+	Position     int    `json:"position"`
+	Caption      string `json:"caption,omitempty"`
+	Kind         string `json:"kind,omitempty"`
+	// StorageKey is empty for photos that are not in our storage (external URLs).
+	StorageKey string `json:"storage_key,omitempty"`
+	URL        string `json:"url,omitempty"`
+	IsCover    bool   `json:"is_cover"`
+	CreatedAt  string `json:"created_at,omitempty"`
+}
+
+// GoshuinPhotoClient is a client for the GoshuinPhoto schema.
+type GoshuinPhotoClient struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+}
+
+// goshuinPhotoColumns is the column list scanned by scanGoshuinPhoto.
+const goshuinPhotoColumns = `id, collection_id, position, COALESCE(caption, ''), kind,
+		       COALESCE(storage_key, ''), url, is_cover, created_at`
+
+// scanGoshuinPhoto scans a row selected with goshuinPhotoColumns.
+func scanGoshuinPhoto(row rowScanner) (*GoshuinPhoto, error) {
+	var p GoshuinPhoto
+	var createdAt time.Time
+	err := row.Scan(&p.ID, &p.CollectionID, &p.Position, &p.Caption, &p.Kind,
+		&p.StorageKey, &p.URL, &p.IsCover, &createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan goshuin photo: %v", err)
+	}
+	p.CreatedAt = createdAt.Format(time.RFC3339)
+	return &p, nil
+}
+
+// Get returns a GoshuinPhoto entity by its id.
+func (c *GoshuinPhotoClient) Get(ctx context.Context, id int) (*GoshuinPhoto, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("goshuin photo not found")
+	}
+
+	query := `SELECT ` + goshuinPhotoColumns + ` FROM goshuin_photos WHERE id = ?`
+	photo, err := scanGoshuinPhoto(c.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get goshuin photo: %v", err)
+	}
+	return photo, nil
+}
+
+// ListByCollection returns the photos of a goshuin collection in display order.
+func (c *GoshuinPhotoClient) ListByCollection(ctx context.Context, collectionID int) ([]*GoshuinPhoto, error) {
+	photos := []*GoshuinPhoto{}
+	if c.db == nil {
+		return photos, nil
+	}
+
+	query := `SELECT ` + goshuinPhotoColumns + ` FROM goshuin_photos WHERE collection_id = ? ORDER BY position, id`
+	rows, err := c.db.QueryContext(ctx, query, collectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query goshuin photos: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		photo, err := scanGoshuinPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, photo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate goshuin photos: %v", err)
+	}
+	return photos, nil
+}
+
+// KeyInUse reports whether any photo or collection still refers to the storage key or URL.
+// Uploads are stored under content hashes, so the same file can be shared.
+func (c *GoshuinPhotoClient) KeyInUse(ctx context.Context, key, url string) (bool, error) {
+	if c.db == nil {
+		return false, ErrNoDatabase
+	}
+
+	var n int
+	err := c.db.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM goshuin_photos WHERE storage_key = ? OR url = ?)
+		     + (SELECT COUNT(*) FROM goshuin_collections WHERE image_url = ?)
+	`, key, url, url).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check storage key: %v", err)
+	}
+	return n > 0, nil
+}
+
+// Create returns a builder for creating a GoshuinPhoto entity.
+func (c *GoshuinPhotoClient) Create() *GoshuinPhotoCreate {
+	return &GoshuinPhotoCreate{db: c.db, hooks: c.hooks, clock: c.clock, photo: &GoshuinPhoto{Kind: GoshuinPhotoKindStamp}}
+}
+
+// UpdateOneID returns a builder for updating a GoshuinPhoto entity.
+func (c *GoshuinPhotoClient) UpdateOneID(id int) *GoshuinPhotoUpdateOneID {
+	return &GoshuinPhotoUpdateOneID{db: c.db, hooks: c.hooks, clock: c.clock, id: id}
+}
+
+// DeleteOneID returns a builder for deleting a GoshuinPhoto entity.
+// When the cover photo is deleted the first remaining photo becomes the cover.
+func (c *GoshuinPhotoClient) DeleteOneID(id int) *GoshuinPhotoDeleteOneID {
+	return &GoshuinPhotoDeleteOneID{db: c.db, hooks: c.hooks, clock: c.clock, id: id}
+}
+
+// Reorder sets the display order of the collection's photos.
+// ids must contain every photo of the collection exactly once.
+func (c *GoshuinPhotoClient) Reorder(ctx context.Context, collectionID int, ids []int) ([]*GoshuinPhoto, error) {
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	photos, err := c.ListByCollection(ctx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != len(photos) {
+		return nil, fmt.Errorf("photo_ids must list all %d photos", len(photos))
+	}
+	existing := map[int]bool{}
+	for _, p := range photos {
+		existing[p.ID] = true
+	}
+	for _, id := range ids {
+		if !existing[id] {
+			return nil, fmt.Errorf("photo %d is not in the collection or listed twice", id)
+		}
+		delete(existing, id)
+	}
+
+	for i, id := range ids {
+		if _, err := c.db.ExecContext(ctx, `UPDATE goshuin_photos SET position = ? WHERE id = ?`, i, id); err != nil {
+			return nil, fmt.Errorf("failed to reorder goshuin photos: %v", err)
+		}
+	}
+
+	reordered, err := c.ListByCollection(ctx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := mu.commit(&Mutation{Op: OpUpdate, Type: TypeGoshuinPhoto, ID: collectionID, Old: photos, New: reordered}); err != nil {
+		return nil, err
+	}
+	return reordered, nil
+}
+
+// setCover makes the photo the cover of its collection and mirrors its URL to image_url,
+// setting the collection's updated_at to now. A zero photoID clears the cover.
+func setCover(ctx context.Context, db dbtx, collectionID, photoID int, now time.Time) error {
+	_, err := db.ExecContext(ctx, `UPDATE goshuin_photos SET is_cover = (id = ?) WHERE collection_id = ?`, photoID, collectionID)
+	if err != nil {
+		return fmt.Errorf("failed to set cover photo: %v", err)
+	}
+	_, err = db.ExecContext(ctx, `
+		UPDATE goshuin_collections
+		SET image_url = (SELECT url FROM goshuin_photos WHERE id = ? AND collection_id = ?), updated_at = ?
+		WHERE id = ?
+	`, photoID, collectionID, now.UTC(), collectionID)
+	if err != nil {
+		return fmt.Errorf("failed to update image_url: %v", err)
+	}
+	return nil
+}
+
+// setCoverURL makes the photo with the URL the cover, adding it as the first stamp photo if it is new.
+// It keeps the photos in step with image_url set through the collection builders.
+func setCoverURL(ctx context.Context, db dbtx, collectionID int, url string, now time.Time) error {
+	if url == "" {
+		return nil
+	}
+
+	var photoID int
+	err := db.QueryRowContext(ctx, `
+		SELECT id FROM goshuin_photos WHERE collection_id = ? AND url = ? ORDER BY position, id LIMIT 1
+	`, collectionID, url).Scan(&photoID)
+	if err == sql.ErrNoRows {
+		if _, err := db.ExecContext(ctx, `UPDATE goshuin_photos SET position = position + 1 WHERE collection_id = ?`, collectionID); err != nil {
+			return fmt.Errorf("failed to add cover photo: %v", err)
+		}
+		id, err := db.insert(ctx, "id", `
+			INSERT INTO goshuin_photos (collection_id, position, kind, url, created_at) VALUES (?, 0, ?, ?, ?)
+		`, collectionID, GoshuinPhotoKindStamp, url, now.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to add cover photo: %v", err)
+		}
+		photoID = int(id)
+	} else if err != nil {
+		return fmt.Errorf("failed to find cover photo: %v", err)
+	}
+
+	return setCover(ctx, db, collectionID, photoID, now)
+}
+
+// GoshuinPhotoCreate is a builder for creating a GoshuinPhoto entity.
+type GoshuinPhotoCreate struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+	photo *GoshuinPhoto
+}
+
+// SetCollectionID sets the collection_id field.
+func (pc *GoshuinPhotoCreate) SetCollectionID(id int) *GoshuinPhotoCreate {
+	pc.photo.CollectionID = id
+	return pc
+}
+
+// SetCaption sets the caption field.
+func (pc *GoshuinPhotoCreate) SetCaption(caption string) *GoshuinPhotoCreate {
+	pc.photo.Caption = caption
+	return pc
+}
+
+// SetKind sets the kind field (stamp, scenery or receipt).
+func (pc *GoshuinPhotoCreate) SetKind(kind string) *GoshuinPhotoCreate {
+	pc.photo.Kind = kind
+	return pc
+}
+
+// SetFile sets the storage_key and url fields. The key is empty for external URLs.
+func (pc *GoshuinPhotoCreate) SetFile(storageKey, url string) *GoshuinPhotoCreate {
+	pc.photo.StorageKey, pc.photo.URL = storageKey, url
+	return pc
+}
+
+// SetCover makes the new photo the cover. The first photo of a collection always becomes the cover.
+func (pc *GoshuinPhotoCreate) SetCover(cover bool) *GoshuinPhotoCreate {
+	pc.photo.IsCover = cover
+	return pc
+}
+
+// Save adds the photo after the existing photos of the collection.
+func (pc *GoshuinPhotoCreate) Save(ctx context.Context) (*GoshuinPhoto, error) {
+	if pc.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	ctx, mu, err := pc.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	var count, next int
+	err = pc.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(MAX(position) + 1, 0) FROM goshuin_photos WHERE collection_id = ?
+	`, pc.photo.CollectionID).Scan(&count, &next)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count goshuin photos: %v", err)
+	}
+
+	now := pc.clock.now()
+	id, err := pc.db.insert(ctx, "id", `
+		INSERT INTO goshuin_photos (collection_id, position, caption, kind, storage_key, url, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, pc.photo.CollectionID, next, pc.photo.Caption, pc.photo.Kind, nullString(pc.photo.StorageKey), pc.photo.URL, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create goshuin photo: %v", err)
+	}
+
+	if pc.photo.IsCover || count == 0 {
+		if err := setCover(ctx, pc.db, pc.photo.CollectionID, int(id), now); err != nil {
+			return nil, err
+		}
+	}
+
+	photo, err := (&GoshuinPhotoClient{db: pc.db}).Get(ctx, int(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mu.commit(&Mutation{Op: OpCreate, Type: TypeGoshuinPhoto, ID: photo.ID, New: photo}); err != nil {
+		return nil, err
+	}
+	return photo, nil
+}
+
+// GoshuinPhotoUpdateOneID is a builder for updating a GoshuinPhoto entity.
+type GoshuinPhotoUpdateOneID struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+	id    int
+	sets  []string
+	args  []interface{}
+	cover bool
+}
+
+// SetCaption sets the caption field.
+func (pu *GoshuinPhotoUpdateOneID) SetCaption(caption string) *GoshuinPhotoUpdateOneID {
+	pu.sets = append(pu.sets, "caption = ?")
+	pu.args = append(pu.args, caption)
+	return pu
+}
+
+// SetKind sets the kind field.
+func (pu *GoshuinPhotoUpdateOneID) SetKind(kind string) *GoshuinPhotoUpdateOneID {
+	pu.sets = append(pu.sets, "kind = ?")
+	pu.args = append(pu.args, kind)
+	return pu
+}
+
+// SetCover makes the photo the cover of its collection.
+func (pu *GoshuinPhotoUpdateOneID) SetCover() *GoshuinPhotoUpdateOneID {
+	pu.cover = true
+	return pu
+}
+
+// Save saves the updated goshuin photo to the database.
+func (pu *GoshuinPhotoUpdateOneID) Save(ctx context.Context) (*GoshuinPhoto, error) {
+	if pu.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	ctx, mu, err := pu.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	client := &GoshuinPhotoClient{db: pu.db}
+	old, err := client.Get(ctx, pu.id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pu.sets) > 0 {
+		query := `UPDATE goshuin_photos SET ` + strings.Join(pu.sets, ", ") + ` WHERE id = ?`
+		if _, err := pu.db.ExecContext(ctx, query, append(pu.args, pu.id)...); err != nil {
+			return nil, fmt.Errorf("failed to update goshuin photo: %v", err)
+		}
+	}
+	if pu.cover {
+		if err := setCover(ctx, pu.db, old.CollectionID, pu.id, pu.clock.now()); err != nil {
+			return nil, err
+		}
+	}
+
+	photo, err := client.Get(ctx, pu.id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mu.commit(&Mutation{Op: OpUpdate, Type: TypeGoshuinPhoto, ID: pu.id, Old: old, New: photo}); err != nil {
+		return nil, err
+	}
+	return photo, nil
+}
+
+// GoshuinPhotoDeleteOneID is a builder for deleting a GoshuinPhoto entity.
+type GoshuinPhotoDeleteOneID struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+	id    int
+}
+
+// Exec executes the delete operation.
+func (pd *GoshuinPhotoDeleteOneID) Exec(ctx context.Context) error {
+	if pd.db == nil {
+		return ErrNoDatabase
+	}
+
+	ctx, mu, err := pd.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	old, err := (&GoshuinPhotoClient{db: pd.db}).Get(ctx, pd.id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := pd.db.ExecContext(ctx, `DELETE FROM goshuin_photos WHERE id = ?`, pd.id); err != nil {
+		return fmt.Errorf("failed to delete goshuin photo: %v", err)
+	}
+
+	if old.IsCover {
+		var next int
+		err := pd.db.QueryRowContext(ctx, `
+			SELECT id FROM goshuin_photos WHERE collection_id = ? ORDER BY position, id LIMIT 1
+		`, old.CollectionID).Scan(&next)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to find next cover photo: %v", err)
+		}
+		if err := setCover(ctx, pd.db, old.CollectionID, next, pd.clock.now()); err != nil {
+			return err
+		}
+	}
+
+	return mu.commit(&Mutation{Op: OpDelete, Type: TypeGoshuinPhoto, ID: pd.id, Old: old})
+}
@@ -0,0 +1,701 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Guide content statuses. A published entry may have newer draft versions.
+const (
+	GuideStatusDraft     = "draft"
+	GuideStatusPublished = "published"
+)
+
+// ErrGuideSlugTaken is returned when creating a second entry with the same slug and locale.
+var ErrGuideSlugTaken = errors.New("an entry with this slug already exists in this locale")
+
+// ErrGuideVersionNotFound is returned when publishing or rolling back to a version that does not exist.
+var ErrGuideVersionNotFound = errors.New("guide version not found")
+
+// guideSlugPattern is the format of section and tip slugs.
+var guideSlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// maxGuideBodyLength is the longest markdown body accepted.
+const maxGuideBodyLength = 50000
+
+// GuideMedia is an image or video referenced by guide content. Key is set for files
+// uploaded to storage; external media only have a URL.
+type GuideMedia struct {
+	Key     string `json:"key,omitempty"`
+	URL     string `json:"url"`
+	Alt     string `json:"alt,omitempty"`
+	Caption string `json:"caption,omitempty"`
+}
+
+// GuideContent is the versioned content of a section or tip.
+type GuideContent struct {
+	Title string `json:"title,omitempty"`
+	// Body is Markdown.
+	Body  string       `json:"body"`
+	Media []GuideMedia `json:"media"`
+}
+
+// GuideVersion is one saved revision of a section or tip.
+type GuideVersion struct {
+	Version int `json:"version"`
+	GuideContent
+	AuthorID  string `json:"author_id,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// guideState holds the fields shared by sections and tips.
+type guideState struct {
+	Slug     string `json:"slug"`
+	Locale   string `json:"locale"`
+	Position int    `json:"position"`
+	Status   string `json:"status"`
+	// Version is the latest version; PublishedVersion is the one served to readers (0 if none).
+	Version          int    `json:"version"`
+	PublishedVersion int    `json:"published_version,omitempty"`
+	CreatedAt        string `json:"created_at"`
+	UpdatedAt        string `json:"updated_at"`
+	PublishedAt      string `json:"published_at,omitempty"`
+}
+
+// GuideSection entity is a Markdown section of the guide in one locale. Sections with the
+// same slug are translations of each other.
+type GuideSection struct {
+	ID int `json:"id"`
+	guideState
+	GuideContent
+}
+
+// GuideTip entity is a short tip of the guide in one locale. Tips with the same slug are
+// translations of each other; the text is kept in Body.
+type GuideTip struct {
+	ID int `json:"id"`
+	guideState
+	GuideContent
+}
+
+// GuideFilter holds the search conditions for listing guide content.
+type GuideFilter struct {
+	Locale string
+	Status string
+	// Published returns the published version of published entries instead of the latest one.
+	Published bool
+}
+
+// GuideClient is a client for the GuideSection and GuideTip schemas. Content is versioned:
+// every edit adds a version, and readers see the published version.
+type GuideClient struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+}
+
+// guideTables maps the entity types to their tables.
+var guideTables = map[string]string{
+	TypeGuideSection: "guide_sections",
+	TypeGuideTip:     "guide_tips",
+}
+
+// guideTable returns the table of a guide entity type.
+func guideTable(kind string) (string, error) {
+	table, ok := guideTables[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown guide type %q", kind)
+	}
+	return table, nil
+}
+
+// ValidateGuideContent checks the slug, locale and content of a section or tip.
+func ValidateGuideContent(kind, slug, locale string, c GuideContent) error {
+	if !guideSlugPattern.MatchString(slug) || len(slug) > 100 {
+		return fmt.Errorf("slug must be lowercase letters, digits and hyphens")
+	}
+	if locale == "" || len(locale) > 35 {
+		return fmt.Errorf("locale is required")
+	}
+	return c.validate(kind)
+}
+
+// validate checks the content of a section or tip.
+func (c GuideContent) validate(kind string) error {
+	if kind == TypeGuideSection && strings.TrimSpace(c.Title) == "" {
+		return fmt.Errorf("title is required")
+	}
+	if len([]rune(c.Title)) > 255 {
+		return fmt.Errorf("title must be at most 255 characters")
+	}
+	if strings.TrimSpace(c.Body) == "" {
+		return fmt.Errorf("body is required")
+	}
+	if len([]rune(c.Body)) > maxGuideBodyLength {
+		return fmt.Errorf("body must be at most %d characters", maxGuideBodyLength)
+	}
+	for _, m := range c.Media {
+		if m.URL == "" {
+			return fmt.Errorf("media url is required")
+		}
+	}
+	return nil
+}
+
+// guideColumns selects a guide row joined with one of its versions (v).
+const guideColumns = `g.id, g.slug, g.locale, g.position, g.version, COALESCE(g.published_version, 0),
+	g.created_at, g.updated_at, g.published_at, COALESCE(v.title, ''), v.body, COALESCE(v.media, '')`
+
+// scanGuide scans a row selected with guideColumns.
+func scanGuide(row rowScanner) (int, guideState, GuideContent, error) {
+	var id int
+	var s guideState
+	var c GuideContent
+	var media string
+	var createdAt, updatedAt time.Time
+	var publishedAt sql.NullTime
+	err := row.Scan(&id, &s.Slug, &s.Locale, &s.Position, &s.Version, &s.PublishedVersion,
+		&createdAt, &updatedAt, &publishedAt, &c.Title, &c.Body, &media)
+	if err != nil {
+		return 0, s, c, fmt.Errorf("failed to scan guide content: %v", err)
+	}
+
+	c.Media = []GuideMedia{}
+	if media != "" {
+		if err := json.Unmarshal([]byte(media), &c.Media); err != nil {
+			return 0, s, c, fmt.Errorf("invalid guide media: %v", err)
+		}
+	}
+	s.Status = GuideStatusDraft
+	if s.PublishedVersion > 0 {
+		s.Status = GuideStatusPublished
+	}
+	s.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	s.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	if publishedAt.Valid {
+		s.PublishedAt = publishedAt.Time.UTC().Format(time.RFC3339)
+	}
+	return id, s, c, nil
+}
+
+// query lists guide rows of a kind with the latest or published version.
+func (c *GuideClient) query(ctx context.Context, kind string, f GuideFilter, id int) ([]int, []guideState, []GuideContent, error) {
+	table, err := guideTable(kind)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	version := "g.version"
+	if f.Published {
+		version = "g.published_version"
+	}
+	query := `SELECT ` + guideColumns + ` FROM ` + table + ` g
+		JOIN guide_versions v ON v.entity_type = ? AND v.entity_id = g.id AND v.version = ` + version
+	args := []interface{}{kind}
+
+	var where []string
+	if id > 0 {
+		where = append(where, "g.id = ?")
+		args = append(args, id)
+	}
+	if f.Locale != "" {
+		where = append(where, "g.locale = ?")
+		args = append(args, f.Locale)
+	}
+	switch f.Status {
+	case GuideStatusDraft:
+		where = append(where, "g.published_version IS NULL")
+	case GuideStatusPublished:
+		where = append(where, "g.published_version IS NOT NULL")
+	}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY g.position, g.id"
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to query guide content: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	var states []guideState
+	var contents []GuideContent
+	for rows.Next() {
+		id, s, content, err := scanGuide(rows)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		ids = append(ids, id)
+		states = append(states, s)
+		contents = append(contents, content)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to iterate guide content: %v", err)
+	}
+	return ids, states, contents, nil
+}
+
+// Sections returns the sections matching the filter, ordered by position.
+func (c *GuideClient) Sections(ctx context.Context, f GuideFilter) ([]*GuideSection, error) {
+	sections := []*GuideSection{}
+	if c.db == nil {
+		return sections, nil
+	}
+	ids, states, contents, err := c.query(ctx, TypeGuideSection, f, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ids {
+		sections = append(sections, &GuideSection{ID: ids[i], guideState: states[i], GuideContent: contents[i]})
+	}
+	return sections, nil
+}
+
+// Tips returns the tips matching the filter, ordered by position.
+func (c *GuideClient) Tips(ctx context.Context, f GuideFilter) ([]*GuideTip, error) {
+	tips := []*GuideTip{}
+	if c.db == nil {
+		return tips, nil
+	}
+	ids, states, contents, err := c.query(ctx, TypeGuideTip, f, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ids {
+		tips = append(tips, &GuideTip{ID: ids[i], guideState: states[i], GuideContent: contents[i]})
+	}
+	return tips, nil
+}
+
+// Section returns a section with its latest version.
+func (c *GuideClient) Section(ctx context.Context, id int) (*GuideSection, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("guide section not found")
+	}
+	ids, states, contents, err := c.query(ctx, TypeGuideSection, GuideFilter{}, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("guide section not found")
+	}
+	return &GuideSection{ID: ids[0], guideState: states[0], GuideContent: contents[0]}, nil
+}
+
+// Tip returns a tip with its latest version.
+func (c *GuideClient) Tip(ctx context.Context, id int) (*GuideTip, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("guide tip not found")
+	}
+	ids, states, contents, err := c.query(ctx, TypeGuideTip, GuideFilter{}, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("guide tip not found")
+	}
+	return &GuideTip{ID: ids[0], guideState: states[0], GuideContent: contents[0]}, nil
+}
+
+// Entity returns a section or tip by type, for hooks and generic handlers.
+func (c *GuideClient) Entity(ctx context.Context, kind string, id int) (interface{}, error) {
+	if kind == TypeGuideSection {
+		return c.Section(ctx, id)
+	}
+	return c.Tip(ctx, id)
+}
+
+// GuideCreate holds a new section or tip.
+type GuideCreate struct {
+	Slug     string
+	Locale   string
+	Position int
+	Content  GuideContent
+	AuthorID string
+	// Publish publishes the first version straight away.
+	Publish bool
+}
+
+// Create adds a section or tip with its first version.
+func (c *GuideClient) Create(ctx context.Context, kind string, gc GuideCreate) (int, error) {
+	table, err := guideTable(kind)
+	if err != nil {
+		return 0, err
+	}
+	if err := ValidateGuideContent(kind, gc.Slug, gc.Locale, gc.Content); err != nil {
+		return 0, err
+	}
+	if c.db == nil {
+		return 0, ErrNoDatabase
+	}
+
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.rollback()
+
+	var taken int
+	err = c.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` WHERE slug = ? AND locale = ?`, gc.Slug, gc.Locale).Scan(&taken)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check guide slug: %v", err)
+	}
+	if taken > 0 {
+		return 0, ErrGuideSlugTaken
+	}
+
+	now := c.clock.now()
+	lastID, err := c.db.insert(ctx, "id", `INSERT INTO `+table+` (slug, locale, position, version, created_at, updated_at)
+		VALUES (?, ?, ?, 0, ?, ?)`, gc.Slug, gc.Locale, gc.Position, now, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create guide content: %v", err)
+	}
+	id := int(lastID)
+
+	version, err := c.addVersion(ctx, kind, id, gc.Content, gc.AuthorID)
+	if err != nil {
+		return 0, err
+	}
+	if gc.Publish {
+		if err := c.setPublished(ctx, kind, id, version); err != nil {
+			return 0, err
+		}
+	}
+
+	entity, err := c.Entity(ctx, kind, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := mu.commit(&Mutation{Op: OpCreate, Type: kind, ID: id, New: entity}); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// GuideUpdate holds changes to a section or tip. Nil fields are left unchanged; a content
+// change adds a version, which stays a draft until published.
+type GuideUpdate struct {
+	Position *int
+	Content  *GuideContent
+	AuthorID string
+}
+
+// Update changes the position and adds a version when the content changed.
+func (c *GuideClient) Update(ctx context.Context, kind string, id int, u GuideUpdate) error {
+	table, err := guideTable(kind)
+	if err != nil {
+		return err
+	}
+	if u.Content != nil {
+		if err := u.Content.validate(kind); err != nil {
+			return err
+		}
+	}
+	if c.db == nil {
+		return ErrNoDatabase
+	}
+
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	old, err := c.Entity(ctx, kind, id)
+	if err != nil {
+		return err
+	}
+
+	if u.Position != nil {
+		_, err := c.db.ExecContext(ctx, `UPDATE `+table+` SET position = ?, updated_at = ? WHERE id = ?`, *u.Position, c.clock.now(), id)
+		if err != nil {
+			return fmt.Errorf("failed to update guide content: %v", err)
+		}
+	}
+	if u.Content != nil && !sameGuideContent(guideContentOf(old), *u.Content) {
+		if _, err := c.addVersion(ctx, kind, id, *u.Content, u.AuthorID); err != nil {
+			return err
+		}
+	}
+
+	return c.commitUpdate(ctx, mu, kind, id, old)
+}
+
+// guideContentOf returns the content of a section or tip.
+func guideContentOf(entity interface{}) GuideContent {
+	switch e := entity.(type) {
+	case *GuideSection:
+		return e.GuideContent
+	case *GuideTip:
+		return e.GuideContent
+	}
+	return GuideContent{}
+}
+
+// sameGuideContent reports whether two contents are equal.
+func sameGuideContent(a, b GuideContent) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// commitUpdate commits a change with the entity before and after it.
+func (c *GuideClient) commitUpdate(ctx context.Context, mu *mutation, kind string, id int, old interface{}) error {
+	entity, err := c.Entity(ctx, kind, id)
+	if err != nil {
+		return err
+	}
+	return mu.commit(&Mutation{Op: OpUpdate, Type: kind, ID: id, Old: old, New: entity})
+}
+
+// addVersion saves the content as the next version and makes it the latest one.
+func (c *GuideClient) addVersion(ctx context.Context, kind string, id int, content GuideContent, authorID string) (int, error) {
+	table, err := guideTable(kind)
+	if err != nil {
+		return 0, err
+	}
+	if content.Media == nil {
+		content.Media = []GuideMedia{}
+	}
+	media, err := json.Marshal(content.Media)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode guide media: %v", err)
+	}
+
+	tx, err := begin(ctx, c.db)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRowContext(ctx, `SELECT version FROM `+table+` WHERE id = ?`+tx.dialect().ForUpdate(), id).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to lock guide content: %v", err)
+	}
+	version++
+
+	now := c.clock.now()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO guide_versions (entity_type, entity_id, version, title, body, media, author_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, kind, id, version, nullString(content.Title), content.Body, string(media), nullString(authorID), now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save guide version: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET version = ?, updated_at = ? WHERE id = ?`, version, now, id); err != nil {
+		return 0, fmt.Errorf("failed to update guide content: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit guide version: %v", err)
+	}
+	return version, nil
+}
+
+// setPublished makes a version the one served to readers; 0 unpublishes.
+func (c *GuideClient) setPublished(ctx context.Context, kind string, id, version int) error {
+	table, err := guideTable(kind)
+	if err != nil {
+		return err
+	}
+	now := c.clock.now()
+	if version == 0 {
+		_, err = c.db.ExecContext(ctx, `UPDATE `+table+` SET published_version = NULL, published_at = NULL, updated_at = ? WHERE id = ?`, now, id)
+	} else {
+		_, err = c.db.ExecContext(ctx, `UPDATE `+table+` SET published_version = ?, published_at = ?, updated_at = ? WHERE id = ?`, version, now, now, id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish guide content: %v", err)
+	}
+	return nil
+}
+
+// Publish publishes a version of a section or tip; 0 means the latest version.
+func (c *GuideClient) Publish(ctx context.Context, kind string, id, version int) error {
+	if c.db == nil {
+		return ErrNoDatabase
+	}
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	old, err := c.Entity(ctx, kind, id)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		version = guideStateOf(old).Version
+	} else if _, err := c.Version(ctx, kind, id, version); err != nil {
+		return err
+	}
+	if err := c.setPublished(ctx, kind, id, version); err != nil {
+		return err
+	}
+	return c.commitUpdate(ctx, mu, kind, id, old)
+}
+
+// Unpublish hides a section or tip from readers. Its versions are kept.
+func (c *GuideClient) Unpublish(ctx context.Context, kind string, id int) error {
+	if c.db == nil {
+		return ErrNoDatabase
+	}
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	old, err := c.Entity(ctx, kind, id)
+	if err != nil {
+		return err
+	}
+	if err := c.setPublished(ctx, kind, id, 0); err != nil {
+		return err
+	}
+	return c.commitUpdate(ctx, mu, kind, id, old)
+}
+
+// Rollback restores an earlier version by saving a copy of it as the latest version, so the
+// history is kept. A published entry is republished with the restored content.
+func (c *GuideClient) Rollback(ctx context.Context, kind string, id, version int, authorID string) error {
+	if c.db == nil {
+		return ErrNoDatabase
+	}
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	old, err := c.Entity(ctx, kind, id)
+	if err != nil {
+		return err
+	}
+	target, err := c.Version(ctx, kind, id, version)
+	if err != nil {
+		return err
+	}
+
+	latest, err := c.addVersion(ctx, kind, id, target.GuideContent, authorID)
+	if err != nil {
+		return err
+	}
+	if guideStateOf(old).PublishedVersion > 0 {
+		if err := c.setPublished(ctx, kind, id, latest); err != nil {
+			return err
+		}
+	}
+	return c.commitUpdate(ctx, mu, kind, id, old)
+}
+
+// guideStateOf returns the state of a section or tip.
+func guideStateOf(entity interface{}) guideState {
+	switch e := entity.(type) {
+	case *GuideSection:
+		return e.guideState
+	case *GuideTip:
+		return e.guideState
+	}
+	return guideState{}
+}
+
+// Versions returns the versions of a section or tip, newest first.
+func (c *GuideClient) Versions(ctx context.Context, kind string, id int) ([]*GuideVersion, error) {
+	versions := []*GuideVersion{}
+	if c.db == nil {
+		return versions, nil
+	}
+	rows, err := c.db.QueryContext(ctx, `SELECT `+guideVersionColumns+`
+		FROM guide_versions WHERE entity_type = ? AND entity_id = ? ORDER BY version DESC`, kind, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query guide versions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v, err := scanGuideVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate guide versions: %v", err)
+	}
+	return versions, nil
+}
+
+// Version returns one version of a section or tip.
+func (c *GuideClient) Version(ctx context.Context, kind string, id, version int) (*GuideVersion, error) {
+	if c.db == nil {
+		return nil, ErrGuideVersionNotFound
+	}
+	row := c.db.QueryRowContext(ctx, `SELECT `+guideVersionColumns+`
+		FROM guide_versions WHERE entity_type = ? AND entity_id = ? AND version = ?`, kind, id, version)
+	v, err := scanGuideVersion(row)
+	if err != nil {
+		return nil, ErrGuideVersionNotFound
+	}
+	return v, nil
+}
+
+// guideVersionColumns is the column list scanned by scanGuideVersion.
+const guideVersionColumns = `version, COALESCE(title, ''), body, COALESCE(media, ''), COALESCE(author_id, ''), created_at`
+
+// scanGuideVersion scans a row selected with guideVersionColumns.
+func scanGuideVersion(row rowScanner) (*GuideVersion, error) {
+	var v GuideVersion
+	var media string
+	var createdAt time.Time
+	if err := row.Scan(&v.Version, &v.Title, &v.Body, &media, &v.AuthorID, &createdAt); err != nil {
+		return nil, fmt.Errorf("failed to scan guide version: %v", err)
+	}
+	v.Media = []GuideMedia{}
+	if media != "" {
+		if err := json.Unmarshal([]byte(media), &v.Media); err != nil {
+			return nil, fmt.Errorf("invalid guide media: %v", err)
+		}
+	}
+	v.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	return &v, nil
+}
+
+// Delete removes a section or tip with all its versions.
+func (c *GuideClient) Delete(ctx context.Context, kind string, id int) error {
+	table, err := guideTable(kind)
+	if err != nil {
+		return err
+	}
+	if c.db == nil {
+		return ErrNoDatabase
+	}
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	old, err := c.Entity(ctx, kind, id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.db.ExecContext(ctx, `DELETE FROM guide_versions WHERE entity_type = ? AND entity_id = ?`, kind, id); err != nil {
+		return fmt.Errorf("failed to delete guide versions: %v", err)
+	}
+	if _, err := c.db.ExecContext(ctx, `DELETE FROM `+table+` WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete guide content: %v", err)
+	}
+
+	return mu.commit(&Mutation{Op: OpDelete, Type: kind, ID: id, Old: old})
+}
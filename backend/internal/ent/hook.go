@@ -0,0 +1,232 @@
+package ent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Op is the operation of a mutation.
+type Op string
+
+// Mutation operations.
+const (
+	OpCreate Op = "create"
+	OpUpdate Op = "update"
+	OpDelete Op = "delete"
+	// OpRestore brings an entity back from the trash; OpPurge deletes a trashed entity permanently.
+	OpRestore Op = "restore"
+	OpPurge   Op = "purge"
+)
+
+// Entity type names passed in Mutation.Type.
+const (
+	TypeTemple            = "Temple"
+	TypeGoshuinCollection = "GoshuinCollection"
+	TypeGoshuinBook       = "GoshuinBook"
+	TypeGoshuinPhoto      = "GoshuinPhoto"
+	TypeUserBadge         = "UserBadge"
+)
+
+// Mutation describes a change that has been written to the database.
+type Mutation struct {
+	Op   Op
+	Type string
+	ID   int
+	// UserID is the owner of the entity, if it has one.
+	UserID string
+	// Old is the entity before the change (nil for create).
+	Old interface{}
+	// New is the entity after the change (nil for delete).
+	New interface{}
+	// OnBehalfOf is the user whose proposal the change applies, such as an approved temple correction.
+	OnBehalfOf string
+}
+
+// Hook is called after a mutation has been written.
+type Hook func(ctx context.Context, m *Mutation)
+
+// TxHook is called with a mutation before it commits, in the same transaction: queries made
+// with ctx through any client on the database run in it. An error rolls the mutation back
+// and is returned by the builder.
+type TxHook func(ctx context.Context, m *Mutation) error
+
+// hooks holds the hooks shared by the client and its sub-clients.
+type hooks struct {
+	mu      sync.RWMutex
+	hooks   []Hook
+	txHooks []TxHook
+	// conn is the database or transaction the mutations are written to, or nil without a database.
+	conn *conn
+	// parent is set for a transaction client. Its mutations are queued and passed to the
+	// parent's hooks once the transaction commits, so hooks never see rolled-back changes.
+	parent *hooks
+	queue  []queued
+}
+
+// queued is a mutation made in a transaction that has not committed yet.
+type queued struct {
+	ctx context.Context
+	m   *Mutation
+}
+
+// root returns the hooks of the client transactions were started from, where hooks are registered.
+func (h *hooks) root() *hooks {
+	for h.parent != nil {
+		h = h.parent
+	}
+	return h
+}
+
+// enabled reports whether any hook is registered, so builders can skip loading the old entity.
+func (h *hooks) enabled() bool {
+	if h == nil {
+		return false
+	}
+	r := h.root()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.hooks) > 0 || len(r.txHooks) > 0
+}
+
+// registeredTx returns the transaction hooks in the order they were added.
+func (h *hooks) registeredTx() []TxHook {
+	r := h.root()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]TxHook(nil), r.txHooks...)
+}
+
+// mutation is a write in progress. When transaction hooks are registered the write runs in a
+// transaction, or a savepoint of the one it is nested in, that commits together with them.
+type mutation struct {
+	h *hooks
+	// ctx is the context the builder was called with; hooks run with it after the commit.
+	ctx context.Context
+	txc *txConn
+	// outer is the mutation this one is nested in. Its hooks run once the outer one commits.
+	outer     *mutation
+	pending   []*Mutation
+	committed bool
+}
+
+// begin starts a mutation. The returned context carries its transaction, so every query the
+// builder makes with it runs in the transaction. Callers defer rollback and finish with commit.
+func (h *hooks) begin(ctx context.Context) (context.Context, *mutation, error) {
+	mu := &mutation{h: h, ctx: ctx}
+	if h == nil || h.conn == nil || len(h.registeredTx()) == 0 {
+		return ctx, mu, nil
+	}
+	txc, err := h.conn.begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	mu.txc = txc
+	if outer, ok := ctx.Value(txKey{}).(*mutation); ok {
+		mu.outer = outer
+		mu.ctx = outer.ctx
+	}
+	return context.WithValue(ctx, txKey{}, mu), mu, nil
+}
+
+// commit runs the transaction hooks for the written mutations, commits, and then runs the
+// hooks. Nil mutations are skipped. If a transaction hook fails, nothing is committed.
+func (mu *mutation) commit(ms ...*Mutation) error {
+	var written []*Mutation
+	for _, m := range ms {
+		if m != nil {
+			written = append(written, m)
+		}
+	}
+
+	if mu.txc != nil {
+		ctx := context.WithValue(mu.ctx, txKey{}, mu)
+		for _, m := range written {
+			for _, hook := range mu.h.registeredTx() {
+				if err := hook(ctx, m); err != nil {
+					return err
+				}
+			}
+		}
+		if err := mu.txc.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %v", err)
+		}
+	}
+	mu.committed = true
+
+	written = append(mu.pending, written...)
+	if mu.outer != nil {
+		mu.outer.pending = append(mu.outer.pending, written...)
+		return nil
+	}
+	for _, m := range written {
+		mu.h.run(mu.ctx, m)
+	}
+	return nil
+}
+
+// rollback undoes the mutation unless it has been committed.
+func (mu *mutation) rollback() {
+	if mu == nil || mu.committed || mu.txc == nil {
+		return
+	}
+	mu.txc.Rollback()
+}
+
+// run calls the registered hooks in order.
+func (h *hooks) run(ctx context.Context, m *Mutation) {
+	if h == nil {
+		return
+	}
+	if h.parent != nil {
+		h.mu.Lock()
+		h.queue = append(h.queue, queued{ctx: ctx, m: m})
+		h.mu.Unlock()
+		return
+	}
+	h.mu.RLock()
+	registered := append([]Hook(nil), h.hooks...)
+	h.mu.RUnlock()
+
+	for _, hook := range registered {
+		hook(ctx, m)
+	}
+}
+
+// flush passes the queued mutations of a committed transaction to the parent's hooks.
+func (h *hooks) flush() {
+	h.mu.Lock()
+	pending := h.queue
+	h.queue = nil
+	h.mu.Unlock()
+
+	for _, q := range pending {
+		h.parent.run(q.ctx, q.m)
+	}
+}
+
+// discard drops the queued mutations of a rolled-back transaction.
+func (h *hooks) discard() {
+	h.mu.Lock()
+	h.queue = nil
+	h.mu.Unlock()
+}
+
+// Use adds mutation hooks to the client. Hooks run for every create, update and delete
+// made through the client's builders, in the order they were added.
+// On a transaction client the hooks are added to the client the transaction was started from.
+func (c *Client) Use(hs ...Hook) {
+	h := c.hooks.root()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, hs...)
+}
+
+// UseTx adds transaction hooks to the client. They run for the same mutations as the hooks
+// added with Use, in the order they were added, before the mutation commits.
+func (c *Client) UseTx(hs ...TxHook) {
+	h := c.hooks.root()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.txHooks = append(h.txHooks, hs...)
+}
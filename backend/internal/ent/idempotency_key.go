@@ -0,0 +1,205 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IdempotencyKey entity is an Idempotency-Key sent with a mutating request, together with
+// the fingerprint of the request and the response to replay for repeats.
+type IdempotencyKey struct {
+	// Scope is the user the key belongs to, so keys of different users never collide.
+	Scope string
+	Key   string
+	// Fingerprint is the SHA-256 of the method, path and body of the request.
+	Fingerprint string
+	// Status is the status code of the stored response, or 0 while the request is in progress.
+	Status int
+	// Header is the JSON object of the stored response headers.
+	Header    string
+	Body      []byte
+	ExpiresAt time.Time
+}
+
+// IdempotencyKeyClient is a client for the IdempotencyKey schema.
+type IdempotencyKeyClient struct {
+	db dbtx
+	// mem keeps the keys of a client without a database.
+	mem *memoryIdempotencyKeys
+}
+
+// newIdempotencyKeyClient returns a client for the keys stored in the database db, or in
+// memory when db is nil.
+func newIdempotencyKeyClient(db dbtx) *IdempotencyKeyClient {
+	if db == nil {
+		return &IdempotencyKeyClient{mem: &memoryIdempotencyKeys{keys: map[[2]string]*IdempotencyKey{}}}
+	}
+	return &IdempotencyKeyClient{db: db}
+}
+
+// Get returns a key that has not expired at now, or nil if there is none.
+func (c *IdempotencyKeyClient) Get(ctx context.Context, scope, key string, now time.Time) (*IdempotencyKey, error) {
+	if c.db == nil {
+		return c.mem.get(scope, key, now), nil
+	}
+
+	k := IdempotencyKey{Scope: scope, Key: key}
+	var status sql.NullInt64
+	var header sql.NullString
+	err := c.db.QueryRowContext(ctx, `
+		SELECT fingerprint, status, header, body, expires_at
+		FROM idempotency_keys WHERE scope = ? AND idempotency_key = ? AND expires_at > ?
+	`, scope, key, now.UTC()).Scan(&k.Fingerprint, &status, &header, &k.Body, &k.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %v", err)
+	}
+	k.Status, k.Header = int(status.Int64), header.String
+	return &k, nil
+}
+
+// Reserve records a key as in progress until k.ExpiresAt. It returns false if the key is
+// already recorded and has not expired; an expired record is replaced.
+func (c *IdempotencyKeyClient) Reserve(ctx context.Context, k *IdempotencyKey, now time.Time) (bool, error) {
+	if c.db == nil {
+		return c.mem.reserve(k, now), nil
+	}
+
+	_, err := c.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE scope = ? AND idempotency_key = ? AND expires_at <= ?
+	`, k.Scope, k.Key, now.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to delete expired idempotency key: %v", err)
+	}
+
+	result, err := c.db.ExecContext(ctx, c.db.dialect().InsertIgnore(`
+		INSERT INTO idempotency_keys (scope, idempotency_key, fingerprint, created_at, expires_at) VALUES (?, ?, ?, ?, ?)
+	`), k.Scope, k.Key, k.Fingerprint, now.UTC(), k.ExpiresAt.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve idempotency key: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve idempotency key: %v", err)
+	}
+	return n > 0, nil
+}
+
+// Complete stores the response of a reserved key and keeps it until k.ExpiresAt.
+func (c *IdempotencyKeyClient) Complete(ctx context.Context, k *IdempotencyKey) error {
+	if c.db == nil {
+		c.mem.complete(k)
+		return nil
+	}
+
+	_, err := c.db.ExecContext(ctx, `
+		UPDATE idempotency_keys SET status = ?, header = ?, body = ?, expires_at = ? WHERE scope = ? AND idempotency_key = ?
+	`, k.Status, k.Header, k.Body, k.ExpiresAt.UTC(), k.Scope, k.Key)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %v", err)
+	}
+	return nil
+}
+
+// Release deletes a reserved key whose response is not stored, so the request can be retried.
+func (c *IdempotencyKeyClient) Release(ctx context.Context, scope, key string) error {
+	if c.db == nil {
+		c.mem.release(scope, key)
+		return nil
+	}
+
+	_, err := c.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE scope = ? AND idempotency_key = ? AND status IS NULL
+	`, scope, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %v", err)
+	}
+	return nil
+}
+
+// DeleteExpired deletes the keys that expired at now and returns how many were deleted.
+func (c *IdempotencyKeyClient) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	if c.db == nil {
+		return c.mem.deleteExpired(now), nil
+	}
+
+	result, err := c.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %v", err)
+	}
+	return int(n), nil
+}
+
+// memoryIdempotencyKeys keeps idempotency keys in memory, by scope and key, with the same
+// rules as the idempotency_keys table.
+type memoryIdempotencyKeys struct {
+	mu   sync.Mutex
+	keys map[[2]string]*IdempotencyKey
+}
+
+func (m *memoryIdempotencyKeys) get(scope, key string, now time.Time) *IdempotencyKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k, ok := m.keys[[2]string{scope, key}]
+	if !ok || !k.ExpiresAt.After(now) {
+		return nil
+	}
+	c := *k
+	return &c
+}
+
+func (m *memoryIdempotencyKeys) reserve(k *IdempotencyKey, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := [2]string{k.Scope, k.Key}
+	if stored, ok := m.keys[id]; ok && stored.ExpiresAt.After(now) {
+		return false
+	}
+	m.keys[id] = &IdempotencyKey{Scope: k.Scope, Key: k.Key, Fingerprint: k.Fingerprint, ExpiresAt: k.ExpiresAt}
+	return true
+}
+
+func (m *memoryIdempotencyKeys) complete(k *IdempotencyKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored, ok := m.keys[[2]string{k.Scope, k.Key}]; ok {
+		stored.Status, stored.Header, stored.ExpiresAt = k.Status, k.Header, k.ExpiresAt
+		stored.Body = append([]byte(nil), k.Body...)
+	}
+}
+
+func (m *memoryIdempotencyKeys) release(scope, key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := [2]string{scope, key}
+	if stored, ok := m.keys[id]; ok && stored.Status == 0 {
+		delete(m.keys, id)
+	}
+}
+
+func (m *memoryIdempotencyKeys) deleteExpired(now time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, k := range m.keys {
+		if !k.ExpiresAt.After(now) {
+			delete(m.keys, id)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,126 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Notification entity is a message to a user, such as the outcome of a moderation review.
+type Notification struct {
+	ID     int    `json:"id"`
+	UserID string `json:"user_id"`
+	Kind   string `json:"kind"`
+	Title  string `json:"title"`
+	Body   string `json:"body,omitempty"`
+	// Data holds kind-specific values such as the reviewed correction.
+	Data      map[string]interface{} `json:"data,omitempty"`
+	ReadAt    string                 `json:"read_at,omitempty"`
+	CreatedAt string                 `json:"created_at"`
+}
+
+// NotificationClient is a client for the Notification schema.
+type NotificationClient struct {
+	db    dbtx
+	clock *clockSource
+}
+
+// Notify sends a notification to the user.
+func (c *NotificationClient) Notify(ctx context.Context, n *Notification) error {
+	if c.db == nil {
+		return ErrNoDatabase
+	}
+
+	var data interface{}
+	if len(n.Data) > 0 {
+		encoded, err := json.Marshal(n.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encode notification data: %v", err)
+		}
+		data = string(encoded)
+	}
+
+	_, err := c.db.ExecContext(ctx, `
+		INSERT INTO notifications (user_id, kind, title, body, data, created_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, n.UserID, n.Kind, n.Title, nullString(n.Body), data, c.clock.now())
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %v", err)
+	}
+	return nil
+}
+
+// ListByUser returns the user's notifications, newest first. With unreadOnly, read ones are left out.
+func (c *NotificationClient) ListByUser(ctx context.Context, userID string, unreadOnly bool) ([]*Notification, error) {
+	notifications := []*Notification{}
+	if c.db == nil {
+		return notifications, nil
+	}
+
+	query := `
+		SELECT id, user_id, kind, title, COALESCE(body, ''), COALESCE(data, ''), read_at, created_at
+		FROM notifications WHERE user_id = ?`
+	if unreadOnly {
+		query += ` AND read_at IS NULL`
+	}
+	query += ` ORDER BY created_at DESC, id DESC LIMIT 200`
+
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n Notification
+		var data string
+		var readAt sql.NullTime
+		var createdAt time.Time
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Title, &n.Body, &data, &readAt, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %v", err)
+		}
+		if data != "" {
+			if err := json.Unmarshal([]byte(data), &n.Data); err != nil {
+				return nil, fmt.Errorf("invalid notification data: %v", err)
+			}
+		}
+		if readAt.Valid {
+			n.ReadAt = readAt.Time.UTC().Format(time.RFC3339)
+		}
+		n.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+		notifications = append(notifications, &n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate notifications: %v", err)
+	}
+	return notifications, nil
+}
+
+// MarkRead marks the user's notifications as read; with no ids, all of them.
+// It returns the number of notifications marked.
+func (c *NotificationClient) MarkRead(ctx context.Context, userID string, ids []int) (int, error) {
+	if c.db == nil {
+		return 0, ErrNoDatabase
+	}
+
+	query := `UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL`
+	args := []interface{}{c.clock.now(), userID}
+	if len(ids) > 0 {
+		query += ` AND id IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	result, err := c.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %v", err)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,482 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Mutation types of the etiquette quiz.
+const (
+	TypeQuizQuestion = "QuizQuestion"
+	TypeQuizAttempt  = "QuizAttempt"
+)
+
+// Quiz question kinds.
+const (
+	// QuizKindChoice asks to pick the correct choices; more than one answer makes it multi-select.
+	QuizKindChoice = "choice"
+	// QuizKindOrder asks to put all choices in the correct order, such as the steps of temizu.
+	QuizKindOrder = "order"
+)
+
+// QuizQuestion entity is a question of the quiz of a guide section in one locale.
+type QuizQuestion struct {
+	ID int `json:"id"`
+	// SectionSlug is the guide section the question belongs to.
+	SectionSlug string   `json:"section_slug"`
+	Locale      string   `json:"locale"`
+	Kind        string   `json:"kind"`
+	Prompt      string   `json:"prompt"`
+	Choices     []string `json:"choices"`
+	// Answer holds the indexes of the correct choices, or the choices in the correct order.
+	Answer      []int  `json:"answer,omitempty"`
+	Explanation string `json:"explanation,omitempty"`
+	Position    int    `json:"position"`
+	Active      bool   `json:"active"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// QuizAnswer is the answer given to one question: the picked choices, or all choices in order.
+type QuizAnswer struct {
+	QuestionID int   `json:"question_id"`
+	Choices    []int `json:"choices"`
+}
+
+// QuizAttempt entity is one graded attempt at the quiz of a section.
+type QuizAttempt struct {
+	ID          int          `json:"id"`
+	UserID      string       `json:"user_id"`
+	SectionSlug string       `json:"section_slug"`
+	Locale      string       `json:"locale"`
+	Answers     []QuizAnswer `json:"answers"`
+	// Score is the percentage of points earned, 0 to 100.
+	Score     float64 `json:"score"`
+	Passed    bool    `json:"passed"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// QuizProgress entity is a user's progress on the quiz of a section.
+type QuizProgress struct {
+	UserID      string  `json:"user_id"`
+	SectionSlug string  `json:"section_slug"`
+	Attempts    int     `json:"attempts"`
+	BestScore   float64 `json:"best_score"`
+	Passed      bool    `json:"passed"`
+	PassedAt    string  `json:"passed_at,omitempty"`
+	UpdatedAt   string  `json:"updated_at"`
+}
+
+// QuizFilter holds the search conditions for QuizClient.Questions.
+type QuizFilter struct {
+	SectionSlug string
+	Locale      string
+	ActiveOnly  bool
+}
+
+// ValidateQuizQuestion checks the kind, choices and answer of a question.
+func ValidateQuizQuestion(q *QuizQuestion) error {
+	if !guideSlugPattern.MatchString(q.SectionSlug) {
+		return fmt.Errorf("section_slug must be a guide section slug")
+	}
+	if q.Locale == "" {
+		return fmt.Errorf("locale is required")
+	}
+	if strings.TrimSpace(q.Prompt) == "" {
+		return fmt.Errorf("prompt is required")
+	}
+	if len(q.Choices) < 2 || len(q.Choices) > 10 {
+		return fmt.Errorf("a question needs 2 to 10 choices")
+	}
+	for _, c := range q.Choices {
+		if strings.TrimSpace(c) == "" {
+			return fmt.Errorf("choices must not be empty")
+		}
+	}
+
+	seen := map[int]bool{}
+	for _, a := range q.Answer {
+		if a < 0 || a >= len(q.Choices) {
+			return fmt.Errorf("answer %d is not a choice", a)
+		}
+		if seen[a] {
+			return fmt.Errorf("answer %d is repeated", a)
+		}
+		seen[a] = true
+	}
+	switch q.Kind {
+	case QuizKindChoice:
+		if len(q.Answer) == 0 {
+			return fmt.Errorf("answer must list the correct choices")
+		}
+	case QuizKindOrder:
+		if len(q.Answer) != len(q.Choices) {
+			return fmt.Errorf("answer must list every choice in the correct order")
+		}
+	default:
+		return fmt.Errorf("kind must be %s or %s", QuizKindChoice, QuizKindOrder)
+	}
+	return nil
+}
+
+// QuizClient is a client for the QuizQuestion, QuizAttempt and QuizProgress schemas.
+type QuizClient struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+}
+
+// quizQuestionColumns is the column list scanned by scanQuizQuestion.
+const quizQuestionColumns = `id, section_slug, locale, kind, prompt, choices, answer,
+	COALESCE(explanation, ''), position, active, created_at, updated_at`
+
+// scanQuizQuestion scans a question row.
+func scanQuizQuestion(row rowScanner) (*QuizQuestion, error) {
+	var q QuizQuestion
+	var choices, answer string
+	var createdAt, updatedAt time.Time
+	err := row.Scan(&q.ID, &q.SectionSlug, &q.Locale, &q.Kind, &q.Prompt, &choices, &answer,
+		&q.Explanation, &q.Position, &q.Active, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan quiz question: %v", err)
+	}
+	if err := json.Unmarshal([]byte(choices), &q.Choices); err != nil {
+		return nil, fmt.Errorf("invalid quiz choices: %v", err)
+	}
+	if err := json.Unmarshal([]byte(answer), &q.Answer); err != nil {
+		return nil, fmt.Errorf("invalid quiz answer: %v", err)
+	}
+	q.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	q.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return &q, nil
+}
+
+// Questions returns the questions matching the filter, by section and position.
+func (c *QuizClient) Questions(ctx context.Context, f QuizFilter) ([]*QuizQuestion, error) {
+	questions := []*QuizQuestion{}
+	if c.db == nil {
+		return questions, nil
+	}
+
+	var where []string
+	var args []interface{}
+	if f.SectionSlug != "" {
+		where = append(where, "section_slug = ?")
+		args = append(args, f.SectionSlug)
+	}
+	if f.Locale != "" {
+		where = append(where, "locale = ?")
+		args = append(args, f.Locale)
+	}
+	if f.ActiveOnly {
+		where = append(where, "active = TRUE")
+	}
+	query := `SELECT ` + quizQuestionColumns + ` FROM quiz_questions`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY section_slug, locale, position, id"
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quiz questions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		q, err := scanQuizQuestion(rows)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate quiz questions: %v", err)
+	}
+	return questions, nil
+}
+
+// Question returns a QuizQuestion entity by its id.
+func (c *QuizClient) Question(ctx context.Context, id int) (*QuizQuestion, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("quiz question not found")
+	}
+	q, err := scanQuizQuestion(c.db.QueryRowContext(ctx, `SELECT `+quizQuestionColumns+` FROM quiz_questions WHERE id = ?`, id))
+	if err != nil {
+		return nil, fmt.Errorf("quiz question not found")
+	}
+	return q, nil
+}
+
+// encodeQuizQuestion encodes the choices and answer of a question.
+func encodeQuizQuestion(q *QuizQuestion) (string, string, error) {
+	choices, err := json.Marshal(q.Choices)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode quiz choices: %v", err)
+	}
+	answer, err := json.Marshal(q.Answer)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode quiz answer: %v", err)
+	}
+	return string(choices), string(answer), nil
+}
+
+// CreateQuestion adds a question to the bank of a section and locale.
+func (c *QuizClient) CreateQuestion(ctx context.Context, q *QuizQuestion) (*QuizQuestion, error) {
+	if err := ValidateQuizQuestion(q); err != nil {
+		return nil, err
+	}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+	choices, answer, err := encodeQuizQuestion(q)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	now := c.clock.now()
+	id, err := c.db.insert(ctx, "id", `
+		INSERT INTO quiz_questions (section_slug, locale, kind, prompt, choices, answer, explanation, position, active,
+			created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, q.SectionSlug, q.Locale, q.Kind, q.Prompt, choices, answer, nullString(q.Explanation), q.Position, q.Active,
+		now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quiz question: %v", err)
+	}
+
+	created, err := c.Question(ctx, int(id))
+	if err != nil {
+		return nil, err
+	}
+	if err := mu.commit(&Mutation{Op: OpCreate, Type: TypeQuizQuestion, ID: created.ID, New: created}); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateQuestion replaces a question. Past attempts keep the score they were given.
+func (c *QuizClient) UpdateQuestion(ctx context.Context, q *QuizQuestion) (*QuizQuestion, error) {
+	if err := ValidateQuizQuestion(q); err != nil {
+		return nil, err
+	}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	old, err := c.Question(ctx, q.ID)
+	if err != nil {
+		return nil, err
+	}
+	choices, answer, err := encodeQuizQuestion(q)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = c.db.ExecContext(ctx, `
+		UPDATE quiz_questions SET section_slug = ?, locale = ?, kind = ?, prompt = ?, choices = ?, answer = ?,
+			explanation = ?, position = ?, active = ?, updated_at = ?
+		WHERE id = ?
+	`, q.SectionSlug, q.Locale, q.Kind, q.Prompt, choices, answer, nullString(q.Explanation), q.Position, q.Active,
+		c.clock.now(), q.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update quiz question: %v", err)
+	}
+
+	updated, err := c.Question(ctx, q.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := mu.commit(&Mutation{Op: OpUpdate, Type: TypeQuizQuestion, ID: q.ID, Old: old, New: updated}); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteQuestion removes a question.
+func (c *QuizClient) DeleteQuestion(ctx context.Context, id int) error {
+	if c.db == nil {
+		return ErrNoDatabase
+	}
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	old, err := c.Question(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := c.db.ExecContext(ctx, `DELETE FROM quiz_questions WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete quiz question: %v", err)
+	}
+	return mu.commit(&Mutation{Op: OpDelete, Type: TypeQuizQuestion, ID: id, Old: old})
+}
+
+// QuizzedSections returns the slugs of published guide sections that have active questions,
+// in guide order. Passing all of them completes the guide.
+func (c *QuizClient) QuizzedSections(ctx context.Context) ([]string, error) {
+	slugs := []string{}
+	if c.db == nil {
+		return slugs, nil
+	}
+
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT s.slug FROM guide_sections s
+		WHERE s.published_version IS NOT NULL
+		  AND EXISTS (SELECT 1 FROM quiz_questions q WHERE q.section_slug = s.slug AND q.active = TRUE)
+		GROUP BY s.slug
+		ORDER BY MIN(s.position), s.slug
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quizzed sections: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, fmt.Errorf("failed to scan quizzed section: %v", err)
+		}
+		slugs = append(slugs, slug)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate quizzed sections: %v", err)
+	}
+	return slugs, nil
+}
+
+// quizProgressColumns is the column list scanned by scanQuizProgress.
+const quizProgressColumns = `user_id, section_slug, attempts, best_score, passed, passed_at, updated_at`
+
+// scanQuizProgress scans a progress row.
+func scanQuizProgress(row rowScanner) (*QuizProgress, error) {
+	var p QuizProgress
+	var passedAt sql.NullTime
+	var updatedAt time.Time
+	if err := row.Scan(&p.UserID, &p.SectionSlug, &p.Attempts, &p.BestScore, &p.Passed, &passedAt, &updatedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan quiz progress: %v", err)
+	}
+	if passedAt.Valid {
+		p.PassedAt = passedAt.Time.UTC().Format(time.RFC3339)
+	}
+	p.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return &p, nil
+}
+
+// Progress returns the user's progress on every section they attempted.
+func (c *QuizClient) Progress(ctx context.Context, userID string) ([]*QuizProgress, error) {
+	progress := []*QuizProgress{}
+	if c.db == nil {
+		return progress, nil
+	}
+
+	rows, err := c.db.QueryContext(ctx, `SELECT `+quizProgressColumns+` FROM quiz_progress WHERE user_id = ? ORDER BY section_slug`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quiz progress: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanQuizProgress(rows)
+		if err != nil {
+			return nil, err
+		}
+		progress = append(progress, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate quiz progress: %v", err)
+	}
+	return progress, nil
+}
+
+// RecordAttempt saves a graded attempt and updates the user's progress on the section in
+// one transaction: the best score is kept, and a section once passed stays passed.
+func (c *QuizClient) RecordAttempt(ctx context.Context, a *QuizAttempt) (*QuizProgress, error) {
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+	answers, err := json.Marshal(a.Answers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode quiz answers: %v", err)
+	}
+
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	tx, err := begin(ctx, c.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := c.clock.now()
+	id, err := tx.insert(ctx, "id", `
+		INSERT INTO quiz_attempts (user_id, section_slug, locale, answers, score, passed, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, a.UserID, a.SectionSlug, a.Locale, string(answers), a.Score, a.Passed, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save quiz attempt: %v", err)
+	}
+	a.ID = int(id)
+
+	_, err = scanQuizProgress(tx.QueryRowContext(ctx, `
+		SELECT `+quizProgressColumns+` FROM quiz_progress WHERE user_id = ? AND section_slug = ?`+tx.dialect().ForUpdate(),
+		a.UserID, a.SectionSlug))
+	// passedAt is the time the section is passed at by this attempt, or NULL.
+	var passedAt interface{}
+	if a.Passed {
+		passedAt = now
+	}
+	if err != nil {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO quiz_progress (user_id, section_slug, attempts, best_score, passed, passed_at, updated_at)
+			VALUES (?, ?, 1, ?, ?, ?, ?)
+		`, a.UserID, a.SectionSlug, a.Score, a.Passed, passedAt, now)
+	} else {
+		// passed_at is assigned before passed so that it still sees the previous value.
+		_, err = tx.ExecContext(ctx, `
+			UPDATE quiz_progress SET attempts = attempts + 1, best_score = `+tx.dialect().Greatest("best_score", "?")+`,
+				passed_at = CASE WHEN passed THEN passed_at ELSE ? END,
+				passed = passed OR ?, updated_at = ?
+			WHERE user_id = ? AND section_slug = ?
+		`, a.Score, passedAt, a.Passed, now, a.UserID, a.SectionSlug)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update quiz progress: %v", err)
+	}
+
+	progress, err := scanQuizProgress(tx.QueryRowContext(ctx, `
+		SELECT `+quizProgressColumns+` FROM quiz_progress WHERE user_id = ? AND section_slug = ?
+	`, a.UserID, a.SectionSlug))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit quiz attempt: %v", err)
+	}
+
+	if err := mu.commit(&Mutation{Op: OpCreate, Type: TypeQuizAttempt, ID: a.ID, UserID: a.UserID, New: a}); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
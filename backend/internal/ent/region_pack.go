@@ -0,0 +1,107 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RegionPack entity is one version of the offline pack of a region. The manifest lists the
+// files of the pack and their hashes; the files themselves are rebuilt from the database.
+type RegionPack struct {
+	ID        int    `json:"id"`
+	RegionKey string `json:"region_key"`
+	Version   int    `json:"version"`
+	// ContentHash identifies the content of the version, so an unchanged rebuild reuses it.
+	ContentHash string `json:"content_hash"`
+	// Manifest is the JSON list of the files of the version.
+	Manifest  string `json:"-"`
+	CreatedAt string `json:"created_at"`
+}
+
+// RegionPackClient is a client for the RegionPack schema.
+type RegionPackClient struct {
+	db    dbtx
+	clock *clockSource
+}
+
+// regionPackColumns is the column list scanned by scanRegionPack.
+const regionPackColumns = `id, region_key, version, content_hash, manifest, created_at`
+
+// scanRegionPack scans a region pack row.
+func scanRegionPack(row rowScanner) (*RegionPack, error) {
+	var p RegionPack
+	var createdAt time.Time
+	if err := row.Scan(&p.ID, &p.RegionKey, &p.Version, &p.ContentHash, &p.Manifest, &createdAt); err != nil {
+		return nil, err
+	}
+	p.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	return &p, nil
+}
+
+// Latest returns the latest version of the region's pack, or nil if none was built yet.
+func (c *RegionPackClient) Latest(ctx context.Context, regionKey string) (*RegionPack, error) {
+	if c.db == nil {
+		return nil, nil
+	}
+	p, err := scanRegionPack(c.db.QueryRowContext(ctx, `
+		SELECT `+regionPackColumns+` FROM region_packs WHERE region_key = ? ORDER BY version DESC LIMIT 1
+	`, regionKey))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get region pack: %v", err)
+	}
+	return p, nil
+}
+
+// Get returns a version of the region's pack, or nil if it does not exist.
+func (c *RegionPackClient) Get(ctx context.Context, regionKey string, version int) (*RegionPack, error) {
+	if c.db == nil {
+		return nil, nil
+	}
+	p, err := scanRegionPack(c.db.QueryRowContext(ctx, `
+		SELECT `+regionPackColumns+` FROM region_packs WHERE region_key = ? AND version = ?
+	`, regionKey, version))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get region pack: %v", err)
+	}
+	return p, nil
+}
+
+// Save records a new version of the region's pack unless the latest version has the same
+// content hash, and returns the version the content belongs to.
+func (c *RegionPackClient) Save(ctx context.Context, regionKey, contentHash, manifest string) (*RegionPack, error) {
+	latest, err := c.Latest(ctx, regionKey)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && latest.ContentHash == contentHash {
+		return latest, nil
+	}
+
+	version := 1
+	if latest != nil {
+		version = latest.Version + 1
+	}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	_, err = c.db.ExecContext(ctx, `
+		INSERT INTO region_packs (region_key, version, content_hash, manifest, created_at) VALUES (?, ?, ?, ?, ?)
+	`, regionKey, version, contentHash, manifest, c.clock.now())
+	if err != nil {
+		// A concurrent build may have saved the same version; use it if the content matches.
+		if p, getErr := c.Get(ctx, regionKey, version); getErr == nil && p != nil && p.ContentHash == contentHash {
+			return p, nil
+		}
+		return nil, fmt.Errorf("failed to save region pack: %v", err)
+	}
+	return c.Get(ctx, regionKey, version)
+}
@@ -0,0 +1,78 @@
+package ent
+
+import (
+	"context"
+	"time"
+)
+
+// TempleRepository stores Temple entities. The Temple builders and client validate input,
+// fill in defaults and run the hooks; a repository only stores and loads.
+//
+// Deleted temples are kept until purged but are left out of Get and Each.
+type TempleRepository interface {
+	// Create stores a new temple created at now and returns it as stored, with the ID and
+	// timestamps set.
+	Create(ctx context.Context, t *Temple, now time.Time) (*Temple, error)
+	// Get returns a temple that is not deleted by its id.
+	Get(ctx context.Context, id int) (*Temple, error)
+	// Each calls fn for the temples matching the filter ordered by name, skipping the first
+	// offset and stopping after limit temples when limit > 0.
+	Each(ctx context.Context, f TempleFilter, limit, offset int, fn func(*Temple) error) error
+	// Delete marks a temple as deleted at now and sets its updated_at to now. Deleting a
+	// deleted or missing temple does nothing.
+	Delete(ctx context.Context, id int, now time.Time) error
+	// Restore brings a deleted temple back and sets its updated_at to now, or returns
+	// ErrNotInTrash if it is not deleted.
+	Restore(ctx context.Context, id int, now time.Time) error
+	// PurgeDeleted permanently deletes the temples deleted before the time that no
+	// collection, including those in the trash, refers to. It returns their ids.
+	PurgeDeleted(ctx context.Context, before time.Time) ([]int, error)
+}
+
+// GoshuinCollectionRepository stores GoshuinCollection entities together with their tags.
+//
+// Collections in the trash are kept until purged but are left out of Get and of Each unless
+// the filter asks for the trash.
+type GoshuinCollectionRepository interface {
+	// Create stores a new collection collected at the given time and created at now, and
+	// returns it as stored. The temple must exist and the client ID must be unique for the user.
+	Create(ctx context.Context, gc *GoshuinCollection, collectedAt, now time.Time) (*GoshuinCollection, error)
+	// Get returns a collection that is not in the trash by its id.
+	Get(ctx context.Context, id int) (*GoshuinCollection, error)
+	// GetTrashed returns a collection in the trash by its id.
+	GetTrashed(ctx context.Context, id int) (*GoshuinCollection, error)
+	// GetByClientID returns a user's collection by its client ID, including one in the trash,
+	// or nil if there is none.
+	GetByClientID(ctx context.Context, userID, clientID string) (*GoshuinCollection, error)
+	// Update applies the change to a collection and sets its updated_at to now.
+	Update(ctx context.Context, id int, change *GoshuinCollectionChange, now time.Time) error
+	// Delete moves a collection to the trash at now and sets its updated_at to now. Deleting
+	// one already in the trash does nothing.
+	Delete(ctx context.Context, id int, now time.Time) error
+	// Restore takes a collection out of the trash and sets its updated_at to now, or returns
+	// ErrNotInTrash if it is not there.
+	Restore(ctx context.Context, id int, now time.Time) error
+	// Purge permanently deletes a collection in the trash, or returns ErrNotInTrash.
+	Purge(ctx context.Context, id int) error
+	// Each calls fn for the collections matching the filter: the newest collected first,
+	// by page for a book and the most recently deleted first for the trash. withTemple
+	// loads Edges.Temple.
+	Each(ctx context.Context, f GoshuinCollectionFilter, withTemple bool, fn func(*GoshuinCollection) error) error
+}
+
+// GoshuinCollectionChange holds the fields set on a GoshuinCollectionUpdateOneID. Nil fields
+// are left unchanged; zero numbers and empty strings clear the field.
+type GoshuinCollectionChange struct {
+	ImageURL *string
+	Notes    *string
+	// CollectedAt is stored in UTC together with its offset.
+	CollectedAt *time.Time
+	// Tags replaces the tags when not nil.
+	Tags           []string
+	Rating         *int
+	FeePaid        *int
+	WaitingMinutes *int
+	HallName       *string
+	BookID         *int
+	Page           *int
+}
@@ -0,0 +1,438 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"stamp-backend/internal/clock"
+)
+
+// NewMemoryRepositories returns repositories that keep temples and goshuin collections in
+// memory, for the demo mode and tests. They behave like the SQL repositories: IDs are
+// assigned in order, a collection must refer to an existing temple and deleted entities
+// stay until purged. Entities are copied in and out, so callers may modify what they get.
+func NewMemoryRepositories() (TempleRepository, GoshuinCollectionRepository) {
+	store := &memoryStore{
+		temples:     map[int]*memoryTemple{},
+		collections: map[int]*memoryCollection{},
+	}
+	return &memoryTempleRepository{store}, &memoryGoshuinCollectionRepository{store}
+}
+
+// memoryStore holds the entities of both repositories, so that collections can check and
+// load their temples.
+type memoryStore struct {
+	mu             sync.RWMutex
+	temples        map[int]*memoryTemple
+	collections    map[int]*memoryCollection
+	lastTemple     int
+	lastCollection int
+}
+
+type memoryTemple struct {
+	temple    Temple
+	deletedAt time.Time
+}
+
+type memoryCollection struct {
+	collection  GoshuinCollection
+	collectedAt time.Time
+	deletedAt   time.Time
+}
+
+// cloneTemple returns a copy of the temple that shares no pointers with it.
+func cloneTemple(t *Temple) *Temple {
+	c := *t
+	for _, p := range []**bool{&c.ReservationRequired, &c.KakiokiOnly, &c.BookDropOff, &c.CashOnly} {
+		if *p != nil {
+			v := **p
+			*p = &v
+		}
+	}
+	c.Localized = nil
+	return &c
+}
+
+// collection returns a copy of the stored collection, with its temple if withTemple.
+func (s *memoryStore) collection(m *memoryCollection, withTemple bool) *GoshuinCollection {
+	c := m.collection
+	c.Tags = append([]string{}, c.Tags...)
+	c.Edges = GoshuinCollectionEdges{}
+	if withTemple {
+		if t, ok := s.temples[c.TempleID]; ok {
+			c.Edges.Temple = cloneTemple(&t.temple)
+		}
+	}
+	return &c
+}
+
+// memoryTempleRepository is the TempleRepository of NewMemoryRepositories.
+type memoryTempleRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryTempleRepository) Create(ctx context.Context, t *Temple, now time.Time) (*Temple, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastTemple++
+	stored := cloneTemple(t)
+	stored.ID = s.lastTemple
+	stored.CreatedAt = now.UTC().Format(time.RFC3339)
+	stored.UpdatedAt = stored.CreatedAt
+	s.temples[stored.ID] = &memoryTemple{temple: *stored}
+	return cloneTemple(stored), nil
+}
+
+func (r *memoryTempleRepository) Get(ctx context.Context, id int) (*Temple, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.temples[id]
+	if !ok || !t.deletedAt.IsZero() {
+		return nil, fmt.Errorf("failed to get temple: %v", sql.ErrNoRows)
+	}
+	return cloneTemple(&t.temple), nil
+}
+
+func (r *memoryTempleRepository) Each(ctx context.Context, f TempleFilter, limit, offset int, fn func(*Temple) error) error {
+	s := r.store
+	s.mu.RLock()
+	var temples []*Temple
+	for _, t := range s.temples {
+		if t.deletedAt.IsZero() && templeMatches(&t.temple, f) {
+			temples = append(temples, cloneTemple(&t.temple))
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(temples, func(i, j int) bool {
+		if temples[i].Name != temples[j].Name {
+			return temples[i].Name < temples[j].Name
+		}
+		return temples[i].ID < temples[j].ID
+	})
+	if limit > 0 {
+		temples = temples[min(offset, len(temples)):]
+		temples = temples[:min(limit, len(temples))]
+	}
+
+	for _, t := range temples {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templeMatches reports whether a temple matches the filter, like sqlTempleRepository.query.
+func templeMatches(t *Temple, f TempleFilter) bool {
+	if !f.IncludeInactive && !t.IsActive {
+		return false
+	}
+	if f.Search != "" {
+		search := strings.ToLower(f.Search)
+		if !strings.Contains(strings.ToLower(t.Name), search) && !strings.Contains(strings.ToLower(t.NameEn), search) {
+			return false
+		}
+	}
+	if f.Prefecture != "" && t.Prefecture != f.Prefecture {
+		return false
+	}
+	if f.Kind != "" && t.Kind != f.Kind {
+		return false
+	}
+	if b := f.BBox; b != nil {
+		if t.Latitude < b.MinLat || t.Latitude > b.MaxLat || t.Longitude < b.MinLng || t.Longitude > b.MaxLng {
+			return false
+		}
+	}
+	return f.Procedure.matches(t)
+}
+
+func (r *memoryTempleRepository) Delete(ctx context.Context, id int, now time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.temples[id]; ok && t.deletedAt.IsZero() {
+		t.deletedAt = now.UTC()
+		t.temple.UpdatedAt = now.UTC().Format(time.RFC3339)
+	}
+	return nil
+}
+
+func (r *memoryTempleRepository) Restore(ctx context.Context, id int, now time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.temples[id]
+	if !ok || t.deletedAt.IsZero() {
+		return ErrNotInTrash
+	}
+	t.deletedAt = time.Time{}
+	t.temple.UpdatedAt = now.UTC().Format(time.RFC3339)
+	return nil
+}
+
+func (r *memoryTempleRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]int, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	referred := map[int]bool{}
+	for _, c := range s.collections {
+		referred[c.collection.TempleID] = true
+	}
+
+	var ids []int
+	for id, t := range s.temples {
+		if !t.deletedAt.IsZero() && t.deletedAt.Before(before) && !referred[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		delete(s.temples, id)
+	}
+	return ids, nil
+}
+
+// memoryGoshuinCollectionRepository is the GoshuinCollectionRepository of NewMemoryRepositories.
+type memoryGoshuinCollectionRepository struct {
+	store *memoryStore
+}
+
+func (r *memoryGoshuinCollectionRepository) Create(ctx context.Context, gc *GoshuinCollection, collectedAt, now time.Time) (*GoshuinCollection, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.temples[gc.TempleID]; !ok {
+		return nil, fmt.Errorf("failed to create goshuin collection: FOREIGN KEY constraint failed")
+	}
+	for _, c := range s.collections {
+		if c.collection.UserID == gc.UserID && c.collection.ClientID == gc.ClientID {
+			return nil, fmt.Errorf("failed to create goshuin collection: UNIQUE constraint failed: goshuin_collections.user_id, goshuin_collections.client_id")
+		}
+	}
+
+	s.lastCollection++
+	stored := &memoryCollection{collection: *gc, collectedAt: collectedAt.UTC()}
+	c := &stored.collection
+	c.ID = s.lastCollection
+	c.Tags = NormalizeTags(gc.Tags)
+	c.CollectedAt = collectedAt.In(clock.Zone(clock.OffsetMinutes(collectedAt))).Format(time.RFC3339)
+	c.CreatedAt = now.UTC().Format(time.RFC3339)
+	c.UpdatedAt = c.CreatedAt
+	c.DeletedAt = ""
+	c.Edges = GoshuinCollectionEdges{}
+	s.collections[c.ID] = stored
+	return s.collection(stored, false), nil
+}
+
+func (r *memoryGoshuinCollectionRepository) Get(ctx context.Context, id int) (*GoshuinCollection, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.collections[id]
+	if !ok || !c.deletedAt.IsZero() {
+		return nil, fmt.Errorf("failed to get goshuin collection: %v", sql.ErrNoRows)
+	}
+	return s.collection(c, false), nil
+}
+
+func (r *memoryGoshuinCollectionRepository) GetTrashed(ctx context.Context, id int) (*GoshuinCollection, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.collections[id]
+	if !ok || c.deletedAt.IsZero() {
+		return nil, fmt.Errorf("failed to get trashed goshuin collection: %v", sql.ErrNoRows)
+	}
+	return s.collection(c, false), nil
+}
+
+func (r *memoryGoshuinCollectionRepository) GetByClientID(ctx context.Context, userID, clientID string) (*GoshuinCollection, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.collections {
+		if c.collection.UserID == userID && c.collection.ClientID == clientID {
+			return s.collection(c, false), nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryGoshuinCollectionRepository) Update(ctx context.Context, id int, change *GoshuinCollectionChange, now time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.collections[id]
+	if !ok {
+		return nil
+	}
+	c := &stored.collection
+	if change.ImageURL != nil {
+		c.ImageURL = *change.ImageURL
+	}
+	if change.Notes != nil {
+		c.Notes = *change.Notes
+	}
+	if at := change.CollectedAt; at != nil {
+		stored.collectedAt = at.UTC()
+		c.CollectedAt = at.In(clock.Zone(clock.OffsetMinutes(*at))).Format(time.RFC3339)
+	}
+	if change.Tags != nil {
+		c.Tags = NormalizeTags(change.Tags)
+	}
+	if change.Rating != nil {
+		c.Rating = *change.Rating
+	}
+	if change.FeePaid != nil {
+		c.FeePaid = *change.FeePaid
+	}
+	if change.WaitingMinutes != nil {
+		c.WaitingMinutes = *change.WaitingMinutes
+	}
+	if change.HallName != nil {
+		c.HallName = *change.HallName
+	}
+	if change.BookID != nil {
+		c.BookID = *change.BookID
+	}
+	if change.Page != nil {
+		c.Page = *change.Page
+	}
+	c.UpdatedAt = now.UTC().Format(time.RFC3339)
+	return nil
+}
+
+func (r *memoryGoshuinCollectionRepository) Delete(ctx context.Context, id int, now time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.collections[id]; ok && c.deletedAt.IsZero() {
+		c.deletedAt = now.UTC()
+		c.collection.DeletedAt = c.deletedAt.Format(time.RFC3339)
+		c.collection.UpdatedAt = c.collection.DeletedAt
+	}
+	return nil
+}
+
+func (r *memoryGoshuinCollectionRepository) Restore(ctx context.Context, id int, now time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.collections[id]
+	if !ok || c.deletedAt.IsZero() {
+		return ErrNotInTrash
+	}
+	c.deletedAt = time.Time{}
+	c.collection.DeletedAt = ""
+	c.collection.UpdatedAt = now.UTC().Format(time.RFC3339)
+	return nil
+}
+
+func (r *memoryGoshuinCollectionRepository) Purge(ctx context.Context, id int) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.collections[id]
+	if !ok || c.deletedAt.IsZero() {
+		return ErrNotInTrash
+	}
+	delete(s.collections, id)
+	return nil
+}
+
+func (r *memoryGoshuinCollectionRepository) Each(ctx context.Context, f GoshuinCollectionFilter, withTemple bool, fn func(*GoshuinCollection) error) error {
+	s := r.store
+	s.mu.RLock()
+	var matched []*memoryCollection
+	for _, c := range s.collections {
+		if collectionMatches(c, f) {
+			matched = append(matched, c)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		switch {
+		case f.Trashed:
+			if !a.deletedAt.Equal(b.deletedAt) {
+				return a.deletedAt.After(b.deletedAt)
+			}
+			return a.collection.ID > b.collection.ID
+		case f.BookID > 0:
+			if a.collection.Page != b.collection.Page {
+				return a.collection.Page < b.collection.Page
+			}
+			if !a.collectedAt.Equal(b.collectedAt) {
+				return a.collectedAt.Before(b.collectedAt)
+			}
+			return a.collection.ID < b.collection.ID
+		default:
+			if !a.collectedAt.Equal(b.collectedAt) {
+				return a.collectedAt.After(b.collectedAt)
+			}
+			return a.collection.ID > b.collection.ID
+		}
+	})
+	collections := make([]*GoshuinCollection, len(matched))
+	for i, c := range matched {
+		collections[i] = s.collection(c, withTemple)
+	}
+	s.mu.RUnlock()
+
+	for _, c := range collections {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectionMatches reports whether a collection matches the filter, like the conditions of
+// sqlGoshuinCollectionRepository.Each.
+func collectionMatches(m *memoryCollection, f GoshuinCollectionFilter) bool {
+	c := &m.collection
+	if f.Trashed {
+		if m.deletedAt.IsZero() || (!f.DeletedBefore.IsZero() && !m.deletedAt.Before(f.DeletedBefore)) {
+			return false
+		}
+	} else if !m.deletedAt.IsZero() {
+		return false
+	}
+	if f.UserID != "" && c.UserID != f.UserID {
+		return false
+	}
+	if f.BookID > 0 && c.BookID != f.BookID {
+		return false
+	}
+	for _, tag := range f.Tags {
+		i := sort.SearchStrings(c.Tags, tag)
+		if i == len(c.Tags) || c.Tags[i] != tag {
+			return false
+		}
+	}
+	if f.Rating > 0 && c.Rating != f.Rating {
+		return false
+	}
+	return f.MinRating <= 0 || c.Rating >= f.MinRating
+}
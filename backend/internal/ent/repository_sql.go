@@ -0,0 +1,413 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"stamp-backend/internal/clock"
+)
+
+// sqlTempleRepository stores temples in the temples table.
+type sqlTempleRepository struct {
+	db dbtx
+}
+
+func (r *sqlTempleRepository) Create(ctx context.Context, t *Temple, now time.Time) (*Temple, error) {
+	query := `
+		INSERT INTO temples (name, name_en, description, description_en, latitude, longitude,
+		                    address, phone, website, instagram, twitter, opening_hours,
+		                    goshuin_fee, goshuin_office, prefecture, kind, is_active, contributed_by,
+		                    created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	id, err := r.db.insert(ctx, "id", query,
+		t.Name, t.NameEn, t.Description, t.DescriptionEn,
+		t.Latitude, t.Longitude, t.Address, t.Phone,
+		t.Website, t.Instagram, t.Twitter, t.OpeningHours,
+		t.GoshuinFee, t.GoshuinOffice, t.Prefecture, t.Kind,
+		t.IsActive, nullString(t.ContributedBy),
+		now.UTC(), now.UTC(),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temple: %v", err)
+	}
+
+	return r.Get(ctx, int(id))
+}
+
+func (r *sqlTempleRepository) Get(ctx context.Context, id int) (*Temple, error) {
+	query := `SELECT ` + templeColumns + ` FROM temples WHERE id = ? AND deleted_at IS NULL`
+
+	temple, err := scanTemple(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get temple: %v", err)
+	}
+
+	return temple, nil
+}
+
+func (r *sqlTempleRepository) Each(ctx context.Context, f TempleFilter, limit, offset int, fn func(*Temple) error) error {
+	query, args := r.query(f, limit, offset)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query temples: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		temple, err := scanTemple(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(temple); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate temples: %v", err)
+	}
+	return nil
+}
+
+// query builds the SELECT statement for Each.
+func (r *sqlTempleRepository) query(f TempleFilter, limit, offset int) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+
+	where = append(where, "deleted_at IS NULL")
+	if !f.IncludeInactive {
+		where = append(where, "is_active = TRUE")
+	}
+	if f.Search != "" {
+		like := r.db.dialect().Like()
+		pattern := "%" + f.Search + "%"
+		where = append(where, "(name "+like+" ? OR name_en "+like+" ?)")
+		args = append(args, pattern, pattern)
+	}
+	if f.Prefecture != "" {
+		where = append(where, "prefecture = ?")
+		args = append(args, f.Prefecture)
+	}
+	if f.Kind != "" {
+		where = append(where, "kind = ?")
+		args = append(args, f.Kind)
+	}
+	if b := f.BBox; b != nil {
+		where = append(where, "latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?")
+		args = append(args, b.MinLat, b.MaxLat, b.MinLng, b.MaxLng)
+	}
+	procedureWhere, procedureArgs := f.Procedure.where()
+	where = append(where, procedureWhere...)
+	args = append(args, procedureArgs...)
+
+	query := `SELECT ` + templeColumns + ` FROM temples WHERE ` + strings.Join(where, " AND ")
+	query += " ORDER BY name"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+		if offset > 0 {
+			query += fmt.Sprintf(" OFFSET %d", offset)
+		}
+	}
+	return query, args
+}
+
+func (r *sqlTempleRepository) Delete(ctx context.Context, id int, now time.Time) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE temples SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL`, now.UTC(), now.UTC(), id); err != nil {
+		return fmt.Errorf("failed to delete temple: %v", err)
+	}
+	return nil
+}
+
+func (r *sqlTempleRepository) Restore(ctx context.Context, id int, now time.Time) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE temples SET deleted_at = NULL, updated_at = ? WHERE id = ? AND deleted_at IS NOT NULL`, now.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to restore temple: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotInTrash
+	}
+	return nil
+}
+
+func (r *sqlTempleRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id FROM temples t
+		WHERE t.deleted_at IS NOT NULL AND t.deleted_at < ?
+		  AND NOT EXISTS (SELECT 1 FROM goshuin_collections gc WHERE gc.temple_id = t.id)
+	`, before.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deleted temples: %v", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan deleted temple: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate deleted temples: %v", err)
+	}
+
+	var purged []int
+	for _, id := range ids {
+		result, err := r.db.ExecContext(ctx, `
+			DELETE FROM temples WHERE id = ? AND deleted_at IS NOT NULL
+			  AND NOT EXISTS (SELECT 1 FROM goshuin_collections gc WHERE gc.temple_id = temples.id)
+		`, id)
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge temple: %v", err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n > 0 {
+			purged = append(purged, id)
+		}
+	}
+	return purged, nil
+}
+
+// sqlGoshuinCollectionRepository stores goshuin collections in the goshuin_collections table,
+// their tags in goshuin_collection_tags and keeps the cover photo in step with image_url.
+type sqlGoshuinCollectionRepository struct {
+	db dbtx
+}
+
+func (r *sqlGoshuinCollectionRepository) Create(ctx context.Context, gc *GoshuinCollection, collectedAt, now time.Time) (*GoshuinCollection, error) {
+	query := `
+		INSERT INTO goshuin_collections (user_id, client_id, temple_id, image_url, notes,
+			rating, fee_paid, waiting_minutes, hall_name, book_id, page, collected_at, collected_tz_offset,
+			created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	id, err := r.db.insert(ctx, "id", query,
+		gc.UserID, gc.ClientID, gc.TempleID, gc.ImageURL, gc.Notes,
+		nullInt(gc.Rating), nullInt(gc.FeePaid), nullInt(gc.WaitingMinutes),
+		nullString(gc.HallName), nullInt(gc.BookID), nullInt(gc.Page),
+		collectedAt.UTC(), clock.OffsetMinutes(collectedAt),
+		now.UTC(), now.UTC(),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create goshuin collection: %v", err)
+	}
+
+	if err := replaceTags(ctx, r.db, int(id), gc.Tags); err != nil {
+		return nil, err
+	}
+	if err := setCoverURL(ctx, r.db, int(id), gc.ImageURL, now); err != nil {
+		return nil, err
+	}
+
+	return r.Get(ctx, int(id))
+}
+
+func (r *sqlGoshuinCollectionRepository) Get(ctx context.Context, id int) (*GoshuinCollection, error) {
+	query := `SELECT ` + goshuinCollectionSelect(r.db.dialect(), "gc") + ` FROM goshuin_collections gc WHERE gc.id = ? AND gc.deleted_at IS NULL`
+
+	collection, err := scanGoshuinCollection(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get goshuin collection: %v", err)
+	}
+
+	return collection, nil
+}
+
+func (r *sqlGoshuinCollectionRepository) GetTrashed(ctx context.Context, id int) (*GoshuinCollection, error) {
+	query := `SELECT ` + goshuinCollectionSelect(r.db.dialect(), "gc") + ` FROM goshuin_collections gc WHERE gc.id = ? AND gc.deleted_at IS NOT NULL`
+
+	collection, err := scanGoshuinCollection(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trashed goshuin collection: %v", err)
+	}
+	return collection, nil
+}
+
+func (r *sqlGoshuinCollectionRepository) GetByClientID(ctx context.Context, userID, clientID string) (*GoshuinCollection, error) {
+	var id int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id FROM goshuin_collections WHERE user_id = ? AND client_id = ?
+	`, userID, clientID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get goshuin collection: %v", err)
+	}
+
+	query := `SELECT ` + goshuinCollectionSelect(r.db.dialect(), "gc") + ` FROM goshuin_collections gc WHERE gc.id = ?`
+
+	return scanGoshuinCollection(r.db.QueryRowContext(ctx, query, id))
+}
+
+func (r *sqlGoshuinCollectionRepository) Update(ctx context.Context, id int, change *GoshuinCollectionChange, now time.Time) error {
+	var sets []string
+	var args []interface{}
+	assign := func(column string, value interface{}) {
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
+	}
+	if change.ImageURL != nil {
+		assign("image_url", *change.ImageURL)
+	}
+	if change.Notes != nil {
+		assign("notes", *change.Notes)
+	}
+	if change.CollectedAt != nil {
+		assign("collected_at", change.CollectedAt.UTC())
+		assign("collected_tz_offset", clock.OffsetMinutes(*change.CollectedAt))
+	}
+	if change.Rating != nil {
+		assign("rating", nullInt(*change.Rating))
+	}
+	if change.FeePaid != nil {
+		assign("fee_paid", nullInt(*change.FeePaid))
+	}
+	if change.WaitingMinutes != nil {
+		assign("waiting_minutes", nullInt(*change.WaitingMinutes))
+	}
+	if change.HallName != nil {
+		assign("hall_name", nullString(*change.HallName))
+	}
+	if change.BookID != nil {
+		assign("book_id", nullInt(*change.BookID))
+	}
+	if change.Page != nil {
+		assign("page", nullInt(*change.Page))
+	}
+
+	assign("updated_at", now.UTC())
+	query := `UPDATE goshuin_collections SET ` + strings.Join(sets, ", ") + ` WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, append(args, id)...); err != nil {
+		return fmt.Errorf("failed to update goshuin collection: %v", err)
+	}
+
+	if change.Tags != nil {
+		if err := replaceTags(ctx, r.db, id, change.Tags); err != nil {
+			return err
+		}
+	}
+	if change.ImageURL != nil {
+		if *change.ImageURL == "" {
+			return setCover(ctx, r.db, id, 0, now)
+		}
+		return setCoverURL(ctx, r.db, id, *change.ImageURL, now)
+	}
+	return nil
+}
+
+func (r *sqlGoshuinCollectionRepository) Delete(ctx context.Context, id int, now time.Time) error {
+	query := `UPDATE goshuin_collections SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, now.UTC(), now.UTC(), id); err != nil {
+		return fmt.Errorf("failed to delete goshuin collection: %v", err)
+	}
+	return nil
+}
+
+func (r *sqlGoshuinCollectionRepository) Restore(ctx context.Context, id int, now time.Time) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE goshuin_collections SET deleted_at = NULL, updated_at = ? WHERE id = ? AND deleted_at IS NOT NULL`, now.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to restore goshuin collection: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotInTrash
+	}
+	return nil
+}
+
+func (r *sqlGoshuinCollectionRepository) Purge(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM goshuin_collections WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to purge goshuin collection: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotInTrash
+	}
+	return nil
+}
+
+func (r *sqlGoshuinCollectionRepository) Each(ctx context.Context, f GoshuinCollectionFilter, withTemple bool, fn func(*GoshuinCollection) error) error {
+	columns := goshuinCollectionSelect(r.db.dialect(), "gc")
+	from := "goshuin_collections gc"
+	if withTemple {
+		columns += ", " + prefixColumns("t", templeColumns)
+		from += " JOIN temples t ON t.id = gc.temple_id"
+	}
+
+	var where []string
+	var args []interface{}
+	if f.Trashed {
+		where = append(where, "gc.deleted_at IS NOT NULL")
+		if !f.DeletedBefore.IsZero() {
+			where = append(where, "gc.deleted_at < ?")
+			args = append(args, f.DeletedBefore.UTC())
+		}
+	} else {
+		where = append(where, "gc.deleted_at IS NULL")
+	}
+	if f.UserID != "" {
+		where = append(where, "gc.user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.BookID > 0 {
+		where = append(where, "gc.book_id = ?")
+		args = append(args, f.BookID)
+	}
+	for _, tag := range f.Tags {
+		where = append(where, "EXISTS (SELECT 1 FROM goshuin_collection_tags gct WHERE gct.collection_id = gc.id AND gct.tag = ?)")
+		args = append(args, tag)
+	}
+	if f.Rating > 0 {
+		where = append(where, "gc.rating = ?")
+		args = append(args, f.Rating)
+	}
+	if f.MinRating > 0 {
+		where = append(where, "gc.rating >= ?")
+		args = append(args, f.MinRating)
+	}
+
+	query := "SELECT " + columns + " FROM " + from + " WHERE " + strings.Join(where, " AND ")
+	if f.Trashed {
+		query += " ORDER BY gc.deleted_at DESC, gc.id DESC"
+	} else if f.BookID > 0 {
+		query += " ORDER BY gc.page, gc.collected_at, gc.id"
+	} else {
+		query += " ORDER BY gc.collected_at DESC, gc.id DESC"
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query goshuin collections: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var collection *GoshuinCollection
+		if withTemple {
+			collection, err = scanGoshuinCollectionWithTemple(rows)
+		} else {
+			collection, err = scanGoshuinCollection(rows)
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(collection); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate goshuin collections: %v", err)
+	}
+	return nil
+}
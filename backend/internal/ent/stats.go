@@ -0,0 +1,255 @@
+package ent
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/dialect"
+	"stamp-backend/internal/geo"
+)
+
+// CollectionStats is the summary of a user's goshuin collection.
+type CollectionStats struct {
+	TotalStamps   int            `json:"total_stamps"`
+	UniqueTemples int            `json:"unique_temples"`
+	ByKind        map[string]int `json:"by_kind"`
+	ByPrefecture  []GroupCount   `json:"by_prefecture"`
+	ByMonth       []GroupCount   `json:"by_month"`
+	FirstStamp    *StampSummary  `json:"first_stamp,omitempty"`
+	LatestStamp   *StampSummary  `json:"latest_stamp,omitempty"`
+	// LongestStreakDays is the longest run of consecutive days with at least one stamp.
+	LongestStreakDays int `json:"longest_streak_days"`
+	// DistanceKm is the great-circle distance between consecutive stamps in collection order.
+	DistanceKm float64              `json:"distance_km"`
+	Completion []PrefectureProgress `json:"completion"`
+}
+
+// GroupCount is the number of stamps and unique temples in a group.
+type GroupCount struct {
+	Key           string `json:"key"`
+	Stamps        int    `json:"stamps"`
+	UniqueTemples int    `json:"unique_temples"`
+}
+
+// StampSummary identifies a single stamp in the statistics.
+type StampSummary struct {
+	CollectionID int    `json:"collection_id"`
+	TempleID     int    `json:"temple_id"`
+	TempleName   string `json:"temple_name"`
+	TempleNameEn string `json:"temple_name_en"`
+	CollectedAt  string `json:"collected_at"`
+}
+
+// PrefectureProgress is the share of active temples in a prefecture that the user has visited.
+type PrefectureProgress struct {
+	Prefecture string  `json:"prefecture"`
+	Collected  int     `json:"collected"`
+	Total      int     `json:"total"`
+	Percent    float64 `json:"percent"`
+}
+
+// Stats computes the collection statistics of the user with SQL aggregates.
+func (c *GoshuinCollectionClient) Stats(ctx context.Context, userID string) (*CollectionStats, error) {
+	stats := &CollectionStats{
+		ByKind:       map[string]int{TempleKindTemple: 0, TempleKindShrine: 0},
+		ByPrefecture: []GroupCount{},
+		ByMonth:      []GroupCount{},
+		Completion:   []PrefectureProgress{},
+	}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	err := c.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT temple_id)
+		FROM goshuin_collections WHERE user_id = ? AND deleted_at IS NULL
+	`, userID).Scan(&stats.TotalStamps, &stats.UniqueTemples)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count goshuin collections: %v", err)
+	}
+	if stats.TotalStamps == 0 {
+		return stats, c.completion(ctx, userID, stats)
+	}
+
+	kinds, err := c.groupCounts(ctx, "t.kind", userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range kinds {
+		stats.ByKind[g.Key] = g.Stamps
+	}
+
+	if stats.ByPrefecture, err = c.groupCounts(ctx, "t.prefecture", userID); err != nil {
+		return nil, err
+	}
+	if stats.ByMonth, err = c.groupCounts(ctx, c.db.dialect().FormatDate(localCollectedAt(c.db.dialect(), "gc"), "%Y-%m"), userID); err != nil {
+		return nil, err
+	}
+
+	if stats.FirstStamp, err = c.stampSummary(ctx, userID, "ASC"); err != nil {
+		return nil, err
+	}
+	if stats.LatestStamp, err = c.stampSummary(ctx, userID, "DESC"); err != nil {
+		return nil, err
+	}
+
+	if stats.LongestStreakDays, err = c.longestStreak(ctx, userID); err != nil {
+		return nil, err
+	}
+	if stats.DistanceKm, err = c.distance(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return stats, c.completion(ctx, userID, stats)
+}
+
+// localCollectedAt returns the SQL expression of collected_at in the offset it was recorded with,
+// so that months and days follow the collector's calendar rather than UTC.
+func localCollectedAt(d dialect.Dialect, alias string) string {
+	return d.AddMinutes(alias+".collected_at", "COALESCE("+alias+".collected_tz_offset, 0)")
+}
+
+// groupCounts counts the user's stamps grouped by the given expression.
+func (c *GoshuinCollectionClient) groupCounts(ctx context.Context, expr, userID string) ([]GroupCount, error) {
+	query := `
+		SELECT ` + expr + ` AS grp, COUNT(*), COUNT(DISTINCT gc.temple_id)
+		FROM goshuin_collections gc JOIN temples t ON t.id = gc.temple_id
+		WHERE gc.user_id = ? AND gc.deleted_at IS NULL
+		GROUP BY grp ORDER BY grp
+	`
+
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate goshuin collections: %v", err)
+	}
+	defer rows.Close()
+
+	groups := []GroupCount{}
+	for rows.Next() {
+		var g GroupCount
+		if err := rows.Scan(&g.Key, &g.Stamps, &g.UniqueTemples); err != nil {
+			return nil, fmt.Errorf("failed to scan aggregate: %v", err)
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// stampSummary returns the first (ASC) or latest (DESC) stamp of the user.
+func (c *GoshuinCollectionClient) stampSummary(ctx context.Context, userID, order string) (*StampSummary, error) {
+	query := `
+		SELECT gc.id, gc.temple_id, t.name, t.name_en, gc.collected_at, COALESCE(gc.collected_tz_offset, 0)
+		FROM goshuin_collections gc JOIN temples t ON t.id = gc.temple_id
+		WHERE gc.user_id = ? AND gc.deleted_at IS NULL
+		ORDER BY gc.collected_at ` + order + `, gc.id ` + order + `
+		LIMIT 1
+	`
+
+	var s StampSummary
+	var collectedAt time.Time
+	var offset int
+	err := c.db.QueryRowContext(ctx, query, userID).Scan(
+		&s.CollectionID, &s.TempleID, &s.TempleName, &s.TempleNameEn, &collectedAt, &offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stamp summary: %v", err)
+	}
+	s.CollectedAt = collectedAt.In(clock.Zone(offset)).Format(time.RFC3339)
+	return &s, nil
+}
+
+// longestStreak returns the longest run of consecutive collection days.
+// The distinct days are aggregated in SQL; the run is measured while reading them in order.
+func (c *GoshuinCollectionClient) longestStreak(ctx context.Context, userID string) (int, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT `+c.db.dialect().FormatDate(localCollectedAt(c.db.dialect(), "gc"), "%Y-%m-%d")+` AS day
+		FROM goshuin_collections gc WHERE gc.user_id = ? AND gc.deleted_at IS NULL
+		GROUP BY day ORDER BY day
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query collection days: %v", err)
+	}
+	defer rows.Close()
+
+	longest, current := 0, 0
+	var prev time.Time
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return 0, fmt.Errorf("failed to scan collection day: %v", err)
+		}
+		day, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid collection day %q: %v", s, err)
+		}
+
+		if !prev.IsZero() && day.Sub(prev) == 24*time.Hour {
+			current++
+		} else {
+			current = 1
+		}
+		longest = max(longest, current)
+		prev = day
+	}
+	return longest, rows.Err()
+}
+
+// distance sums the distance between the temples of consecutive stamps.
+func (c *GoshuinCollectionClient) distance(ctx context.Context, userID string) (float64, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT t.latitude, t.longitude
+		FROM goshuin_collections gc JOIN temples t ON t.id = gc.temple_id
+		WHERE gc.user_id = ? AND gc.deleted_at IS NULL
+		ORDER BY gc.collected_at, gc.id
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query stamp locations: %v", err)
+	}
+	defer rows.Close()
+
+	var total, prevLat, prevLng float64
+	first := true
+	for rows.Next() {
+		var lat, lng float64
+		if err := rows.Scan(&lat, &lng); err != nil {
+			return 0, fmt.Errorf("failed to scan stamp location: %v", err)
+		}
+		if !first {
+			total += geo.DistanceKm(prevLat, prevLng, lat, lng)
+		}
+		prevLat, prevLng, first = lat, lng, false
+	}
+	return math.Round(total*10) / 10, rows.Err()
+}
+
+// completion fills the per-prefecture share of active temples the user has collected.
+func (c *GoshuinCollectionClient) completion(ctx context.Context, userID string, stats *CollectionStats) error {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT t.prefecture, COUNT(*), COUNT(uc.temple_id)
+		FROM temples t
+		LEFT JOIN (
+			SELECT DISTINCT temple_id FROM goshuin_collections WHERE user_id = ? AND deleted_at IS NULL
+		) uc ON uc.temple_id = t.id
+		WHERE t.is_active = TRUE AND t.deleted_at IS NULL AND t.prefecture <> ''
+		GROUP BY t.prefecture ORDER BY t.prefecture
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to query prefecture completion: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p PrefectureProgress
+		if err := rows.Scan(&p.Prefecture, &p.Total, &p.Collected); err != nil {
+			return fmt.Errorf("failed to scan prefecture completion: %v", err)
+		}
+		if p.Total > 0 {
+			p.Percent = float64(p.Collected*1000/p.Total) / 10
+		}
+		stats.Completion = append(stats.Completion, p)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,263 @@
+package ent
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Sync change operations.
+const (
+	// SyncOpUpsert means the collection was created or some of its fields changed.
+	SyncOpUpsert = "upsert"
+	// SyncOpDelete means the collection was moved to the trash or purged.
+	SyncOpDelete = "delete"
+)
+
+// SyncFieldDeleted is the pseudo field whose clock records when a collection was deleted or restored.
+const SyncFieldDeleted = "deleted"
+
+// SyncChange is an entry of the change log of a user's goshuin collections. Seq increases
+// monotonically, so a client that has seen every change up to a seq only needs later entries.
+type SyncChange struct {
+	Seq      int64  `json:"seq"`
+	UserID   string `json:"-"`
+	ClientID string `json:"client_id"`
+	// CollectionID is 0 once the collection has been purged.
+	CollectionID int    `json:"id,omitempty"`
+	Op           string `json:"op"`
+	// Fields are the fields the change wrote.
+	Fields []string `json:"fields"`
+	// MutationID is the client mutation the change applied, empty for changes made through the REST API.
+	MutationID string `json:"-"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// SyncClient is a client for the change log and field clocks of goshuin collection sync.
+type SyncClient struct {
+	db dbtx
+}
+
+// uuidPattern matches a UUID in its canonical textual form.
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// ValidUUID reports whether s is a UUID in canonical lower-case form.
+func ValidUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
+
+// NewUUID returns a random (version 4) UUID.
+func NewUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to generate uuid: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// GetByClientID returns a user's goshuin collection by its client ID, including one in the
+// trash (DeletedAt is set), or nil if there is none.
+func (c *GoshuinCollectionClient) GetByClientID(ctx context.Context, userID, clientID string) (*GoshuinCollection, error) {
+	return c.repo.GetByClientID(ctx, userID, clientID)
+}
+
+// Record appends a change to the log at now and sets the clocks of its fields to at. It
+// returns the change with Seq set.
+//
+// Seq is taken from the single-row sync_sequence counter, which stays locked until the
+// transaction the change is recorded in ends. Changes therefore become visible in seq order,
+// and a client that pulled up to a seq never misses a smaller one committed later.
+func (c *SyncClient) Record(ctx context.Context, change *SyncChange, at, now time.Time) (*SyncChange, error) {
+	recorded := *change
+	recorded.CreatedAt = now.UTC().Format(time.RFC3339)
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	tx, err := begin(ctx, c.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE sync_sequence SET seq = seq + 1 WHERE id = 1`); err != nil {
+		return nil, fmt.Errorf("failed to allocate sync seq: %v", err)
+	}
+	var seq int64
+	if err := tx.QueryRowContext(ctx, `SELECT seq FROM sync_sequence WHERE id = 1`).Scan(&seq); err != nil {
+		return nil, fmt.Errorf("failed to allocate sync seq: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO sync_changes (seq, user_id, client_id, collection_id, op, fields, mutation_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, seq, change.UserID, change.ClientID, nullInt(change.CollectionID), change.Op,
+		strings.Join(change.Fields, ","), nullString(change.MutationID), now.UTC().Truncate(time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record sync change: %v", err)
+	}
+
+	for _, field := range change.Fields {
+		_, err := tx.ExecContext(ctx, tx.dialect().Upsert(`
+			INSERT INTO sync_field_clocks (user_id, client_id, field, changed_at, seq) VALUES (?, ?, ?, ?, ?)`,
+			[]string{"user_id", "client_id", "field"}, []string{"changed_at", "seq"},
+		), change.UserID, change.ClientID, field, at.UTC(), seq)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set field clock: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit sync change: %v", err)
+	}
+
+	recorded.Seq = seq
+	return &recorded, nil
+}
+
+// Clocks returns when each field of a collection was last written, by client ID. The
+// clocks outlive a purged collection, so a late edit cannot bring it back unnoticed.
+func (c *SyncClient) Clocks(ctx context.Context, userID, clientID string) (map[string]time.Time, error) {
+	clocks := map[string]time.Time{}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT field, changed_at FROM sync_field_clocks WHERE user_id = ? AND client_id = ?
+	`, userID, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query field clocks: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var field string
+		var at time.Time
+		if err := rows.Scan(&field, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan field clock: %v", err)
+		}
+		clocks[field] = at.UTC()
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate field clocks: %v", err)
+	}
+	return clocks, nil
+}
+
+// Changes returns the latest change of each of the user's collections changed after since,
+// ordered by seq. Earlier changes of the same collection are superseded and left out.
+func (c *SyncClient) Changes(ctx context.Context, userID string, since int64, limit int) ([]*SyncChange, error) {
+	changes := []*SyncChange{}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT sc.seq, sc.client_id, COALESCE(sc.collection_id, 0), sc.op, sc.fields, sc.created_at
+		FROM sync_changes sc
+		JOIN (
+			SELECT MAX(seq) AS seq FROM sync_changes WHERE user_id = ? AND seq > ? GROUP BY client_id
+		) latest ON latest.seq = sc.seq
+		ORDER BY sc.seq
+		LIMIT ?
+	`, userID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sync changes: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		change := &SyncChange{UserID: userID}
+		var fields string
+		var createdAt time.Time
+		if err := rows.Scan(&change.Seq, &change.ClientID, &change.CollectionID, &change.Op, &fields, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan sync change: %v", err)
+		}
+		change.Fields = []string{}
+		if fields != "" {
+			change.Fields = strings.Split(fields, ",")
+		}
+		change.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate sync changes: %v", err)
+	}
+	return changes, nil
+}
+
+// LatestSeq returns the seq of the user's latest change, or 0 if there is none.
+func (c *SyncClient) LatestSeq(ctx context.Context, userID string) (int64, error) {
+	if c.db == nil {
+		return 0, ErrNoDatabase
+	}
+
+	var seq int64
+	err := c.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM sync_changes WHERE user_id = ?`, userID).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest sync seq: %v", err)
+	}
+	return seq, nil
+}
+
+// MutationResult returns the stored result of a client mutation that was already pushed.
+func (c *SyncClient) MutationResult(ctx context.Context, userID, mutationID string) (string, bool, error) {
+	if c.db == nil {
+		return "", false, ErrNoDatabase
+	}
+
+	var result string
+	err := c.db.QueryRowContext(ctx, `
+		SELECT result FROM sync_mutations WHERE user_id = ? AND mutation_id = ?
+	`, userID, mutationID).Scan(&result)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get sync mutation: %v", err)
+	}
+	return result, true, nil
+}
+
+// ClaimMutation records a client mutation as being applied in the current transaction. It
+// returns false if the mutation was already claimed; a transaction claiming the same mutation
+// concurrently waits on the row until this one ends, so a mutation is applied only once.
+func (c *SyncClient) ClaimMutation(ctx context.Context, userID, mutationID string) (bool, error) {
+	if c.db == nil {
+		return false, ErrNoDatabase
+	}
+
+	result, err := c.db.ExecContext(ctx, c.db.dialect().InsertIgnore(`
+		INSERT INTO sync_mutations (user_id, mutation_id, result) VALUES (?, ?, '')
+	`), userID, mutationID)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim sync mutation: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim sync mutation: %v", err)
+	}
+	return n > 0, nil
+}
+
+// SaveMutationResult stores the result of a claimed client mutation so a replay returns it unchanged.
+func (c *SyncClient) SaveMutationResult(ctx context.Context, userID, mutationID, result string) error {
+	if c.db == nil {
+		return ErrNoDatabase
+	}
+
+	_, err := c.db.ExecContext(ctx, `
+		UPDATE sync_mutations SET result = ? WHERE user_id = ? AND mutation_id = ?
+	`, result, userID, mutationID)
+	if err != nil {
+		return fmt.Errorf("failed to save sync mutation: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package ent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tag limits per goshuin collection.
+const (
+	MaxTags      = 20
+	MaxTagLength = 32
+)
+
+// TagCount is the number of collections of a user with the tag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTags trims, lower-cases and de-duplicates tags and returns them sorted.
+// Commas are removed because they separate tags in queries. At most MaxTags tags of
+// MaxTagLength characters are kept.
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ReplaceAll(tag, ",", " ")
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if runes := []rune(tag); len(runes) > MaxTagLength {
+			tag = strings.TrimSpace(string(runes[:MaxTagLength]))
+		}
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+		if len(normalized) == MaxTags {
+			break
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// replaceTags replaces the tags of a goshuin collection.
+func replaceTags(ctx context.Context, db dbtx, collectionID int, tags []string) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM goshuin_collection_tags WHERE collection_id = ?`, collectionID); err != nil {
+		return fmt.Errorf("failed to clear tags: %v", err)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(tags))
+	args := make([]interface{}, 0, len(tags)*2)
+	for i, tag := range tags {
+		placeholders[i] = "(?, ?)"
+		args = append(args, collectionID, tag)
+	}
+	query := `INSERT INTO goshuin_collection_tags (collection_id, tag) VALUES ` + strings.Join(placeholders, ", ")
+	if _, err := db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to save tags: %v", err)
+	}
+	return nil
+}
+
+// TagCounts returns the tags of the user's collections with their usage, most used first.
+func (c *GoshuinCollectionClient) TagCounts(ctx context.Context, userID string) ([]TagCount, error) {
+	counts := []TagCount{}
+	if c.db == nil {
+		return c.countTags(ctx, userID)
+	}
+
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT gct.tag, COUNT(*) AS cnt
+		FROM goshuin_collection_tags gct
+		JOIN goshuin_collections gc ON gc.id = gct.collection_id
+		WHERE gc.user_id = ? AND gc.deleted_at IS NULL
+		GROUP BY gct.tag
+		ORDER BY cnt DESC, gct.tag
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %v", err)
+		}
+		counts = append(counts, tc)
+	}
+	return counts, rows.Err()
+}
+
+// countTags counts the tags of the user's collections in the repository, for a client without
+// a database.
+func (c *GoshuinCollectionClient) countTags(ctx context.Context, userID string) ([]TagCount, error) {
+	seen := map[string]int{}
+	err := c.repo.Each(ctx, GoshuinCollectionFilter{UserID: userID}, false, func(gc *GoshuinCollection) error {
+		for _, tag := range gc.Tags {
+			seen[tag]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make([]TagCount, 0, len(seen))
+	for tag, n := range seen {
+		counts = append(counts, TagCount{Tag: tag, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Tag < counts[j].Tag
+	})
+	return counts, nil
+}
@@ -0,0 +1,522 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Temple correction statuses.
+const (
+	TempleCorrectionPending  = "pending"
+	TempleCorrectionApproved = "approved"
+	TempleCorrectionMerged   = "merged"
+	TempleCorrectionRejected = "rejected"
+)
+
+// TypeTempleCorrection is the Mutation.Type of temple corrections.
+const TypeTempleCorrection = "TempleCorrection"
+
+// ErrAlreadyReviewed is returned when reviewing a correction that is no longer pending.
+var ErrAlreadyReviewed = errors.New("correction has already been reviewed")
+
+// CorrectableTempleFields are the temple fields users can propose changes to.
+// Each field is also the column name.
+var CorrectableTempleFields = []string{
+	"name", "name_en", "description", "description_en", "latitude", "longitude",
+	"address", "phone", "website", "instagram", "twitter", "opening_hours",
+	"goshuin_fee", "goshuin_office", "reservation_required", "kakioki_only", "book_drop_off",
+	"cash_only", "photography", "procedure_notes",
+}
+
+// maxTempleFieldLength is the longest value accepted for a text field other than descriptions.
+const maxTempleFieldLength = 500
+
+// TempleFieldChange is a proposed change of one temple field. Before is the value when the
+// correction was submitted, so reviewers can tell whether the temple changed since.
+type TempleFieldChange struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// TempleCorrection entity is a change to a temple proposed by a user.
+type TempleCorrection struct {
+	ID       int                          `json:"id"`
+	TempleID int                          `json:"temple_id"`
+	UserID   string                       `json:"user_id"`
+	Changes  map[string]TempleFieldChange `json:"changes"`
+	Comment  string                       `json:"comment,omitempty"`
+	// PhotoKey is the storage key of an uploaded evidence photo.
+	PhotoKey   string `json:"-"`
+	PhotoURL   string `json:"photo_url,omitempty"`
+	Status     string `json:"status"`
+	ReviewerID string `json:"reviewer_id,omitempty"`
+	ReviewNote string `json:"review_note,omitempty"`
+	// Applied holds the values written to the temple when approved or merged.
+	Applied    map[string]string `json:"applied,omitempty"`
+	CreatedAt  string            `json:"created_at"`
+	ReviewedAt string            `json:"reviewed_at,omitempty"`
+}
+
+// CorrectionConflictError is returned when approving a correction whose fields changed on the
+// temple after it was submitted. Merging lets the reviewer resolve them.
+type CorrectionConflictError struct {
+	Fields []string
+}
+
+func (e *CorrectionConflictError) Error() string {
+	return "temple changed since the correction was submitted: " + strings.Join(e.Fields, ", ")
+}
+
+// ValidateTempleChanges checks that the changes only touch correctable fields with valid values.
+func ValidateTempleChanges(changes map[string]string) error {
+	if len(changes) == 0 {
+		return fmt.Errorf("changes must not be empty")
+	}
+	allowed := map[string]bool{}
+	for _, f := range CorrectableTempleFields {
+		allowed[f] = true
+	}
+
+	for field, value := range changes {
+		if !allowed[field] {
+			return fmt.Errorf("%s cannot be corrected", field)
+		}
+		if ok, err := validateProcedureChange(field, value); ok {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		switch field {
+		case "name", "name_en":
+			if strings.TrimSpace(value) == "" {
+				return fmt.Errorf("%s must not be empty", field)
+			}
+		case "latitude", "longitude":
+			limit := 90.0
+			if field == "longitude" {
+				limit = 180
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil || v < -limit || v > limit {
+				return fmt.Errorf("%s must be a number between %g and %g", field, -limit, limit)
+			}
+		case "description", "description_en", "procedure_notes":
+			continue
+		}
+		if len([]rune(value)) > maxTempleFieldLength {
+			return fmt.Errorf("%s must be at most %d characters", field, maxTempleFieldLength)
+		}
+	}
+	return nil
+}
+
+// templeFieldValue returns the current value of a correctable field as a string.
+func templeFieldValue(t *Temple, field string) string {
+	switch field {
+	case "name":
+		return t.Name
+	case "name_en":
+		return t.NameEn
+	case "description":
+		return t.Description
+	case "description_en":
+		return t.DescriptionEn
+	case "latitude":
+		return strconv.FormatFloat(t.Latitude, 'f', -1, 64)
+	case "longitude":
+		return strconv.FormatFloat(t.Longitude, 'f', -1, 64)
+	case "address":
+		return t.Address
+	case "phone":
+		return t.Phone
+	case "website":
+		return t.Website
+	case "instagram":
+		return t.Instagram
+	case "twitter":
+		return t.Twitter
+	case "opening_hours":
+		return t.OpeningHours
+	case "goshuin_fee":
+		return t.GoshuinFee
+	case "goshuin_office":
+		return t.GoshuinOffice
+	}
+	value, _ := templeProcedureValue(t, field)
+	return value
+}
+
+// Conflicts returns the proposed fields whose value on the temple changed since submission.
+func (c *TempleCorrection) Conflicts(t *Temple) []string {
+	conflicts := []string{}
+	for field, change := range c.Changes {
+		if templeFieldValue(t, field) != change.Before {
+			conflicts = append(conflicts, field)
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// TempleCorrectionClient is a client for the TempleCorrection schema.
+type TempleCorrectionClient struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+}
+
+// TempleCorrectionFilter holds the search conditions for TempleCorrectionClient.List.
+type TempleCorrectionFilter struct {
+	Status   string
+	UserID   string
+	TempleID int
+}
+
+// templeCorrectionColumns is the column list scanned by scanTempleCorrection.
+const templeCorrectionColumns = `id, temple_id, user_id, changes, COALESCE(comment, ''), COALESCE(photo_key, ''),
+	COALESCE(photo_url, ''), status, COALESCE(reviewer_id, ''), COALESCE(review_note, ''),
+	COALESCE(applied_changes, ''), created_at, reviewed_at`
+
+// scanTempleCorrection scans a row selected with templeCorrectionColumns.
+func scanTempleCorrection(row rowScanner) (*TempleCorrection, error) {
+	var c TempleCorrection
+	var changes, applied string
+	var createdAt time.Time
+	var reviewedAt sql.NullTime
+	err := row.Scan(
+		&c.ID, &c.TempleID, &c.UserID, &changes, &c.Comment, &c.PhotoKey,
+		&c.PhotoURL, &c.Status, &c.ReviewerID, &c.ReviewNote,
+		&applied, &createdAt, &reviewedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan temple correction: %v", err)
+	}
+
+	if err := json.Unmarshal([]byte(changes), &c.Changes); err != nil {
+		return nil, fmt.Errorf("invalid temple correction changes: %v", err)
+	}
+	if applied != "" {
+		if err := json.Unmarshal([]byte(applied), &c.Applied); err != nil {
+			return nil, fmt.Errorf("invalid applied temple changes: %v", err)
+		}
+	}
+	c.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	if reviewedAt.Valid {
+		c.ReviewedAt = reviewedAt.Time.UTC().Format(time.RFC3339)
+	}
+	return &c, nil
+}
+
+// Get returns a TempleCorrection entity by its id.
+func (c *TempleCorrectionClient) Get(ctx context.Context, id int) (*TempleCorrection, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("temple correction not found")
+	}
+
+	query := `SELECT ` + templeCorrectionColumns + ` FROM temple_corrections WHERE id = ?`
+	correction, err := scanTempleCorrection(c.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get temple correction: %v", err)
+	}
+	return correction, nil
+}
+
+// List returns the corrections matching the filter. Pending corrections are listed oldest first
+// (the moderation queue), others newest first.
+func (c *TempleCorrectionClient) List(ctx context.Context, f TempleCorrectionFilter) ([]*TempleCorrection, error) {
+	corrections := []*TempleCorrection{}
+	if c.db == nil {
+		return corrections, nil
+	}
+
+	var where []string
+	var args []interface{}
+	if f.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.UserID != "" {
+		where = append(where, "user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.TempleID > 0 {
+		where = append(where, "temple_id = ?")
+		args = append(args, f.TempleID)
+	}
+
+	query := `SELECT ` + templeCorrectionColumns + ` FROM temple_corrections`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if f.Status == TempleCorrectionPending {
+		query += " ORDER BY created_at, id"
+	} else {
+		query += " ORDER BY created_at DESC, id DESC"
+	}
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query temple corrections: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		correction, err := scanTempleCorrection(rows)
+		if err != nil {
+			return nil, err
+		}
+		corrections = append(corrections, correction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate temple corrections: %v", err)
+	}
+	return corrections, nil
+}
+
+// Create returns a builder for creating a TempleCorrection entity.
+func (c *TempleCorrectionClient) Create() *TempleCorrectionCreate {
+	return &TempleCorrectionCreate{db: c.db, hooks: c.hooks, clock: c.clock, correction: &TempleCorrection{}}
+}
+
+// TempleCorrectionCreate is a builder for creating a TempleCorrection entity.
+type TempleCorrectionCreate struct {
+	db         dbtx
+	hooks      *hooks
+	clock      *clockSource
+	correction *TempleCorrection
+	changes    map[string]string
+}
+
+// SetTempleID sets the temple_id field.
+func (cc *TempleCorrectionCreate) SetTempleID(id int) *TempleCorrectionCreate {
+	cc.correction.TempleID = id
+	return cc
+}
+
+// SetUserID sets the user_id field.
+func (cc *TempleCorrectionCreate) SetUserID(userID string) *TempleCorrectionCreate {
+	cc.correction.UserID = userID
+	return cc
+}
+
+// SetChanges sets the proposed values by field. The current values are recorded on Save.
+func (cc *TempleCorrectionCreate) SetChanges(changes map[string]string) *TempleCorrectionCreate {
+	cc.changes = changes
+	return cc
+}
+
+// SetComment sets the comment field.
+func (cc *TempleCorrectionCreate) SetComment(comment string) *TempleCorrectionCreate {
+	cc.correction.Comment = comment
+	return cc
+}
+
+// SetPhoto sets the evidence photo by storage key (empty for external URLs) and URL.
+func (cc *TempleCorrectionCreate) SetPhoto(key, url string) *TempleCorrectionCreate {
+	cc.correction.PhotoKey, cc.correction.PhotoURL = key, url
+	return cc
+}
+
+// Save validates the changes against the current temple and saves the correction.
+// Fields whose proposed value equals the current value are dropped.
+func (cc *TempleCorrectionCreate) Save(ctx context.Context) (*TempleCorrection, error) {
+	if err := ValidateTempleChanges(cc.changes); err != nil {
+		return nil, err
+	}
+	if cc.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	ctx, mu, err := cc.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	temple, err := newTempleClient(cc.db, nil, nil).Get(ctx, cc.correction.TempleID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]TempleFieldChange{}
+	for field, value := range cc.changes {
+		if before := templeFieldValue(temple, field); before != value {
+			changes[field] = TempleFieldChange{Before: before, After: value}
+		}
+	}
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("changes do not differ from the current temple")
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode temple changes: %v", err)
+	}
+
+	id, err := cc.db.insert(ctx, "id", `
+		INSERT INTO temple_corrections (temple_id, user_id, changes, comment, photo_key, photo_url, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, cc.correction.TempleID, cc.correction.UserID, string(data), nullString(cc.correction.Comment),
+		nullString(cc.correction.PhotoKey), nullString(cc.correction.PhotoURL), TempleCorrectionPending, cc.clock.now(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temple correction: %v", err)
+	}
+
+	correction, err := (&TempleCorrectionClient{db: cc.db}).Get(ctx, int(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mu.commit(&Mutation{Op: OpCreate, Type: TypeTempleCorrection, ID: correction.ID, UserID: correction.UserID, New: correction}); err != nil {
+		return nil, err
+	}
+	return correction, nil
+}
+
+// TempleCorrectionReview is the decision of a reviewer.
+type TempleCorrectionReview struct {
+	// Status is TempleCorrectionApproved, TempleCorrectionMerged or TempleCorrectionRejected.
+	Status     string
+	ReviewerID string
+	Note       string
+	// Fields are the values to apply when merging. They may edit or leave out proposed
+	// fields and include other correctable fields.
+	Fields map[string]string
+}
+
+// Review approves, merges or rejects a pending correction. Approved and merged changes are
+// written to the temple in the same transaction as the status, so a correction is applied
+// exactly once. Approving fails with *CorrectionConflictError when a proposed field changed
+// on the temple after submission.
+func (c *TempleCorrectionClient) Review(ctx context.Context, id int, review TempleCorrectionReview) (*TempleCorrection, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("temple correction not found")
+	}
+
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	old, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var apply map[string]string
+	switch review.Status {
+	case TempleCorrectionApproved:
+		apply = map[string]string{}
+		for field, change := range old.Changes {
+			apply[field] = change.After
+		}
+	case TempleCorrectionMerged:
+		if err := ValidateTempleChanges(review.Fields); err != nil {
+			return nil, err
+		}
+		apply = review.Fields
+	case TempleCorrectionRejected:
+	default:
+		return nil, fmt.Errorf("invalid review status %q", review.Status)
+	}
+
+	now := c.clock.now()
+	tx, err := begin(ctx, c.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var status string
+	if err := tx.QueryRowContext(ctx, `SELECT status FROM temple_corrections WHERE id = ?`+tx.dialect().ForUpdate(), id).Scan(&status); err != nil {
+		return nil, fmt.Errorf("failed to lock temple correction: %v", err)
+	}
+	if status != TempleCorrectionPending {
+		return nil, ErrAlreadyReviewed
+	}
+
+	var oldTemple *Temple
+	if len(apply) > 0 {
+		query := `SELECT ` + templeColumns + ` FROM temples WHERE id = ? AND deleted_at IS NULL` + tx.dialect().ForUpdate()
+		if oldTemple, err = scanTemple(tx.QueryRowContext(ctx, query, old.TempleID)); err != nil {
+			return nil, fmt.Errorf("failed to lock temple: %v", err)
+		}
+
+		if review.Status == TempleCorrectionApproved {
+			if conflicts := old.Conflicts(oldTemple); len(conflicts) > 0 {
+				return nil, &CorrectionConflictError{Fields: conflicts}
+			}
+		}
+
+		fields := make([]string, 0, len(apply))
+		for field := range apply {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		sets := make([]string, 0, len(fields)+1)
+		args := make([]interface{}, 0, len(fields)+1)
+		for _, field := range fields {
+			sets = append(sets, field+" = ?")
+			args = append(args, templeColumnArg(field, apply[field]))
+		}
+		sets = append(sets, "updated_at = ?")
+		args = append(args, now)
+		query = `UPDATE temples SET ` + strings.Join(sets, ", ") + ` WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, query, append(args, old.TempleID)...); err != nil {
+			return nil, fmt.Errorf("failed to apply temple correction: %v", err)
+		}
+	}
+
+	var applied interface{}
+	if len(apply) > 0 {
+		data, err := json.Marshal(apply)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode applied changes: %v", err)
+		}
+		applied = string(data)
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE temple_corrections
+		SET status = ?, reviewer_id = ?, review_note = ?, applied_changes = ?, reviewed_at = ?
+		WHERE id = ?
+	`, review.Status, review.ReviewerID, nullString(review.Note), applied, now, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to review temple correction: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit temple correction: %v", err)
+	}
+
+	correction, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var templeMutation *Mutation
+	if oldTemple != nil {
+		temple, err := newTempleClient(c.db, nil, nil).Get(ctx, old.TempleID)
+		if err != nil {
+			return nil, err
+		}
+		templeMutation = &Mutation{
+			Op: OpUpdate, Type: TypeTemple, ID: temple.ID, Old: oldTemple, New: temple, OnBehalfOf: correction.UserID,
+		}
+	}
+	err = mu.commit(templeMutation, &Mutation{
+		Op: OpUpdate, Type: TypeTempleCorrection, ID: id, UserID: correction.UserID, Old: old, New: correction,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return correction, nil
+}
@@ -0,0 +1,106 @@
+package ent_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"stamp-backend/internal/ent"
+)
+
+func TestValidateTempleChanges(t *testing.T) {
+	cases := []struct {
+		changes map[string]string
+		valid   bool
+	}{
+		{map[string]string{"name": "浅草寺", "latitude": "35.71", "reservation_required": "true"}, true},
+		{map[string]string{"photography": "", "cash_only": ""}, true},
+		{map[string]string{}, false},
+		{map[string]string{"active": "false"}, false},
+		{map[string]string{"name": " "}, false},
+		{map[string]string{"longitude": "181"}, false},
+		{map[string]string{"kakioki_only": "maybe"}, false},
+		{map[string]string{"photography": "sometimes"}, false},
+	}
+	for _, c := range cases {
+		if err := ent.ValidateTempleChanges(c.changes); (err == nil) != c.valid {
+			t.Errorf("ValidateTempleChanges(%v) = %v; want valid %v", c.changes, err, c.valid)
+		}
+	}
+}
+
+func TestTempleCorrectionReview(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	temple, err := createTemple(ctx, client, "浅草寺")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	propose := func(userID string, changes map[string]string) *ent.TempleCorrection {
+		t.Helper()
+		correction, err := client.TempleCorrection.Create().SetTempleID(temple.ID).SetUserID(userID).SetChanges(changes).Save(ctx)
+		if err != nil {
+			t.Fatalf("failed to create correction: %v", err)
+		}
+		return correction
+	}
+
+	// Fields equal to the current values are dropped.
+	first := propose("user-1", map[string]string{"name": "金龍山浅草寺", "address": "台東区浅草2-3-1", "latitude": "35.7148"})
+	want := map[string]ent.TempleFieldChange{
+		"name":    {Before: "浅草寺", After: "金龍山浅草寺"},
+		"address": {Before: "", After: "台東区浅草2-3-1"},
+	}
+	if !reflect.DeepEqual(first.Changes, want) || first.Status != ent.TempleCorrectionPending {
+		t.Errorf("correction = %+v; want pending with %v", first, want)
+	}
+	if _, err := client.TempleCorrection.Create().SetTempleID(temple.ID).SetUserID("user-1").
+		SetChanges(map[string]string{"name": "浅草寺"}).Save(ctx); err == nil {
+		t.Errorf("correction without differences was saved")
+	}
+	second := propose("user-2", map[string]string{"name": "浅草観音", "phone": "03-3842-0181"})
+	rejected := propose("user-3", map[string]string{"website": "https://example.com"})
+
+	approved, err := client.TempleCorrection.Review(ctx, first.ID, ent.TempleCorrectionReview{Status: ent.TempleCorrectionApproved, ReviewerID: "admin-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.Status != ent.TempleCorrectionApproved || approved.ReviewerID != "admin-1" ||
+		!reflect.DeepEqual(approved.Applied, map[string]string{"name": "金龍山浅草寺", "address": "台東区浅草2-3-1"}) {
+		t.Errorf("approved = %+v", approved)
+	}
+	if _, err := client.TempleCorrection.Review(ctx, first.ID, ent.TempleCorrectionReview{Status: ent.TempleCorrectionRejected}); err != ent.ErrAlreadyReviewed {
+		t.Errorf("second review = %v; want %v", err, ent.ErrAlreadyReviewed)
+	}
+
+	// A field changed since submission blocks approval; merging applies the chosen values.
+	_, err = client.TempleCorrection.Review(ctx, second.ID, ent.TempleCorrectionReview{Status: ent.TempleCorrectionApproved})
+	var conflict *ent.CorrectionConflictError
+	if !errors.As(err, &conflict) || !reflect.DeepEqual(conflict.Fields, []string{"name"}) {
+		t.Errorf("approve changed field = %v; want a conflict on name", err)
+	}
+	merged, err := client.TempleCorrection.Review(ctx, second.ID, ent.TempleCorrectionReview{
+		Status: ent.TempleCorrectionMerged, ReviewerID: "admin-1",
+		Fields: map[string]string{"phone": "03-3842-0181", "name_en": "Senso-ji"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Status != ent.TempleCorrectionMerged {
+		t.Errorf("merged status = %q", merged.Status)
+	}
+
+	if _, err := client.TempleCorrection.Review(ctx, rejected.ID, ent.TempleCorrectionReview{Status: ent.TempleCorrectionRejected, Note: "出典がありません"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := client.Temple.Get(ctx, temple.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "金龍山浅草寺" || got.NameEn != "Senso-ji" || got.Address != "台東区浅草2-3-1" || got.Phone != "03-3842-0181" || got.Website != "" {
+		t.Errorf("temple = %+v; want the approved and merged values only", got)
+	}
+}
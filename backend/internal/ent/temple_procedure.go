@@ -0,0 +1,129 @@
+package ent
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Photography rules of a temple.
+const (
+	// PhotographyAllowed means photos are allowed, including at the goshuin office.
+	PhotographyAllowed = "allowed"
+	// PhotographyRestricted means photos are allowed on the grounds but not inside halls or of the goshuin being written.
+	PhotographyRestricted = "restricted"
+	// PhotographyProhibited means no photos anywhere on the grounds.
+	PhotographyProhibited = "prohibited"
+)
+
+// procedureFlags are the yes/no procedure columns of temples.
+var procedureFlags = []string{"reservation_required", "kakioki_only", "book_drop_off", "cash_only"}
+
+// ValidPhotography reports whether s is one of the Photography constants.
+func ValidPhotography(s string) bool {
+	return s == PhotographyAllowed || s == PhotographyRestricted || s == PhotographyProhibited
+}
+
+// ProcedureFilter holds the procedure conditions of TempleFilter. Nil flags and an empty
+// Photography match any temple; set ones only match temples where the value is known.
+type ProcedureFilter struct {
+	ReservationRequired *bool
+	KakiokiOnly         *bool
+	BookDropOff         *bool
+	CashOnly            *bool
+	Photography         string
+}
+
+// where returns the conditions of the filter.
+func (f ProcedureFilter) where() ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	for i, flag := range []*bool{f.ReservationRequired, f.KakiokiOnly, f.BookDropOff, f.CashOnly} {
+		if flag != nil {
+			where = append(where, procedureFlags[i]+" = ?")
+			args = append(args, *flag)
+		}
+	}
+	if f.Photography != "" {
+		where = append(where, "photography = ?")
+		args = append(args, f.Photography)
+	}
+	return where, args
+}
+
+// matches reports whether the temple matches the filter, like the conditions of where.
+func (f ProcedureFilter) matches(t *Temple) bool {
+	values := []*bool{t.ReservationRequired, t.KakiokiOnly, t.BookDropOff, t.CashOnly}
+	for i, flag := range []*bool{f.ReservationRequired, f.KakiokiOnly, f.BookDropOff, f.CashOnly} {
+		if flag != nil && (values[i] == nil || *values[i] != *flag) {
+			return false
+		}
+	}
+	return f.Photography == "" || t.Photography == f.Photography
+}
+
+// FormatFlag returns a procedure flag as "true", "false", or "" if not known.
+func FormatFlag(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+// templeProcedureValue returns the current value of a procedure field as a string.
+func templeProcedureValue(t *Temple, field string) (string, bool) {
+	switch field {
+	case "reservation_required":
+		return FormatFlag(t.ReservationRequired), true
+	case "kakioki_only":
+		return FormatFlag(t.KakiokiOnly), true
+	case "book_drop_off":
+		return FormatFlag(t.BookDropOff), true
+	case "cash_only":
+		return FormatFlag(t.CashOnly), true
+	case "photography":
+		return t.Photography, true
+	case "procedure_notes":
+		return t.ProcedureNotes, true
+	}
+	return "", false
+}
+
+// validateProcedureChange checks a proposed value of a procedure field. Flags take "true",
+// "false" or "" (not known).
+func validateProcedureChange(field, value string) (bool, error) {
+	for _, flag := range procedureFlags {
+		if field == flag {
+			if value != "" {
+				if _, err := strconv.ParseBool(value); err != nil {
+					return true, fmt.Errorf("%s must be true, false or empty", field)
+				}
+			}
+			return true, nil
+		}
+	}
+	if field == "photography" {
+		if value != "" && !ValidPhotography(value) {
+			return true, fmt.Errorf("photography must be %s, %s or %s", PhotographyAllowed, PhotographyRestricted, PhotographyProhibited)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// templeColumnArg converts a corrected field value to its column value: procedure flags
+// become booleans, and empty procedure values NULL.
+func templeColumnArg(field, value string) interface{} {
+	for _, flag := range procedureFlags {
+		if field == flag {
+			if value == "" {
+				return nil
+			}
+			b, _ := strconv.ParseBool(value)
+			return b
+		}
+	}
+	if field == "photography" || field == "procedure_notes" {
+		return nullString(value)
+	}
+	return value
+}
@@ -0,0 +1,595 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"stamp-backend/internal/clock"
+)
+
+// Temple proposal statuses. A proposal is approved when a new temple is created from it and
+// merged when it turns out to be an existing temple.
+const (
+	TempleProposalPending  = "pending"
+	TempleProposalApproved = "approved"
+	TempleProposalMerged   = "merged"
+	TempleProposalRejected = "rejected"
+)
+
+// TypeTempleProposal is the Mutation.Type of temple proposals.
+const TypeTempleProposal = "TempleProposal"
+
+// ErrProposalAlreadyReviewed is returned when reviewing a proposal that is no longer pending.
+var ErrProposalAlreadyReviewed = errors.New("proposal has already been reviewed")
+
+// ErrProposalRejected is returned when adding an entry to a rejected proposal.
+var ErrProposalRejected = errors.New("proposal was rejected")
+
+// TempleProposal entity is a temple that is not in the database yet, proposed by a user.
+type TempleProposal struct {
+	ID           int     `json:"id"`
+	UserID       string  `json:"user_id"`
+	Name         string  `json:"name"`
+	NameEn       string  `json:"name_en,omitempty"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	Prefecture   string  `json:"prefecture,omitempty"`
+	Kind         string  `json:"kind"`
+	Address      string  `json:"address,omitempty"`
+	Description  string  `json:"description,omitempty"`
+	Website      string  `json:"website,omitempty"`
+	OpeningHours string  `json:"opening_hours,omitempty"`
+	GoshuinFee   string  `json:"goshuin_fee,omitempty"`
+	// PhotoKey is the storage key of the uploaded photo.
+	PhotoKey   string `json:"-"`
+	PhotoURL   string `json:"photo_url,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	Status     string `json:"status"`
+	ReviewerID string `json:"reviewer_id,omitempty"`
+	ReviewNote string `json:"review_note,omitempty"`
+	// TempleID is the temple created on approval or chosen on merge.
+	TempleID   int    `json:"temple_id,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	ReviewedAt string `json:"reviewed_at,omitempty"`
+
+	// Entries are the goshuin recorded against the proposal, loaded by Get.
+	Entries []*TempleProposalEntry `json:"entries,omitempty"`
+}
+
+// TempleProposalEntry is a goshuin collected at a proposed temple. It becomes a
+// GoshuinCollection once the proposal is approved or merged.
+type TempleProposalEntry struct {
+	ID          int    `json:"id"`
+	ProposalID  int    `json:"proposal_id"`
+	UserID      string `json:"user_id"`
+	ImageURL    string `json:"image_url,omitempty"`
+	Notes       string `json:"notes,omitempty"`
+	CollectedAt string `json:"collected_at,omitempty"`
+	// CollectionID is set once the entry has been linked to a temple.
+	CollectionID int    `json:"collection_id,omitempty"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// TempleProposalClient is a client for the TempleProposal schema.
+type TempleProposalClient struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+}
+
+// TempleProposalFilter holds the search conditions for TempleProposalClient.List.
+type TempleProposalFilter struct {
+	Status string
+	UserID string
+	// BBox limits results to proposals inside the bounding box.
+	BBox *BBox
+}
+
+// templeProposalColumns is the column list scanned by scanTempleProposal.
+const templeProposalColumns = `id, user_id, name, COALESCE(name_en, ''), latitude, longitude, prefecture, kind,
+	COALESCE(address, ''), COALESCE(description, ''), COALESCE(website, ''), COALESCE(opening_hours, ''),
+	COALESCE(goshuin_fee, ''), COALESCE(photo_key, ''), COALESCE(photo_url, ''), COALESCE(comment, ''),
+	status, COALESCE(reviewer_id, ''), COALESCE(review_note, ''), COALESCE(temple_id, 0), created_at, reviewed_at`
+
+// scanTempleProposal scans a row selected with templeProposalColumns.
+func scanTempleProposal(row rowScanner) (*TempleProposal, error) {
+	var p TempleProposal
+	var createdAt time.Time
+	var reviewedAt sql.NullTime
+	err := row.Scan(
+		&p.ID, &p.UserID, &p.Name, &p.NameEn, &p.Latitude, &p.Longitude, &p.Prefecture, &p.Kind,
+		&p.Address, &p.Description, &p.Website, &p.OpeningHours,
+		&p.GoshuinFee, &p.PhotoKey, &p.PhotoURL, &p.Comment,
+		&p.Status, &p.ReviewerID, &p.ReviewNote, &p.TempleID, &createdAt, &reviewedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan temple proposal: %v", err)
+	}
+	p.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+	if reviewedAt.Valid {
+		p.ReviewedAt = reviewedAt.Time.UTC().Format(time.RFC3339)
+	}
+	return &p, nil
+}
+
+// Get returns a TempleProposal entity by its id, with its entries.
+func (c *TempleProposalClient) Get(ctx context.Context, id int) (*TempleProposal, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("temple proposal not found")
+	}
+
+	query := `SELECT ` + templeProposalColumns + ` FROM temple_proposals WHERE id = ?`
+	proposal, err := scanTempleProposal(c.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get temple proposal: %v", err)
+	}
+	if proposal.Entries, err = c.entries(ctx, id); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+// List returns the proposals matching the filter, without entries. Pending proposals are
+// listed oldest first (the moderation queue), others newest first.
+func (c *TempleProposalClient) List(ctx context.Context, f TempleProposalFilter) ([]*TempleProposal, error) {
+	proposals := []*TempleProposal{}
+	if c.db == nil {
+		return proposals, nil
+	}
+
+	var where []string
+	var args []interface{}
+	if f.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, f.Status)
+	}
+	if f.UserID != "" {
+		where = append(where, "user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.BBox != nil {
+		where = append(where, "latitude BETWEEN ? AND ?", "longitude BETWEEN ? AND ?")
+		args = append(args, f.BBox.MinLat, f.BBox.MaxLat, f.BBox.MinLng, f.BBox.MaxLng)
+	}
+
+	query := `SELECT ` + templeProposalColumns + ` FROM temple_proposals`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if f.Status == TempleProposalPending {
+		query += " ORDER BY created_at, id"
+	} else {
+		query += " ORDER BY created_at DESC, id DESC"
+	}
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query temple proposals: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		proposal, err := scanTempleProposal(rows)
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, proposal)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate temple proposals: %v", err)
+	}
+	return proposals, nil
+}
+
+// Photos returns the storage key of the photo of the latest approved or merged proposal of
+// each temple that has one.
+func (c *TempleProposalClient) Photos(ctx context.Context, templeIDs []int) (map[int]string, error) {
+	photos := map[int]string{}
+	if c.db == nil || len(templeIDs) == 0 {
+		return photos, nil
+	}
+
+	args := []interface{}{TempleProposalApproved, TempleProposalMerged}
+	for _, id := range templeIDs {
+		args = append(args, id)
+	}
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT temple_id, photo_key FROM temple_proposals
+		WHERE status IN (?, ?) AND photo_key IS NOT NULL AND temple_id IN (`+placeholders(len(templeIDs))+`)
+		ORDER BY reviewed_at, id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query temple photos: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var templeID int
+		var key string
+		if err := rows.Scan(&templeID, &key); err != nil {
+			return nil, fmt.Errorf("failed to scan temple photo: %v", err)
+		}
+		// Rows are ordered by review time, so the latest photo wins.
+		photos[templeID] = key
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate temple photos: %v", err)
+	}
+	return photos, nil
+}
+
+// entries returns the entries of a proposal in the order they were added.
+func (c *TempleProposalClient) entries(ctx context.Context, proposalID int) ([]*TempleProposalEntry, error) {
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT id, proposal_id, user_id, COALESCE(image_url, ''), COALESCE(notes, ''),
+		       collected_at, collected_tz_offset, COALESCE(collection_id, 0), created_at
+		FROM temple_proposal_entries WHERE proposal_id = ? ORDER BY id
+	`, proposalID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query temple proposal entries: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []*TempleProposalEntry{}
+	for rows.Next() {
+		var e TempleProposalEntry
+		var collectedAt sql.NullTime
+		var offset int
+		var createdAt time.Time
+		err := rows.Scan(&e.ID, &e.ProposalID, &e.UserID, &e.ImageURL, &e.Notes,
+			&collectedAt, &offset, &e.CollectionID, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan temple proposal entry: %v", err)
+		}
+		if collectedAt.Valid {
+			e.CollectedAt = collectedAt.Time.In(clock.Zone(offset)).Format(time.RFC3339)
+		}
+		e.CreatedAt = createdAt.UTC().Format(time.RFC3339)
+		entries = append(entries, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate temple proposal entries: %v", err)
+	}
+	return entries, nil
+}
+
+// Create returns a builder for creating a TempleProposal entity.
+func (c *TempleProposalClient) Create() *TempleProposalCreate {
+	return &TempleProposalCreate{db: c.db, hooks: c.hooks, clock: c.clock, proposal: &TempleProposal{}}
+}
+
+// TempleProposalCreate is a builder for creating a TempleProposal entity.
+type TempleProposalCreate struct {
+	db       dbtx
+	hooks    *hooks
+	clock    *clockSource
+	proposal *TempleProposal
+}
+
+// SetUserID sets the user_id field.
+func (pc *TempleProposalCreate) SetUserID(userID string) *TempleProposalCreate {
+	pc.proposal.UserID = userID
+	return pc
+}
+
+// SetName sets the name and name_en fields.
+func (pc *TempleProposalCreate) SetName(name, nameEn string) *TempleProposalCreate {
+	pc.proposal.Name, pc.proposal.NameEn = name, nameEn
+	return pc
+}
+
+// SetLocation sets the latitude and longitude fields.
+func (pc *TempleProposalCreate) SetLocation(lat, lng float64) *TempleProposalCreate {
+	pc.proposal.Latitude, pc.proposal.Longitude = lat, lng
+	return pc
+}
+
+// SetPrefecture sets the prefecture field.
+func (pc *TempleProposalCreate) SetPrefecture(prefecture string) *TempleProposalCreate {
+	pc.proposal.Prefecture = prefecture
+	return pc
+}
+
+// SetKind sets the kind field. It defaults to TempleKindTemple.
+func (pc *TempleProposalCreate) SetKind(kind string) *TempleProposalCreate {
+	pc.proposal.Kind = kind
+	return pc
+}
+
+// SetDetails sets the optional address, description, website, opening_hours and goshuin_fee fields.
+func (pc *TempleProposalCreate) SetDetails(address, description, website, openingHours, goshuinFee string) *TempleProposalCreate {
+	p := pc.proposal
+	p.Address, p.Description, p.Website, p.OpeningHours, p.GoshuinFee = address, description, website, openingHours, goshuinFee
+	return pc
+}
+
+// SetPhoto sets the photo by storage key (empty for external URLs) and URL.
+func (pc *TempleProposalCreate) SetPhoto(key, url string) *TempleProposalCreate {
+	pc.proposal.PhotoKey, pc.proposal.PhotoURL = key, url
+	return pc
+}
+
+// SetComment sets the comment field.
+func (pc *TempleProposalCreate) SetComment(comment string) *TempleProposalCreate {
+	pc.proposal.Comment = comment
+	return pc
+}
+
+// validate checks the proposed temple with the same limits as temple corrections.
+func (p *TempleProposal) validate() error {
+	if p.Kind == "" {
+		p.Kind = TempleKindTemple
+	}
+	if p.Kind != TempleKindTemple && p.Kind != TempleKindShrine {
+		return fmt.Errorf("kind must be %q or %q", TempleKindTemple, TempleKindShrine)
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if p.Latitude == 0 && p.Longitude == 0 {
+		return fmt.Errorf("latitude and longitude are required")
+	}
+	fields := map[string]string{
+		"name":          p.Name,
+		"latitude":      fmt.Sprint(p.Latitude),
+		"longitude":     fmt.Sprint(p.Longitude),
+		"address":       p.Address,
+		"website":       p.Website,
+		"opening_hours": p.OpeningHours,
+		"goshuin_fee":   p.GoshuinFee,
+	}
+	if p.NameEn != "" {
+		fields["name_en"] = p.NameEn
+	}
+	if len([]rune(p.Prefecture)) > 50 {
+		return fmt.Errorf("prefecture must be at most 50 characters")
+	}
+	return ValidateTempleChanges(fields)
+}
+
+// Save validates and saves the proposal as pending.
+func (pc *TempleProposalCreate) Save(ctx context.Context) (*TempleProposal, error) {
+	p := pc.proposal
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	if pc.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	ctx, mu, err := pc.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	id, err := pc.db.insert(ctx, "id", `
+		INSERT INTO temple_proposals (user_id, name, name_en, latitude, longitude, prefecture, kind,
+			address, description, website, opening_hours, goshuin_fee, photo_key, photo_url, comment, status,
+			created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, p.UserID, p.Name, nullString(p.NameEn), p.Latitude, p.Longitude, p.Prefecture, p.Kind,
+		nullString(p.Address), nullString(p.Description), nullString(p.Website), nullString(p.OpeningHours),
+		nullString(p.GoshuinFee), nullString(p.PhotoKey), nullString(p.PhotoURL), nullString(p.Comment),
+		TempleProposalPending, pc.clock.now(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temple proposal: %v", err)
+	}
+
+	proposal, err := (&TempleProposalClient{db: pc.db}).Get(ctx, int(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mu.commit(&Mutation{Op: OpCreate, Type: TypeTempleProposal, ID: proposal.ID, UserID: proposal.UserID, New: proposal}); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+// AddEntry records a goshuin collected at the proposed temple. While the proposal is pending
+// the entry waits for review; once it has a temple the entry is linked straight away.
+func (c *TempleProposalClient) AddEntry(ctx context.Context, entry *TempleProposalEntry, collectedAt time.Time) (*TempleProposalEntry, error) {
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	proposal, err := c.Get(ctx, entry.ProposalID)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status == TempleProposalRejected {
+		return nil, ErrProposalRejected
+	}
+
+	now := c.clock.now()
+	if collectedAt.IsZero() {
+		collectedAt = now
+	}
+	id, err := c.db.insert(ctx, "id", `
+		INSERT INTO temple_proposal_entries (proposal_id, user_id, image_url, notes, collected_at, collected_tz_offset,
+			created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, entry.ProposalID, entry.UserID, nullString(entry.ImageURL), nullString(entry.Notes),
+		collectedAt.UTC(), clock.OffsetMinutes(collectedAt), now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add temple proposal entry: %v", err)
+	}
+
+	if proposal.TempleID > 0 {
+		if _, err := c.linkEntries(ctx, proposal.ID, proposal.TempleID); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := c.entries(ctx, proposal.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.ID == int(id) {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("temple proposal entry not found")
+}
+
+// linkEntries creates a goshuin collection at the temple for every entry of the proposal that
+// is not linked yet, and returns the entries it linked. Each entry is marked as soon as its
+// collection exists, so running it again after a failure does not duplicate collections.
+func (c *TempleProposalClient) linkEntries(ctx context.Context, proposalID, templeID int) ([]*TempleProposalEntry, error) {
+	entries, err := c.entries(ctx, proposalID)
+	if err != nil {
+		return nil, err
+	}
+
+	collections := newGoshuinCollectionClient(c.db, c.hooks, c.clock)
+	linked := []*TempleProposalEntry{}
+	for _, e := range entries {
+		if e.CollectionID > 0 {
+			continue
+		}
+		create := collections.Create().
+			SetUserID(e.UserID).
+			SetTempleID(templeID).
+			SetImageURL(e.ImageURL).
+			SetNotes(e.Notes)
+		if e.CollectedAt != "" {
+			t, err := time.Parse(time.RFC3339, e.CollectedAt)
+			if err != nil {
+				return nil, fmt.Errorf("invalid collected_at of entry %d: %v", e.ID, err)
+			}
+			create.SetCollectedAt(t)
+		}
+		collection, err := create.Save(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = c.db.ExecContext(ctx, `UPDATE temple_proposal_entries SET collection_id = ? WHERE id = ?`, collection.ID, e.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to link temple proposal entry: %v", err)
+		}
+		e.CollectionID = collection.ID
+		linked = append(linked, e)
+	}
+	return linked, nil
+}
+
+// TempleProposalReview is the decision of a reviewer.
+type TempleProposalReview struct {
+	// Status is TempleProposalApproved, TempleProposalMerged or TempleProposalRejected.
+	Status     string
+	ReviewerID string
+	Note       string
+	// TempleID is the existing temple the proposal duplicates, required when merging.
+	TempleID int
+}
+
+// TempleProposalResult is the outcome of a review.
+type TempleProposalResult struct {
+	Proposal *TempleProposal
+	// Temple is the created or merged temple; nil when rejected.
+	Temple *Temple
+	// Linked are the entries that became goshuin collections.
+	Linked []*TempleProposalEntry
+}
+
+// Review approves, merges or rejects a pending proposal. Approving creates the temple credited
+// to the proposer; approving and merging link the pending entries to the temple.
+func (c *TempleProposalClient) Review(ctx context.Context, id int, review TempleProposalReview) (*TempleProposalResult, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("temple proposal not found")
+	}
+
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	old, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	temples := newTempleClient(c.db, c.hooks, c.clock)
+	var temple *Temple
+	switch review.Status {
+	case TempleProposalApproved, TempleProposalRejected:
+	case TempleProposalMerged:
+		if temple, err = temples.Get(ctx, review.TempleID); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid review status %q", review.Status)
+	}
+
+	// 状態を先に更新して提案を確保し、二重に寺社が作成されないようにする
+	result, err := c.db.ExecContext(ctx, `
+		UPDATE temple_proposals SET status = ?, reviewer_id = ?, review_note = ?, reviewed_at = ?
+		WHERE id = ? AND status = ?
+	`, review.Status, review.ReviewerID, nullString(review.Note), c.clock.now(), id, TempleProposalPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to review temple proposal: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to review temple proposal: %v", err)
+	} else if n == 0 {
+		return nil, ErrProposalAlreadyReviewed
+	}
+
+	if review.Status == TempleProposalApproved {
+		temple, err = temples.Create().
+			SetName(old.Name).
+			SetNameEn(old.NameEn).
+			SetLatitude(old.Latitude).
+			SetLongitude(old.Longitude).
+			SetPrefecture(old.Prefecture).
+			SetKind(old.Kind).
+			SetDescription(old.Description).
+			SetAddress(old.Address).
+			SetWebsite(old.Website).
+			SetOpeningHours(old.OpeningHours).
+			SetGoshuinFee(old.GoshuinFee).
+			SetActive(true).
+			SetContributedBy(old.UserID).
+			Save(ctx)
+		if err != nil {
+			c.reopen(ctx, id)
+			return nil, err
+		}
+	}
+
+	res := &TempleProposalResult{Temple: temple}
+	if temple != nil {
+		_, err := c.db.ExecContext(ctx, `UPDATE temple_proposals SET temple_id = ? WHERE id = ?`, temple.ID, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set proposal temple: %v", err)
+		}
+		if res.Linked, err = c.linkEntries(ctx, id, temple.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.Proposal, err = c.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := mu.commit(&Mutation{Op: OpUpdate, Type: TypeTempleProposal, ID: id, UserID: old.UserID, Old: old, New: res.Proposal}); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// reopen returns a proposal to the queue after its approval failed.
+func (c *TempleProposalClient) reopen(ctx context.Context, id int) {
+	_, _ = c.db.ExecContext(ctx, `
+		UPDATE temple_proposals SET status = ?, reviewer_id = NULL, review_note = NULL, reviewed_at = NULL WHERE id = ?
+	`, TempleProposalPending, id)
+}
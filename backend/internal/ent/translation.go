@@ -0,0 +1,284 @@
+package ent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Mutation types of translations and of the guide content they translate.
+const (
+	TypeTranslation  = "Translation"
+	TypeGuide        = "Guide"
+	TypeGuideSection = "GuideSection"
+	TypeGuideTip     = "GuideTip"
+)
+
+// TranslatableFields are the fields that can be translated, by entity type. Guide sections
+// and tips are not translated here: each locale is its own entry with the same slug.
+var TranslatableFields = map[string][]string{
+	TypeTemple: {"name", "description", "address", "opening_hours", "goshuin_fee", "goshuin_office", "procedure_notes"},
+	TypeGuide:  {"title", "description"},
+}
+
+// columnLocales are the locales stored in the entity's own columns rather than as translations:
+// temples are written in Japanese with name_en and description_en, the guide in English.
+var columnLocales = map[string]map[string][]string{
+	TypeTemple: {
+		"name":        {"ja", "en"},
+		"description": {"ja", "en"},
+		"*":           {"ja"},
+	},
+	TypeGuide: {"*": {"en"}},
+}
+
+// maxTranslationLength is the longest translated value accepted.
+const maxTranslationLength = 10000
+
+// Translation entity is the value of one field of an entity in one locale.
+type Translation struct {
+	ID         int    `json:"id"`
+	EntityType string `json:"entity_type"`
+	EntityID   int    `json:"entity_id"`
+	Field      string `json:"field"`
+	Locale     string `json:"locale"`
+	Value      string `json:"value"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+// LocalizedValue is a field value picked from a fallback chain, with the locale it came from.
+type LocalizedValue struct {
+	Value  string `json:"value"`
+	Locale string `json:"locale"`
+}
+
+// Translations holds loaded values by entity id, field and locale.
+type Translations map[int]map[string]map[string]string
+
+// Values returns the values of a field by locale. The map may be modified by the caller.
+func (t Translations) Values(id int, field string) map[string]string {
+	values := map[string]string{}
+	for locale, v := range t[id][field] {
+		values[locale] = v
+	}
+	return values
+}
+
+// ValidateTranslation checks that the field can be translated and the locale is not one
+// stored in the entity's own columns.
+func ValidateTranslation(entityType, field, locale string) error {
+	fields, ok := TranslatableFields[entityType]
+	if !ok {
+		return fmt.Errorf("%s cannot be translated", entityType)
+	}
+	found := false
+	for _, f := range fields {
+		found = found || f == field
+	}
+	if !found {
+		return fmt.Errorf("%s.%s cannot be translated", entityType, field)
+	}
+
+	locales, ok := columnLocales[entityType][field]
+	if !ok {
+		locales = columnLocales[entityType]["*"]
+	}
+	for _, l := range locales {
+		if l == locale {
+			return fmt.Errorf("%s.%s in %s is edited on the %s itself", entityType, field, locale, entityType)
+		}
+	}
+	return nil
+}
+
+// TranslationClient is a client for the Translation schema.
+type TranslationClient struct {
+	db    dbtx
+	hooks *hooks
+	clock *clockSource
+}
+
+// TranslationFilter holds the search conditions for TranslationClient.List.
+type TranslationFilter struct {
+	EntityType string
+	EntityIDs  []int
+	// Locales limits results to these locales; empty means all.
+	Locales []string
+}
+
+// scanTranslation scans a translation row.
+func scanTranslation(row rowScanner) (*Translation, error) {
+	var t Translation
+	var updatedAt time.Time
+	if err := row.Scan(&t.ID, &t.EntityType, &t.EntityID, &t.Field, &t.Locale, &t.Value, &updatedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan translation: %v", err)
+	}
+	t.UpdatedAt = updatedAt.UTC().Format(time.RFC3339)
+	return &t, nil
+}
+
+// translationColumns is the column list scanned by scanTranslation.
+const translationColumns = `id, entity_type, entity_id, field, locale, value, updated_at`
+
+// Get returns a Translation entity by its id.
+func (c *TranslationClient) Get(ctx context.Context, id int) (*Translation, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("translation not found")
+	}
+	t, err := scanTranslation(c.db.QueryRowContext(ctx, `SELECT `+translationColumns+` FROM translations WHERE id = ?`, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get translation: %v", err)
+	}
+	return t, nil
+}
+
+// List returns the translations matching the filter.
+func (c *TranslationClient) List(ctx context.Context, f TranslationFilter) ([]*Translation, error) {
+	translations := []*Translation{}
+	if c.db == nil {
+		return translations, nil
+	}
+
+	where := []string{"entity_type = ?"}
+	args := []interface{}{f.EntityType}
+	if len(f.EntityIDs) > 0 {
+		where = append(where, "entity_id IN ("+placeholders(len(f.EntityIDs))+")")
+		for _, id := range f.EntityIDs {
+			args = append(args, id)
+		}
+	}
+	if len(f.Locales) > 0 {
+		where = append(where, "locale IN ("+placeholders(len(f.Locales))+")")
+		for _, l := range f.Locales {
+			args = append(args, l)
+		}
+	}
+
+	query := `SELECT ` + translationColumns + ` FROM translations WHERE ` + strings.Join(where, " AND ") +
+		` ORDER BY entity_id, field, locale`
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query translations: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTranslation(rows)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate translations: %v", err)
+	}
+	return translations, nil
+}
+
+// Load returns the translations of the entities in the given locales.
+func (c *TranslationClient) Load(ctx context.Context, entityType string, ids []int, locales []string) (Translations, error) {
+	list, err := c.List(ctx, TranslationFilter{EntityType: entityType, EntityIDs: ids, Locales: locales})
+	if err != nil {
+		return nil, err
+	}
+	loaded := Translations{}
+	for _, t := range list {
+		if loaded[t.EntityID] == nil {
+			loaded[t.EntityID] = map[string]map[string]string{}
+		}
+		if loaded[t.EntityID][t.Field] == nil {
+			loaded[t.EntityID][t.Field] = map[string]string{}
+		}
+		loaded[t.EntityID][t.Field][t.Locale] = t.Value
+	}
+	return loaded, nil
+}
+
+// Set creates or replaces the translation of a field in a locale.
+func (c *TranslationClient) Set(ctx context.Context, t *Translation) (*Translation, error) {
+	if err := ValidateTranslation(t.EntityType, t.Field, t.Locale); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(t.Value) == "" {
+		return nil, fmt.Errorf("value must not be empty")
+	}
+	if len([]rune(t.Value)) > maxTranslationLength {
+		return nil, fmt.Errorf("value must be at most %d characters", maxTranslationLength)
+	}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	var old *Translation
+	query := `SELECT ` + translationColumns + ` FROM translations WHERE entity_type = ? AND entity_id = ? AND field = ? AND locale = ?`
+	existing, err := scanTranslation(c.db.QueryRowContext(ctx, query, t.EntityType, t.EntityID, t.Field, t.Locale))
+	if err == nil {
+		old = existing
+	}
+
+	var id int
+	now := c.clock.now()
+	if old != nil {
+		_, err = c.db.ExecContext(ctx, `UPDATE translations SET value = ?, updated_at = ? WHERE id = ?`, t.Value, now, old.ID)
+		id = old.ID
+	} else {
+		var lastID int64
+		lastID, err = c.db.insert(ctx, "id", `
+			INSERT INTO translations (entity_type, entity_id, field, locale, value, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, t.EntityType, t.EntityID, t.Field, t.Locale, t.Value, now, now)
+		id = int(lastID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save translation: %v", err)
+	}
+
+	saved, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Mutation{Op: OpCreate, Type: TypeTranslation, ID: saved.ID, New: saved}
+	if old != nil {
+		m.Op, m.Old = OpUpdate, old
+	}
+	if err := mu.commit(m); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// Delete removes a translation.
+func (c *TranslationClient) Delete(ctx context.Context, id int) error {
+	if c.db == nil {
+		return ErrNoDatabase
+	}
+
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	old, err := c.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := c.db.ExecContext(ctx, `DELETE FROM translations WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete translation: %v", err)
+	}
+
+	return mu.commit(&Mutation{Op: OpDelete, Type: TypeTranslation, ID: id, Old: old})
+}
+
+// placeholders returns n comma-separated query placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
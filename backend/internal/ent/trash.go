@@ -0,0 +1,143 @@
+package ent
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotInTrash is returned when restoring or purging an entity that is not in the trash.
+var ErrNotInTrash = errors.New("not in trash")
+
+// GetTrashed returns a GoshuinCollection entity in the trash by its id.
+func (c *GoshuinCollectionClient) GetTrashed(ctx context.Context, id int) (*GoshuinCollection, error) {
+	return c.repo.GetTrashed(ctx, id)
+}
+
+// Restore takes a GoshuinCollection entity out of the trash.
+func (c *GoshuinCollectionClient) Restore(ctx context.Context, id int) (*GoshuinCollection, error) {
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	if err := c.repo.Restore(ctx, id, c.clock.now()); err != nil {
+		return nil, err
+	}
+
+	collection, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mu.commit(&Mutation{Op: OpRestore, Type: TypeGoshuinCollection, ID: id, UserID: collection.UserID, New: collection}); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// Purge permanently deletes a GoshuinCollection entity in the trash together with its tags and photos.
+// Files in storage are left to the caller.
+func (c *GoshuinCollectionClient) Purge(ctx context.Context, id int) error {
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	var old *GoshuinCollection
+	if c.hooks.enabled() {
+		if old, err = c.GetTrashed(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	if err := c.repo.Purge(ctx, id); err != nil {
+		return err
+	}
+
+	var m *Mutation
+	if old != nil {
+		m = &Mutation{Op: OpPurge, Type: TypeGoshuinCollection, ID: id, UserID: old.UserID, Old: old}
+	}
+	return mu.commit(m)
+}
+
+// DeleteOneID returns a builder for deleting a Temple entity.
+// The temple is hidden from queries but kept while collections refer to it.
+func (c *TempleClient) DeleteOneID(id int) *TempleDeleteOneID {
+	return &TempleDeleteOneID{repo: c.repo, hooks: c.hooks, clock: c.clock, id: id}
+}
+
+// TempleDeleteOneID is a builder for deleting a Temple entity.
+type TempleDeleteOneID struct {
+	repo  TempleRepository
+	hooks *hooks
+	clock *clockSource
+	id    int
+}
+
+// Exec marks the temple as deleted. Collections of the temple are not affected.
+func (td *TempleDeleteOneID) Exec(ctx context.Context) error {
+	ctx, mu, err := td.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	old, err := td.repo.Get(ctx, td.id)
+	if err != nil {
+		return err
+	}
+
+	if err := td.repo.Delete(ctx, td.id, td.clock.now()); err != nil {
+		return err
+	}
+
+	return mu.commit(&Mutation{Op: OpDelete, Type: TypeTemple, ID: td.id, Old: old})
+}
+
+// Restore brings a deleted Temple entity back.
+func (c *TempleClient) Restore(ctx context.Context, id int) (*Temple, error) {
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mu.rollback()
+
+	if err := c.repo.Restore(ctx, id, c.clock.now()); err != nil {
+		return nil, err
+	}
+
+	temple, err := c.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mu.commit(&Mutation{Op: OpRestore, Type: TypeTemple, ID: id, New: temple}); err != nil {
+		return nil, err
+	}
+	return temple, nil
+}
+
+// PurgeDeleted permanently deletes the temples deleted before the time that no collection,
+// including those in the trash, refers to. It returns the number of temples deleted.
+func (c *TempleClient) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer mu.rollback()
+
+	// Temples purged before a failure stay purged.
+	ids, err := c.repo.PurgeDeleted(ctx, before)
+	ms := make([]*Mutation, 0, len(ids))
+	for _, id := range ids {
+		ms = append(ms, &Mutation{Op: OpPurge, Type: TypeTemple, ID: id})
+	}
+	if cerr := mu.commit(ms...); cerr != nil {
+		return 0, cerr
+	}
+	return len(ids), err
+}
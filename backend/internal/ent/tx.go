@@ -0,0 +1,213 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
+	"stamp-backend/internal/dialect"
+)
+
+// runner is the part of *sql.DB and *sql.Tx used to run queries.
+type runner interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// dbtx is what the sub-clients run their queries on, so the same builders work inside and
+// outside a transaction. Queries are written with ? placeholders in MySQL syntax; the
+// dialect supplies the expressions that differ between databases.
+type dbtx interface {
+	runner
+	// dialect returns the SQL dialect of the database.
+	dialect() dialect.Dialect
+	// insert runs an INSERT and returns the generated value of the key column, or 0 if no row
+	// was inserted.
+	insert(ctx context.Context, key, query string, args ...interface{}) (int64, error)
+}
+
+// conn runs queries on a database, or in a transaction if tx is set, rebinding the
+// placeholders for the dialect.
+type conn struct {
+	d  dialect.Dialect
+	db *sql.DB
+	tx *sql.Tx
+}
+
+// txKey is the context key of the mutation in progress, whose transaction the queries made
+// with the context run in.
+type txKey struct{}
+
+// txFor returns the transaction queries made with ctx run in: the client's own, or the one of a
+// mutation in progress on the same database. It returns nil outside a transaction.
+func (c *conn) txFor(ctx context.Context) *sql.Tx {
+	if c.tx != nil {
+		return c.tx
+	}
+	if mu, ok := ctx.Value(txKey{}).(*mutation); ok && mu.txc != nil && mu.txc.db == c.db {
+		return mu.txc.tx
+	}
+	return nil
+}
+
+func (c *conn) runner(ctx context.Context) runner {
+	if tx := c.txFor(ctx); tx != nil {
+		return tx
+	}
+	return c.db
+}
+
+func (c *conn) dialect() dialect.Dialect {
+	return c.d
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.runner(ctx).ExecContext(ctx, c.d.Rebind(query), args...)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.runner(ctx).QueryContext(ctx, c.d.Rebind(query), args...)
+}
+
+func (c *conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.runner(ctx).QueryRowContext(ctx, c.d.Rebind(query), args...)
+}
+
+func (c *conn) insert(ctx context.Context, key, query string, args ...interface{}) (int64, error) {
+	return dialect.InsertID(ctx, c.runner(ctx), c.d, key, query, args...)
+}
+
+// savepointSeq numbers savepoints so that nested ones never share a name.
+var savepointSeq uint64
+
+// begin starts a transaction on the database, or a savepoint when c is already a transaction
+// or ctx carries one.
+func (c *conn) begin(ctx context.Context) (*txConn, error) {
+	if tx := c.txFor(ctx); tx != nil {
+		name := fmt.Sprintf("sp_%d", atomic.AddUint64(&savepointSeq, 1))
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+			return nil, fmt.Errorf("failed to set savepoint: %v", err)
+		}
+		return &txConn{conn: &conn{d: c.d, db: c.db, tx: tx}, ctx: ctx, savepoint: name}, nil
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &txConn{conn: &conn{d: c.d, db: c.db, tx: tx}, ctx: ctx}, nil
+}
+
+// txConn is a transaction, or a savepoint in an outer one, started on a conn.
+type txConn struct {
+	*conn
+	ctx context.Context
+	// savepoint names the savepoint; empty for a transaction.
+	savepoint string
+	done      bool
+}
+
+// Commit commits the transaction or releases the savepoint, keeping its changes in the outer
+// transaction.
+func (t *txConn) Commit() error {
+	if t.savepoint == "" {
+		return t.tx.Commit()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.tx.ExecContext(t.ctx, "RELEASE SAVEPOINT "+t.savepoint)
+	return err
+}
+
+// Rollback rolls back the transaction, or the changes made since the savepoint while the
+// outer transaction continues.
+func (t *txConn) Rollback() error {
+	if t.savepoint == "" {
+		return t.tx.Rollback()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.tx.ExecContext(t.ctx, "ROLLBACK TO SAVEPOINT "+t.savepoint)
+	return err
+}
+
+// begin starts a transaction on db for a multi-statement write. When db is already a
+// transaction, the write gets a savepoint so that a failure only undoes its own statements.
+func begin(ctx context.Context, db dbtx) (*txConn, error) {
+	return db.(*conn).begin(ctx)
+}
+
+// Tx is a transactional client. The embedded client's sub-clients run every query in one
+// database transaction until Commit or Rollback is called.
+//
+// Hooks for the mutations made through the transaction run when it commits, and not at all
+// when it rolls back. Calling Tx or WithTx on the transactional client starts a nested
+// transaction backed by a savepoint: rolling it back undoes only its own changes, and its
+// hooks run when the outermost transaction commits.
+type Tx struct {
+	*Client
+	txc   *txConn
+	hooks *hooks
+}
+
+// Tx starts a transaction. On a transactional client it starts a nested transaction.
+// Without a database it returns ErrNoDatabase, since the changes could not be rolled back.
+func (c *Client) Tx(ctx context.Context) (*Tx, error) {
+	if c.conn == nil {
+		return nil, ErrNoDatabase
+	}
+
+	txc, err := c.conn.begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	h := &hooks{parent: c.hooks, conn: txc.conn}
+	return &Tx{Client: buildClient(txc.conn, h, c.clock), txc: txc, hooks: h}, nil
+}
+
+// Commit commits the transaction and runs the hooks of its mutations.
+func (tx *Tx) Commit() error {
+	if err := tx.txc.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	tx.hooks.flush()
+	return nil
+}
+
+// Rollback rolls back the transaction and discards the hooks of its mutations.
+func (tx *Tx) Rollback() error {
+	tx.hooks.discard()
+	if err := tx.txc.Rollback(); err != nil {
+		return fmt.Errorf("failed to roll back transaction: %v", err)
+	}
+	return nil
+}
+
+// WithTx calls fn with a transactional client and commits if fn returns nil. If fn returns
+// an error or panics the transaction is rolled back, and the error or panic is passed on.
+// On a transactional client fn runs in a nested transaction.
+func (c *Client) WithTx(ctx context.Context, fn func(tx *Client) error) error {
+	tx, err := c.Tx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx.Client); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("%w (%v)", err, rerr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
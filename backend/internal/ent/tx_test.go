@@ -0,0 +1,276 @@
+package ent_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/database"
+	"stamp-backend/internal/ent"
+)
+
+// testNow is the current time of the tests.
+var testNow = time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+
+var errTest = errors.New("test")
+
+func TestMain(m *testing.M) {
+	// Keep the migration log out of the test output.
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestClient opens an in-memory SQLite database.
+func newTestClient(t *testing.T) *ent.Client {
+	t.Helper()
+
+	client, err := database.OpenWithClock(map[string]string{"driver": "sqlite", "name": ":memory:"}, clock.Fixed(testNow))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// createTemple creates an active temple with the given name.
+func createTemple(ctx context.Context, c *ent.Client, name string) (*ent.Temple, error) {
+	return c.Temple.Create().
+		SetName(name).
+		SetPrefecture("東京都").
+		SetKind("temple").
+		SetLatitude(35.7148).
+		SetLongitude(139.7967).
+		SetActive(true).
+		Save(ctx)
+}
+
+// templeNames returns the names of the temples with the given IDs that exist.
+func templeNames(t *testing.T, c *ent.Client, ids ...int) []string {
+	t.Helper()
+
+	var names []string
+	for _, id := range ids {
+		if temple, err := c.Temple.Get(context.Background(), id); err == nil {
+			names = append(names, temple.Name)
+		}
+	}
+	return names
+}
+
+// recordHooks records the names of the temples created through c as its hooks run.
+func recordHooks(c *ent.Client) *[]string {
+	var names []string
+	c.Use(func(ctx context.Context, m *ent.Mutation) {
+		if m.Op == ent.OpCreate && m.Type == ent.TypeTemple {
+			names = append(names, m.New.(*ent.Temple).Name)
+		}
+	})
+	return &names
+}
+
+func TestWithTx(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	hooked := recordHooks(client)
+
+	var ids []int
+	for _, c := range []struct {
+		name string
+		err  error
+	}{
+		{"committed", nil},
+		{"rolled back", errTest},
+	} {
+		before := len(*hooked)
+		err := client.WithTx(ctx, func(tx *ent.Client) error {
+			temple, err := createTemple(ctx, tx, c.name)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, temple.ID)
+			if len(*hooked) != before {
+				t.Errorf("%s: hooks ran before the transaction ended", c.name)
+			}
+			return c.err
+		})
+		if err != c.err {
+			t.Errorf("%s: WithTx = %v; want %v", c.name, err, c.err)
+		}
+	}
+
+	want := []string{"committed"}
+	if got := templeNames(t, client, ids...); !reflect.DeepEqual(got, want) {
+		t.Errorf("temples = %q; want %q", got, want)
+	}
+	if !reflect.DeepEqual(*hooked, want) {
+		t.Errorf("hooks ran for %q; want %q", *hooked, want)
+	}
+}
+
+func TestWithTxPanic(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	var id int
+	func() {
+		defer func() {
+			if p := recover(); p != errTest {
+				t.Errorf("recovered %v; want %v", p, errTest)
+			}
+		}()
+		client.WithTx(ctx, func(tx *ent.Client) error {
+			temple, err := createTemple(ctx, tx, "panicked")
+			if err != nil {
+				t.Fatal(err)
+			}
+			id = temple.ID
+			panic(errTest)
+		})
+	}()
+
+	if got := templeNames(t, client, id); len(got) != 0 {
+		t.Errorf("temples = %q; want none", got)
+	}
+}
+
+func TestNestedTx(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	hooked := recordHooks(client)
+
+	// A failed savepoint undoes only its own changes, and the hooks of all the committed
+	// levels run when the outermost transaction commits.
+	var ids []int
+	err := client.WithTx(ctx, func(tx *ent.Client) error {
+		for _, c := range []struct {
+			name string
+			err  error
+		}{
+			{"outer", nil},
+			{"released", nil},
+			{"rolled back", errTest},
+		} {
+			create := func(tx *ent.Client) error {
+				temple, err := createTemple(ctx, tx, c.name)
+				if err != nil {
+					return err
+				}
+				ids = append(ids, temple.ID)
+				return c.err
+			}
+			if c.name == "outer" {
+				if err := create(tx); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.WithTx(ctx, create); err != c.err {
+				t.Errorf("%s: WithTx = %v; want %v", c.name, err, c.err)
+			}
+		}
+		if len(*hooked) != 0 {
+			t.Errorf("hooks ran before the outermost transaction committed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"outer", "released"}
+	if got := templeNames(t, client, ids...); !reflect.DeepEqual(got, want) {
+		t.Errorf("temples = %q; want %q", got, want)
+	}
+	if !reflect.DeepEqual(*hooked, want) {
+		t.Errorf("hooks ran for %q; want %q", *hooked, want)
+	}
+
+	// Rolling back the outer transaction undoes the savepoints released in it.
+	ids = ids[:0]
+	err = client.WithTx(ctx, func(tx *ent.Client) error {
+		return tx.WithTx(ctx, func(tx *ent.Client) error {
+			temple, err := createTemple(ctx, tx, "inner")
+			if err != nil {
+				return err
+			}
+			ids = append(ids, temple.ID)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WithTx(ctx, func(tx *ent.Client) error {
+		if err := tx.WithTx(ctx, func(tx *ent.Client) error {
+			temple, err := createTemple(ctx, tx, "released then rolled back")
+			if err != nil {
+				return err
+			}
+			ids = append(ids, temple.ID)
+			return nil
+		}); err != nil {
+			return err
+		}
+		return errTest
+	}); err != errTest {
+		t.Errorf("WithTx = %v; want %v", err, errTest)
+	}
+	want = []string{"inner"}
+	if got := templeNames(t, client, ids...); !reflect.DeepEqual(got, want) {
+		t.Errorf("temples = %q; want %q", got, want)
+	}
+}
+
+func TestTxHook(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+
+	// A TxHook sees the mutation's own writes through ctx, and its error undoes them.
+	var seen []string
+	client.UseTx(func(ctx context.Context, m *ent.Mutation) error {
+		if m.Type != ent.TypeTemple || m.Op != ent.OpCreate {
+			return nil
+		}
+		temple, err := client.Temple.Get(ctx, m.ID)
+		if err != nil {
+			return err
+		}
+		seen = append(seen, temple.Name)
+		if temple.Name == "rejected" {
+			return errTest
+		}
+		return nil
+	})
+
+	accepted, err := createTemple(ctx, client, "accepted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected, err := createTemple(ctx, client, "rejected")
+	if !errors.Is(err, errTest) {
+		t.Errorf("create rejected = %v, %v; want %v", rejected, err, errTest)
+	}
+	if want := []string{"accepted", "rejected"}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("hook saw %q; want %q", seen, want)
+	}
+
+	ids := []int{accepted.ID}
+	if rejected != nil {
+		ids = append(ids, rejected.ID)
+	}
+	if got, want := templeNames(t, client, ids...), []string{"accepted"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("temples = %q; want %q", got, want)
+	}
+}
+
+func TestTxWithoutDatabase(t *testing.T) {
+	if _, err := ent.NewClient().Tx(context.Background()); err != ent.ErrNoDatabase {
+		t.Errorf("Tx = %v; want %v", err, ent.ErrNoDatabase)
+	}
+}
@@ -0,0 +1,111 @@
+package ent
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UserBadge entity is a badge earned by a user.
+type UserBadge struct {
+	ID       int    `json:"id,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	BadgeID  string `json:"badge_id,omitempty"`
+	EarnedAt string `json:"earned_at,omitempty"`
+}
+
+// UserBadgeClient is a client for the UserBadge schema.
+type UserBadgeClient struct {
+	db    dbtx
+	hooks *hooks
+}
+
+// ListByUser returns the badges earned by the user, oldest first.
+func (c *UserBadgeClient) ListByUser(ctx context.Context, userID string) ([]*UserBadge, error) {
+	badges := []*UserBadge{}
+	if c.db == nil {
+		return nil, ErrNoDatabase
+	}
+
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT id, user_id, badge_id, earned_at
+		FROM user_badges WHERE user_id = ?
+		ORDER BY earned_at, id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user badges: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b UserBadge
+		var earnedAt time.Time
+		if err := rows.Scan(&b.ID, &b.UserID, &b.BadgeID, &earnedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user badge: %v", err)
+		}
+		b.EarnedAt = earnedAt.Format(time.RFC3339)
+		badges = append(badges, &b)
+	}
+	return badges, rows.Err()
+}
+
+// Award records that the user earned the badge at the given time.
+// Awarding a badge the user already has keeps the original timestamp.
+func (c *UserBadgeClient) Award(ctx context.Context, userID, badgeID string, earnedAt time.Time) error {
+	if c.db == nil {
+		return ErrNoDatabase
+	}
+
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	id, err := c.db.insert(ctx, "id", c.db.dialect().InsertIgnore(`
+		INSERT INTO user_badges (user_id, badge_id, earned_at) VALUES (?, ?, ?)
+	`), userID, badgeID, earnedAt)
+	if err != nil {
+		return fmt.Errorf("failed to award badge: %v", err)
+	}
+
+	var m *Mutation
+	if id > 0 {
+		badge := &UserBadge{ID: int(id), UserID: userID, BadgeID: badgeID, EarnedAt: earnedAt.UTC().Format(time.RFC3339)}
+		m = &Mutation{Op: OpCreate, Type: TypeUserBadge, ID: badge.ID, UserID: userID, New: badge}
+	}
+	return mu.commit(m)
+}
+
+// Revoke removes the badge from the user.
+func (c *UserBadgeClient) Revoke(ctx context.Context, userID, badgeID string) error {
+	if c.db == nil {
+		return ErrNoDatabase
+	}
+
+	ctx, mu, err := c.hooks.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer mu.rollback()
+
+	var old UserBadge
+	var earnedAt time.Time
+	err = c.db.QueryRowContext(ctx, `
+		SELECT id, user_id, badge_id, earned_at FROM user_badges WHERE user_id = ? AND badge_id = ?
+	`, userID, badgeID).Scan(&old.ID, &old.UserID, &old.BadgeID, &earnedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user badge: %v", err)
+	}
+	old.EarnedAt = earnedAt.UTC().Format(time.RFC3339)
+
+	if _, err := c.db.ExecContext(ctx, `DELETE FROM user_badges WHERE id = ?`, old.ID); err != nil {
+		return fmt.Errorf("failed to revoke badge: %v", err)
+	}
+
+	return mu.commit(&Mutation{Op: OpDelete, Type: TypeUserBadge, ID: old.ID, UserID: userID, Old: &old})
+}
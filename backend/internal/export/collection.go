@@ -0,0 +1,231 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stamp-backend/internal/ent"
+)
+
+// CollectionDocumentVersion エクスポート形式のバージョン
+const CollectionDocumentVersion = 1
+
+// maxImageSize エクスポートに含める画像1枚あたりの上限サイズ
+const maxImageSize = 20 << 20
+
+// maxImagePixels 展開する画像1枚あたりの上限画素数（小さなファイルが巨大な画像に展開されるのを防ぎます）
+const maxImagePixels = 40_000_000
+
+// ImageFetcher 画像URLの内容を取得する関数
+type ImageFetcher func(ctx context.Context, url string) (io.ReadCloser, error)
+
+// CollectionDocument 御朱印コレクションのエクスポート形式
+// ZIPの collection.json もこの形式で、インポートの入力にもなります
+type CollectionDocument struct {
+	Version     int               `json:"version"`
+	ExportedAt  string            `json:"exported_at"`
+	UserID      string            `json:"user_id"`
+	Collections []CollectionEntry `json:"collections"`
+	// MissingImages ZIPに含められなかった画像のURL
+	MissingImages []string `json:"missing_images,omitempty"`
+}
+
+// CollectionEntry 御朱印1件分のエクスポートデータ
+type CollectionEntry struct {
+	ID       int    `json:"id"`
+	TempleID int    `json:"temple_id"`
+	ImageURL string `json:"image_url,omitempty"`
+	// ImageFile ZIP内の画像ファイルのパス
+	ImageFile      string      `json:"image_file,omitempty"`
+	Notes          string      `json:"notes,omitempty"`
+	Tags           []string    `json:"tags,omitempty"`
+	Rating         int         `json:"rating,omitempty"`
+	FeePaid        int         `json:"fee_paid,omitempty"`
+	WaitingMinutes int         `json:"waiting_minutes,omitempty"`
+	HallName       string      `json:"hall_name,omitempty"`
+	CollectedAt    string      `json:"collected_at"`
+	CreatedAt      string      `json:"created_at,omitempty"`
+	UpdatedAt      string      `json:"updated_at,omitempty"`
+	Temple         *ent.Temple `json:"temple,omitempty"`
+}
+
+// NewCollectionDocument 寺社を結合済みのコレクションからエクスポートデータを作成します
+func NewCollectionDocument(userID string, collections []*ent.GoshuinCollection, exportedAt time.Time) *CollectionDocument {
+	doc := &CollectionDocument{
+		Version:     CollectionDocumentVersion,
+		ExportedAt:  exportedAt.Format(time.RFC3339),
+		UserID:      userID,
+		Collections: make([]CollectionEntry, 0, len(collections)),
+	}
+	for _, gc := range collections {
+		doc.Collections = append(doc.Collections, CollectionEntry{
+			ID:             gc.ID,
+			TempleID:       gc.TempleID,
+			ImageURL:       gc.ImageURL,
+			Notes:          gc.Notes,
+			Tags:           gc.Tags,
+			Rating:         gc.Rating,
+			FeePaid:        gc.FeePaid,
+			WaitingMinutes: gc.WaitingMinutes,
+			HallName:       gc.HallName,
+			CollectedAt:    gc.CollectedAt,
+			CreatedAt:      gc.CreatedAt,
+			UpdatedAt:      gc.UpdatedAt,
+			Temple:         gc.Edges.Temple,
+		})
+	}
+	return doc
+}
+
+// WriteCollectionJSON JSON形式で書き出します
+func WriteCollectionJSON(w io.Writer, doc *CollectionDocument) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// collectionCSVColumns CSVのヘッダー
+var collectionCSVColumns = []string{
+	"id", "collected_at", "temple_id", "temple_name", "temple_name_en",
+	"latitude", "longitude", "address", "notes", "image_url",
+	"tags", "rating", "fee_paid", "waiting_minutes", "hall_name",
+}
+
+// WriteCollectionCSV CSV形式で書き出します
+func WriteCollectionCSV(w io.Writer, doc *CollectionDocument) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(collectionCSVColumns); err != nil {
+		return err
+	}
+
+	for _, e := range doc.Collections {
+		t := e.Temple
+		if t == nil {
+			t = &ent.Temple{}
+		}
+		err := cw.Write([]string{
+			strconv.Itoa(e.ID),
+			e.CollectedAt,
+			strconv.Itoa(e.TempleID),
+			t.Name,
+			t.NameEn,
+			strconv.FormatFloat(t.Latitude, 'f', -1, 64),
+			strconv.FormatFloat(t.Longitude, 'f', -1, 64),
+			t.Address,
+			e.Notes,
+			e.ImageURL,
+			strings.Join(e.Tags, ";"),
+			optionalInt(e.Rating),
+			optionalInt(e.FeePaid),
+			optionalInt(e.WaitingMinutes),
+			e.HallName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// optionalInt 未設定（0）の数値を空欄にします
+func optionalInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// WriteCollectionZIP 画像を含むZIPアーカイブを書き出します
+// 取得できなかった画像は collection.json の missing_images に記録します
+func WriteCollectionZIP(ctx context.Context, w io.Writer, doc *CollectionDocument, fetch ImageFetcher) error {
+	zw := zip.NewWriter(w)
+
+	for i := range doc.Collections {
+		e := &doc.Collections[i]
+		if e.ImageURL == "" {
+			continue
+		}
+
+		data, err := readImage(ctx, fetch, e.ImageURL)
+		if err != nil {
+			doc.MissingImages = append(doc.MissingImages, e.ImageURL)
+			continue
+		}
+
+		e.ImageFile = fmt.Sprintf("images/%d%s", e.ID, ImageExtension(data))
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: e.ImageFile, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+	}
+
+	f, err := zw.Create("collection.json")
+	if err != nil {
+		return err
+	}
+	if err := WriteCollectionJSON(f, doc); err != nil {
+		return err
+	}
+
+	f, err = zw.Create("collection.csv")
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	if err := WriteCollectionCSV(bw, doc); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// readImage 画像を上限サイズまで読み込みます
+func readImage(ctx context.Context, fetch ImageFetcher, url string) ([]byte, error) {
+	rc, err := fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageSize {
+		return nil, fmt.Errorf("image too large: %s", url)
+	}
+	return data, nil
+}
+
+// ImageExtension 画像の内容から拡張子を判定します
+func ImageExtension(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".bin"
+	}
+}
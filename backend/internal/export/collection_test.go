@@ -0,0 +1,148 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/ent"
+)
+
+// testDocument 画像あり・画像が取得できない・画像なしの御朱印3件のエクスポートデータ
+func testDocument() *CollectionDocument {
+	temple := testTemples()[0]
+	return NewCollectionDocument("user-1", []*ent.GoshuinCollection{
+		{
+			ID: 1, TempleID: temple.ID, ImageURL: "http://localhost/uploads/a.png", Notes: "本堂で",
+			Tags: []string{"東京", "初詣"}, Rating: 5, CollectedAt: "2024-01-01T01:00:00Z",
+			Edges: ent.GoshuinCollectionEdges{Temple: temple},
+		},
+		{ID: 2, TempleID: 9, ImageURL: "http://localhost/uploads/missing.png", CollectedAt: "2024-02-01T01:00:00Z"},
+		{ID: 3, TempleID: 9, Notes: "メモ,\"引用\"", CollectedAt: "2024-03-01T01:00:00Z"},
+	}, time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC))
+}
+
+// testPNG 小さな PNG 画像
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testFetcher a.png だけを返す ImageFetcher
+func testFetcher(t *testing.T) ImageFetcher {
+	data := testPNG(t)
+	return func(ctx context.Context, url string) (io.ReadCloser, error) {
+		if url != "http://localhost/uploads/a.png" {
+			return nil, errors.New("not found")
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+}
+
+func TestWriteCollectionJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCollectionJSON(&buf, testDocument()); err != nil {
+		t.Fatal(err)
+	}
+
+	// JSON はインポートの入力になるため、読み戻して同じ内容になることを確かめます
+	var got CollectionDocument
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := testDocument()
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("document = %+v; want %+v", got, want)
+	}
+	if got.Version != CollectionDocumentVersion || got.ExportedAt != "2024-06-01T03:00:00Z" {
+		t.Errorf("version = %d, exported_at = %q", got.Version, got.ExportedAt)
+	}
+}
+
+func TestWriteCollectionCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCollectionCSV(&buf, testDocument()); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		collectionCSVColumns,
+		{"1", "2024-01-01T01:00:00Z", "1", "浅草寺", "Senso-ji", "35.7148", "139.7967", "", "本堂で", "http://localhost/uploads/a.png", "東京;初詣", "5", "", "", ""},
+		{"2", "2024-02-01T01:00:00Z", "9", "", "", "0", "0", "", "", "http://localhost/uploads/missing.png", "", "", "", "", ""},
+		{"3", "2024-03-01T01:00:00Z", "9", "", "", "0", "0", "", "メモ,\"引用\"", "", "", "", "", "", ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("CSV = %q; want %q", records, want)
+	}
+}
+
+func TestWriteCollectionZIP(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCollectionZIP(context.Background(), &buf, testDocument(), testFetcher(t)); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	if len(files) != 3 || !bytes.Equal(files["images/1.png"], testPNG(t)) || files["collection.csv"] == nil {
+		t.Fatalf("zip files = %d; want images/1.png, collection.json and collection.csv", len(files))
+	}
+
+	// 取得できなかった画像は missing_images に記録します
+	var doc CollectionDocument
+	if err := json.Unmarshal(files["collection.json"], &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Collections[0].ImageFile != "images/1.png" || doc.Collections[1].ImageFile != "" {
+		t.Errorf("image files = %q, %q", doc.Collections[0].ImageFile, doc.Collections[1].ImageFile)
+	}
+	if want := []string{"http://localhost/uploads/missing.png"}; !reflect.DeepEqual(doc.MissingImages, want) {
+		t.Errorf("missing images = %q; want %q", doc.MissingImages, want)
+	}
+}
+
+func TestImageExtension(t *testing.T) {
+	cases := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), ".jpg"},
+		{testPNG(t), ".png"},
+		{[]byte("GIF89a"), ".gif"},
+		{[]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), ".webp"},
+		{[]byte("plain text"), ".bin"},
+	}
+	for _, c := range cases {
+		if got := ImageExtension(c.data); got != c.want {
+			t.Errorf("ImageExtension(%q) = %q; want %q", c.data[:4], got, c.want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// パスポートのページサイズ（A5、ポイント単位）
+const (
+	passportWidth  = 420.0
+	passportHeight = 595.0
+)
+
+// ページで使うフォントのリソース名
+const (
+	fontLatin     = "F1"
+	fontLatinBold = "F2"
+	fontCJK       = "F3"
+)
+
+// japanOutline 地図サムネイル用の日本列島の簡略な輪郭（経度, 緯度）
+var japanOutline = [][][2]float64{
+	// 北海道
+	{{140.0, 41.4}, {140.6, 41.8}, {141.2, 41.8}, {140.9, 42.5}, {141.7, 42.6}, {143.2, 42.0}, {143.4, 42.0},
+		{144.9, 42.9}, {145.6, 43.3}, {145.2, 43.6}, {145.1, 44.1}, {144.3, 44.0}, {143.0, 44.5}, {141.9, 45.5},
+		{141.6, 45.4}, {141.7, 44.3}, {141.4, 43.3}, {140.5, 43.3}, {140.4, 42.6}, {139.9, 42.6}},
+	// 本州
+	{{140.9, 41.5}, {141.5, 41.4}, {141.5, 40.6}, {142.1, 39.6}, {141.7, 38.9}, {141.5, 38.3}, {141.0, 38.0},
+		{141.0, 37.0}, {140.8, 36.6}, {140.6, 35.8}, {140.9, 35.7}, {140.4, 35.2}, {139.9, 34.9}, {139.8, 35.3},
+		{139.6, 35.3}, {139.1, 35.1}, {138.8, 34.6}, {138.2, 34.6}, {137.0, 34.6}, {136.9, 34.3}, {136.3, 34.1},
+		{135.8, 33.5}, {135.1, 33.9}, {135.2, 34.6}, {134.2, 34.7}, {133.0, 34.4}, {132.0, 33.9}, {130.9, 33.95},
+		{131.2, 34.4}, {132.6, 35.4}, {133.5, 35.6}, {135.2, 35.7}, {135.9, 35.6}, {136.1, 36.1}, {136.7, 37.0},
+		{136.9, 37.2}, {137.3, 37.5}, {137.1, 36.8}, {138.2, 37.1}, {139.0, 37.9}, {139.6, 38.7}, {140.0, 39.6},
+		{139.9, 40.2}, {140.0, 40.7}, {140.3, 41.2}},
+	// 四国
+	{{132.5, 33.0}, {132.9, 32.75}, {133.3, 33.4}, {134.3, 33.2}, {134.7, 33.8}, {134.4, 34.2}, {133.6, 34.3},
+		{133.0, 34.1}, {132.6, 33.9}, {132.0, 33.3}},
+	// 九州
+	{{129.6, 33.3}, {130.0, 33.6}, {130.9, 33.95}, {131.6, 33.6}, {131.9, 32.8}, {131.4, 31.4}, {130.7, 31.0},
+		{130.2, 31.2}, {130.3, 32.1}, {130.1, 32.8}, {129.8, 32.7}},
+}
+
+// WritePassportPDF 御朱印1件につき1ページのパスポートPDFを書き出します
+// 寺社名・日付・メモ・画像・地図サムネイルを外部サービスを使わずに描画します
+func WritePassportPDF(ctx context.Context, w io.Writer, doc *CollectionDocument, fetch ImageFetcher) error {
+	d := &pdfDocument{}
+	catalogNum := d.reserve()
+	pagesNum := d.reserve()
+
+	infoNum := d.add(fmt.Sprintf("<< /Title %s /Producer (Goshuin App) >>", pdfLiteral("Goshuin Passport")))
+	fonts := fmt.Sprintf("/%s %d 0 R /%s %d 0 R /%s %d 0 R",
+		fontLatin, d.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>"),
+		fontLatinBold, d.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>"),
+		fontCJK, addCJKFont(d),
+	)
+
+	if len(doc.Collections) == 0 {
+		var c bytes.Buffer
+		drawFrame(&c)
+		drawText(&c, fontLatinBold, 16, 40, 520, "Goshuin Passport")
+		drawText(&c, fontLatin, 11, 40, 495, "No stamps collected yet.")
+		addPage(d, pagesNum, fonts, "", c.Bytes())
+	}
+
+	for i, e := range doc.Collections {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var c bytes.Buffer
+		xobjects := ""
+
+		drawFrame(&c)
+		drawText(&c, fontLatinBold, 9, 40, 555, "GOSHUIN PASSPORT")
+		no := fmt.Sprintf("No. %d / %d", i+1, len(doc.Collections))
+		drawText(&c, fontLatin, 9, passportWidth-40-textWidth(no, 9), 555, no)
+
+		temple := e.Temple
+		name, nameEn := fmt.Sprintf("Temple #%d", e.TempleID), ""
+		if temple != nil {
+			name, nameEn = temple.Name, temple.NameEn
+		}
+		drawText(&c, fontCJK, 20, 40, 522, name)
+		if nameEn != "" {
+			drawText(&c, fontLatin, 13, 40, 503, nameEn)
+		}
+		drawText(&c, fontLatin, 10, 40, 486, "Collected: "+formatPassportDate(e.CollectedAt))
+
+		// 御朱印の画像
+		imgX, imgY, imgW, imgH := 40.0, 200.0, passportWidth-80, 275.0
+		drawn := false
+		if e.ImageURL != "" && fetch != nil {
+			if num, iw, ih, err := addImage(ctx, d, fetch, e.ImageURL); err == nil {
+				scale := math.Min(imgW/float64(iw), imgH/float64(ih))
+				dw, dh := float64(iw)*scale, float64(ih)*scale
+				fmt.Fprintf(&c, "q %.2f 0 0 %.2f %.2f %.2f cm /Im1 Do Q\n",
+					dw, dh, imgX+(imgW-dw)/2, imgY+(imgH-dh)/2)
+				xobjects = fmt.Sprintf("/Im1 %d 0 R", num)
+				drawn = true
+			}
+		}
+		if !drawn {
+			fmt.Fprintf(&c, "q 0.95 0.93 0.9 rg %.2f %.2f %.2f %.2f re f Q\n", imgX, imgY, imgW, imgH)
+			drawText(&c, fontLatin, 10, imgX+imgW/2-textWidth("No image", 10)/2, imgY+imgH/2, "No image")
+		}
+
+		// メモ
+		drawText(&c, fontLatinBold, 10, 40, 180, "Notes")
+		y := 165.0
+		for _, line := range wrapText(e.Notes, 9, 200) {
+			if y < 40 {
+				break
+			}
+			drawText(&c, fontCJK, 9, 40, y, line)
+			y -= 12
+		}
+
+		// 地図サムネイル
+		if temple != nil {
+			drawMap(&c, 260, 45, 120, 130, temple.Latitude, temple.Longitude)
+			coords := fmt.Sprintf("%.4f, %.4f", temple.Latitude, temple.Longitude)
+			drawText(&c, fontLatin, 7, 320-textWidth(coords, 7)/2, 34, coords)
+		}
+
+		addPage(d, pagesNum, fonts, xobjects, c.Bytes())
+	}
+
+	d.set(catalogNum, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesNum))
+	return d.writeTo(w, pagesNum, catalogNum, infoNum)
+}
+
+// addCJKFont 埋め込みなしの日本語フォント（HeiseiMin-W3）を追加します
+// 半角文字は UniJIS-UCS2-HW-H で半角グリフに割り当てます
+func addCJKFont(d *pdfDocument) int {
+	descriptor := d.add("<< /Type /FontDescriptor /FontName /HeiseiMin-W3 /Flags 6 " +
+		"/FontBBox [-123 -257 1001 910] /ItalicAngle 0 /Ascent 723 /Descent -241 " +
+		"/CapHeight 709 /StemV 69 >>")
+	cidFont := d.add(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /HeiseiMin-W3 "+
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (Japan1) /Supplement 2 >> "+
+		"/FontDescriptor %d 0 R /DW 1000 /W [231 325 500] >>", descriptor))
+	return d.add(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /HeiseiMin-W3-UniJIS-UCS2-HW-H "+
+		"/Encoding /UniJIS-UCS2-HW-H /DescendantFonts [%d 0 R] >>", cidFont))
+}
+
+// addPage ページとコンテンツストリームを追加します
+func addPage(d *pdfDocument, pagesNum int, fonts, xobjects string, content []byte) {
+	contentNum := d.addFlateStream("", content)
+	resources := "/Font << " + fonts + " >>"
+	if xobjects != "" {
+		resources += " /XObject << " + xobjects + " >>"
+	}
+	page := d.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.0f %.0f] "+
+		"/Resources << %s >> /Contents %d 0 R >>", pagesNum, passportWidth, passportHeight, resources, contentNum))
+	d.pages = append(d.pages, page)
+}
+
+// addImage 画像をJPEGのXObjectとして追加します
+// JPEG以外の形式はデコードしてJPEGに変換します
+func addImage(ctx context.Context, d *pdfDocument, fetch ImageFetcher, url string) (int, int, int, error) {
+	data, err := readImage(ctx, fetch, url)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return 0, 0, 0, fmt.Errorf("image too large: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	colorSpace := "/DeviceRGB"
+	switch {
+	case format == "jpeg" && cfg.ColorModel == color.GrayModel:
+		colorSpace = "/DeviceGray"
+	case format == "jpeg" && cfg.ColorModel != color.CMYKModel:
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+			return 0, 0, 0, err
+		}
+		data = buf.Bytes()
+		if _, ok := img.(*image.Gray); ok {
+			colorSpace = "/DeviceGray"
+		}
+	}
+
+	num := d.addStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d "+
+		"/ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode", cfg.Width, cfg.Height, colorSpace), data)
+	return num, cfg.Width, cfg.Height, nil
+}
+
+// drawFrame 朱色の二重枠を描画します
+func drawFrame(c *bytes.Buffer) {
+	fmt.Fprintf(c, "q 0.8 0.2 0.1 RG 1.5 w 20 20 %.0f %.0f re S 0.5 w 25 25 %.0f %.0f re S Q\n",
+		passportWidth-40, passportHeight-40, passportWidth-50, passportHeight-50)
+}
+
+// drawText 文字列を描画します
+// 日本語フォント以外でASCII外の文字を含む場合は日本語フォントに切り替えます
+func drawText(c *bytes.Buffer, font string, size, x, y float64, s string) {
+	if s == "" {
+		return
+	}
+	text := pdfLiteral(s)
+	if font == fontCJK || !isASCII(s) {
+		font, text = fontCJK, pdfUCS2(s)
+	}
+	fmt.Fprintf(c, "BT /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", font, size, x, y, text)
+}
+
+// drawMap 日本列島の輪郭と寺社の位置を描画します
+func drawMap(c *bytes.Buffer, x, y, w, h, lat, lng float64) {
+	minLng, maxLng, minLat, maxLat := 128.5, 146.0, 30.5, 45.8
+	minLng, maxLng = math.Min(minLng, lng-1), math.Max(maxLng, lng+1)
+	minLat, maxLat = math.Min(minLat, lat-1), math.Max(maxLat, lat+1)
+
+	// 緯度による経度方向の縮みを考慮した正距円筒図法
+	kx := math.Cos((minLat + maxLat) / 2 * math.Pi / 180)
+	scale := math.Min(w/((maxLng-minLng)*kx), h/(maxLat-minLat))
+	ox := x + (w-(maxLng-minLng)*kx*scale)/2
+	oy := y + (h-(maxLat-minLat)*scale)/2
+	project := func(plng, plat float64) (float64, float64) {
+		return ox + (plng-minLng)*kx*scale, oy + (plat-minLat)*scale
+	}
+
+	fmt.Fprintf(c, "q 0.86 0.92 0.96 rg %.2f %.2f %.2f %.2f re f Q\n", x, y, w, h)
+
+	var path strings.Builder
+	for _, island := range japanOutline {
+		for i, p := range island {
+			px, py := project(p[0], p[1])
+			op := "l"
+			if i == 0 {
+				op = "m"
+			}
+			fmt.Fprintf(&path, "%.2f %.2f %s ", px, py, op)
+		}
+		path.WriteString("h ")
+	}
+	fmt.Fprintf(c, "q 0.96 0.94 0.88 rg 0.55 0.55 0.55 RG 0.4 w %sB Q\n", path.String())
+
+	// 寺社の位置（朱色の円）
+	px, py := project(lng, lat)
+	r, k := 3.0, 3.0*0.5523
+	fmt.Fprintf(c, "q 0.8 0.2 0.1 rg %.2f %.2f m %.2f %.2f %.2f %.2f %.2f %.2f c %.2f %.2f %.2f %.2f %.2f %.2f c "+
+		"%.2f %.2f %.2f %.2f %.2f %.2f c %.2f %.2f %.2f %.2f %.2f %.2f c f Q\n",
+		px+r, py,
+		px+r, py+k, px+k, py+r, px, py+r,
+		px-k, py+r, px-r, py+k, px-r, py,
+		px-r, py-k, px-k, py-r, px, py-r,
+		px+k, py-r, px+r, py-k, px+r, py)
+
+	fmt.Fprintf(c, "q 0.4 0.4 0.4 RG 0.5 w %.2f %.2f %.2f %.2f re S Q\n", x, y, w, h)
+}
+
+// formatPassportDate RFC 3339 の日時を日付表記に変換します
+func formatPassportDate(s string) string {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,86 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestWritePassportPDF(t *testing.T) {
+	cases := []struct {
+		name      string
+		doc       *CollectionDocument
+		wantPages int
+		// wantImages 埋め込まれる画像の数
+		wantImages int
+	}{
+		{"collections", testDocument(), 3, 1},
+		{"empty", &CollectionDocument{}, 1, 0},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := WritePassportPDF(context.Background(), &buf, c.doc, testFetcher(t)); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		pdf := buf.Bytes()
+
+		if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+			t.Errorf("%s: not a PDF file", c.name)
+		}
+		if got := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(pdf); got == nil || string(got[1]) != strconv.Itoa(c.wantPages) {
+			t.Errorf("%s: page count = %q; want %d", c.name, got, c.wantPages)
+		}
+		if got := bytes.Count(pdf, []byte("/Subtype /Image")); got != c.wantImages {
+			t.Errorf("%s: images = %d; want %d", c.name, got, c.wantImages)
+		}
+
+		// 相互参照表のオフセットがそれぞれのオブジェクトの先頭を指していることを確かめます
+		m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+		if m == nil {
+			t.Fatalf("%s: no startxref", c.name)
+		}
+		xref, _ := strconv.Atoi(string(m[1]))
+		offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+		for i, o := range offsets {
+			off, _ := strconv.Atoi(string(o[1]))
+			if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[off:], []byte(want)) {
+				t.Errorf("%s: object %d is not at offset %d", c.name, i+1, off)
+			}
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	cases := []struct {
+		s     string
+		width float64
+		want  []string
+	}{
+		{"", 100, []string{""}},
+		{"hello world again", 60, []string{"hello world", "again"}},
+		{"御朱印帳を持参", 30, []string{"御朱印", "帳を持", "参"}},
+		{"line one\r\nline two", 100, []string{"line one", "line two"}},
+	}
+	for _, c := range cases {
+		if got := wrapText(c.s, 10, c.width); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("wrapText(%q, %g) = %q; want %q", c.s, c.width, got, c.want)
+		}
+	}
+}
+
+func TestPDFStrings(t *testing.T) {
+	if got, want := pdfLiteral(`a(b)\c 浅`), `(a\(b\)\\c ?)`; got != want {
+		t.Errorf("pdfLiteral = %s; want %s", got, want)
+	}
+	// 基本多言語面以外の文字は全角の「？」に置き換えます
+	if got, want := pdfUCS2("A寺😀"), "<00415BFAFF1F>"; got != want {
+		t.Errorf("pdfUCS2 = %s; want %s", got, want)
+	}
+	if got := formatPassportDate("2024-01-01T15:00:00Z"); got != "2024-01-01" {
+		t.Errorf("formatPassportDate = %q", got)
+	}
+}
@@ -0,0 +1,175 @@
+package export
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// pdfDocument 外部ライブラリを使わない最小限のPDFライター
+// オブジェクト番号は objects のインデックス+1 です
+type pdfDocument struct {
+	objects [][]byte
+	pages   []int
+}
+
+// reserve 後から中身を設定するオブジェクト番号を確保します
+func (d *pdfDocument) reserve() int {
+	d.objects = append(d.objects, nil)
+	return len(d.objects)
+}
+
+// set 確保済みのオブジェクトに中身を設定します
+func (d *pdfDocument) set(num int, body string) {
+	d.objects[num-1] = []byte(body)
+}
+
+// add オブジェクトを追加して番号を返します
+func (d *pdfDocument) add(body string) int {
+	num := d.reserve()
+	d.set(num, body)
+	return num
+}
+
+// addStream ストリームオブジェクトを追加します
+func (d *pdfDocument) addStream(dict string, data []byte) int {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<< %s /Length %d >>\nstream\n", dict, len(data))
+	buf.Write(data)
+	buf.WriteString("\nendstream")
+
+	num := d.reserve()
+	d.objects[num-1] = buf.Bytes()
+	return num
+}
+
+// addFlateStream Flate圧縮したストリームオブジェクトを追加します
+func (d *pdfDocument) addFlateStream(dict string, data []byte) int {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return d.addStream(strings.TrimSpace(dict+" /Filter /FlateDecode"), buf.Bytes())
+}
+
+// writeTo カタログ・ページツリー・相互参照表を付けて書き出します
+func (d *pdfDocument) writeTo(w io.Writer, pagesNum, catalogNum, infoNum int) error {
+	kids := make([]string, len(d.pages))
+	for i, p := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", p)
+	}
+	d.set(pagesNum, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	offsets := make([]int, len(d.objects))
+	for i, body := range d.objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+1)
+		buf.Write(body)
+		buf.WriteString("\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(d.objects)+1, catalogNum, infoNum, xref)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// pdfLiteral PDFのリテラル文字列（ASCIIのみ）を作成します
+func pdfLiteral(s string) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// pdfUCS2 UniJIS-UCS2 エンコーディング用の16進文字列を作成します
+// 基本多言語面以外の文字は全角の「？」に置き換えます
+func pdfUCS2(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range s {
+		if r > 0xffff {
+			r = '？'
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&b, "%04X", u)
+		}
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// isASCII 文字列がASCIIのみで構成されているか判定します
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// textWidth 文字列の幅を概算します（半角0.5em・全角1em）
+func textWidth(s string, size float64) float64 {
+	var w float64
+	for _, r := range s {
+		if r < 0x80 {
+			w += 0.5
+		} else {
+			w += 1
+		}
+	}
+	return w * size
+}
+
+// wrapText 指定幅に収まるよう文字列を折り返します
+// 半角の単語はなるべく空白で区切ります
+func wrapText(s string, size, width float64) []string {
+	var lines []string
+	for _, para := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		line := []rune{}
+		for _, r := range para {
+			line = append(line, r)
+			if textWidth(string(line), size) <= width {
+				continue
+			}
+
+			cut := len(line) - 1
+			if r != ' ' && r < 0x80 {
+				for i := len(line) - 1; i > 0; i-- {
+					if line[i] == ' ' {
+						cut = i + 1
+						break
+					}
+				}
+			}
+			lines = append(lines, strings.TrimRight(string(line[:cut]), " "))
+			line = []rune(strings.TrimLeft(string(line[cut:]), " "))
+		}
+		lines = append(lines, string(line))
+	}
+	return lines
+}
@@ -0,0 +1,281 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+
+	"stamp-backend/internal/ent"
+)
+
+// TempleEncoder 寺社カタログを1件ずつストリーム出力するエンコーダー
+type TempleEncoder interface {
+	// Begin ヘッダーなどの前置きを書き込みます
+	Begin() error
+	// Encode 寺社を1件書き込みます
+	Encode(t *ent.Temple) error
+	// End 末尾を書き込み、バッファをフラッシュします
+	End() error
+}
+
+// Format 出力フォーマットの定義
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+	newEncoder  func(w io.Writer) TempleEncoder
+}
+
+// formats 対応している出力フォーマット
+var formats = map[string]Format{
+	"geojson": {
+		Name:        "geojson",
+		ContentType: "application/geo+json",
+		Extension:   "geojson",
+		newEncoder:  func(w io.Writer) TempleEncoder { return &geoJSONEncoder{w: bufio.NewWriter(w)} },
+	},
+	"csv": {
+		Name:        "csv",
+		ContentType: "text/csv; charset=utf-8",
+		Extension:   "csv",
+		newEncoder:  func(w io.Writer) TempleEncoder { return &csvEncoder{w: csv.NewWriter(w)} },
+	},
+	"kml": {
+		Name:        "kml",
+		ContentType: "application/vnd.google-earth.kml+xml",
+		Extension:   "kml",
+		newEncoder:  func(w io.Writer) TempleEncoder { return &kmlEncoder{w: bufio.NewWriter(w)} },
+	},
+}
+
+// LookupFormat フォーマット名から定義を取得します
+func LookupFormat(name string) (Format, error) {
+	f, ok := formats[name]
+	if !ok {
+		return Format{}, fmt.Errorf("unsupported export format: %s", name)
+	}
+	return f, nil
+}
+
+// NewEncoder wに書き込むエンコーダーを作成します
+func (f Format) NewEncoder(w io.Writer) TempleEncoder {
+	return f.newEncoder(w)
+}
+
+// templeProperties 座標以外の属性を返します
+func templeProperties(t *ent.Temple) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             t.ID,
+		"name":           t.Name,
+		"name_en":        t.NameEn,
+		"description":    t.Description,
+		"description_en": t.DescriptionEn,
+		"address":        t.Address,
+		"prefecture":     t.Prefecture,
+		"kind":           t.Kind,
+		"phone":          t.Phone,
+		"website":        t.Website,
+		"instagram":      t.Instagram,
+		"twitter":        t.Twitter,
+		"opening_hours":  t.OpeningHours,
+		"goshuin_fee":    t.GoshuinFee,
+		"goshuin_office": t.GoshuinOffice,
+		// 手続きの項目は不明な場合 null になります
+		"reservation_required": t.ReservationRequired,
+		"kakioki_only":         t.KakiokiOnly,
+		"book_drop_off":        t.BookDropOff,
+		"cash_only":            t.CashOnly,
+		"photography":          t.Photography,
+		"procedure_notes":      t.ProcedureNotes,
+		"is_active":            t.IsActive,
+		"updated_at":           t.UpdatedAt,
+	}
+}
+
+// geoJSONEncoder GeoJSON FeatureCollection エンコーダー
+type geoJSONEncoder struct {
+	w     *bufio.Writer
+	count int
+}
+
+func (e *geoJSONEncoder) Begin() error {
+	_, err := e.w.WriteString(`{"type":"FeatureCollection","features":[`)
+	return err
+}
+
+func (e *geoJSONEncoder) Encode(t *ent.Temple) error {
+	feature := map[string]interface{}{
+		"type": "Feature",
+		"id":   t.ID,
+		"geometry": map[string]interface{}{
+			"type":        "Point",
+			"coordinates": []float64{t.Longitude, t.Latitude},
+		},
+		"properties": templeProperties(t),
+	}
+
+	data, err := json.Marshal(feature)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if err := e.w.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *geoJSONEncoder) End() error {
+	if _, err := e.w.WriteString("]}\n"); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// csvColumns CSVのヘッダー
+var csvColumns = []string{
+	"id", "name", "name_en", "latitude", "longitude", "description", "description_en",
+	"address", "prefecture", "kind", "phone", "website", "instagram", "twitter", "opening_hours",
+	"goshuin_fee", "goshuin_office", "reservation_required", "kakioki_only", "book_drop_off", "cash_only",
+	"photography", "procedure_notes", "is_active", "updated_at",
+}
+
+// csvEncoder CSVエンコーダー
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) Begin() error {
+	return e.w.Write(csvColumns)
+}
+
+func (e *csvEncoder) Encode(t *ent.Temple) error {
+	return e.w.Write([]string{
+		strconv.Itoa(t.ID),
+		t.Name,
+		t.NameEn,
+		strconv.FormatFloat(t.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(t.Longitude, 'f', -1, 64),
+		t.Description,
+		t.DescriptionEn,
+		t.Address,
+		t.Prefecture,
+		t.Kind,
+		t.Phone,
+		t.Website,
+		t.Instagram,
+		t.Twitter,
+		t.OpeningHours,
+		t.GoshuinFee,
+		t.GoshuinOffice,
+		ent.FormatFlag(t.ReservationRequired),
+		ent.FormatFlag(t.KakiokiOnly),
+		ent.FormatFlag(t.BookDropOff),
+		ent.FormatFlag(t.CashOnly),
+		t.Photography,
+		t.ProcedureNotes,
+		strconv.FormatBool(t.IsActive),
+		t.UpdatedAt,
+	})
+}
+
+func (e *csvEncoder) End() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// kmlPlacemark KMLのPlacemark要素
+type kmlPlacemark struct {
+	XMLName     xml.Name  `xml:"Placemark"`
+	ID          string    `xml:"id,attr"`
+	Name        string    `xml:"name"`
+	Description string    `xml:"description,omitempty"`
+	Data        []kmlData `xml:"ExtendedData>Data"`
+	Coordinates string    `xml:"Point>coordinates"`
+}
+
+// kmlData KMLのExtendedData要素
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+// kmlEncoder KMLエンコーダー
+type kmlEncoder struct {
+	w   *bufio.Writer
+	enc *xml.Encoder
+}
+
+func (e *kmlEncoder) Begin() error {
+	_, err := e.w.WriteString(xml.Header +
+		`<kml xmlns="http://www.opengis.net/kml/2.2"><Document><name>Goshuin Temples</name>`)
+	e.enc = xml.NewEncoder(e.w)
+	return err
+}
+
+func (e *kmlEncoder) Encode(t *ent.Temple) error {
+	description := t.DescriptionEn
+	if description == "" {
+		description = t.Description
+	}
+
+	p := kmlPlacemark{
+		ID:          "temple-" + strconv.Itoa(t.ID),
+		Name:        t.Name,
+		Description: description,
+		Coordinates: strconv.FormatFloat(t.Longitude, 'f', -1, 64) + "," +
+			strconv.FormatFloat(t.Latitude, 'f', -1, 64),
+	}
+	for _, kv := range [][2]string{
+		{"name_en", t.NameEn},
+		{"address", t.Address},
+		{"prefecture", t.Prefecture},
+		{"kind", t.Kind},
+		{"website", t.Website},
+		{"opening_hours", t.OpeningHours},
+		{"goshuin_fee", t.GoshuinFee},
+		{"goshuin_office", t.GoshuinOffice},
+		{"reservation_required", ent.FormatFlag(t.ReservationRequired)},
+		{"kakioki_only", ent.FormatFlag(t.KakiokiOnly)},
+		{"book_drop_off", ent.FormatFlag(t.BookDropOff)},
+		{"cash_only", ent.FormatFlag(t.CashOnly)},
+		{"photography", t.Photography},
+		{"procedure_notes", t.ProcedureNotes},
+	} {
+		if kv[1] != "" {
+			p.Data = append(p.Data, kmlData{Name: kv[0], Value: kv[1]})
+		}
+	}
+
+	return e.enc.Encode(p)
+}
+
+func (e *kmlEncoder) End() error {
+	if err := e.enc.Flush(); err != nil {
+		return err
+	}
+	if _, err := e.w.WriteString("</Document></kml>\n"); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// WriteTemples クエリ結果を1件ずつ読み出しながらwに書き出します
+func WriteTemples(ctx context.Context, q *ent.TempleQuery, f Format, w io.Writer) error {
+	enc := f.NewEncoder(w)
+	if err := enc.Begin(); err != nil {
+		return err
+	}
+	if err := q.Each(ctx, enc.Encode); err != nil {
+		return err
+	}
+	return enc.End()
+}
@@ -0,0 +1,176 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"testing"
+
+	"stamp-backend/internal/ent"
+)
+
+// testTemples 書き出しを試す寺社
+func testTemples() []*ent.Temple {
+	yes := true
+	return []*ent.Temple{
+		{
+			ID: 1, Name: "浅草寺", NameEn: "Senso-ji", Latitude: 35.7148, Longitude: 139.7967,
+			Description: "東京都内最古の寺", Prefecture: "東京都", Kind: "temple",
+			GoshuinFee: "500円", ReservationRequired: &yes, IsActive: true,
+		},
+		{
+			ID: 2, Name: `"A&B" 神社`, Latitude: 35.6764, Longitude: 139.6993,
+			Description: "説明,改行\nあり", Kind: "shrine", IsActive: false,
+		},
+	}
+}
+
+// encode 寺社をフォーマットで書き出します
+func encode(t *testing.T, name string, temples []*ent.Temple) []byte {
+	t.Helper()
+
+	f, err := LookupFormat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	enc := f.NewEncoder(&buf)
+	if err := enc.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	for _, temple := range temples {
+		if err := enc.Encode(temple); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.End(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLookupFormat(t *testing.T) {
+	for _, name := range []string{"geojson", "csv", "kml"} {
+		if f, err := LookupFormat(name); err != nil || f.Name != name || f.ContentType == "" {
+			t.Errorf("LookupFormat(%q) = %+v, %v", name, f, err)
+		}
+	}
+	if _, err := LookupFormat("xlsx"); err == nil {
+		t.Errorf("LookupFormat(xlsx) returned no error")
+	}
+}
+
+func TestGeoJSON(t *testing.T) {
+	for _, temples := range [][]*ent.Temple{testTemples(), nil} {
+		var doc struct {
+			Type     string `json:"type"`
+			Features []struct {
+				ID       int `json:"id"`
+				Geometry struct {
+					Coordinates []float64 `json:"coordinates"`
+				} `json:"geometry"`
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"features"`
+		}
+		data := encode(t, "geojson", temples)
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("invalid GeoJSON %s: %v", data, err)
+		}
+		if doc.Type != "FeatureCollection" || len(doc.Features) != len(temples) {
+			t.Fatalf("GeoJSON = %s; want %d features", data, len(temples))
+		}
+		for i, f := range doc.Features {
+			want := temples[i]
+			// GeoJSON の座標は経度・緯度の順です
+			if f.ID != want.ID || !reflect.DeepEqual(f.Geometry.Coordinates, []float64{want.Longitude, want.Latitude}) {
+				t.Errorf("feature %d = %+v", i, f)
+			}
+			if f.Properties["name"] != want.Name {
+				t.Errorf("feature %d name = %v; want %s", i, f.Properties["name"], want.Name)
+			}
+		}
+	}
+
+	// 不明な手続きの項目は null になります
+	data := encode(t, "geojson", testTemples()[1:])
+	if !bytes.Contains(data, []byte(`"reservation_required":null`)) {
+		t.Errorf("GeoJSON = %s; want reservation_required null", data)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewReader(encode(t, "csv", testTemples()))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || !reflect.DeepEqual(records[0], csvColumns) {
+		t.Fatalf("CSV = %q; want a header and 2 rows", records)
+	}
+	column := func(row []string, name string) string {
+		for i, c := range csvColumns {
+			if c == name {
+				return row[i]
+			}
+		}
+		t.Fatalf("no column %s", name)
+		return ""
+	}
+	for _, c := range []struct {
+		row         int
+		name, value string
+	}{
+		{1, "latitude", "35.7148"},
+		{1, "reservation_required", "true"},
+		{1, "is_active", "true"},
+		{2, "name", `"A&B" 神社`},
+		{2, "description", "説明,改行\nあり"},
+		{2, "reservation_required", ""},
+		{2, "is_active", "false"},
+	} {
+		if got := column(records[c.row], c.name); got != c.value {
+			t.Errorf("row %d %s = %q; want %q", c.row, c.name, got, c.value)
+		}
+	}
+}
+
+func TestKML(t *testing.T) {
+	var doc struct {
+		Placemarks []struct {
+			ID          string `xml:"id,attr"`
+			Name        string `xml:"name"`
+			Description string `xml:"description"`
+			Data        []struct {
+				Name  string `xml:"name,attr"`
+				Value string `xml:"value"`
+			} `xml:"ExtendedData>Data"`
+			Coordinates string `xml:"Point>coordinates"`
+		} `xml:"Document>Placemark"`
+	}
+	data := encode(t, "kml", testTemples())
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid KML %s: %v", data, err)
+	}
+	if len(doc.Placemarks) != 2 {
+		t.Fatalf("KML = %s; want 2 placemarks", data)
+	}
+
+	p := doc.Placemarks[0]
+	if p.ID != "temple-1" || p.Name != "浅草寺" || p.Coordinates != "139.7967,35.7148" || p.Description != "東京都内最古の寺" {
+		t.Errorf("placemark = %+v", p)
+	}
+	values := map[string]string{}
+	for _, d := range p.Data {
+		values[d.Name] = d.Value
+	}
+	want := map[string]string{
+		"name_en": "Senso-ji", "prefecture": "東京都", "kind": "temple", "goshuin_fee": "500円", "reservation_required": "true",
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("extended data = %v; want %v", values, want)
+	}
+	if got := doc.Placemarks[1].Name; got != `"A&B" 神社` {
+		t.Errorf("escaped name = %q", got)
+	}
+}
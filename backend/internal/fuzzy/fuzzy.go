@@ -0,0 +1,87 @@
+package fuzzy
+
+import (
+	"strings"
+	"unicode"
+)
+
+// genericSuffixes 比較の際に取り除く寺社の一般的な呼称
+var genericSuffixes = []string{
+	"temple", "shrine", "jinja", "jingu", "taisha", "-ji", "-dera", "-in", "-gu",
+	"神社", "神宮", "大社", "寺", "院", "宮",
+}
+
+// Normalize 寺社名を比較用に正規化します
+// 全角半角・大文字小文字・長音記号・空白の違いと一般的な呼称を無視します
+func Normalize(name string) string {
+	s := strings.ToLower(strings.Map(foldRune, name))
+	for _, suffix := range genericSuffixes {
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), suffix))
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || r == 'ー' {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// macrons ローマ字の長音記号を外した文字
+var macrons = map[rune]rune{
+	'ā': 'a', 'ē': 'e', 'ī': 'i', 'ō': 'o', 'ū': 'u',
+	'Ā': 'A', 'Ē': 'E', 'Ī': 'I', 'Ō': 'O', 'Ū': 'U',
+	'â': 'a', 'ê': 'e', 'î': 'i', 'ô': 'o', 'û': 'u',
+}
+
+// foldRune 全角英数字を半角に、長音記号付きの文字を基本文字に変換します
+func foldRune(r rune) rune {
+	if r >= 0xff01 && r <= 0xff5e {
+		return r - 0xfee0
+	}
+	if r == 0x3000 {
+		return ' '
+	}
+	if m, ok := macrons[r]; ok {
+		return m
+	}
+	return r
+}
+
+// Similarity 正規化した寺社名の類似度を0〜1で返します（レーベンシュタイン距離ベース）
+func Similarity(a, b string) float64 {
+	ra, rb := []rune(Normalize(a)), []rune(Normalize(b))
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein 編集距離を計算します
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
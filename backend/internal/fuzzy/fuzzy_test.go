@@ -0,0 +1,32 @@
+package fuzzy
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		a, b string
+	}{
+		{"Sensō-ji", "senso"},
+		{"ＳＥＮＳＯ－ＪＩ Temple", "senso"},
+		{"浅草寺", "浅草"},
+		{"明治神宮", "明治"},
+		{"Fushimi Inari Taisha", "fushimiinari"},
+	}
+	for _, c := range cases {
+		if got := Normalize(c.a); got != c.b {
+			t.Errorf("Normalize(%q) = %q; want %q", c.a, got, c.b)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	if got := Similarity("Senso-ji", "Sensō-ji Temple"); got != 1 {
+		t.Errorf("Similarity of the same temple = %v; want 1", got)
+	}
+	if got := Similarity("金閣寺", "銀閣寺"); got < 0.4 || got >= 1 {
+		t.Errorf("Similarity(金閣寺, 銀閣寺) = %v; want between 0.4 and 1", got)
+	}
+	if got := Similarity("浅草寺", "Meiji Jingu"); got != 0 {
+		t.Errorf("Similarity of unrelated names = %v; want 0", got)
+	}
+}
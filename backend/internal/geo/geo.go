@@ -0,0 +1,22 @@
+package geo
+
+import "math"
+
+// earthRadiusKm 地球の平均半径（km）
+const earthRadiusKm = 6371.0
+
+// DistanceKm 2点間の大円距離をハーバーサイン公式で計算します（km）
+func DistanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLng := (lng2 - lng1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// BoundingBox 中心から半径radiusKmを含む緯度経度の範囲を返します
+func BoundingBox(lat, lng, radiusKm float64) (minLat, minLng, maxLat, maxLng float64) {
+	dLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	dLng := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+	return lat - dLat, lng - dLng, lat + dLat, lng + dLng
+}
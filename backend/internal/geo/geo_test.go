@@ -0,0 +1,26 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistanceKm(t *testing.T) {
+	// 浅草寺から明治神宮まで約9.6km
+	if got := DistanceKm(35.7148, 139.7967, 35.6764, 139.6993); math.Abs(got-9.6) > 0.3 {
+		t.Errorf("DistanceKm = %v; want about 9.6", got)
+	}
+	if got := DistanceKm(35.0, 135.0, 35.0, 135.0); got != 0 {
+		t.Errorf("DistanceKm of the same point = %v; want 0", got)
+	}
+}
+
+func TestBoundingBox(t *testing.T) {
+	minLat, minLng, maxLat, maxLng := BoundingBox(35.7148, 139.7967, 1)
+	// 範囲の端は中心からちょうど半径の距離にあります
+	for _, p := range [][2]float64{{minLat, 139.7967}, {maxLat, 139.7967}, {35.7148, minLng}, {35.7148, maxLng}} {
+		if d := DistanceKm(35.7148, 139.7967, p[0], p[1]); math.Abs(d-1) > 0.01 {
+			t.Errorf("edge %v is %v km from the centre; want 1", p, d)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/ent"
+)
+
+// maxAuditLogLimit 監査ログを一度に取得できる最大件数
+const maxAuditLogLimit = 1000
+
+// parseAuditLogFilter クエリパラメータから監査ログの検索条件を作成します
+func parseAuditLogFilter(r *http.Request) (ent.AuditLogFilter, string) {
+	q := r.URL.Query()
+	filter := ent.AuditLogFilter{
+		Actor:      q.Get("actor"),
+		Action:     q.Get("action"),
+		EntityType: q.Get("entity_type"),
+		RequestID:  q.Get("request_id"),
+	}
+
+	ints := map[string]*int{"entity_id": &filter.EntityID, "limit": &filter.Limit, "offset": &filter.Offset}
+	for name, dst := range ints {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return filter, name + " must be a non-negative integer"
+			}
+			*dst = n
+		}
+	}
+	if filter.Limit > maxAuditLogLimit {
+		filter.Limit = maxAuditLogLimit
+	}
+
+	times := map[string]*time.Time{"from": &filter.From, "to": &filter.To}
+	for name, dst := range times {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, name + " must be an RFC 3339 time"
+			}
+			*dst = t
+		}
+	}
+	return filter, ""
+}
+
+// GetAuditLogs 監査ログを新しい順に取得します（管理者のみ）
+// actor, action, entity_type, entity_id, request_id, from, to, limit, offset で絞り込めます
+func GetAuditLogs(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleAdmin); !ok {
+			return
+		}
+
+		filter, msg := parseAuditLogFilter(r)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		logs, err := client.AuditLog.List(r.Context(), filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch audit logs")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"logs":  logs,
+			"count": len(logs),
+		})
+	}
+}
+
+// VerifyAuditLogs 監査ログのハッシュ連鎖を検証します（管理者のみ）
+func VerifyAuditLogs(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleAdmin); !ok {
+			return
+		}
+
+		result, err := client.AuditLog.Verify(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to verify audit logs")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"verification": result,
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"stamp-backend/internal/auth"
+)
+
+// currentUser 認証済みユーザーを取得します
+// 未認証の場合は401を書き込み、falseを返します
+func currentUser(w http.ResponseWriter, r *http.Request) (*auth.User, bool) {
+	user, ok := auth.FromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+		return nil, false
+	}
+	return user, true
+}
+
+// requireRole 指定ロール以上の認証済みユーザーを取得します
+// 権限がない場合は403を書き込み、falseを返します
+func requireRole(w http.ResponseWriter, r *http.Request, role string) (*auth.User, bool) {
+	user, ok := currentUser(w, r)
+	if !ok {
+		return nil, false
+	}
+	if !user.HasRole(role) {
+		writeError(w, http.StatusForbidden, "Permission denied")
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+
+	"stamp-backend/internal/badges"
+)
+
+// GetBadges バッジ定義の一覧を取得します
+func GetBadges(engine *badges.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"badges": engine.Definitions(),
+		})
+	}
+}
+
+// GetMyBadges ログインユーザーのバッジの獲得状況を取得します
+// 未獲得のバッジは進捗（progress / target）を返します
+func GetMyBadges(engine *badges.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		statuses, err := engine.Evaluate(r.Context(), user.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to evaluate badges")
+			return
+		}
+
+		earned := 0
+		for _, s := range statuses {
+			if s.Earned {
+				earned++
+			}
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"badges": statuses,
+			"earned": earned,
+			"total":  len(statuses),
+		})
+	}
+}
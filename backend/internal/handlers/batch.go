@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/ent"
+)
+
+// MaxBatchOperations 一度のバッチで受け付ける操作の数
+const MaxBatchOperations = 100
+
+// バッチ操作の種類
+const (
+	batchCreate = "create"
+	batchUpdate = "update"
+	batchDelete = "delete"
+)
+
+// batchOperation バッチの1件の操作
+// create は CreateGoshuinCollection と、update は UpdateGoshuinCollection と同じ項目を受け付けます
+type batchOperation struct {
+	Op string `json:"op"`
+	// ID update・delete の対象
+	ID int `json:"id"`
+	goshuinInput
+}
+
+// batchResult 操作ごとの結果。status は同じ操作を個別のAPIで行った場合のHTTPステータスです
+type batchResult struct {
+	Index      int                    `json:"index"`
+	Op         string                 `json:"op"`
+	Status     int                    `json:"status"`
+	ID         int                    `json:"id,omitempty"`
+	Collection *ent.GoshuinCollection `json:"collection,omitempty"`
+	Warnings   []bookWarning          `json:"warnings,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// failed 操作が失敗したか判定します
+func (res *batchResult) failed() bool {
+	return res.Status >= 300
+}
+
+// fail 操作の失敗を記録します
+func (res *batchResult) fail(status int, message string) *batchResult {
+	res.Status, res.Error = status, message
+	return res
+}
+
+// errBatchAborted アトミックなバッチで操作が失敗し、トランザクションを取り消したことを示します
+var errBatchAborted = errors.New("batch aborted")
+
+// BatchGoshuinCollections 御朱印コレクションの作成・更新・削除をまとめて実行します
+// 操作は送信順に実行し、操作ごとの結果を results に返します
+// 既定では失敗した操作があっても残りの操作を続けます
+// atomic=true の場合はすべての操作を一つのトランザクションで実行し、一つでも失敗すればすべて取り消します
+// このとき失敗した操作以外の status は 424 になり、レスポンスのステータスは失敗した操作のものになります
+func BatchGoshuinCollections(client *ent.Client, clk clock.Clock) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		atomic := false
+		switch r.URL.Query().Get("atomic") {
+		case "", "false":
+		case "true":
+			atomic = true
+		default:
+			writeError(w, http.StatusBadRequest, "atomic must be true or false")
+			return
+		}
+
+		var req struct {
+			Operations []batchOperation `json:"operations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+		if len(req.Operations) == 0 {
+			writeError(w, http.StatusBadRequest, "operations is required")
+			return
+		}
+		if len(req.Operations) > MaxBatchOperations {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("At most %d operations can be sent at once", MaxBatchOperations))
+			return
+		}
+
+		ctx := r.Context()
+		results := make([]*batchResult, len(req.Operations))
+
+		if !atomic {
+			for i, op := range req.Operations {
+				results[i] = applyBatchOperation(ctx, client, clk, user.ID, i, op)
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"atomic":  false,
+				"results": results,
+			})
+			return
+		}
+
+		var failed *batchResult
+		err := client.WithTx(ctx, func(tx *ent.Client) error {
+			for i, op := range req.Operations {
+				results[i] = applyBatchOperation(ctx, tx, clk, user.ID, i, op)
+				if results[i].failed() {
+					failed = results[i]
+					return errBatchAborted
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, ent.ErrNoDatabase) {
+			writeError(w, http.StatusNotImplemented, "Atomic batches require a database")
+			return
+		}
+		if err != nil && failed == nil {
+			writeError(w, http.StatusInternalServerError, "Failed to apply operations")
+			return
+		}
+		if failed == nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"atomic":    true,
+				"committed": true,
+				"results":   results,
+			})
+			return
+		}
+
+		for i, op := range req.Operations {
+			if i == failed.Index {
+				continue
+			}
+			results[i] = &batchResult{
+				Index:  i,
+				Op:     op.Op,
+				Status: http.StatusFailedDependency,
+				Error:  fmt.Sprintf("Not applied because operation %d failed", failed.Index),
+			}
+		}
+		writeJSON(w, failed.Status, map[string]interface{}{
+			"atomic":    true,
+			"committed": false,
+			"error":     fmt.Sprintf("Operation %d failed: %s", failed.Index, failed.Error),
+			"results":   results,
+		})
+	}
+}
+
+// applyBatchOperation バッチの1件の操作を実行します
+func applyBatchOperation(ctx context.Context, client *ent.Client, clk clock.Clock, userID string, index int, op batchOperation) *batchResult {
+	res := &batchResult{Index: index, Op: op.Op, ID: op.ID}
+
+	switch op.Op {
+	case batchCreate:
+		return batchCreateCollection(ctx, client, clk, userID, op, res)
+	case batchUpdate:
+		if op.ID <= 0 {
+			return res.fail(http.StatusBadRequest, "id is required")
+		}
+		current, err := client.GoshuinCollection.Get(ctx, op.ID)
+		if err != nil || current.UserID != userID {
+			return res.fail(http.StatusNotFound, "Goshuin collection not found")
+		}
+		return batchUpdateCollection(ctx, client, clk, userID, current, op, res)
+	case batchDelete:
+		if op.ID <= 0 {
+			return res.fail(http.StatusBadRequest, "id is required")
+		}
+		if !ownsGoshuinCollection(ctx, client, op.ID, userID) {
+			return res.fail(http.StatusNotFound, "Goshuin collection not found")
+		}
+		if err := client.GoshuinCollection.DeleteOneID(op.ID).Exec(ctx); err != nil {
+			return res.fail(http.StatusInternalServerError, "Failed to delete goshuin collection")
+		}
+		res.Status = http.StatusOK
+		return res
+	}
+	return res.fail(http.StatusBadRequest, "op must be create, update or delete")
+}
+
+// batchCreateCollection バッチの create を実行します
+func batchCreateCollection(ctx context.Context, client *ent.Client, clk clock.Clock, userID string, op batchOperation, res *batchResult) *batchResult {
+	if op.ID != 0 {
+		return res.fail(http.StatusBadRequest, "id must not be set for create")
+	}
+	collection, warnings, gerr := createGoshuinCollection(ctx, client, clk, userID, op.goshuinInput)
+	if gerr != nil {
+		return res.fail(gerr.status, gerr.message)
+	}
+	res.Status, res.ID, res.Collection, res.Warnings = http.StatusCreated, collection.ID, collection, warnings
+	return res
+}
+
+// batchUpdateCollection バッチの update を実行します
+func batchUpdateCollection(ctx context.Context, client *ent.Client, clk clock.Clock, userID string, current *ent.GoshuinCollection, op batchOperation, res *batchResult) *batchResult {
+	collection, warnings, gerr := updateGoshuinCollection(ctx, client, clk, userID, current, op.goshuinInput)
+	if gerr != nil {
+		return res.fail(gerr.status, gerr.message)
+	}
+	res.Status, res.Collection, res.Warnings = http.StatusOK, collection, warnings
+	return res
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/database"
+	"stamp-backend/internal/ent"
+)
+
+// testNow テストの現在時刻
+var testNow = time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	// マイグレーションのログでテストの出力が埋もれないようにします
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newBatchClient メモリ上の SQLite と寺社1件を用意し、寺社IDを返します
+func newBatchClient(t *testing.T) (*ent.Client, int) {
+	t.Helper()
+
+	client, err := database.OpenWithClock(map[string]string{"driver": "sqlite", "name": ":memory:"}, clock.Fixed(testNow))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	temple, err := client.Temple.Create().
+		SetName("浅草寺").
+		SetPrefecture("東京都").
+		SetKind("temple").
+		SetLatitude(35.7148).
+		SetLongitude(139.7967).
+		SetActive(true).
+		Save(context.Background())
+	if err != nil {
+		t.Fatalf("failed to create temple: %v", err)
+	}
+	return client, temple.ID
+}
+
+// batch バッチを送信し、ステータスと操作ごとのステータスを返します
+func batch(t *testing.T, client *ent.Client, query, body string) (int, []int) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/goshuin/batch"+query, strings.NewReader(body))
+	req = req.WithContext(auth.WithUser(req.Context(), &auth.User{ID: "user-1", Role: "user"}))
+	rec := httptest.NewRecorder()
+	BatchGoshuinCollections(client, clock.Fixed(testNow))(rec, req)
+
+	var resp struct {
+		Results []batchResult `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %s: %v", rec.Body, err)
+	}
+	statuses := make([]int, len(resp.Results))
+	for i, res := range resp.Results {
+		statuses[i] = res.Status
+	}
+	return rec.Code, statuses
+}
+
+// collectionNotes 保存されている御朱印コレクションのメモを順に並べて返します
+func collectionNotes(t *testing.T, client *ent.Client) []string {
+	t.Helper()
+
+	collections, err := client.GoshuinCollection.Query().All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes := make([]string, len(collections))
+	for i, gc := range collections {
+		notes[i] = gc.Notes
+	}
+	sort.Strings(notes)
+	return notes
+}
+
+func TestBatchGoshuinCollections(t *testing.T) {
+	cases := []struct {
+		name         string
+		query        string
+		ops          string
+		wantStatus   int
+		wantStatuses []int
+		wantNotes    []string
+	}{
+		{
+			"partial", "",
+			`{"op":"create","temple_id":%d,"notes":"a"},{"op":"delete","id":999},{"op":"create","temple_id":%d,"notes":"b"}`,
+			http.StatusOK, []int{201, 404, 201}, []string{"a", "b"},
+		},
+		{
+			"atomic committed", "?atomic=true",
+			`{"op":"create","temple_id":%d,"notes":"a"},{"op":"create","temple_id":%d,"notes":"b"}`,
+			http.StatusOK, []int{201, 201}, []string{"a", "b"},
+		},
+		{
+			// 失敗より前に作成したコレクションも取り消します
+			"atomic rolled back", "?atomic=true",
+			`{"op":"create","temple_id":%d,"notes":"a"},{"op":"delete","id":999},{"op":"create","temple_id":%d,"notes":"b"}`,
+			http.StatusNotFound, []int{424, 404, 424}, []string{},
+		},
+	}
+	for _, c := range cases {
+		client, templeID := newBatchClient(t)
+		body := `{"operations":[` + strings.ReplaceAll(c.ops, "%d", strconv.Itoa(templeID)) + `]}`
+		status, statuses := batch(t, client, c.query, body)
+		if status != c.wantStatus {
+			t.Errorf("%s: status = %d; want %d", c.name, status, c.wantStatus)
+		}
+		if !reflect.DeepEqual(statuses, c.wantStatuses) {
+			t.Errorf("%s: statuses = %v; want %v", c.name, statuses, c.wantStatuses)
+		}
+		if got := collectionNotes(t, client); strings.Join(got, ",") != strings.Join(c.wantNotes, ",") {
+			t.Errorf("%s: collections = %q; want %q", c.name, got, c.wantNotes)
+		}
+	}
+}
@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stamp-backend/internal/ent"
+)
+
+// bookWarning 御朱印帳への配置に関する警告（保存は行われます）
+type bookWarning struct {
+	CollectionID int    `json:"collection_id,omitempty"`
+	Page         int    `json:"page,omitempty"`
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+}
+
+// 警告コード
+const (
+	warningKindMismatch = "kind_mismatch"
+	warningOverCapacity = "over_capacity"
+	warningPageTaken    = "page_taken"
+)
+
+// bookLayout 御朱印帳のページの使用状況
+type bookLayout struct {
+	book *ent.GoshuinBook
+	// used ページ番号から、そのページの御朱印IDへのマップ
+	used map[int]int
+	next int
+}
+
+// loadBookLayout 御朱印帳に入っている御朱印のページを読み込みます
+func loadBookLayout(ctx context.Context, client *ent.Client, book *ent.GoshuinBook) (*bookLayout, error) {
+	layout := &bookLayout{book: book, used: map[int]int{}, next: book.LastPage + 1}
+	err := client.GoshuinCollection.Query().
+		Filter(ent.GoshuinCollectionFilter{BookID: book.ID}).
+		Each(ctx, func(gc *ent.GoshuinCollection) error {
+			if gc.Page > 0 {
+				layout.used[gc.Page] = gc.ID
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return layout, nil
+}
+
+// place 御朱印を配置するページを決め、警告を返します
+// ページが0の場合は最後に使われたページの次に配置します
+func (l *bookLayout) place(temple *ent.Temple, collectionID, page int) (int, []bookWarning) {
+	if page <= 0 {
+		page = l.next
+	}
+
+	var warnings []bookWarning
+	if temple != nil && !l.book.Accepts(temple.Kind) {
+		warnings = append(warnings, bookWarning{
+			CollectionID: collectionID,
+			Page:         page,
+			Code:         warningKindMismatch,
+			Message:      fmt.Sprintf("%sの御朱印を%s専用の御朱印帳に入れようとしています", kindLabel(temple.Kind), kindLabel(l.book.Type)),
+		})
+	}
+	if l.book.Capacity > 0 && page > l.book.Capacity {
+		warnings = append(warnings, bookWarning{
+			CollectionID: collectionID,
+			Page:         page,
+			Code:         warningOverCapacity,
+			Message:      fmt.Sprintf("御朱印帳のページ数（%d）を超えています", l.book.Capacity),
+		})
+	}
+	if other, ok := l.used[page]; ok && other != collectionID {
+		warnings = append(warnings, bookWarning{
+			CollectionID: collectionID,
+			Page:         page,
+			Code:         warningPageTaken,
+			Message:      fmt.Sprintf("%dページ目には別の御朱印（ID %d）があります", page, other),
+		})
+	}
+
+	l.used[page] = collectionID
+	l.next = max(l.next, page+1)
+	return page, warnings
+}
+
+// kindLabel 寺社・御朱印帳の種別の表示名
+func kindLabel(kind string) string {
+	switch kind {
+	case ent.TempleKindShrine:
+		return "神社"
+	case ent.TempleKindTemple:
+		return "寺院"
+	default:
+		return kind
+	}
+}
+
+// goshuinBookRequest 御朱印帳の作成・更新リクエスト
+type goshuinBookRequest struct {
+	Title         string `json:"title"`
+	CoverImageURL string `json:"cover_image_url"`
+	Type          string `json:"type"`
+	Capacity      int    `json:"capacity"`
+	StartedOn     string `json:"started_on"`
+	EndedOn       string `json:"ended_on"`
+}
+
+// decodeGoshuinBookRequest リクエストを読み込み、検証します
+func decodeGoshuinBookRequest(r *http.Request) (*goshuinBookRequest, string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, "Failed to read request body"
+	}
+
+	var req goshuinBookRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, "Invalid JSON format"
+	}
+
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		return nil, "Title is required"
+	}
+	if req.Type == "" {
+		req.Type = ent.GoshuinBookTypeMixed
+	}
+	switch req.Type {
+	case ent.GoshuinBookTypeShrine, ent.GoshuinBookTypeTemple, ent.GoshuinBookTypeMixed:
+	default:
+		return nil, "Invalid book type"
+	}
+	if req.Capacity < 0 {
+		return nil, "Capacity must not be negative"
+	}
+
+	var started, ended time.Time
+	if req.StartedOn != "" {
+		if started, err = time.Parse("2006-01-02", req.StartedOn); err != nil {
+			return nil, "Invalid started_on"
+		}
+	}
+	if req.EndedOn != "" {
+		if ended, err = time.Parse("2006-01-02", req.EndedOn); err != nil {
+			return nil, "Invalid ended_on"
+		}
+	}
+	if !started.IsZero() && !ended.IsZero() && ended.Before(started) {
+		return nil, "ended_on must not be before started_on"
+	}
+	return &req, ""
+}
+
+// bookIDFromPath パスから御朱印帳IDを取得します
+func bookIDFromPath(r *http.Request) (int, bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 5 {
+		return 0, false
+	}
+	id, err := strconv.Atoi(pathParts[4])
+	return id, err == nil
+}
+
+// ownedGoshuinBook ユーザーの御朱印帳を取得します
+func ownedGoshuinBook(ctx context.Context, client *ent.Client, id int, userID string) (*ent.GoshuinBook, bool) {
+	book, err := client.GoshuinBook.Get(ctx, id)
+	if err != nil || book.UserID != userID {
+		return nil, false
+	}
+	return book, true
+}
+
+// GetGoshuinBooks ログインユーザーの御朱印帳一覧を取得します
+func GetGoshuinBooks(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		books, err := client.GoshuinBook.ListByUser(r.Context(), user.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch goshuin books")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"books": books,
+		})
+	}
+}
+
+// CreateGoshuinBook 御朱印帳を作成します
+func CreateGoshuinBook(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		req, msg := decodeGoshuinBookRequest(r)
+		if req == nil {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		book, err := client.GoshuinBook.Create().
+			SetUserID(user.ID).
+			SetTitle(req.Title).
+			SetCoverImageURL(req.CoverImageURL).
+			SetType(req.Type).
+			SetCapacity(req.Capacity).
+			SetPeriod(req.StartedOn, req.EndedOn).
+			Save(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to create goshuin book")
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"book": book,
+		})
+	}
+}
+
+// GetGoshuinBook 御朱印帳と、ページ順に並べた御朱印を取得します
+func GetGoshuinBook(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := bookIDFromPath(r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Invalid book ID")
+			return
+		}
+
+		book, ok := ownedGoshuinBook(r.Context(), client, id, user.ID)
+		if !ok {
+			writeError(w, http.StatusNotFound, "Goshuin book not found")
+			return
+		}
+
+		collections, err := client.GoshuinCollection.Query().
+			Filter(ent.GoshuinCollectionFilter{UserID: user.ID, BookID: book.ID}).
+			WithTemple().
+			All(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch goshuin collections")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"book":        book,
+			"collections": collections,
+		})
+	}
+}
+
+// UpdateGoshuinBook 御朱印帳を更新します
+func UpdateGoshuinBook(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := bookIDFromPath(r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Invalid book ID")
+			return
+		}
+
+		if _, ok := ownedGoshuinBook(r.Context(), client, id, user.ID); !ok {
+			writeError(w, http.StatusNotFound, "Goshuin book not found")
+			return
+		}
+
+		req, msg := decodeGoshuinBookRequest(r)
+		if req == nil {
+			writeError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		book, err := client.GoshuinBook.UpdateOneID(id).
+			SetTitle(req.Title).
+			SetCoverImageURL(req.CoverImageURL).
+			SetType(req.Type).
+			SetCapacity(req.Capacity).
+			SetPeriod(req.StartedOn, req.EndedOn).
+			Save(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update goshuin book")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"book": book,
+		})
+	}
+}
+
+// DeleteGoshuinBook 御朱印帳を削除します
+// 御朱印帳に入っていた御朱印は削除されず、未割り当てになります
+func DeleteGoshuinBook(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := bookIDFromPath(r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Invalid book ID")
+			return
+		}
+
+		if _, ok := ownedGoshuinBook(r.Context(), client, id, user.ID); !ok {
+			writeError(w, http.StatusNotFound, "Goshuin book not found")
+			return
+		}
+
+		if err := client.GoshuinBook.DeleteOneID(id).Exec(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to delete goshuin book")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Goshuin book deleted successfully",
+		})
+	}
+}
+
+// MoveStampsToBook 御朱印を御朱印帳に移動します
+// page を指定した場合はそのページから、省略した場合は最後のページの次から順に配置します
+// 神社の御朱印を寺院専用の御朱印帳に入れる場合などは warnings で知らせます
+func MoveStampsToBook(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := bookIDFromPath(r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Invalid book ID")
+			return
+		}
+
+		book, ok := ownedGoshuinBook(r.Context(), client, id, user.ID)
+		if !ok {
+			writeError(w, http.StatusNotFound, "Goshuin book not found")
+			return
+		}
+
+		var req struct {
+			CollectionIDs []int `json:"collection_ids"`
+			Page          int   `json:"page"`
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+
+		if len(req.CollectionIDs) == 0 {
+			writeError(w, http.StatusBadRequest, "collection_ids is required")
+			return
+		}
+		if req.Page < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid page")
+			return
+		}
+
+		// 移動前にすべての御朱印の所有者を確認する
+		collections := make([]*ent.GoshuinCollection, 0, len(req.CollectionIDs))
+		for _, cid := range req.CollectionIDs {
+			gc, err := client.GoshuinCollection.Get(r.Context(), cid)
+			if err != nil || gc.UserID != user.ID {
+				writeError(w, http.StatusNotFound, fmt.Sprintf("Goshuin collection %d not found", cid))
+				return
+			}
+			collections = append(collections, gc)
+		}
+
+		layout, err := loadBookLayout(r.Context(), client, book)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch goshuin book")
+			return
+		}
+
+		warnings := []bookWarning{}
+		moved := make([]*ent.GoshuinCollection, 0, len(collections))
+		page := req.Page
+		for _, gc := range collections {
+			temple, _ := client.Temple.Get(r.Context(), gc.TempleID)
+
+			assigned, ws := layout.place(temple, gc.ID, page)
+			warnings = append(warnings, ws...)
+			if page > 0 {
+				page = assigned + 1
+			}
+
+			updated, err := client.GoshuinCollection.UpdateOneID(gc.ID).SetBook(book.ID, assigned).Save(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to move goshuin collection")
+				return
+			}
+			moved = append(moved, updated)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"collections": moved,
+			"warnings":    warnings,
+		})
+	}
+}
+
+// assignBook 御朱印の登録・更新時に御朱印帳とページを決めます
+// 御朱印帳がユーザーのものでない場合は false を返します
+func assignBook(ctx context.Context, client *ent.Client, userID string, bookID, templeID, collectionID, page int) (int, []bookWarning, bool, error) {
+	book, ok := ownedGoshuinBook(ctx, client, bookID, userID)
+	if !ok {
+		return 0, nil, false, nil
+	}
+
+	layout, err := loadBookLayout(ctx, client, book)
+	if err != nil {
+		return 0, nil, true, err
+	}
+	if collectionID > 0 && page == 0 {
+		// 同じ御朱印帳内での更新はページを維持する
+		for p, id := range layout.used {
+			if id == collectionID {
+				page = p
+			}
+		}
+	}
+
+	temple, _ := client.Temple.Get(ctx, templeID)
+	assigned, warnings := layout.place(temple, collectionID, page)
+	return assigned, warnings, true, nil
+}
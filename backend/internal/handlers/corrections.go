@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/storage"
+)
+
+// correctionValues 提案された値を文字列に揃えます（数値の緯度経度もそのまま受け付けます）
+func correctionValues(raw map[string]interface{}) (map[string]string, error) {
+	values := make(map[string]string, len(raw))
+	for field, v := range raw {
+		switch v := v.(type) {
+		case string:
+			values[field] = strings.TrimSpace(v)
+		case float64:
+			values[field] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("%s must be a string or number", field)
+		}
+	}
+	return values, nil
+}
+
+// CreateTempleCorrection 寺社情報の修正を提案します
+// JSON の changes（項目ごとの新しい値）、comment、photo_url で送るか、
+// multipart/form-data の changes（JSON文字列）、comment、photo（証拠写真）で送ります
+func CreateTempleCorrection(client *ent.Client, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		templeID, ok := templeIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		if _, err := client.Temple.Get(r.Context(), templeID); err != nil {
+			writeError(w, http.StatusNotFound, "Temple not found")
+			return
+		}
+
+		var req struct {
+			Changes  map[string]interface{} `json:"changes"`
+			Comment  string                 `json:"comment"`
+			PhotoURL string                 `json:"photo_url"`
+		}
+		var photoKey string
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "multipart/form-data" {
+			data, ext, ok := readImageFile(w, r, "photo", false)
+			if !ok {
+				return
+			}
+			if err := json.Unmarshal([]byte(r.FormValue("changes")), &req.Changes); err != nil {
+				writeError(w, http.StatusBadRequest, "changes must be a JSON object")
+				return
+			}
+			req.Comment = r.FormValue("comment")
+
+			if data != nil {
+				key, err := storage.PutHashed(r.Context(), store, "corrections/"+url.PathEscape(user.ID), data, ext)
+				if err != nil {
+					log.Printf("correction photo upload failed: %v", err)
+					writeError(w, http.StatusInternalServerError, "Failed to store photo")
+					return
+				}
+				photoKey, req.PhotoURL = key, store.URL(key)
+			}
+		} else {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Failed to read request body")
+				return
+			}
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON format")
+				return
+			}
+		}
+
+		changes, err := correctionValues(req.Changes)
+		if err == nil {
+			err = ent.ValidateTempleChanges(changes)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		correction, err := client.TempleCorrection.Create().
+			SetTempleID(templeID).
+			SetUserID(user.ID).
+			SetChanges(changes).
+			SetComment(strings.TrimSpace(req.Comment)).
+			SetPhoto(photoKey, req.PhotoURL).
+			Save(r.Context())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"correction": correction,
+		})
+	}
+}
+
+// GetMyTempleCorrections 自分が提案した修正を新しい順に取得します
+func GetMyTempleCorrections(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		corrections, err := client.TempleCorrection.List(r.Context(), ent.TempleCorrectionFilter{UserID: user.ID})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch corrections")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"corrections": corrections,
+			"count":       len(corrections),
+		})
+	}
+}
+
+// GetTempleCorrectionQueue 修正提案のモデレーションキューを取得します（編集者以上）
+// status を省略すると未処理（pending）の提案を古い順に返します
+func GetTempleCorrectionQueue(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+
+		filter := ent.TempleCorrectionFilter{Status: r.URL.Query().Get("status")}
+		if filter.Status == "" {
+			filter.Status = ent.TempleCorrectionPending
+		}
+		if v := r.URL.Query().Get("temple_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "temple_id must be an integer")
+				return
+			}
+			filter.TempleID = id
+		}
+
+		corrections, err := client.TempleCorrection.List(r.Context(), filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch corrections")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"corrections": corrections,
+			"count":       len(corrections),
+		})
+	}
+}
+
+// correctionFromPath パスの修正提案IDから提案を取得します
+func correctionFromPath(w http.ResponseWriter, r *http.Request, client *ent.Client) (*ent.TempleCorrection, bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 6 {
+		writeError(w, http.StatusBadRequest, "Invalid correction ID")
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(pathParts[5])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid correction ID")
+		return nil, false
+	}
+
+	correction, err := client.TempleCorrection.Get(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Correction not found")
+		return nil, false
+	}
+	return correction, true
+}
+
+// GetTempleCorrection 修正提案を現在の寺社情報と合わせて取得します（編集者以上）
+// conflicts は提案後に寺社側で変更された項目です（承認はできず、マージで解決します）
+func GetTempleCorrection(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+
+		correction, ok := correctionFromPath(w, r, client)
+		if !ok {
+			return
+		}
+
+		response := map[string]interface{}{
+			"correction": correction,
+		}
+		if temple, err := client.Temple.Get(r.Context(), correction.TempleID); err == nil {
+			response["temple"] = temple
+			if correction.Status == ent.TempleCorrectionPending {
+				response["conflicts"] = correction.Conflicts(temple)
+			}
+		}
+
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// ReviewTempleCorrection 修正提案を承認・マージ・却下します（編集者以上）
+// 承認・マージした変更は寺社に反映され、提案者に結果が通知されます
+// マージでは fields で反映する値を指定します（提案の一部だけ、または編集した値）
+func ReviewTempleCorrection(client *ent.Client, status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reviewer, ok := requireRole(w, r, auth.RoleEditor)
+		if !ok {
+			return
+		}
+
+		correction, ok := correctionFromPath(w, r, client)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Note   string                 `json:"note"`
+			Fields map[string]interface{} `json:"fields"`
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON format")
+				return
+			}
+		}
+
+		review := ent.TempleCorrectionReview{
+			Status:     status,
+			ReviewerID: reviewer.ID,
+			Note:       strings.TrimSpace(req.Note),
+		}
+		if status == ent.TempleCorrectionMerged {
+			if review.Fields, err = correctionValues(req.Fields); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := ent.ValidateTempleChanges(review.Fields); err != nil {
+				writeError(w, http.StatusBadRequest, "fields: "+err.Error())
+				return
+			}
+		}
+
+		reviewed, err := client.TempleCorrection.Review(r.Context(), correction.ID, review)
+		var conflict *ent.CorrectionConflictError
+		switch {
+		case errors.As(err, &conflict):
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":     err.Error(),
+				"conflicts": conflict.Fields,
+			})
+			return
+		case errors.Is(err, ent.ErrAlreadyReviewed):
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, "Failed to review correction")
+			return
+		}
+
+		notifyCorrectionReviewed(r.Context(), client, reviewed)
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"correction": reviewed,
+		})
+	}
+}
+
+// notifyCorrectionReviewed 提案者に審査結果を通知します
+func notifyCorrectionReviewed(ctx context.Context, client *ent.Client, correction *ent.TempleCorrection) {
+	name := fmt.Sprintf("temple #%d", correction.TempleID)
+	if temple, err := client.Temple.Get(ctx, correction.TempleID); err == nil {
+		name = temple.Name
+	}
+
+	outcome := map[string]string{
+		ent.TempleCorrectionApproved: "was approved",
+		ent.TempleCorrectionMerged:   "was merged with edits",
+		ent.TempleCorrectionRejected: "was not accepted",
+	}[correction.Status]
+
+	err := client.Notification.Notify(ctx, &ent.Notification{
+		UserID: correction.UserID,
+		Kind:   "temple_correction_" + correction.Status,
+		Title:  fmt.Sprintf("Your correction to %s %s", name, outcome),
+		Body:   correction.ReviewNote,
+		Data: map[string]interface{}{
+			"correction_id": correction.ID,
+			"temple_id":     correction.TempleID,
+			"status":        correction.Status,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to notify %s of correction %d: %v", correction.UserID, correction.ID, err)
+	}
+}
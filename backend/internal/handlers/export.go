@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/export"
+	"stamp-backend/internal/importer"
+	"stamp-backend/internal/storage"
+)
+
+// ExportTemples 寺社カタログをGeoJSON・CSV・KMLでストリーム出力します
+func ExportTemples(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("format")
+		if name == "" {
+			name = "geojson"
+		}
+
+		format, err := export.LookupFormat(name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		filter, err := ParseTempleFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", format.ContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="temples.`+format.Extension+`"`)
+
+		// ヘッダー送信後はステータスを変更できないため、エラーはログのみ
+		if err := export.WriteTemples(r.Context(), client.Temple.Query().Filter(filter), format, w); err != nil {
+			log.Printf("temple export failed: %v", err)
+		}
+	}
+}
+
+// ExportGoshuinCollections ユーザーの御朱印コレクションを寺社情報付きでエクスポートします
+// format: json, csv, zip（画像入り）, pdf（パスポート）
+func ExportGoshuinCollections(client *ent.Client, store storage.Storage, clk clock.Clock) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json"
+		}
+
+		var contentType string
+		switch format {
+		case "json":
+			contentType = "application/json"
+		case "csv":
+			contentType = "text/csv; charset=utf-8"
+		case "zip":
+			contentType = "application/zip"
+		case "pdf":
+			contentType = "application/pdf"
+		default:
+			writeError(w, http.StatusBadRequest, "Unsupported export format: "+format)
+			return
+		}
+
+		collections, err := client.GoshuinCollection.Query().
+			Filter(ent.GoshuinCollectionFilter{UserID: user.ID}).
+			WithTemple().
+			All(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch goshuin collections")
+			return
+		}
+
+		doc := export.NewCollectionDocument(user.ID, collections, clk.Now())
+		fetch := func(ctx context.Context, url string) (io.ReadCloser, error) {
+			return storage.Fetch(ctx, store, url)
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		filename := "goshuin-collection." + format
+		if format == "pdf" {
+			filename = "goshuin-passport.pdf"
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+		switch format {
+		case "json":
+			err = export.WriteCollectionJSON(w, doc)
+		case "csv":
+			err = export.WriteCollectionCSV(w, doc)
+		case "zip":
+			err = export.WriteCollectionZIP(r.Context(), w, doc, fetch)
+		case "pdf":
+			err = export.WritePassportPDF(r.Context(), w, doc, fetch)
+		}
+
+		// ヘッダー送信後はステータスを変更できないため、エラーはログのみ
+		if err != nil {
+			log.Printf("goshuin export failed: %v", err)
+		}
+	}
+}
+
+// maxImportSize インポートで受け付けるリクエストボディの上限
+const maxImportSize = 200 << 20
+
+// ImportGoshuinCollections エクスポートしたZIPまたはJSONから御朱印コレクションを取り込みます
+func ImportGoshuinCollections(client *ent.Client, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, "Import file is too large")
+			return
+		}
+
+		doc, images, err := importer.ReadDocument(body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		report, err := importer.New(client, store).Import(r.Context(), user.ID, doc, images)
+		if err != nil {
+			log.Printf("goshuin import failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "Failed to import goshuin collections")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"imported_count": len(report.Imported),
+			"skipped_count":  len(report.Skipped),
+			"conflict_count": len(report.Conflicts),
+			"report":         report,
+		})
+	}
+}
@@ -1,19 +1,37 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"stamp-backend/internal/clock"
 	"stamp-backend/internal/ent"
 )
 
 // GetGoshuinCollections 御朱印コレクション一覧を取得します
 func GetGoshuinCollections(client *ent.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		collections, err := client.GoshuinCollection.Query().All(r.Context())
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		filter, err := parseGoshuinCollectionFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		filter.UserID = user.ID
+
+		collections, err := client.GoshuinCollection.Query().
+			Filter(filter).
+			All(r.Context())
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, "Failed to fetch goshuin collections")
 			return
@@ -25,13 +43,232 @@ func GetGoshuinCollections(client *ent.Client) http.HandlerFunc {
 	}
 }
 
+// parseGoshuinCollectionFilter クエリパラメータから御朱印の検索条件を組み立てます
+// tag は複数指定（?tag=a&tag=b またはカンマ区切り）でき、すべてのタグを持つ御朱印に絞り込みます
+func parseGoshuinCollectionFilter(r *http.Request) (ent.GoshuinCollectionFilter, error) {
+	q := r.URL.Query()
+	var filter ent.GoshuinCollectionFilter
+
+	var tags []string
+	for _, v := range q["tag"] {
+		tags = append(tags, strings.Split(v, ",")...)
+	}
+	filter.Tags = ent.NormalizeTags(tags)
+
+	for name, dst := range map[string]*int{"rating": &filter.Rating, "min_rating": &filter.MinRating} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 5 {
+			return filter, fmt.Errorf("%s must be between 1 and 5", name)
+		}
+		*dst = n
+	}
+
+	return filter, nil
+}
+
+// validateGoshuinDetails 評価・納めた金額・待ち時間を検証します
+func validateGoshuinDetails(rating, feePaid, waitingMinutes int) string {
+	if rating < 0 || rating > 5 {
+		return "Rating must be between 1 and 5"
+	}
+	if feePaid < 0 {
+		return "fee_paid must not be negative"
+	}
+	if waitingMinutes < 0 {
+		return "waiting_minutes must not be negative"
+	}
+	return ""
+}
+
+// maxClockSkew 端末の時計のずれとして許容する未来方向の誤差
+const maxClockSkew = 5 * time.Minute
+
+// parseCollectedAt オフセット付きのRFC 3339の収集日時を検証します
+// 未来の日時と、保存できない1970年以前の日時は受け付けません
+func parseCollectedAt(s string, now time.Time) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("collected_at must be RFC 3339 with a UTC offset (e.g. 2024-01-01T10:00:00+09:00)")
+	}
+	if t.After(now.Add(maxClockSkew)) {
+		return time.Time{}, fmt.Errorf("collected_at must not be in the future")
+	}
+	if t.Year() < 1970 {
+		return time.Time{}, fmt.Errorf("collected_at is too old")
+	}
+	return t, nil
+}
+
+// goshuinInput 御朱印コレクションの作成・更新で受け付ける項目
+// 更新では省略した項目（nil）を変更しません（rating などは0で未設定に戻します）
+type goshuinInput struct {
+	// ClientID オフラインの端末が生成したUUID（作成のみ。省略時はサーバーが生成します）
+	ClientID string `json:"client_id"`
+	// TempleID 作成のみ
+	TempleID int     `json:"temple_id"`
+	ImageURL *string `json:"image_url"`
+	// Notes Markdown形式のメモ
+	Notes          *string   `json:"notes"`
+	Tags           *[]string `json:"tags"`
+	Rating         *int      `json:"rating"`
+	FeePaid        *int      `json:"fee_paid"`
+	WaitingMinutes *int      `json:"waiting_minutes"`
+	HallName       *string   `json:"hall_name"`
+	// BookID 更新では0で御朱印帳から外します
+	BookID      *int    `json:"book_id"`
+	Page        int     `json:"page"`
+	CollectedAt *string `json:"collected_at"`
+}
+
+// goshuinError 御朱印コレクションの作成・更新に失敗した理由と、応答するHTTPステータス
+type goshuinError struct {
+	status  int
+	message string
+}
+
+func (e *goshuinError) Error() string {
+	return e.message
+}
+
+// createGoshuinCollection 入力を検証して御朱印コレクションを作成します
+// collected_at を省略した場合は現在時刻になります
+func createGoshuinCollection(ctx context.Context, client *ent.Client, clk clock.Clock, userID string, in goshuinInput) (*ent.GoshuinCollection, []bookWarning, *goshuinError) {
+	if in.TempleID == 0 {
+		return nil, nil, &goshuinError{http.StatusBadRequest, "Temple ID is required"}
+	}
+	if _, err := client.Temple.Get(ctx, in.TempleID); err != nil {
+		return nil, nil, &goshuinError{http.StatusBadRequest, "Temple not found"}
+	}
+
+	if in.ClientID != "" {
+		if !ent.ValidUUID(in.ClientID) {
+			return nil, nil, &goshuinError{http.StatusBadRequest, "client_id must be a lower-case UUID"}
+		}
+		existing, err := client.GoshuinCollection.GetByClientID(ctx, userID, in.ClientID)
+		if err != nil {
+			return nil, nil, &goshuinError{http.StatusInternalServerError, "Failed to fetch goshuin collection"}
+		}
+		if existing != nil {
+			return nil, nil, &goshuinError{http.StatusConflict, "client_id is already used by another goshuin collection"}
+		}
+	}
+
+	if msg := validateGoshuinDetails(deref(in.Rating), deref(in.FeePaid), deref(in.WaitingMinutes)); msg != "" {
+		return nil, nil, &goshuinError{http.StatusBadRequest, msg}
+	}
+
+	collectedAt := clk.Now()
+	if in.CollectedAt != nil && *in.CollectedAt != "" {
+		var err error
+		if collectedAt, err = parseCollectedAt(*in.CollectedAt, clk.Now()); err != nil {
+			return nil, nil, &goshuinError{http.StatusBadRequest, err.Error()}
+		}
+	}
+
+	bookID, page := deref(in.BookID), in.Page
+	var warnings []bookWarning
+	if bookID > 0 {
+		p, ws, ok, err := assignBook(ctx, client, userID, bookID, in.TempleID, 0, page)
+		if err != nil {
+			return nil, nil, &goshuinError{http.StatusInternalServerError, "Failed to fetch goshuin book"}
+		}
+		if !ok {
+			return nil, nil, &goshuinError{http.StatusBadRequest, "Goshuin book not found"}
+		}
+		page, warnings = p, ws
+	}
+
+	var tags []string
+	if in.Tags != nil {
+		tags = *in.Tags
+	}
+	collection, err := client.GoshuinCollection.Create().
+		SetUserID(userID).
+		SetClientID(in.ClientID).
+		SetTempleID(in.TempleID).
+		SetImageURL(derefString(in.ImageURL)).
+		SetNotes(derefString(in.Notes)).
+		SetTags(tags).
+		SetDetails(deref(in.Rating), deref(in.FeePaid), deref(in.WaitingMinutes), strings.TrimSpace(derefString(in.HallName))).
+		SetBook(bookID, page).
+		SetCollectedAt(collectedAt).
+		Save(ctx)
+	if err != nil {
+		return nil, nil, &goshuinError{http.StatusInternalServerError, "Failed to create goshuin collection"}
+	}
+	return collection, warnings, nil
+}
+
+// updateGoshuinCollection 入力を検証して、ユーザーの御朱印コレクション current の指定された項目を更新します
+func updateGoshuinCollection(ctx context.Context, client *ent.Client, clk clock.Clock, userID string, current *ent.GoshuinCollection, in goshuinInput) (*ent.GoshuinCollection, []bookWarning, *goshuinError) {
+	if msg := validateGoshuinDetails(deref(in.Rating), deref(in.FeePaid), deref(in.WaitingMinutes)); msg != "" {
+		return nil, nil, &goshuinError{http.StatusBadRequest, msg}
+	}
+
+	update := client.GoshuinCollection.UpdateOneID(current.ID)
+	if in.ImageURL != nil {
+		update.SetImageURL(*in.ImageURL)
+	}
+	if in.Notes != nil {
+		update.SetNotes(*in.Notes)
+	}
+	if in.Tags != nil {
+		update.SetTags(*in.Tags)
+	}
+	if in.Rating != nil {
+		update.SetRating(*in.Rating)
+	}
+	if in.FeePaid != nil {
+		update.SetFeePaid(*in.FeePaid)
+	}
+	if in.WaitingMinutes != nil {
+		update.SetWaitingMinutes(*in.WaitingMinutes)
+	}
+	if in.HallName != nil {
+		update.SetHallName(strings.TrimSpace(*in.HallName))
+	}
+	if in.CollectedAt != nil {
+		collectedAt, err := parseCollectedAt(*in.CollectedAt, clk.Now())
+		if err != nil {
+			return nil, nil, &goshuinError{http.StatusBadRequest, err.Error()}
+		}
+		update.SetCollectedAt(collectedAt)
+	}
+
+	var warnings []bookWarning
+	if in.BookID != nil {
+		page := 0
+		if *in.BookID > 0 {
+			p, ws, ok, err := assignBook(ctx, client, userID, *in.BookID, current.TempleID, current.ID, in.Page)
+			if err != nil {
+				return nil, nil, &goshuinError{http.StatusInternalServerError, "Failed to fetch goshuin book"}
+			}
+			if !ok {
+				return nil, nil, &goshuinError{http.StatusBadRequest, "Goshuin book not found"}
+			}
+			page, warnings = p, ws
+		}
+		update.SetBook(*in.BookID, page)
+	}
+
+	collection, err := update.Save(ctx)
+	if err != nil {
+		return nil, nil, &goshuinError{http.StatusInternalServerError, "Failed to update goshuin collection"}
+	}
+	return collection, warnings, nil
+}
+
 // CreateGoshuinCollection 新しい御朱印コレクションを作成します
-func CreateGoshuinCollection(client *ent.Client) http.HandlerFunc {
+// collected_at を省略した場合は現在時刻（UTC）になります
+func CreateGoshuinCollection(client *ent.Client, clk clock.Clock) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			TempleID int    `json:"temple_id"`
-			ImageURL string `json:"image_url"`
-			Notes    string `json:"notes"`
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
 		}
 
 		body, err := io.ReadAll(r.Body)
@@ -40,36 +277,40 @@ func CreateGoshuinCollection(client *ent.Client) http.HandlerFunc {
 			return
 		}
 
+		var req goshuinInput
 		if err := json.Unmarshal(body, &req); err != nil {
 			writeError(w, http.StatusBadRequest, "Invalid JSON format")
 			return
 		}
 
-		if req.TempleID == 0 {
-			writeError(w, http.StatusBadRequest, "Temple ID is required")
-			return
-		}
-
-		collection, err := client.GoshuinCollection.Create().
-			SetTempleID(req.TempleID).
-			SetImageURL(req.ImageURL).
-			SetNotes(req.Notes).
-			Save(r.Context())
-
-		if err != nil {
-			writeError(w, http.StatusInternalServerError, "Failed to create goshuin collection")
+		collection, warnings, gerr := createGoshuinCollection(r.Context(), client, clk, user.ID, req)
+		if gerr != nil {
+			writeError(w, gerr.status, gerr.message)
 			return
 		}
 
-		writeJSON(w, http.StatusCreated, map[string]interface{}{
+		resp := map[string]interface{}{
 			"collection": collection,
-		})
+		}
+		if len(warnings) > 0 {
+			resp["warnings"] = warnings
+		}
+		// ガイドを修了していなければ、マナークイズへの案内として修了状況を返します
+		if status := guideNudge(r.Context(), client, user.ID); status != nil {
+			resp["guide"] = status
+		}
+		writeJSON(w, http.StatusCreated, resp)
 	}
 }
 
 // GetGoshuinCollection 特定の御朱印コレクションを取得します
 func GetGoshuinCollection(client *ent.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
 		pathParts := strings.Split(r.URL.Path, "/")
 		if len(pathParts) < 5 {
 			writeError(w, http.StatusBadRequest, "Invalid collection ID")
@@ -83,11 +324,16 @@ func GetGoshuinCollection(client *ent.Client) http.HandlerFunc {
 		}
 
 		collection, err := client.GoshuinCollection.Get(r.Context(), id)
-		if err != nil {
+		if err != nil || collection.UserID != user.ID {
 			writeError(w, http.StatusNotFound, "Goshuin collection not found")
 			return
 		}
 
+		if collection.Edges.Photos, err = client.GoshuinPhoto.ListByCollection(r.Context(), id); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch photos")
+			return
+		}
+
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"collection": collection,
 		})
@@ -95,8 +341,13 @@ func GetGoshuinCollection(client *ent.Client) http.HandlerFunc {
 }
 
 // UpdateGoshuinCollection 御朱印コレクションを更新します
-func UpdateGoshuinCollection(client *ent.Client) http.HandlerFunc {
+func UpdateGoshuinCollection(client *ent.Client, clk clock.Clock) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
 		pathParts := strings.Split(r.URL.Path, "/")
 		if len(pathParts) < 5 {
 			writeError(w, http.StatusBadRequest, "Invalid collection ID")
@@ -109,9 +360,10 @@ func UpdateGoshuinCollection(client *ent.Client) http.HandlerFunc {
 			return
 		}
 
-		var req struct {
-			ImageURL string `json:"image_url"`
-			Notes    string `json:"notes"`
+		current, err := client.GoshuinCollection.Get(r.Context(), id)
+		if err != nil || current.UserID != user.ID {
+			writeError(w, http.StatusNotFound, "Goshuin collection not found")
+			return
 		}
 
 		body, err := io.ReadAll(r.Body)
@@ -120,30 +372,37 @@ func UpdateGoshuinCollection(client *ent.Client) http.HandlerFunc {
 			return
 		}
 
+		// 省略した項目は変更しません
+		var req goshuinInput
 		if err := json.Unmarshal(body, &req); err != nil {
 			writeError(w, http.StatusBadRequest, "Invalid JSON format")
 			return
 		}
 
-		collection, err := client.GoshuinCollection.UpdateOneID(id).
-			SetImageURL(req.ImageURL).
-			SetNotes(req.Notes).
-			Save(r.Context())
-
-		if err != nil {
-			writeError(w, http.StatusInternalServerError, "Failed to update goshuin collection")
+		collection, warnings, gerr := updateGoshuinCollection(r.Context(), client, clk, user.ID, current, req)
+		if gerr != nil {
+			writeError(w, gerr.status, gerr.message)
 			return
 		}
 
-		writeJSON(w, http.StatusOK, map[string]interface{}{
+		resp := map[string]interface{}{
 			"collection": collection,
-		})
+		}
+		if len(warnings) > 0 {
+			resp["warnings"] = warnings
+		}
+		writeJSON(w, http.StatusOK, resp)
 	}
 }
 
 // DeleteGoshuinCollection 御朱印コレクションを削除します
 func DeleteGoshuinCollection(client *ent.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
 		pathParts := strings.Split(r.URL.Path, "/")
 		if len(pathParts) < 5 {
 			writeError(w, http.StatusBadRequest, "Invalid collection ID")
@@ -156,6 +415,11 @@ func DeleteGoshuinCollection(client *ent.Client) http.HandlerFunc {
 			return
 		}
 
+		if !ownsGoshuinCollection(r.Context(), client, id, user.ID) {
+			writeError(w, http.StatusNotFound, "Goshuin collection not found")
+			return
+		}
+
 		if err := client.GoshuinCollection.DeleteOneID(id).Exec(r.Context()); err != nil {
 			writeError(w, http.StatusInternalServerError, "Failed to delete goshuin collection")
 			return
@@ -166,3 +430,45 @@ func DeleteGoshuinCollection(client *ent.Client) http.HandlerFunc {
 		})
 	}
 }
+
+// ownsGoshuinCollection 御朱印コレクションがユーザーのものか確認します
+func ownsGoshuinCollection(ctx context.Context, client *ent.Client, id int, userID string) bool {
+	collection, err := client.GoshuinCollection.Get(ctx, id)
+	return err == nil && collection.UserID == userID
+}
+
+// deref 省略されたJSONの数値を0として扱います
+func deref(n *int) int {
+	if n == nil {
+		return 0
+	}
+	return *n
+}
+
+// derefString 省略されたJSONの文字列を空文字として扱います
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// GetMyTags ログインユーザーのタグと使用数（タグクラウド）を取得します
+func GetMyTags(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		tags, err := client.GoshuinCollection.TagCounts(r.Context(), user.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch tags")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"tags": tags,
+		})
+	}
+}
@@ -1,54 +1,534 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"stamp-backend/internal/auth"
 	"stamp-backend/internal/ent"
+	"stamp-backend/internal/i18n"
+	"stamp-backend/internal/storage"
 )
 
-// GetGuide 御朱印のガイド情報を取得します
+// ガイドの見出しと説明（英語の原文）。翻訳は translations の Guide（id 1）に登録します
+const (
+	guideTitle       = "Goshuin Guide"
+	guideDescription = "Learn about Japanese temple stamps and how to collect them"
+)
+
+// guideText 原文と翻訳から要求された言語の文を選び、使った言語を served に記録します
+func guideText(t ent.Translations, pref i18n.Preference, served *i18n.Served, field, original string) (string, string) {
+	values := t.Values(1, field)
+	values[i18n.English] = original
+	value, locale := i18n.Pick(pref.Chain, values)
+	served.Add(locale)
+	return value, locale
+}
+
+// pickByLocale 同じ slug の項目のうち、チェーンで最も優先される言語のものを選び、元の順番で添字を返します
+// チェーンにない言語しかない slug は除きます
+func pickByLocale(n int, key func(i int) (slug, locale string), chain []string) []int {
+	rank := map[string]int{}
+	for i, l := range chain {
+		rank[l] = i + 1
+	}
+
+	best := map[string]int{}
+	for i := 0; i < n; i++ {
+		slug, locale := key(i)
+		if rank[locale] == 0 {
+			continue
+		}
+		if j, ok := best[slug]; ok {
+			if _, current := key(j); rank[current] <= rank[locale] {
+				continue
+			}
+		}
+		best[slug] = i
+	}
+
+	picked := []int{}
+	for i := 0; i < n; i++ {
+		slug, _ := key(i)
+		if j, ok := best[slug]; ok && j == i {
+			picked = append(picked, i)
+		}
+	}
+	return picked
+}
+
+// GetGuide 公開中の御朱印のガイドを取得します
+// 節とヒントは slug ごとに lang パラメータまたは Accept-Language で最も優先される言語のものを返し、
+// 各節の locale と Content-Language で実際の言語を示します
 func GetGuide(client *ent.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// 御朱印のガイド情報を返す
-		guide := map[string]interface{}{
-			"title":       "Goshuin Guide",
-			"description": "Learn about Japanese temple stamps and how to collect them",
-			"sections": []map[string]interface{}{
-				{
-					"title":     "What is Goshuin?",
-					"content":   "Goshuin (御朱印) are special stamps or calligraphy that you can receive at Japanese temples and shrines. They serve as proof of your visit and are considered sacred items.",
-					"image_url": "/images/goshuin-example.jpg",
-				},
-				{
-					"title":     "How to Receive Goshuin",
-					"content":   "1. Visit the temple or shrine during opening hours\n2. Look for the goshuin office (御朱印所)\n3. Pay the fee (usually 300-500 yen)\n4. Present your goshuin book or paper\n5. Wait while the priest writes the goshuin",
-					"image_url": "/images/goshuin-process.jpg",
-				},
-				{
-					"title":     "Etiquette and Manners",
-					"content":   "- Dress modestly and respectfully\n- Be quiet and respectful in sacred areas\n- Don't take photos of the goshuin writing process\n- Handle your goshuin book with care\n- Don't rush the priest while they're writing",
-					"image_url": "/images/temple-manners.jpg",
-				},
-				{
-					"title":     "Goshuin Book (御朱印帳)",
-					"content":   "A goshuin book is a special notebook designed to collect goshuin. You can purchase one at most temples and shrines, or bring your own. Traditional books are made of washi paper and have beautiful covers.",
-					"image_url": "/images/goshuin-book.jpg",
-				},
-				{
-					"title":     "Best Practices",
-					"content":   "- Start with famous temples in your area\n- Visit during weekdays to avoid crowds\n- Check temple websites for special goshuin\n- Keep your goshuin book in a protective case\n- Document your visits with photos",
-					"image_url": "/images/temple-visit.jpg",
-				},
-			},
-			"tips": []string{
-				"Some temples offer special goshuin for different seasons",
-				"Many temples have multiple goshuin designs",
-				"Some temples require advance reservations for goshuin",
-				"Goshuin are considered sacred items, so treat them with respect",
-				"You can collect goshuin at both temples (寺) and shrines (神社)",
-			},
-		}
-
-		writeJSON(w, http.StatusOK, guide)
+		pref := i18n.FromRequest(r)
+		published := ent.GuideFilter{Status: ent.GuideStatusPublished, Published: true}
+
+		header, err := client.Translation.Load(r.Context(), ent.TypeGuide, []int{1}, pref.Chain)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch translations")
+			return
+		}
+		allSections, err := client.Guide.Sections(r.Context(), published)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch guide")
+			return
+		}
+		allTips, err := client.Guide.Tips(r.Context(), published)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch guide")
+			return
+		}
+
+		var served i18n.Served
+		title, locale := guideText(header, pref, &served, "title", guideTitle)
+		description, _ := guideText(header, pref, &served, "description", guideDescription)
+
+		sections := []map[string]interface{}{}
+		for _, i := range pickByLocale(len(allSections), func(i int) (string, string) {
+			return allSections[i].Slug, allSections[i].Locale
+		}, pref.Chain) {
+			s := allSections[i]
+			served.Add(s.Locale)
+			sections = append(sections, map[string]interface{}{
+				"id":      s.ID,
+				"slug":    s.Slug,
+				"title":   s.Title,
+				"content": s.Body,
+				"media":   s.Media,
+				"locale":  s.Locale,
+			})
+		}
+
+		tips := []string{}
+		for _, i := range pickByLocale(len(allTips), func(i int) (string, string) {
+			return allTips[i].Slug, allTips[i].Locale
+		}, pref.Chain) {
+			served.Add(allTips[i].Locale)
+			tips = append(tips, allTips[i].Body)
+		}
+
+		served.SetHeader(w)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"title":       title,
+			"description": description,
+			"locale":      locale,
+			"locales":     served.Locales(),
+			"sections":    sections,
+			"tips":        tips,
+		})
+	}
+}
+
+// guideIDFromPath パスの節・ヒントのIDを取得します
+func guideIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 6 {
+		writeError(w, http.StatusBadRequest, "Invalid guide ID")
+		return 0, false
+	}
+	id, err := strconv.Atoi(pathParts[5])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid guide ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// guideEntity 節またはヒントを取得します。見つからない場合は 404 を書き込みます
+func guideEntity(ctx context.Context, w http.ResponseWriter, client *ent.Client, kind string, id int) (interface{}, bool) {
+	entity, err := client.Guide.Entity(ctx, kind, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Guide content not found")
+		return nil, false
+	}
+	return entity, true
+}
+
+// guideResponseKey レスポンスのキー（section または tip）を返します
+func guideResponseKey(kind string) string {
+	if kind == ent.TypeGuideSection {
+		return "section"
+	}
+	return "tip"
+}
+
+// writeGuideEntity 更新後の節またはヒントを返します
+func writeGuideEntity(ctx context.Context, w http.ResponseWriter, client *ent.Client, kind string, id, status int) {
+	entity, ok := guideEntity(ctx, w, client, kind, id)
+	if !ok {
+		return
+	}
+	writeJSON(w, status, map[string]interface{}{
+		guideResponseKey(kind): entity,
+	})
+}
+
+// writeGuideError ガイドの編集エラーを書き込みます
+func writeGuideError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ent.ErrGuideSlugTaken):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ent.ErrGuideVersionNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+// ListGuideContent 節またはヒントを下書きも含めて最新の版で取得します（編集者以上）
+// locale と status（draft・published）で絞り込めます
+func ListGuideContent(client *ent.Client, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+
+		filter := ent.GuideFilter{Locale: r.URL.Query().Get("locale"), Status: r.URL.Query().Get("status")}
+		if filter.Locale != "" {
+			filter.Locale = i18n.Canonical(filter.Locale)
+		}
+
+		var list interface{}
+		var count int
+		var err error
+		if kind == ent.TypeGuideSection {
+			var sections []*ent.GuideSection
+			sections, err = client.Guide.Sections(r.Context(), filter)
+			list, count = sections, len(sections)
+		} else {
+			var tips []*ent.GuideTip
+			tips, err = client.Guide.Tips(r.Context(), filter)
+			list, count = tips, len(tips)
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch guide")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			guideResponseKey(kind) + "s": list,
+			"count":                      count,
+		})
+	}
+}
+
+// GetGuideContent 節またはヒントを最新の版で取得します（編集者以上）
+func GetGuideContent(client *ent.Client, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+		id, ok := guideIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		writeGuideEntity(r.Context(), w, client, kind, id, http.StatusOK)
+	}
+}
+
+// guideContentRequest 節・ヒントの作成・更新のリクエスト
+// ヒントは title を使わず、本文を body に入れます
+type guideContentRequest struct {
+	Slug     string            `json:"slug"`
+	Locale   string            `json:"locale"`
+	Position *int              `json:"position"`
+	Title    *string           `json:"title"`
+	Body     *string           `json:"body"`
+	Media    *[]ent.GuideMedia `json:"media"`
+	// Publish 作成と同時に公開します
+	Publish bool `json:"publish"`
+}
+
+// content 現在の内容にリクエストの変更を重ねます。内容の変更がなければ nil を返します
+func (req guideContentRequest) content(current ent.GuideContent) *ent.GuideContent {
+	if req.Title == nil && req.Body == nil && req.Media == nil {
+		return nil
+	}
+	c := current
+	if req.Title != nil {
+		c.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Body != nil {
+		c.Body = *req.Body
+	}
+	if req.Media != nil {
+		c.Media = *req.Media
+	}
+	return &c
+}
+
+// CreateGuideContent 節またはヒントを作成します（編集者以上）
+// 最初の版は publish を指定しない限り下書きになります
+func CreateGuideContent(client *ent.Client, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		editor, ok := requireRole(w, r, auth.RoleEditor)
+		if !ok {
+			return
+		}
+
+		var req guideContentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+		if !i18n.Valid(req.Locale) {
+			writeError(w, http.StatusBadRequest, "locale must be a language tag such as zh-TW")
+			return
+		}
+
+		create := ent.GuideCreate{
+			Slug:     strings.TrimSpace(req.Slug),
+			Locale:   i18n.Canonical(req.Locale),
+			Content:  ent.GuideContent{Media: []ent.GuideMedia{}},
+			AuthorID: editor.ID,
+			Publish:  req.Publish,
+		}
+		if c := req.content(create.Content); c != nil {
+			create.Content = *c
+		}
+		if req.Position != nil {
+			create.Position = *req.Position
+		}
+
+		id, err := client.Guide.Create(r.Context(), kind, create)
+		if err != nil {
+			writeGuideError(w, err)
+			return
+		}
+		writeGuideEntity(r.Context(), w, client, kind, id, http.StatusCreated)
+	}
+}
+
+// UpdateGuideContent 節またはヒントを更新します（編集者以上）
+// 内容（title・body・media）を変更すると新しい版が下書きとして追加され、公開中の版は公開するまで変わりません
+func UpdateGuideContent(client *ent.Client, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		editor, ok := requireRole(w, r, auth.RoleEditor)
+		if !ok {
+			return
+		}
+		id, ok := guideIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		entity, ok := guideEntity(r.Context(), w, client, kind, id)
+		if !ok {
+			return
+		}
+
+		var req guideContentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+
+		var current ent.GuideContent
+		switch e := entity.(type) {
+		case *ent.GuideSection:
+			current = e.GuideContent
+		case *ent.GuideTip:
+			current = e.GuideContent
+		}
+
+		err := client.Guide.Update(r.Context(), kind, id, ent.GuideUpdate{
+			Position: req.Position,
+			Content:  req.content(current),
+			AuthorID: editor.ID,
+		})
+		if err != nil {
+			writeGuideError(w, err)
+			return
+		}
+		writeGuideEntity(r.Context(), w, client, kind, id, http.StatusOK)
+	}
+}
+
+// DeleteGuideContent 節またはヒントを版の履歴ごと削除します（編集者以上）
+func DeleteGuideContent(client *ent.Client, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+		id, ok := guideIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		if _, ok := guideEntity(r.Context(), w, client, kind, id); !ok {
+			return
+		}
+
+		if err := client.Guide.Delete(r.Context(), kind, id); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to delete guide content")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Guide content deleted successfully",
+		})
+	}
+}
+
+// guideVersionRequest 公開・ロールバックする版のリクエスト
+type guideVersionRequest struct {
+	Version int `json:"version"`
+}
+
+// readGuideVersion 版の指定を読み込みます（本文は省略できます）
+func readGuideVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	var req guideVersionRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to read request body")
+		return 0, false
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return 0, false
+		}
+	}
+	if req.Version < 0 {
+		writeError(w, http.StatusBadRequest, "version must be positive")
+		return 0, false
+	}
+	return req.Version, true
+}
+
+// PublishGuideContent 節またはヒントの版を公開します（編集者以上）
+// version を省略すると最新の版を公開します
+func PublishGuideContent(client *ent.Client, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+		id, ok := guideIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		if _, ok := guideEntity(r.Context(), w, client, kind, id); !ok {
+			return
+		}
+		version, ok := readGuideVersion(w, r)
+		if !ok {
+			return
+		}
+
+		if err := client.Guide.Publish(r.Context(), kind, id, version); err != nil {
+			writeGuideError(w, err)
+			return
+		}
+		writeGuideEntity(r.Context(), w, client, kind, id, http.StatusOK)
+	}
+}
+
+// UnpublishGuideContent 節またはヒントを非公開にします（編集者以上）
+func UnpublishGuideContent(client *ent.Client, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+		id, ok := guideIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		if _, ok := guideEntity(r.Context(), w, client, kind, id); !ok {
+			return
+		}
+
+		if err := client.Guide.Unpublish(r.Context(), kind, id); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to unpublish guide content")
+			return
+		}
+		writeGuideEntity(r.Context(), w, client, kind, id, http.StatusOK)
+	}
+}
+
+// GetGuideVersions 節またはヒントの版の履歴を新しい順に取得します（編集者以上）
+func GetGuideVersions(client *ent.Client, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+		id, ok := guideIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		if _, ok := guideEntity(r.Context(), w, client, kind, id); !ok {
+			return
+		}
+
+		versions, err := client.Guide.Versions(r.Context(), kind, id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch versions")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"versions": versions,
+			"count":    len(versions),
+		})
+	}
+}
+
+// RollbackGuideContent 節またはヒントを以前の版に戻します（編集者以上）
+// 指定した版の内容が新しい版として保存され、公開中であればそのまま公開されます
+func RollbackGuideContent(client *ent.Client, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		editor, ok := requireRole(w, r, auth.RoleEditor)
+		if !ok {
+			return
+		}
+		id, ok := guideIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		if _, ok := guideEntity(r.Context(), w, client, kind, id); !ok {
+			return
+		}
+		version, ok := readGuideVersion(w, r)
+		if !ok {
+			return
+		}
+		if version == 0 {
+			writeError(w, http.StatusBadRequest, "version is required")
+			return
+		}
+
+		if err := client.Guide.Rollback(r.Context(), kind, id, version, editor.ID); err != nil {
+			writeGuideError(w, err)
+			return
+		}
+		writeGuideEntity(r.Context(), w, client, kind, id, http.StatusOK)
+	}
+}
+
+// UploadGuideMedia ガイドで使う画像をアップロードします（編集者以上）
+// multipart/form-data の file で送り、節の media に指定する key と url を返します
+func UploadGuideMedia(store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+
+		data, ext, ok := readImageFile(w, r, "file", true)
+		if !ok {
+			return
+		}
+		key, err := storage.PutHashed(r.Context(), store, "guide", data, ext)
+		if err != nil {
+			log.Printf("guide media upload failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "Failed to store media")
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"media": ent.GuideMedia{Key: key, URL: store.URL(key)},
+		})
 	}
 }
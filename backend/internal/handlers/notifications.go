@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"stamp-backend/internal/ent"
+)
+
+// GetMyNotifications 自分宛ての通知を新しい順に取得します（unread=true で未読のみ）
+func GetMyNotifications(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		unreadOnly := r.URL.Query().Get("unread") == "true"
+		notifications, err := client.Notification.ListByUser(r.Context(), user.ID, unreadOnly)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch notifications")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"notifications": notifications,
+			"count":         len(notifications),
+		})
+	}
+}
+
+// MarkNotificationsRead 通知を既読にします（ids を省略するとすべて）
+func MarkNotificationsRead(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			IDs []int `json:"ids"`
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON format")
+				return
+			}
+		}
+
+		marked, err := client.Notification.MarkRead(r.Context(), user.ID, req.IDs)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update notifications")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"marked": marked,
+		})
+	}
+}
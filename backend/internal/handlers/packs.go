@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/regionpack"
+	"stamp-backend/internal/storage"
+)
+
+// buildRegionPack クエリパラメータの地域のパックを作り、バージョンを記録します
+// 失敗した場合はエラーを書き込み、falseを返します
+func buildRegionPack(w http.ResponseWriter, r *http.Request, client *ent.Client, store storage.Storage) (*regionpack.Pack, bool) {
+	region, err := regionpack.ParseRegion(r.URL.Query().Get("prefecture"), r.URL.Query().Get("bbox"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	pack, err := regionpack.Build(r.Context(), client, store, region)
+	if errors.Is(err, regionpack.ErrRegionTooLarge) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if err == nil {
+		err = regionpack.Publish(r.Context(), client, pack)
+	}
+	if err != nil {
+		log.Printf("region pack build failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to build region pack")
+		return nil, false
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, pack.Manifest.ContentHash))
+	w.Header().Set("X-Pack-Version", strconv.Itoa(pack.Manifest.Version))
+	return pack, true
+}
+
+// GetRegionPack 都道府県（prefecture）または範囲（bbox）の地域パックの最新の目録を取得します
+// 目録のバージョンと端末のバージョンを比べて、更新が必要か判断できます
+func GetRegionPack(client *ent.Client, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pack, ok := buildRegionPack(w, r, client, store)
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"manifest": pack.Manifest,
+		})
+	}
+}
+
+// DownloadRegionPack 地域パックを ZIP でダウンロードします
+// since に端末のバージョンを指定すると、そのバージョンから変わったファイルだけを含む差分になります
+// 記録されていないバージョンを指定した場合は全体を返します
+func DownloadRegionPack(client *ent.Client, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		since := 0
+		if v := r.URL.Query().Get("since"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, "since must be a pack version")
+				return
+			}
+			since = n
+		}
+
+		pack, ok := buildRegionPack(w, r, client, store)
+		if !ok {
+			return
+		}
+
+		manifest := pack.Manifest
+		var only []string
+		if since > 0 {
+			changed, removed, found, err := regionpack.Delta(r.Context(), client, pack, since)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to build region pack")
+				return
+			}
+			if found {
+				manifest.BaseVersion, manifest.Changed, manifest.Removed = since, changed, removed
+				only = changed
+			}
+		}
+
+		name := fmt.Sprintf("region-pack-v%d.zip", manifest.Version)
+		if only != nil {
+			name = fmt.Sprintf("region-pack-v%d-from-v%d.zip", manifest.Version, since)
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		if err := regionpack.WriteZIP(w, pack, manifest, only); err != nil {
+			log.Printf("region pack download failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/export"
+	"stamp-backend/internal/storage"
+	"stamp-backend/internal/trash"
+)
+
+// maxPhotoSize アップロードできる写真1枚あたりの上限サイズ
+const maxPhotoSize = 20 << 20
+
+// readImageFile multipart/form-data の画像ファイルを読み込み、拡張子とともに返します
+// required が false でファイルがない場合は nil を返します。失敗した場合はエラーを書き込み、falseを返します
+func readImageFile(w http.ResponseWriter, r *http.Request, field string, required bool) ([]byte, string, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPhotoSize+1<<20)
+	file, _, err := r.FormFile(field)
+	if err == http.ErrMissingFile && !required {
+		return nil, "", true
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, field+" is required")
+		return nil, "", false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxPhotoSize+1))
+	if err != nil || len(data) > maxPhotoSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "Photo is too large")
+		return nil, "", false
+	}
+	ext := export.ImageExtension(data)
+	if ext == ".bin" {
+		writeError(w, http.StatusBadRequest, "Unsupported image format")
+		return nil, "", false
+	}
+	return data, ext, true
+}
+
+// validPhotoKind 写真の種別か判定します
+func validPhotoKind(kind string) bool {
+	switch kind {
+	case ent.GoshuinPhotoKindStamp, ent.GoshuinPhotoKindScenery, ent.GoshuinPhotoKindReceipt:
+		return true
+	}
+	return false
+}
+
+// ownedCollectionFromPath パスの御朱印IDを取得し、ユーザーのものか確認します
+// 失敗した場合はエラーを書き込み、falseを返します
+func ownedCollectionFromPath(w http.ResponseWriter, r *http.Request, client *ent.Client, userID string) (int, bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 5 {
+		writeError(w, http.StatusBadRequest, "Invalid collection ID")
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(pathParts[4])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid collection ID")
+		return 0, false
+	}
+
+	if !ownsGoshuinCollection(r.Context(), client, id, userID) {
+		writeError(w, http.StatusNotFound, "Goshuin collection not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// photoFromPath パスの写真IDを取得し、御朱印の写真か確認します
+func photoFromPath(w http.ResponseWriter, r *http.Request, client *ent.Client, collectionID int) (*ent.GoshuinPhoto, bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 7 {
+		writeError(w, http.StatusBadRequest, "Invalid photo ID")
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(pathParts[6])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid photo ID")
+		return nil, false
+	}
+
+	photo, err := client.GoshuinPhoto.Get(r.Context(), id)
+	if err != nil || photo.CollectionID != collectionID {
+		writeError(w, http.StatusNotFound, "Photo not found")
+		return nil, false
+	}
+	return photo, true
+}
+
+// GetGoshuinPhotos 御朱印の写真を表示順に取得します
+func GetGoshuinPhotos(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := ownedCollectionFromPath(w, r, client, user.ID)
+		if !ok {
+			return
+		}
+
+		photos, err := client.GoshuinPhoto.ListByCollection(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch photos")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"photos": photos,
+		})
+	}
+}
+
+// AddGoshuinPhoto 御朱印に写真を追加します
+// multipart/form-data の file（caption, kind, cover）でアップロードするか、
+// JSON の url で外部の画像を登録します。最初の写真は自動的に表紙になります
+func AddGoshuinPhoto(client *ent.Client, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := ownedCollectionFromPath(w, r, client, user.ID)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			URL     string `json:"url"`
+			Caption string `json:"caption"`
+			Kind    string `json:"kind"`
+			Cover   bool   `json:"cover"`
+		}
+		var key string
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "multipart/form-data" {
+			data, ext, ok := readImageFile(w, r, "file", true)
+			if !ok {
+				return
+			}
+
+			var err error
+			key, err = storage.PutHashed(r.Context(), store, "goshuin/"+url.PathEscape(user.ID), data, ext)
+			if err != nil {
+				log.Printf("photo upload failed: %v", err)
+				writeError(w, http.StatusInternalServerError, "Failed to store photo")
+				return
+			}
+			req.URL = store.URL(key)
+			req.Caption = r.FormValue("caption")
+			req.Kind = r.FormValue("kind")
+			req.Cover, _ = strconv.ParseBool(r.FormValue("cover"))
+		} else {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Failed to read request body")
+				return
+			}
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON format")
+				return
+			}
+			if req.URL == "" {
+				writeError(w, http.StatusBadRequest, "url or file is required")
+				return
+			}
+			key, _ = store.KeyFromURL(req.URL)
+		}
+
+		if req.Kind == "" {
+			req.Kind = ent.GoshuinPhotoKindStamp
+		}
+		if !validPhotoKind(req.Kind) {
+			writeError(w, http.StatusBadRequest, "kind must be stamp, scenery or receipt")
+			return
+		}
+
+		photo, err := client.GoshuinPhoto.Create().
+			SetCollectionID(id).
+			SetCaption(strings.TrimSpace(req.Caption)).
+			SetKind(req.Kind).
+			SetFile(key, req.URL).
+			SetCover(req.Cover).
+			Save(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to add photo")
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"photo": photo,
+		})
+	}
+}
+
+// ReorderGoshuinPhotos 御朱印の写真の表示順を変更します
+func ReorderGoshuinPhotos(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := ownedCollectionFromPath(w, r, client, user.ID)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			PhotoIDs []int `json:"photo_ids"`
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+
+		photos, err := client.GoshuinPhoto.Reorder(r.Context(), id, req.PhotoIDs)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"photos": photos,
+		})
+	}
+}
+
+// UpdateGoshuinPhoto 写真のキャプション・種別を変更し、表紙に設定します
+func UpdateGoshuinPhoto(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := ownedCollectionFromPath(w, r, client, user.ID)
+		if !ok {
+			return
+		}
+
+		photo, ok := photoFromPath(w, r, client, id)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Caption *string `json:"caption"`
+			Kind    *string `json:"kind"`
+			Cover   bool    `json:"cover"`
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+
+		update := client.GoshuinPhoto.UpdateOneID(photo.ID)
+		if req.Caption != nil {
+			update.SetCaption(strings.TrimSpace(*req.Caption))
+		}
+		if req.Kind != nil {
+			if !validPhotoKind(*req.Kind) {
+				writeError(w, http.StatusBadRequest, "kind must be stamp, scenery or receipt")
+				return
+			}
+			update.SetKind(*req.Kind)
+		}
+		if req.Cover {
+			update.SetCover()
+		}
+
+		photo, err = update.Save(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update photo")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"photo": photo,
+		})
+	}
+}
+
+// DeleteGoshuinPhoto 写真を削除します
+// ストレージのファイルは、他の写真から参照されていない場合のみ削除します
+func DeleteGoshuinPhoto(client *ent.Client, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := ownedCollectionFromPath(w, r, client, user.ID)
+		if !ok {
+			return
+		}
+
+		photo, ok := photoFromPath(w, r, client, id)
+		if !ok {
+			return
+		}
+
+		if err := client.GoshuinPhoto.DeleteOneID(photo.ID).Exec(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to delete photo")
+			return
+		}
+
+		trash.ReleasePhotoFile(r.Context(), client, store, photo)
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Photo deleted successfully",
+		})
+	}
+}
@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/proposals"
+	"stamp-backend/internal/storage"
+)
+
+// templeProposalRequest 寺社の提案のリクエスト
+type templeProposalRequest struct {
+	Name         string  `json:"name"`
+	NameEn       string  `json:"name_en"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	Prefecture   string  `json:"prefecture"`
+	Kind         string  `json:"kind"`
+	Address      string  `json:"address"`
+	Description  string  `json:"description"`
+	Website      string  `json:"website"`
+	OpeningHours string  `json:"opening_hours"`
+	GoshuinFee   string  `json:"goshuin_fee"`
+	PhotoURL     string  `json:"photo_url"`
+	Comment      string  `json:"comment"`
+	// ConfirmNew 「もしかして」の候補を確認したうえで新しい寺社として提案します
+	ConfirmNew bool `json:"confirm_new"`
+}
+
+// readTempleProposalForm multipart/form-data の項目を提案のリクエストに読み込みます
+func readTempleProposalForm(r *http.Request, req *templeProposalRequest) error {
+	for field, dest := range map[string]*float64{"latitude": &req.Latitude, "longitude": &req.Longitude} {
+		v := r.FormValue(field)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be a number", field)
+		}
+		*dest = f
+	}
+	req.Name = r.FormValue("name")
+	req.NameEn = r.FormValue("name_en")
+	req.Prefecture = r.FormValue("prefecture")
+	req.Kind = r.FormValue("kind")
+	req.Address = r.FormValue("address")
+	req.Description = r.FormValue("description")
+	req.Website = r.FormValue("website")
+	req.OpeningHours = r.FormValue("opening_hours")
+	req.GoshuinFee = r.FormValue("goshuin_fee")
+	req.Comment = r.FormValue("comment")
+	req.ConfirmNew, _ = strconv.ParseBool(r.FormValue("confirm_new"))
+	return nil
+}
+
+// CheckTempleProposal 提案しようとしている寺社と重複しそうな寺社・提案を返します
+// name と latitude・longitude（任意で name_en）を JSON で送ります
+func CheckTempleProposal(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := currentUser(w, r); !ok {
+			return
+		}
+
+		var req templeProposalRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || (req.Latitude == 0 && req.Longitude == 0) {
+			writeError(w, http.StatusBadRequest, "name, latitude and longitude are required")
+			return
+		}
+
+		candidates, err := proposals.Candidates(r.Context(), client, proposals.Query{
+			Name: req.Name, NameEn: strings.TrimSpace(req.NameEn), Latitude: req.Latitude, Longitude: req.Longitude,
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to check for similar temples")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"candidates": candidates,
+			"count":      len(candidates),
+		})
+	}
+}
+
+// CreateTempleProposal 新しい寺社を提案します
+// JSON（photo_url）か multipart/form-data（photo に写真）で、名前・座標・写真と任意の詳細を送ります
+// 近くに名前の似た寺社や審査中の提案がある場合は、confirm_new を指定しない限り
+// 候補を返して 409 になります
+func CreateTempleProposal(client *ent.Client, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		var req templeProposalRequest
+		var photo []byte
+		var photoExt string
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "multipart/form-data" {
+			if photo, photoExt, ok = readImageFile(w, r, "photo", true); !ok {
+				return
+			}
+			if err := readTempleProposalForm(r, &req); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		} else {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "Failed to read request body")
+				return
+			}
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON format")
+				return
+			}
+			if strings.TrimSpace(req.PhotoURL) == "" {
+				writeError(w, http.StatusBadRequest, "photo is required")
+				return
+			}
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		req.NameEn = strings.TrimSpace(req.NameEn)
+		if req.Name == "" || (req.Latitude == 0 && req.Longitude == 0) {
+			writeError(w, http.StatusBadRequest, "name, latitude and longitude are required")
+			return
+		}
+
+		if !req.ConfirmNew {
+			candidates, err := proposals.Candidates(r.Context(), client, proposals.Query{
+				Name: req.Name, NameEn: req.NameEn, Latitude: req.Latitude, Longitude: req.Longitude,
+			})
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to check for similar temples")
+				return
+			}
+			if len(candidates) > 0 {
+				writeJSON(w, http.StatusConflict, map[string]interface{}{
+					"error":      "Similar temples already exist; resubmit with confirm_new to propose it anyway",
+					"candidates": candidates,
+				})
+				return
+			}
+		}
+
+		var photoKey string
+		if photo != nil {
+			key, err := storage.PutHashed(r.Context(), store, "proposals/"+url.PathEscape(user.ID), photo, photoExt)
+			if err != nil {
+				log.Printf("proposal photo upload failed: %v", err)
+				writeError(w, http.StatusInternalServerError, "Failed to store photo")
+				return
+			}
+			photoKey, req.PhotoURL = key, store.URL(key)
+		}
+
+		proposal, err := client.TempleProposal.Create().
+			SetUserID(user.ID).
+			SetName(req.Name, req.NameEn).
+			SetLocation(req.Latitude, req.Longitude).
+			SetPrefecture(strings.TrimSpace(req.Prefecture)).
+			SetKind(req.Kind).
+			SetDetails(
+				strings.TrimSpace(req.Address), strings.TrimSpace(req.Description), strings.TrimSpace(req.Website),
+				strings.TrimSpace(req.OpeningHours), strings.TrimSpace(req.GoshuinFee),
+			).
+			SetPhoto(photoKey, strings.TrimSpace(req.PhotoURL)).
+			SetComment(strings.TrimSpace(req.Comment)).
+			Save(r.Context())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"proposal": proposal,
+		})
+	}
+}
+
+// proposalFromPath パスの提案IDから提案を取得します（index はIDの位置）
+func proposalFromPath(w http.ResponseWriter, r *http.Request, client *ent.Client, index int) (*ent.TempleProposal, bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) <= index {
+		writeError(w, http.StatusBadRequest, "Invalid proposal ID")
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(pathParts[index])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid proposal ID")
+		return nil, false
+	}
+
+	proposal, err := client.TempleProposal.Get(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Proposal not found")
+		return nil, false
+	}
+	return proposal, true
+}
+
+// AddTempleProposalEntry 提案中の寺社でいただいた御朱印を記録します
+// 提案が承認（またはマージ）されると御朱印コレクションに追加されます。承認済みの場合はすぐに追加されます
+func AddTempleProposalEntry(client *ent.Client, clk clock.Clock) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		proposal, ok := proposalFromPath(w, r, client, 4)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			ImageURL    string `json:"image_url"`
+			Notes       string `json:"notes"`
+			CollectedAt string `json:"collected_at"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+
+		collectedAt := clk.Now()
+		if req.CollectedAt != "" {
+			var err error
+			if collectedAt, err = parseCollectedAt(req.CollectedAt, clk.Now()); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		entry, err := client.TempleProposal.AddEntry(r.Context(), &ent.TempleProposalEntry{
+			ProposalID: proposal.ID,
+			UserID:     user.ID,
+			ImageURL:   strings.TrimSpace(req.ImageURL),
+			Notes:      req.Notes,
+		}, collectedAt)
+		if errors.Is(err, ent.ErrProposalRejected) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to add entry")
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"entry": entry,
+		})
+	}
+}
+
+// GetMyTempleProposals 自分が提案した寺社を新しい順に取得します
+func GetMyTempleProposals(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		list, err := client.TempleProposal.List(r.Context(), ent.TempleProposalFilter{UserID: user.ID})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch proposals")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"proposals": list,
+			"count":     len(list),
+		})
+	}
+}
+
+// GetTempleProposalQueue 寺社の提案のモデレーションキューを取得します（編集者以上）
+// status を省略すると未処理（pending）の提案を古い順に返します
+func GetTempleProposalQueue(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+
+		filter := ent.TempleProposalFilter{Status: r.URL.Query().Get("status")}
+		if filter.Status == "" {
+			filter.Status = ent.TempleProposalPending
+		}
+
+		list, err := client.TempleProposal.List(r.Context(), filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch proposals")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"proposals": list,
+			"count":     len(list),
+		})
+	}
+}
+
+// GetTempleProposal 提案を重複の候補と合わせて取得します（編集者以上）
+func GetTempleProposal(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+
+		proposal, ok := proposalFromPath(w, r, client, 5)
+		if !ok {
+			return
+		}
+
+		response := map[string]interface{}{
+			"proposal": proposal,
+		}
+		if proposal.Status == ent.TempleProposalPending {
+			candidates, err := proposals.Candidates(r.Context(), client, proposals.Query{
+				Name: proposal.Name, NameEn: proposal.NameEn, Latitude: proposal.Latitude, Longitude: proposal.Longitude,
+				ExcludeProposalID: proposal.ID,
+			})
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to check for similar temples")
+				return
+			}
+			response["candidates"] = candidates
+		}
+
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// ReviewTempleProposal 寺社の提案を承認・マージ・却下します（編集者以上）
+// 承認すると寺社が作成され、提案者が登録者として記録されます
+// マージでは temple_id で既存の寺社を指定します。承認・マージでは記録された御朱印がその寺社に追加されます
+func ReviewTempleProposal(client *ent.Client, status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reviewer, ok := requireRole(w, r, auth.RoleEditor)
+		if !ok {
+			return
+		}
+
+		proposal, ok := proposalFromPath(w, r, client, 5)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Note     string `json:"note"`
+			TempleID int    `json:"temple_id"`
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid JSON format")
+				return
+			}
+		}
+
+		review := ent.TempleProposalReview{
+			Status:     status,
+			ReviewerID: reviewer.ID,
+			Note:       strings.TrimSpace(req.Note),
+		}
+		if status == ent.TempleProposalMerged {
+			if req.TempleID == 0 {
+				writeError(w, http.StatusBadRequest, "temple_id is required")
+				return
+			}
+			if _, err := client.Temple.Get(r.Context(), req.TempleID); err != nil {
+				writeError(w, http.StatusBadRequest, "Temple not found")
+				return
+			}
+			review.TempleID = req.TempleID
+		}
+
+		result, err := client.TempleProposal.Review(r.Context(), proposal.ID, review)
+		if errors.Is(err, ent.ErrProposalAlreadyReviewed) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to review proposal")
+			return
+		}
+
+		notifyProposalReviewed(r.Context(), client, result)
+
+		response := map[string]interface{}{
+			"proposal": result.Proposal,
+			"linked":   len(result.Linked),
+		}
+		if result.Temple != nil {
+			response["temple"] = result.Temple
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// notifyProposalReviewed 提案者に審査結果を、御朱印を記録したユーザーにコレクションへの追加を通知します
+func notifyProposalReviewed(ctx context.Context, client *ent.Client, result *ent.TempleProposalResult) {
+	proposal := result.Proposal
+	outcome := map[string]string{
+		ent.TempleProposalApproved: "was added",
+		ent.TempleProposalMerged:   "matched an existing temple",
+		ent.TempleProposalRejected: "was not accepted",
+	}[proposal.Status]
+
+	notify := func(n *ent.Notification) {
+		if err := client.Notification.Notify(ctx, n); err != nil {
+			log.Printf("Failed to notify %s of proposal %d: %v", n.UserID, proposal.ID, err)
+		}
+	}
+
+	notify(&ent.Notification{
+		UserID: proposal.UserID,
+		Kind:   "temple_proposal_" + proposal.Status,
+		Title:  fmt.Sprintf("Your proposed temple %s %s", proposal.Name, outcome),
+		Body:   proposal.ReviewNote,
+		Data: map[string]interface{}{
+			"proposal_id": proposal.ID,
+			"temple_id":   proposal.TempleID,
+			"status":      proposal.Status,
+		},
+	})
+
+	if result.Temple == nil {
+		return
+	}
+	collections := map[string][]int{}
+	var users []string
+	for _, e := range result.Linked {
+		if _, ok := collections[e.UserID]; !ok {
+			users = append(users, e.UserID)
+		}
+		collections[e.UserID] = append(collections[e.UserID], e.CollectionID)
+	}
+	for _, userID := range users {
+		notify(&ent.Notification{
+			UserID: userID,
+			Kind:   "temple_proposal_entries_linked",
+			Title:  fmt.Sprintf("Your goshuin at %s were added to your collection", result.Temple.Name),
+			Data: map[string]interface{}{
+				"proposal_id":    proposal.ID,
+				"temple_id":      result.Temple.ID,
+				"collection_ids": collections[userID],
+			},
+		})
+	}
+}
@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/i18n"
+	"stamp-backend/internal/quiz"
+)
+
+// quizBanks 有効な問題を節ごとに、要求された言語で最も優先される問題集にまとめます
+// 節は公開中でクイズのあるものだけを、ガイドの順番で返します
+func quizBanks(ctx context.Context, client *ent.Client, pref i18n.Preference) ([]string, map[string][]*ent.QuizQuestion, error) {
+	slugs, err := client.Quiz.QuizzedSections(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	questions, err := client.Quiz.Questions(ctx, ent.QuizFilter{ActiveOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 問題は節・言語の順に並んでいるので、節と言語の組ごとに代表の1問で言語を選びます
+	var heads []*ent.QuizQuestion
+	for i, q := range questions {
+		if i == 0 || q.SectionSlug != questions[i-1].SectionSlug || q.Locale != questions[i-1].Locale {
+			heads = append(heads, q)
+		}
+	}
+	locales := map[string]string{}
+	for _, i := range pickByLocale(len(heads), func(i int) (string, string) {
+		return heads[i].SectionSlug, heads[i].Locale
+	}, pref.Chain) {
+		locales[heads[i].SectionSlug] = heads[i].Locale
+	}
+
+	banks := map[string][]*ent.QuizQuestion{}
+	for _, q := range questions {
+		if locales[q.SectionSlug] == q.Locale {
+			banks[q.SectionSlug] = append(banks[q.SectionSlug], q)
+		}
+	}
+	var available []string
+	for _, slug := range slugs {
+		if len(banks[slug]) > 0 {
+			available = append(available, slug)
+		}
+	}
+	return available, banks, nil
+}
+
+// quizSlugFromPath パスの節の slug を取得します
+func quizSlugFromPath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 6 || pathParts[5] == "" {
+		writeError(w, http.StatusBadRequest, "Invalid section")
+		return "", false
+	}
+	return pathParts[5], true
+}
+
+// GetGuideQuizzes クイズのある節の一覧を取得します
+// 節ごとに lang パラメータまたは Accept-Language で最も優先される言語の問題集を選びます
+func GetGuideQuizzes(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pref := i18n.FromRequest(r)
+		slugs, banks, err := quizBanks(r.Context(), client, pref)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch quizzes")
+			return
+		}
+
+		var served i18n.Served
+		quizzes := []map[string]interface{}{}
+		for _, slug := range slugs {
+			locale := banks[slug][0].Locale
+			served.Add(locale)
+			quizzes = append(quizzes, map[string]interface{}{
+				"section":   slug,
+				"locale":    locale,
+				"questions": len(banks[slug]),
+			})
+		}
+
+		served.SetHeader(w)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"quizzes":    quizzes,
+			"pass_score": quiz.PassScore,
+		})
+	}
+}
+
+// GetGuideQuiz 節のクイズを正解を除いて取得します
+// 選択問題で multiple が true のものは正解が複数あり、並べ替え問題は全ての選択肢を正しい順に並べます
+func GetGuideQuiz(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slug, ok := quizSlugFromPath(w, r)
+		if !ok {
+			return
+		}
+		_, banks, err := quizBanks(r.Context(), client, i18n.FromRequest(r))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch quiz")
+			return
+		}
+		bank := banks[slug]
+		if len(bank) == 0 {
+			writeError(w, http.StatusNotFound, "Quiz not found")
+			return
+		}
+
+		questions := []map[string]interface{}{}
+		for _, q := range bank {
+			questions = append(questions, map[string]interface{}{
+				"id":       q.ID,
+				"kind":     q.Kind,
+				"prompt":   q.Prompt,
+				"choices":  q.Choices,
+				"multiple": q.Kind == ent.QuizKindChoice && len(q.Answer) > 1,
+			})
+		}
+
+		served := i18n.Served{}
+		served.Add(bank[0].Locale)
+		served.SetHeader(w)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"section":    slug,
+			"locale":     bank[0].Locale,
+			"pass_score": quiz.PassScore,
+			"questions":  questions,
+		})
+	}
+}
+
+// SubmitQuizAttempt 節のクイズの回答を採点し、結果と進み具合を記録します
+// locale は GET で受け取った問題集の言語で、省略すると要求された言語で選び直します
+func SubmitQuizAttempt(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+		slug, ok := quizSlugFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Locale  string           `json:"locale"`
+			Answers []ent.QuizAnswer `json:"answers"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+
+		var bank []*ent.QuizQuestion
+		if req.Locale != "" {
+			if !i18n.Valid(req.Locale) {
+				writeError(w, http.StatusBadRequest, "Invalid locale")
+				return
+			}
+			questions, err := client.Quiz.Questions(r.Context(), ent.QuizFilter{
+				SectionSlug: slug, Locale: i18n.Canonical(req.Locale), ActiveOnly: true,
+			})
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to fetch quiz")
+				return
+			}
+			bank = questions
+		} else {
+			_, banks, err := quizBanks(r.Context(), client, i18n.FromRequest(r))
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "Failed to fetch quiz")
+				return
+			}
+			bank = banks[slug]
+		}
+		if len(bank) == 0 {
+			writeError(w, http.StatusNotFound, "Quiz not found")
+			return
+		}
+
+		result, err := quiz.Grade(bank, req.Answers)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		progress, err := client.Quiz.RecordAttempt(r.Context(), &ent.QuizAttempt{
+			UserID:      user.ID,
+			SectionSlug: slug,
+			Locale:      bank[0].Locale,
+			Answers:     req.Answers,
+			Score:       result.Score,
+			Passed:      result.Passed,
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to record attempt")
+			return
+		}
+		status, err := quiz.UserStatus(r.Context(), client, user.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch guide progress")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"result":   result,
+			"progress": progress,
+			"guide":    status,
+		})
+	}
+}
+
+// GetMyGuideProgress ログインユーザーのクイズの進み具合とガイドの修了状況を取得します
+func GetMyGuideProgress(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		status, err := quiz.UserStatus(r.Context(), client, user.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch guide progress")
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	}
+}
+
+// guideNudge 御朱印の登録時にガイドを修了していなければ修了状況を返します（nil なら案内不要）
+func guideNudge(ctx context.Context, client *ent.Client, userID string) *quiz.Status {
+	status, err := quiz.UserStatus(ctx, client, userID)
+	if err != nil || status.Total == 0 || status.Completed {
+		return nil
+	}
+	return status
+}
+
+// questionIDFromPath パスの問題IDを取得します
+func questionIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 6 {
+		writeError(w, http.StatusBadRequest, "Invalid question ID")
+		return 0, false
+	}
+	id, err := strconv.Atoi(pathParts[5])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid question ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// GetQuizQuestions 問題を正解・無効なものも含めて取得します（編集者以上）
+// section と locale で絞り込めます
+func GetQuizQuestions(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+
+		filter := ent.QuizFilter{SectionSlug: r.URL.Query().Get("section")}
+		if v := r.URL.Query().Get("locale"); v != "" {
+			filter.Locale = i18n.Canonical(v)
+		}
+		questions, err := client.Quiz.Questions(r.Context(), filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch questions")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"questions": questions,
+			"count":     len(questions),
+		})
+	}
+}
+
+// GetQuizQuestion 問題を取得します（編集者以上）
+func GetQuizQuestion(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+		id, ok := questionIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		question, err := client.Quiz.Question(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "Question not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"question": question,
+		})
+	}
+}
+
+// quizQuestionRequest 問題の作成・更新のリクエスト（更新では指定した項目だけを変更します）
+type quizQuestionRequest struct {
+	SectionSlug *string   `json:"section_slug"`
+	Locale      *string   `json:"locale"`
+	Kind        *string   `json:"kind"`
+	Prompt      *string   `json:"prompt"`
+	Choices     *[]string `json:"choices"`
+	Answer      *[]int    `json:"answer"`
+	Explanation *string   `json:"explanation"`
+	Position    *int      `json:"position"`
+	Active      *bool     `json:"active"`
+}
+
+// apply リクエストの項目を問題に設定します
+func (req quizQuestionRequest) apply(q *ent.QuizQuestion) {
+	if req.SectionSlug != nil {
+		q.SectionSlug = strings.TrimSpace(*req.SectionSlug)
+	}
+	if req.Locale != nil {
+		q.Locale = i18n.Canonical(strings.TrimSpace(*req.Locale))
+	}
+	if req.Kind != nil {
+		q.Kind = *req.Kind
+	}
+	if req.Prompt != nil {
+		q.Prompt = strings.TrimSpace(*req.Prompt)
+	}
+	if req.Choices != nil {
+		q.Choices = *req.Choices
+	}
+	if req.Answer != nil {
+		q.Answer = *req.Answer
+	}
+	if req.Explanation != nil {
+		q.Explanation = strings.TrimSpace(*req.Explanation)
+	}
+	if req.Position != nil {
+		q.Position = *req.Position
+	}
+	if req.Active != nil {
+		q.Active = *req.Active
+	}
+}
+
+// guideSectionExists 指定した slug の節がいずれかの言語にあるか確認します
+func guideSectionExists(ctx context.Context, client *ent.Client, slug string) (bool, error) {
+	sections, err := client.Guide.Sections(ctx, ent.GuideFilter{})
+	if err != nil {
+		return false, err
+	}
+	for _, s := range sections {
+		if s.Slug == slug {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// saveQuizQuestion 問題の節と言語を確認してから保存します
+func saveQuizQuestion(w http.ResponseWriter, r *http.Request, client *ent.Client, q *ent.QuizQuestion, status int) {
+	if q.Locale != "" && !i18n.Valid(q.Locale) {
+		writeError(w, http.StatusBadRequest, "locale must be a language tag such as zh-TW")
+		return
+	}
+	exists, err := guideSectionExists(r.Context(), client, q.SectionSlug)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to fetch guide")
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusBadRequest, "section_slug must be a guide section")
+		return
+	}
+
+	save := client.Quiz.CreateQuestion
+	if q.ID > 0 {
+		save = client.Quiz.UpdateQuestion
+	}
+	saved, err := save(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"question": saved,
+	})
+}
+
+// CreateQuizQuestion 節の問題集に問題を追加します（編集者以上）
+func CreateQuizQuestion(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+
+		var req quizQuestionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+		q := &ent.QuizQuestion{Active: true}
+		req.apply(q)
+		saveQuizQuestion(w, r, client, q, http.StatusCreated)
+	}
+}
+
+// UpdateQuizQuestion 問題を更新します（編集者以上）
+func UpdateQuizQuestion(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+		id, ok := questionIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		q, err := client.Quiz.Question(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "Question not found")
+			return
+		}
+
+		var req quizQuestionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+		req.apply(q)
+		saveQuizQuestion(w, r, client, q, http.StatusOK)
+	}
+}
+
+// DeleteQuizQuestion 問題を削除します（編集者以上）
+// 過去の回答の得点と合格は変わりません
+func DeleteQuizQuestion(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+		id, ok := questionIDFromPath(w, r)
+		if !ok {
+			return
+		}
+		if _, err := client.Quiz.Question(r.Context(), id); err != nil {
+			writeError(w, http.StatusNotFound, "Question not found")
+			return
+		}
+
+		if err := client.Quiz.DeleteQuestion(r.Context(), id); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to delete question")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Question deleted successfully",
+		})
+	}
+}
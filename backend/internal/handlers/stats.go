@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"stamp-backend/internal/ent"
+)
+
+// GetMyStats ログインユーザーの御朱印コレクションの統計を取得します
+func GetMyStats(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		stats, err := client.GoshuinCollection.Stats(r.Context(), user.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to compute statistics")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"stats": stats,
+		})
+	}
+}
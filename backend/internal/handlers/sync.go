@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"stamp-backend/internal/delta"
+)
+
+// 変更の取得件数
+const (
+	defaultSyncLimit = 100
+	maxSyncLimit     = 500
+)
+
+// GetSyncChanges since（前回の cursor）より後の御朱印の変更を取得します
+// 御朱印ごとに最新の変更だけを返し、upsert には現在の状態と項目ごとの変更日時を含めます
+// has_more が true の間は cursor を since に指定して続きを取得します
+func GetSyncChanges(engine *delta.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		var since int64
+		if v := r.URL.Query().Get("since"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, "since must be a sync cursor")
+				return
+			}
+			since = n
+		}
+		limit := defaultSyncLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxSyncLimit {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxSyncLimit))
+				return
+			}
+			limit = n
+		}
+
+		page, err := engine.Pull(r.Context(), user.ID, since, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch changes")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+// PushSyncMutations 端末で溜めた御朱印の変更をまとめて適用します
+// 変更は送信順に適用し、項目ごとに新しい方を残します。サーバーの値が残った項目は conflicts に返します
+// 適用済みの変更（同じ id）は再び適用せず、前回と同じ結果を返します
+func PushSyncMutations(engine *delta.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		var req struct {
+			Mutations []delta.Mutation `json:"mutations"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+		if len(req.Mutations) == 0 {
+			writeError(w, http.StatusBadRequest, "mutations is required")
+			return
+		}
+		if len(req.Mutations) > delta.MaxBatch {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("At most %d mutations can be pushed at once", delta.MaxBatch))
+			return
+		}
+
+		results, err := engine.Push(r.Context(), user.ID, req.Mutations)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to apply mutations")
+			return
+		}
+
+		conflicts := []delta.Conflict{}
+		for _, res := range results {
+			conflicts = append(conflicts, res.Conflicts...)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"results":   results,
+			"conflicts": conflicts,
+		})
+	}
+}
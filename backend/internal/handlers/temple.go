@@ -1,30 +1,102 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
 	"stamp-backend/internal/ent"
+	"stamp-backend/internal/i18n"
 )
 
 // GetTemples 寺社一覧を取得します
 func GetTemples(client *ent.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		temples, err := client.Temple.Query().All(r.Context())
+		filter, err := ParseTempleFilter(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		temples, err := client.Temple.Query().Filter(filter).All(r.Context())
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, "Failed to fetch temples")
 			return
 		}
 
+		var served i18n.Served
+		if err := localizeTemples(r.Context(), client, i18n.FromRequest(r), &served, temples...); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch translations")
+			return
+		}
+		served.SetHeader(w)
+
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"temples": temples,
 		})
 	}
 }
 
+// ParseTempleFilter クエリパラメータから寺社の検索条件を組み立てます
+// 一覧API・エクスポートAPI・cmd/export で同じ条件を使います
+func ParseTempleFilter(q url.Values) (ent.TempleFilter, error) {
+	filter := ent.TempleFilter{
+		Search:     strings.TrimSpace(q.Get("q")),
+		Prefecture: q.Get("prefecture"),
+		Kind:       q.Get("kind"),
+	}
+
+	if filter.Kind != "" && filter.Kind != ent.TempleKindTemple && filter.Kind != ent.TempleKindShrine {
+		return filter, fmt.Errorf("kind must be temple or shrine")
+	}
+
+	if bbox := q.Get("bbox"); bbox != "" {
+		box, err := ent.ParseBBox(bbox)
+		if err != nil {
+			return filter, err
+		}
+		filter.BBox = box
+	}
+
+	if inactive := q.Get("include_inactive"); inactive != "" {
+		v, err := strconv.ParseBool(inactive)
+		if err != nil {
+			return filter, fmt.Errorf("include_inactive must be a boolean")
+		}
+		filter.IncludeInactive = v
+	}
+
+	// 御朱印の手続きで絞り込みます（値が登録されていない寺社は含みません）
+	for _, p := range []struct {
+		name string
+		dest **bool
+	}{
+		{"reservation_required", &filter.Procedure.ReservationRequired},
+		{"kakioki_only", &filter.Procedure.KakiokiOnly},
+		{"book_drop_off", &filter.Procedure.BookDropOff},
+		{"cash_only", &filter.Procedure.CashOnly},
+	} {
+		if v := q.Get(p.name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be a boolean", p.name)
+			}
+			*p.dest = &b
+		}
+	}
+	if photography := q.Get("photography"); photography != "" {
+		if !ent.ValidPhotography(photography) {
+			return filter, fmt.Errorf("photography must be allowed, restricted or prohibited")
+		}
+		filter.Procedure.Photography = photography
+	}
+
+	return filter, nil
+}
+
 // GetTemple 特定の寺社を取得します
 func GetTemple(client *ent.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -47,6 +119,13 @@ func GetTemple(client *ent.Client) http.HandlerFunc {
 			return
 		}
 
+		var served i18n.Served
+		if err := localizeTemples(r.Context(), client, i18n.FromRequest(r), &served, temple); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch translations")
+			return
+		}
+		served.SetHeader(w)
+
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"temple": temple,
 		})
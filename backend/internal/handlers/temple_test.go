@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"stamp-backend/internal/ent"
+)
+
+func TestParseTempleFilter(t *testing.T) {
+	yes, no := true, false
+	q, _ := url.ParseQuery("q=+浅草+&prefecture=東京都&kind=temple&bbox=139.7,35.6,139.8,35.8&include_inactive=1" +
+		"&reservation_required=true&kakioki_only=false&photography=restricted")
+	got, err := ParseTempleFilter(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ent.TempleFilter{
+		Search:          "浅草",
+		Prefecture:      "東京都",
+		Kind:            ent.TempleKindTemple,
+		BBox:            &ent.BBox{MinLng: 139.7, MinLat: 35.6, MaxLng: 139.8, MaxLat: 35.8},
+		IncludeInactive: true,
+		Procedure:       ent.ProcedureFilter{ReservationRequired: &yes, KakiokiOnly: &no, Photography: "restricted"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTempleFilter = %+v; want %+v", got, want)
+	}
+
+	for _, query := range []string{
+		"kind=castle",
+		"bbox=1,2,3",
+		"include_inactive=maybe",
+		"cash_only=yes",
+		"photography=sometimes",
+	} {
+		q, _ := url.ParseQuery(query)
+		if _, err := ParseTempleFilter(q); err == nil {
+			t.Errorf("ParseTempleFilter(%s) returned no error", query)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/i18n"
+)
+
+// templeColumnValues 寺社の列に保存されている言語ごとの値を返します
+func templeColumnValues(t *ent.Temple, field string) map[string]string {
+	values := map[string]string{}
+	switch field {
+	case "name":
+		values[i18n.Japanese], values[i18n.English] = t.Name, t.NameEn
+	case "description":
+		values[i18n.Japanese], values[i18n.English] = t.Description, t.DescriptionEn
+	case "address":
+		values[i18n.Japanese] = t.Address
+	case "opening_hours":
+		values[i18n.Japanese] = t.OpeningHours
+	case "goshuin_fee":
+		values[i18n.Japanese] = t.GoshuinFee
+	case "goshuin_office":
+		values[i18n.Japanese] = t.GoshuinOffice
+	case "procedure_notes":
+		values[i18n.Japanese] = t.ProcedureNotes
+	}
+	return values
+}
+
+// localizeTemples 寺社の翻訳対象の項目を要求された言語で localized に設定し、使った言語を served に記録します
+func localizeTemples(ctx context.Context, client *ent.Client, pref i18n.Preference, served *i18n.Served, temples ...*ent.Temple) error {
+	if len(temples) == 0 {
+		return nil
+	}
+	ids := make([]int, len(temples))
+	for i, t := range temples {
+		ids[i] = t.ID
+	}
+	translations, err := client.Translation.Load(ctx, ent.TypeTemple, ids, pref.Chain)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range temples {
+		t.Localized = map[string]ent.LocalizedValue{}
+		for _, field := range ent.TranslatableFields[ent.TypeTemple] {
+			values := translations.Values(t.ID, field)
+			for locale, v := range templeColumnValues(t, field) {
+				values[locale] = v
+			}
+			if value, locale := i18n.Pick(pref.Chain, values); locale != "" {
+				t.Localized[field] = ent.LocalizedValue{Value: value, Locale: locale}
+				served.Add(locale)
+			}
+		}
+	}
+	return nil
+}
+
+// GetTranslations 項目の翻訳を取得します（編集者以上）
+// entity_type は必須で、entity_id と locale で絞り込めます
+func GetTranslations(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+
+		q := r.URL.Query()
+		filter := ent.TranslationFilter{EntityType: q.Get("entity_type")}
+		if _, ok := ent.TranslatableFields[filter.EntityType]; !ok {
+			writeError(w, http.StatusBadRequest, "entity_type must be a translatable type")
+			return
+		}
+		if v := q.Get("entity_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "entity_id must be an integer")
+				return
+			}
+			filter.EntityIDs = []int{id}
+		}
+		if v := q.Get("locale"); v != "" {
+			if !i18n.Valid(v) {
+				writeError(w, http.StatusBadRequest, "Invalid locale")
+				return
+			}
+			filter.Locales = []string{i18n.Canonical(v)}
+		}
+
+		translations, err := client.Translation.List(r.Context(), filter)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch translations")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"translations": translations,
+			"count":        len(translations),
+			"fields":       ent.TranslatableFields[filter.EntityType],
+		})
+	}
+}
+
+// PutTranslation 項目の翻訳を作成または更新します（編集者以上）
+func PutTranslation(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+
+		var req ent.Translation
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON format")
+			return
+		}
+		if !i18n.Valid(req.Locale) {
+			writeError(w, http.StatusBadRequest, "locale must be a language tag such as zh-TW")
+			return
+		}
+		req.Locale = i18n.Canonical(req.Locale)
+
+		if req.EntityType == ent.TypeTemple {
+			if _, err := client.Temple.Get(r.Context(), req.EntityID); err != nil {
+				writeError(w, http.StatusNotFound, "Temple not found")
+				return
+			}
+		}
+
+		translation, err := client.Translation.Set(r.Context(), &ent.Translation{
+			EntityType: req.EntityType,
+			EntityID:   req.EntityID,
+			Field:      req.Field,
+			Locale:     req.Locale,
+			Value:      strings.TrimSpace(req.Value),
+		})
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"translation": translation,
+		})
+	}
+}
+
+// DeleteTranslation 翻訳を削除します（編集者以上）
+func DeleteTranslation(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleEditor); !ok {
+			return
+		}
+
+		pathParts := strings.Split(r.URL.Path, "/")
+		if len(pathParts) < 5 {
+			writeError(w, http.StatusBadRequest, "Invalid translation ID")
+			return
+		}
+		id, err := strconv.Atoi(pathParts[4])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid translation ID")
+			return
+		}
+
+		if _, err := client.Translation.Get(r.Context(), id); err != nil {
+			writeError(w, http.StatusNotFound, "Translation not found")
+			return
+		}
+		if err := client.Translation.Delete(r.Context(), id); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to delete translation")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Translation deleted successfully",
+		})
+	}
+}
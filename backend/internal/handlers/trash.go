@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/storage"
+	"stamp-backend/internal/trash"
+)
+
+// trashedCollectionFromPath パスの御朱印IDを取得し、ユーザーのゴミ箱にあるか確認します
+func trashedCollectionFromPath(w http.ResponseWriter, r *http.Request, client *ent.Client, userID string, index int) (int, bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) <= index {
+		writeError(w, http.StatusBadRequest, "Invalid collection ID")
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(pathParts[index])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid collection ID")
+		return 0, false
+	}
+
+	collection, err := client.GoshuinCollection.GetTrashed(r.Context(), id)
+	if err != nil || collection.UserID != userID {
+		writeError(w, http.StatusNotFound, "Goshuin collection not found in trash")
+		return 0, false
+	}
+	return id, true
+}
+
+// GetTrash ゴミ箱の御朱印を削除日時の新しい順に取得します
+// purge_at は完全に削除される予定日時です
+func GetTrash(client *ent.Client, purger *trash.Purger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		collections, err := client.GoshuinCollection.Query().
+			Filter(ent.GoshuinCollectionFilter{UserID: user.ID, Trashed: true}).
+			WithTemple().
+			All(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to fetch trash")
+			return
+		}
+
+		items := make([]map[string]interface{}, 0, len(collections))
+		for _, collection := range collections {
+			items = append(items, map[string]interface{}{
+				"collection": collection,
+				"purge_at":   purger.PurgeAt(collection.DeletedAt),
+			})
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"items": items,
+			"count": len(items),
+		})
+	}
+}
+
+// RestoreGoshuinCollection ゴミ箱の御朱印を元に戻します
+func RestoreGoshuinCollection(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := trashedCollectionFromPath(w, r, client, user.ID, 4)
+		if !ok {
+			return
+		}
+
+		collection, err := client.GoshuinCollection.Restore(r.Context(), id)
+		if errors.Is(err, ent.ErrNotInTrash) {
+			writeError(w, http.StatusNotFound, "Goshuin collection not found in trash")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to restore goshuin collection")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"collection": collection,
+		})
+	}
+}
+
+// PurgeGoshuinCollection ゴミ箱の御朱印を保持期間を待たずに完全に削除します
+func PurgeGoshuinCollection(client *ent.Client, store storage.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := currentUser(w, r)
+		if !ok {
+			return
+		}
+
+		id, ok := trashedCollectionFromPath(w, r, client, user.ID, 5)
+		if !ok {
+			return
+		}
+
+		err := trash.PurgeCollection(r.Context(), client, store, id)
+		if errors.Is(err, ent.ErrNotInTrash) {
+			writeError(w, http.StatusNotFound, "Goshuin collection not found in trash")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to delete goshuin collection")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Goshuin collection permanently deleted",
+		})
+	}
+}
+
+// templeIDFromPath パスの寺社IDを取得します
+func templeIDFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	if len(pathParts) < 5 {
+		writeError(w, http.StatusBadRequest, "Invalid temple ID")
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(pathParts[4])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid temple ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// DeleteTemple 寺社を削除します（管理者のみ）
+// 寺社は一覧や検索から外れますが、ユーザーの御朱印はそのまま残ります
+func DeleteTemple(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleAdmin); !ok {
+			return
+		}
+
+		id, ok := templeIDFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		if _, err := client.Temple.Get(r.Context(), id); err != nil {
+			writeError(w, http.StatusNotFound, "Temple not found")
+			return
+		}
+
+		if err := client.Temple.DeleteOneID(id).Exec(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to delete temple")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Temple deleted successfully",
+		})
+	}
+}
+
+// RestoreTemple 削除した寺社を元に戻します（管理者のみ）
+func RestoreTemple(client *ent.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requireRole(w, r, auth.RoleAdmin); !ok {
+			return
+		}
+
+		id, ok := templeIDFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		temple, err := client.Temple.Restore(r.Context(), id)
+		if errors.Is(err, ent.ErrNotInTrash) {
+			writeError(w, http.StatusNotFound, "Deleted temple not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to restore temple")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"temple": temple,
+		})
+	}
+}
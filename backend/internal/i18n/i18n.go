@@ -0,0 +1,176 @@
+// Package i18n リクエストの言語を判定し、翻訳のフォールバックチェーンを組み立てます
+package i18n
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 基本の言語
+const (
+	// Japanese 寺社情報の元の言語
+	Japanese = "ja"
+	// English 英語（name_en などの列と、ガイドの元の言語）
+	English = "en"
+)
+
+// DefaultFallback どの言語を要求されても最後に試す言語
+var DefaultFallback = []string{English, Japanese}
+
+// localePattern BCP 47 の言語タグとして受け付ける形式
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// Valid 言語タグとして正しい形式か判定します
+func Valid(locale string) bool {
+	return localePattern.MatchString(locale)
+}
+
+// Canonical 言語タグの大文字小文字を揃えます（zh-tw → zh-TW、zh-hant → zh-Hant）
+func Canonical(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(locale, "_", "-"), "-")
+	for i, p := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(p)
+		case len(p) == 2:
+			parts[i] = strings.ToUpper(p)
+		case len(p) == 4:
+			parts[i] = strings.ToUpper(p[:1]) + strings.ToLower(p[1:])
+		default:
+			parts[i] = strings.ToLower(p)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Chain 要求された言語を順に、サブタグを1つずつ落としながら並べ、DefaultFallback を加えます
+// 例: [zh-TW] → zh-TW, zh, en, ja
+func Chain(locales ...string) []string {
+	var chain []string
+	seen := map[string]bool{}
+	add := func(l string) {
+		if !seen[l] {
+			seen[l] = true
+			chain = append(chain, l)
+		}
+	}
+	for _, l := range locales {
+		if !Valid(l) {
+			continue
+		}
+		parts := strings.Split(Canonical(l), "-")
+		for n := len(parts); n > 0; n-- {
+			add(strings.Join(parts[:n], "-"))
+		}
+	}
+	for _, l := range DefaultFallback {
+		add(l)
+	}
+	return chain
+}
+
+// Preference リクエストから判定した言語の優先順位
+type Preference struct {
+	// Requested 要求された言語（優先度順）。指定がなければ空です
+	Requested []string
+	// Chain 翻訳を探す順番
+	Chain []string
+}
+
+// FromRequest lang パラメータ、なければ Accept-Language ヘッダーから言語の優先順位を判定します
+// どちらもない場合は日本語を優先します
+func FromRequest(r *http.Request) Preference {
+	var requested []string
+	if lang := strings.TrimSpace(r.URL.Query().Get("lang")); lang != "" {
+		for _, l := range strings.Split(lang, ",") {
+			if l = strings.TrimSpace(l); Valid(l) {
+				requested = append(requested, Canonical(l))
+			}
+		}
+	} else {
+		requested = parseAcceptLanguage(r.Header.Get("Accept-Language"))
+	}
+
+	if len(requested) == 0 {
+		return Preference{Chain: Chain(Japanese)}
+	}
+	return Preference{Requested: requested, Chain: Chain(requested...)}
+}
+
+// parseAcceptLanguage Accept-Language の言語を q 値の高い順に返します（* と q=0 は除きます）
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		locale := strings.TrimSpace(fields[0])
+		if locale == "" || locale == "*" || !Valid(locale) {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			langs = append(langs, weighted{Canonical(locale), q})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	locales := make([]string, len(langs))
+	for i, l := range langs {
+		locales[i] = l.locale
+	}
+	return locales
+}
+
+// Pick チェーンの順に値のある言語を探し、値と実際に使った言語を返します
+func Pick(chain []string, values map[string]string) (string, string) {
+	for _, l := range chain {
+		if v := values[l]; v != "" {
+			return v, l
+		}
+	}
+	return "", ""
+}
+
+// Served 実際に使った言語を記録し、Content-Language ヘッダーの値にします
+type Served struct {
+	locales []string
+}
+
+// Add 使った言語を追加します
+func (s *Served) Add(locale string) {
+	if locale == "" {
+		return
+	}
+	for _, l := range s.locales {
+		if l == locale {
+			return
+		}
+	}
+	s.locales = append(s.locales, locale)
+}
+
+// Locales 使った言語を最初に使った順に返します
+func (s *Served) Locales() []string {
+	return s.locales
+}
+
+// SetHeader Content-Language と Vary ヘッダーを設定します
+func (s *Served) SetHeader(w http.ResponseWriter) {
+	w.Header().Add("Vary", "Accept-Language")
+	if len(s.locales) > 0 {
+		w.Header().Set("Content-Language", strings.Join(s.locales, ", "))
+	}
+}
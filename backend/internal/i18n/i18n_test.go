@@ -0,0 +1,94 @@
+package i18n
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	cases := map[string]string{
+		"JA":         "ja",
+		"zh-tw":      "zh-TW",
+		"zh_hant_tw": "zh-Hant-TW",
+		"en-US":      "en-US",
+		"sr-LATN":    "sr-Latn",
+	}
+	for in, want := range cases {
+		if got := Canonical(in); got != want {
+			t.Errorf("Canonical(%q) = %q; want %q", in, got, want)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	cases := []struct {
+		locales []string
+		want    []string
+	}{
+		{nil, []string{"en", "ja"}},
+		{[]string{"ja"}, []string{"ja", "en"}},
+		{[]string{"zh-tw"}, []string{"zh-TW", "zh", "en", "ja"}},
+		{[]string{"zh-Hant-TW", "ko"}, []string{"zh-Hant-TW", "zh-Hant", "zh", "ko", "en", "ja"}},
+		{[]string{"fr-CA", "fr", "en-GB"}, []string{"fr-CA", "fr", "en-GB", "en", "ja"}},
+		{[]string{"not a locale", "de"}, []string{"de", "en", "ja"}},
+	}
+	for _, c := range cases {
+		if got := Chain(c.locales...); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Chain(%q) = %q; want %q", c.locales, got, c.want)
+		}
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	cases := []struct {
+		name           string
+		url            string
+		acceptLanguage string
+		want           Preference
+	}{
+		{"default", "/", "", Preference{Chain: []string{"ja", "en"}}},
+		{"lang", "/?lang=ko,zh-tw", "fr", Preference{Requested: []string{"ko", "zh-TW"}, Chain: []string{"ko", "zh-TW", "zh", "en", "ja"}}},
+		{"accept language", "/", "fr;q=0.5, de-AT, *;q=0.1, es;q=0", Preference{Requested: []string{"de-AT", "fr"}, Chain: []string{"de-AT", "de", "fr", "en", "ja"}}},
+		{"invalid", "/?lang=%21%21", "", Preference{Chain: []string{"ja", "en"}}},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, c.url, nil)
+		if c.acceptLanguage != "" {
+			r.Header.Set("Accept-Language", c.acceptLanguage)
+		}
+		if got := FromRequest(r); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: FromRequest = %+v; want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPickAndServed(t *testing.T) {
+	values := map[string]string{"ja": "浅草寺", "en": "Senso-ji", "zh": ""}
+	var served Served
+	for _, c := range []struct {
+		chain      []string
+		want, lang string
+	}{
+		{[]string{"zh-TW", "zh", "en", "ja"}, "Senso-ji", "en"},
+		{[]string{"ja", "en"}, "浅草寺", "ja"},
+		{[]string{"ko", "en", "ja"}, "Senso-ji", "en"},
+		{[]string{"ko"}, "", ""},
+	} {
+		got, lang := Pick(c.chain, values)
+		if got != c.want || lang != c.lang {
+			t.Errorf("Pick(%q) = %q, %q; want %q, %q", c.chain, got, lang, c.want, c.lang)
+		}
+		served.Add(lang)
+	}
+
+	rec := httptest.NewRecorder()
+	served.SetHeader(rec)
+	if got := rec.Header().Get("Content-Language"); got != "en, ja" {
+		t.Errorf("Content-Language = %q; want %q", got, "en, ja")
+	}
+	if got := rec.Header().Get("Vary"); got != "Accept-Language" {
+		t.Errorf("Vary = %q; want Accept-Language", got)
+	}
+}
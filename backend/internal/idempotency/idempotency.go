@@ -0,0 +1,305 @@
+// Package idempotency Idempotency-Key ヘッダー付きの変更リクエストの応答を保存し、再送に同じ応答を返します
+//
+// 電波の弱い境内で保存ボタンを二度押したり、応答が届かずに再送したりしても、
+// 同じキーのリクエストは一度しか実行されません。
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"stamp-backend/internal/audit"
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/ent"
+)
+
+// Header リクエストのキーのヘッダー名
+const Header = "Idempotency-Key"
+
+// ReplayedHeader 保存しておいた応答を返したことを示すレスポンスヘッダー
+const ReplayedHeader = "Idempotent-Replayed"
+
+const (
+	// DefaultRetentionHours 応答を保存しておく時間の既定値
+	DefaultRetentionHours = 24
+	// MaxKeyLength キーの最大長
+	MaxKeyLength = 255
+	// maxStoredBody 保存する応答の最大サイズ。これを超える応答は保存せず、再送は再び実行されます
+	maxStoredBody = 1 << 20
+	// maxMemoryBody メモリに読み込むリクエストボディの最大サイズ。画像のアップロードなど
+	// これを超えるボディは一時ファイルに書き出しながら指紋を計算し、ハンドラーにはファイルから渡します
+	maxMemoryBody = 1 << 20
+	// maxSpooledBody 一時ファイルに書き出すボディの最大サイズ（インポートの上限より大きくします）
+	maxSpooledBody = 256 << 20
+	// lockTimeout 実行中のまま応答が保存されなかったキー（プロセスの停止など）を解放するまでの時間
+	lockTimeout = 5 * time.Minute
+)
+
+// storedHeaders 応答とともに保存するヘッダー
+var storedHeaders = []string{"Content-Type", "Content-Language", "Content-Disposition", "Location", "ETag"}
+
+// Store キーと応答を保存するミドルウェアです
+type Store struct {
+	client    *ent.Client
+	clock     clock.Clock
+	retention time.Duration
+}
+
+// New 保持時間（時間）を指定して Store を作成します
+func New(client *ent.Client, clk clock.Clock, retentionHours int) *Store {
+	if clk == nil {
+		clk = clock.System
+	}
+	if retentionHours <= 0 {
+		retentionHours = DefaultRetentionHours
+	}
+	return &Store{client: client, clock: clk, retention: time.Duration(retentionHours) * time.Hour}
+}
+
+// mutating キーを受け付けるメソッドか判定します
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Middleware POST・PUT・PATCH・DELETE の Idempotency-Key を処理します
+// 初めてのキーはリクエストを実行して応答を保存し、同じキーの再送には保存した応答を返します
+// 同じキーで内容（メソッド・パス・ボディ）が異なるリクエストは 422、実行中のキーは 409 になります
+// 5xx の応答は保存しないため、同じキーで再試行できます
+// 指紋にはボディ全体を含めます。maxMemoryBody バイトを超えるボディは一時ファイルを経由してハンドラーに渡します
+func (s *Store) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" || !mutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > MaxKeyLength {
+			writeError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+
+		body, sum, err := readBody(r)
+		if err != nil {
+			if errors.Is(err, errBodyTooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, "Request body is too large")
+			} else {
+				writeError(w, http.StatusBadRequest, "Failed to read request body")
+			}
+			return
+		}
+		defer body.Close()
+		r.Body = body
+
+		ctx := r.Context()
+		now := s.clock.Now()
+		k := &ent.IdempotencyKey{Scope: scope(r), Key: key, Fingerprint: sum, ExpiresAt: now.Add(lockTimeout)}
+
+		reserved, err := s.client.IdempotencyKey.Reserve(ctx, k, now)
+		if err != nil {
+			log.Printf("Failed to reserve idempotency key: %v", err)
+			writeError(w, http.StatusInternalServerError, "Failed to process Idempotency-Key")
+			return
+		}
+		if !reserved {
+			s.replay(w, r, k)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		defer func() {
+			if !completed {
+				// パニックなどで応答を保存できなかった場合は、再試行できるようキーを解放します
+				if err := s.client.IdempotencyKey.Release(context.WithoutCancel(ctx), k.Scope, k.Key); err != nil {
+					log.Printf("Failed to release idempotency key: %v", err)
+				}
+			}
+		}()
+		next.ServeHTTP(rec, r)
+
+		if rec.status >= 500 || rec.overflow {
+			return
+		}
+		header := map[string]string{}
+		for _, name := range storedHeaders {
+			if v := rec.Header().Get(name); v != "" {
+				header[name] = v
+			}
+		}
+		encoded, _ := json.Marshal(header)
+		k.Status, k.Header, k.Body = rec.status, string(encoded), rec.body.Bytes()
+		k.ExpiresAt = s.clock.Now().Add(s.retention)
+		if err := s.client.IdempotencyKey.Complete(context.WithoutCancel(ctx), k); err != nil {
+			log.Printf("Failed to store idempotent response: %v", err)
+			return
+		}
+		completed = true
+	})
+}
+
+// replay 保存済みのキーの応答を返します
+func (s *Store) replay(w http.ResponseWriter, r *http.Request, k *ent.IdempotencyKey) {
+	stored, err := s.client.IdempotencyKey.Get(r.Context(), k.Scope, k.Key, s.clock.Now())
+	if err != nil {
+		log.Printf("Failed to get idempotency key: %v", err)
+		writeError(w, http.StatusInternalServerError, "Failed to process Idempotency-Key")
+		return
+	}
+	switch {
+	case stored == nil:
+		// 予約と読み取りの間に期限が切れたキーです
+		writeError(w, http.StatusConflict, "A request with this Idempotency-Key is in progress; retry later")
+	case stored.Fingerprint != k.Fingerprint:
+		writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+	case stored.Status == 0:
+		writeError(w, http.StatusConflict, "A request with this Idempotency-Key is in progress; retry later")
+	default:
+		var header map[string]string
+		json.Unmarshal([]byte(stored.Header), &header)
+		for name, v := range header {
+			w.Header().Set(name, v)
+		}
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+	}
+}
+
+// Run 指定間隔で期限切れのキーを削除します。ctx が終了するまで戻りません
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.client.IdempotencyKey.DeleteExpired(ctx, s.clock.Now()); err != nil {
+			log.Printf("Failed to delete expired idempotency keys: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scope キーの持ち主を返します。未認証のリクエストはクライアントのアドレスごとに分けます
+// アドレスはサーバーが監査ログと同じく TRUST_PROXY に従ってコンテキストに設定したものを使い、
+// プロキシ配下でもクライアントごとにキーを分けます
+func scope(r *http.Request) string {
+	if user, ok := auth.FromContext(r.Context()); ok {
+		return "user:" + user.ID
+	}
+	if ip := audit.ClientIP(r.Context()); ip != "" {
+		return "addr:" + ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// errBodyTooLarge ボディが maxSpooledBody を超えています
+var errBodyTooLarge = errors.New("request body is too large")
+
+// readBody ボディを最後まで読み、メソッド・パス（クエリを含む）・ボディから同じリクエストかを判定する
+// ハッシュ（指紋）を計算します。読み込んだボディはハンドラーに渡せるよう、読み直せるボディとして返します
+// maxMemoryBody バイトを超えるボディは一時ファイルに書き出し、返したボディを閉じると削除します
+func readBody(r *http.Request) (io.ReadCloser, string, error) {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	defer r.Body.Close()
+
+	head, err := io.ReadAll(io.LimitReader(r.Body, maxMemoryBody+1))
+	if err != nil {
+		return nil, "", err
+	}
+	h.Write(head)
+	if len(head) <= maxMemoryBody {
+		return io.NopCloser(bytes.NewReader(head)), hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	f, err := os.CreateTemp("", "idempotency-body-*")
+	if err != nil {
+		return nil, "", err
+	}
+	spool := &spooledBody{f}
+	if _, err := f.Write(head); err != nil {
+		spool.Close()
+		return nil, "", err
+	}
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(r.Body, maxSpooledBody-int64(len(head))+1))
+	if err == nil && int64(len(head))+n > maxSpooledBody {
+		err = errBodyTooLarge
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		return nil, "", err
+	}
+	return spool, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// spooledBody 一時ファイルに書き出したボディ。閉じるとファイルを削除します
+type spooledBody struct {
+	*os.File
+}
+
+func (b *spooledBody) Close() error {
+	err := b.File.Close()
+	os.Remove(b.File.Name())
+	return err
+}
+
+// recorder 応答を書き込みながら、保存するためにステータスとボディを記録します
+type recorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+	wrote    bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wrote {
+		rec.status, rec.wrote = status, true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.wrote = true
+	if !rec.overflow {
+		if rec.body.Len()+len(b) > maxStoredBody {
+			rec.overflow = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// writeError エラーレスポンスを書き込みます
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
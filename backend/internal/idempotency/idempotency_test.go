@@ -0,0 +1,216 @@
+package idempotency
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/audit"
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/ent"
+)
+
+// testNow テストの現在時刻
+var testNow = time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+
+// send キーとボディを指定してリクエストを送ります
+func send(h http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(Header, key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestMiddlewareReplaysStoredResponse(t *testing.T) {
+	calls := 0
+	h := New(ent.NewClient(), clock.Fixed(testNow), 0).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/collections/1")
+		w.Header().Set("X-Not-Stored", "1")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"call":%d,"body":%q}`, calls, body)
+	}))
+
+	first := send(h, http.MethodPost, "/api/collections", "k1", `{"notes":"a"}`)
+	if first.Code != http.StatusCreated || first.Header().Get(ReplayedHeader) != "" {
+		t.Fatalf("first request: status = %d, replayed = %q", first.Code, first.Header().Get(ReplayedHeader))
+	}
+
+	replay := send(h, http.MethodPost, "/api/collections", "k1", `{"notes":"a"}`)
+	if calls != 1 {
+		t.Errorf("handler ran %d times; want 1", calls)
+	}
+	if replay.Code != http.StatusCreated || replay.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("replay: status = %d, replayed = %q", replay.Code, replay.Header().Get(ReplayedHeader))
+	}
+	if replay.Body.String() != first.Body.String() {
+		t.Errorf("replay body = %s; want %s", replay.Body, first.Body)
+	}
+	if got := replay.Header().Get("Location"); got != "/api/collections/1" {
+		t.Errorf("replay Location = %q", got)
+	}
+	if got := replay.Header().Get("X-Not-Stored"); got != "" {
+		t.Errorf("replay X-Not-Stored = %q; want it not to be stored", got)
+	}
+
+	// キーのない再送や GET はそのまま実行します
+	send(h, http.MethodPost, "/api/collections", "", `{"notes":"a"}`)
+	send(h, http.MethodGet, "/api/collections", "k1", "")
+	if calls != 3 {
+		t.Errorf("handler ran %d times; want 3", calls)
+	}
+}
+
+func TestMiddlewareRejectsDifferentRequest(t *testing.T) {
+	h := New(ent.NewClient(), clock.Fixed(testNow), 0).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	send(h, http.MethodPost, "/api/collections", "k1", `{"notes":"a"}`)
+	cases := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/api/collections", `{"notes":"b"}`},
+		{http.MethodPost, "/api/collections?x=1", `{"notes":"a"}`},
+		{http.MethodPut, "/api/collections", `{"notes":"a"}`},
+	}
+	for _, c := range cases {
+		if rec := send(h, c.method, c.path, "k1", c.body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s %s %s: status = %d; want 422", c.method, c.path, c.body, rec.Code)
+		}
+	}
+
+	// 別のクライアントのキーとは区別します
+	r := httptest.NewRequest(http.MethodPost, "/api/collections", strings.NewReader(`{"notes":"b"}`))
+	r.RemoteAddr = "192.0.2.9:1234"
+	r.Header.Set(Header, "k1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("other client: status = %d; want 201", rec.Code)
+	}
+}
+
+func TestMiddlewareScopesByClientIP(t *testing.T) {
+	calls := 0
+	h := New(ent.NewClient(), clock.Fixed(testNow), 0).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	// プロキシ配下では RemoteAddr が同じでも、サーバーが求めたクライアントIPごとにキーを分けます
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.1"} {
+		r := httptest.NewRequest(http.MethodPost, "/api/collections", strings.NewReader(`{}`))
+		r = r.WithContext(audit.WithRequest(r.Context(), "req", ip))
+		r.Header.Set(Header, "k1")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times; want 2", calls)
+	}
+}
+
+func TestMiddlewareFingerprintsWholeBody(t *testing.T) {
+	var received []int
+	h := New(ent.NewClient(), clock.Fixed(testNow), 0).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, len(body))
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	// 長さのわからない（チャンク形式の）大きなボディも、先頭が同じだけでは同じリクエストとみなしません
+	post := func(tail string) int {
+		body := strings.Repeat("x", maxMemoryBody+10) + tail
+		r := httptest.NewRequest(http.MethodPost, "/api/import", io.MultiReader(strings.NewReader(body)))
+		r.ContentLength = -1
+		r.Header.Set(Header, "k1")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	if code := post("a"); code != http.StatusCreated {
+		t.Fatalf("status = %d; want 201", code)
+	}
+	if code := post("b"); code != http.StatusUnprocessableEntity {
+		t.Errorf("different body: status = %d; want 422", code)
+	}
+	if code := post("a"); code != http.StatusCreated {
+		t.Errorf("replay: status = %d; want 201", code)
+	}
+	if !reflect.DeepEqual(received, []int{maxMemoryBody + 11}) {
+		t.Errorf("handler received %v bytes; want the whole body once", received)
+	}
+}
+
+func TestMiddlewareInProgress(t *testing.T) {
+	var h http.Handler
+	var inner *httptest.ResponseRecorder
+	h = New(ent.NewClient(), clock.Fixed(testNow), 0).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inner == nil {
+			// 実行中に同じキーで再送されたものとして扱います
+			inner = send(h, http.MethodPost, "/api/collections", "k1", `{}`)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	if rec := send(h, http.MethodPost, "/api/collections", "k1", `{}`); rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d; want 201", rec.Code)
+	}
+	if inner.Code != http.StatusConflict {
+		t.Errorf("request during execution: status = %d; want 409", inner.Code)
+	}
+}
+
+func TestMiddlewareRetriesAfterFailure(t *testing.T) {
+	calls := 0
+	status := http.StatusServiceUnavailable
+	h := New(ent.NewClient(), clock.Fixed(testNow), 0).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 2 {
+			panic("handler failed")
+		}
+		w.WriteHeader(status)
+	}))
+
+	// 5xx は保存しません
+	if rec := send(h, http.MethodPost, "/api/collections", "k1", `{}`); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d; want 503", rec.Code)
+	}
+
+	// パニックしたリクエストのキーは解放します
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("handler did not panic")
+			}
+		}()
+		send(h, http.MethodPost, "/api/collections", "k1", `{}`)
+	}()
+
+	status = http.StatusCreated
+	if rec := send(h, http.MethodPost, "/api/collections", "k1", `{}`); rec.Code != http.StatusCreated || rec.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("retry: status = %d, replayed = %q; want 201 executed again", rec.Code, rec.Header().Get(ReplayedHeader))
+	}
+	if calls != 3 {
+		t.Errorf("handler ran %d times; want 3", calls)
+	}
+}
+
+func TestMiddlewareRejectsLongKey(t *testing.T) {
+	h := New(ent.NewClient(), clock.Fixed(testNow), 0).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler ran for a key that is too long")
+	}))
+	if rec := send(h, http.MethodPost, "/api/collections", strings.Repeat("k", MaxKeyLength+1), `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d; want 400", rec.Code)
+	}
+}
@@ -0,0 +1,348 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/export"
+	"stamp-backend/internal/fuzzy"
+	"stamp-backend/internal/geo"
+	"stamp-backend/internal/storage"
+)
+
+// 寺社の再リンク判定に使うしきい値
+const (
+	// searchRadiusKm 座標で候補を探す半径
+	searchRadiusKm = 1.0
+	// nameThreshold 名前が一致したとみなす類似度
+	nameThreshold = 0.8
+	// nearbyNameThreshold 座標がほぼ一致する場合に許容する類似度
+	nearbyNameThreshold = 0.5
+	// nearbyDistanceKm 座標がほぼ一致するとみなす距離
+	nearbyDistanceKm = 0.15
+)
+
+// maxArchiveFileSize ZIP内の1ファイルあたりの上限サイズ
+const maxArchiveFileSize = 20 << 20
+
+// Report インポート結果
+type Report struct {
+	Imported  []Item `json:"imported"`
+	Skipped   []Item `json:"skipped"`
+	Conflicts []Item `json:"conflicts"`
+}
+
+// Item インポート対象1件の処理結果
+type Item struct {
+	// Index 入力データ内の位置
+	Index        int `json:"index"`
+	SourceID     int `json:"source_id,omitempty"`
+	TempleID     int `json:"temple_id,omitempty"`
+	CollectionID int `json:"collection_id,omitempty"`
+	// MatchedBy 寺社の特定方法（id, name_coordinates, name）
+	MatchedBy  string `json:"matched_by,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	Candidates []int  `json:"candidates,omitempty"`
+}
+
+// Importer エクスポートデータから御朱印コレクションを取り込みます
+type Importer struct {
+	client *ent.Client
+	store  storage.Storage
+}
+
+// New インポーターを作成します
+func New(client *ent.Client, store storage.Storage) *Importer {
+	return &Importer{client: client, store: store}
+}
+
+// ReadDocument エクスポートされたZIPまたはJSONを読み込みます
+// ZIPの場合は画像をパスをキーにしたマップで返します
+func ReadDocument(data []byte) (*export.CollectionDocument, map[string][]byte, error) {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		var doc export.CollectionDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, nil, fmt.Errorf("invalid export JSON: %v", err)
+		}
+		return &doc, nil, nil
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid export archive: %v", err)
+	}
+
+	var doc *export.CollectionDocument
+	images := map[string][]byte{}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if f.Name != "collection.json" && !strings.HasPrefix(f.Name, "images/") {
+			continue
+		}
+
+		content, err := readZipFile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if f.Name == "collection.json" {
+			doc = &export.CollectionDocument{}
+			if err := json.Unmarshal(content, doc); err != nil {
+				return nil, nil, fmt.Errorf("invalid collection.json: %v", err)
+			}
+			continue
+		}
+		images[f.Name] = content
+	}
+
+	if doc == nil {
+		return nil, nil, fmt.Errorf("collection.json not found in archive")
+	}
+	return doc, images, nil
+}
+
+// readZipFile ZIP内のファイルを上限サイズまで読み込みます
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(io.LimitReader(rc, maxArchiveFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", f.Name, err)
+	}
+	if len(content) > maxArchiveFileSize {
+		return nil, fmt.Errorf("%s is too large", f.Name)
+	}
+	return content, nil
+}
+
+// Import ユーザーのコレクションとして取り込みます
+// 同じ寺社・同じ収集日時の記録が既にある場合は取り込まないため、何度実行しても重複しません
+func (im *Importer) Import(ctx context.Context, userID string, doc *export.CollectionDocument, images map[string][]byte) (*Report, error) {
+	if doc.Version > export.CollectionDocumentVersion {
+		return nil, fmt.Errorf("unsupported export version: %d", doc.Version)
+	}
+
+	existing := map[string]*ent.GoshuinCollection{}
+	err := im.client.GoshuinCollection.Query().
+		Filter(ent.GoshuinCollectionFilter{UserID: userID}).
+		Each(ctx, func(gc *ent.GoshuinCollection) error {
+			if t, err := time.Parse(time.RFC3339, gc.CollectedAt); err == nil {
+				existing[dedupKey(gc.TempleID, t)] = gc
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Imported: []Item{}, Skipped: []Item{}, Conflicts: []Item{}}
+	for i, e := range doc.Collections {
+		item := Item{Index: i, SourceID: e.ID}
+
+		collectedAt, err := time.Parse(time.RFC3339, e.CollectedAt)
+		if err != nil {
+			item.Reason = "invalid collected_at"
+			report.Skipped = append(report.Skipped, item)
+			continue
+		}
+
+		temple, matchedBy, candidates, err := im.resolveTemple(ctx, e)
+		if err != nil {
+			return nil, err
+		}
+		if temple == nil {
+			item.Candidates = candidates
+			if len(candidates) > 1 {
+				item.Reason = "ambiguous temple match"
+				report.Conflicts = append(report.Conflicts, item)
+			} else {
+				item.Reason = "temple not found"
+				report.Skipped = append(report.Skipped, item)
+			}
+			continue
+		}
+		item.TempleID, item.MatchedBy = temple.ID, matchedBy
+
+		key := dedupKey(temple.ID, collectedAt)
+		if gc, ok := existing[key]; ok {
+			item.CollectionID = gc.ID
+			if gc.Notes == e.Notes {
+				item.Reason = "already imported"
+				report.Skipped = append(report.Skipped, item)
+			} else {
+				item.Reason = "existing entry for the same temple and time has different notes"
+				report.Conflicts = append(report.Conflicts, item)
+			}
+			continue
+		}
+
+		imageURL := e.ImageURL
+		if data, ok := images[e.ImageFile]; ok && e.ImageFile != "" {
+			imageURL, err = im.storeImage(ctx, userID, e.ImageFile, data)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		gc, err := im.client.GoshuinCollection.Create().
+			SetUserID(userID).
+			SetTempleID(temple.ID).
+			SetImageURL(imageURL).
+			SetNotes(e.Notes).
+			SetTags(e.Tags).
+			SetDetails(e.Rating, e.FeePaid, e.WaitingMinutes, e.HallName).
+			SetCollectedAt(collectedAt).
+			Save(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		existing[key] = gc
+		item.CollectionID = gc.ID
+		report.Imported = append(report.Imported, item)
+	}
+
+	return report, nil
+}
+
+// dedupKey 重複判定のキー（寺社ID＋収集日時の秒）
+func dedupKey(templeID int, collectedAt time.Time) string {
+	return fmt.Sprintf("%d@%d", templeID, collectedAt.Unix())
+}
+
+// storeImage 画像をストレージに保存し、公開URLを返します
+// キーに内容のハッシュを使うため、同じ画像は同じキーに上書きされます
+func (im *Importer) storeImage(ctx context.Context, userID, name string, data []byte) (string, error) {
+	ext := path.Ext(name)
+	if ext == "" || ext == ".bin" {
+		ext = export.ImageExtension(data)
+	}
+
+	key, err := storage.PutHashed(ctx, im.store, "goshuin/"+url.PathEscape(userID), data, ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to store image %s: %v", name, err)
+	}
+	return im.store.URL(key), nil
+}
+
+// resolveTemple エクスポート時の寺社情報から、このデータベースの寺社を特定します
+// IDが一致しても名前と位置が異なる場合は別のデータベースのIDとみなし、名前と座標で探します
+func (im *Importer) resolveTemple(ctx context.Context, e export.CollectionEntry) (*ent.Temple, string, []int, error) {
+	snapshot := e.Temple
+
+	if e.TempleID > 0 {
+		if t, err := im.client.Temple.Get(ctx, e.TempleID); err == nil {
+			if snapshot == nil || matchesSnapshot(snapshot, t) {
+				return t, "id", nil, nil
+			}
+		}
+	}
+	if snapshot == nil {
+		return nil, "", nil, nil
+	}
+
+	// 座標の近くから名前が似ている寺社を探す
+	if snapshot.Latitude != 0 || snapshot.Longitude != 0 {
+		minLat, minLng, maxLat, maxLng := geo.BoundingBox(snapshot.Latitude, snapshot.Longitude, searchRadiusKm)
+		nearby, err := im.client.Temple.Query().Filter(ent.TempleFilter{
+			BBox:            &ent.BBox{MinLat: minLat, MinLng: minLng, MaxLat: maxLat, MaxLng: maxLng},
+			IncludeInactive: true,
+		}).All(ctx)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		var matches []*ent.Temple
+		for _, t := range nearby {
+			if matchesSnapshot(snapshot, t) {
+				matches = append(matches, t)
+			}
+		}
+		if len(matches) == 1 {
+			return matches[0], "name_coordinates", nil, nil
+		}
+		if len(matches) > 1 {
+			return nil, "", templeIDs(matches), nil
+		}
+	}
+
+	// 座標で見つからない場合は名前のみで探す
+	var matches []*ent.Temple
+	for _, name := range []string{snapshot.Name, snapshot.NameEn} {
+		if name == "" {
+			continue
+		}
+		found, err := im.client.Temple.Query().Filter(ent.TempleFilter{Search: name, IncludeInactive: true}).All(ctx)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		for _, t := range found {
+			if fuzzy.Normalize(t.Name) == fuzzy.Normalize(snapshot.Name) ||
+				(snapshot.NameEn != "" && fuzzy.Normalize(t.NameEn) == fuzzy.Normalize(snapshot.NameEn)) {
+				matches = appendUnique(matches, t)
+			}
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], "name", nil, nil
+	}
+	return nil, "", templeIDs(matches), nil
+}
+
+// matchesSnapshot 寺社がエクスポート時の寺社情報と同じ寺社か判定します
+// 座標がない場合は正規化した名前の完全一致のみを認めます
+func matchesSnapshot(snapshot, t *ent.Temple) bool {
+	if snapshot.Latitude == 0 && snapshot.Longitude == 0 {
+		return fuzzy.Normalize(snapshot.Name) == fuzzy.Normalize(t.Name)
+	}
+
+	dist := geo.DistanceKm(snapshot.Latitude, snapshot.Longitude, t.Latitude, t.Longitude)
+	if dist > searchRadiusKm {
+		return false
+	}
+	score := nameScore(snapshot, t)
+	return score >= nameThreshold || (dist <= nearbyDistanceKm && score >= nearbyNameThreshold)
+}
+
+// nameScore 日本語名・英語名の類似度の高い方を返します
+func nameScore(snapshot, t *ent.Temple) float64 {
+	score := fuzzy.Similarity(snapshot.Name, t.Name)
+	if snapshot.NameEn != "" && t.NameEn != "" {
+		score = max(score, fuzzy.Similarity(snapshot.NameEn, t.NameEn))
+	}
+	return score
+}
+
+// appendUnique IDが重複しないように追加します
+func appendUnique(temples []*ent.Temple, t *ent.Temple) []*ent.Temple {
+	for _, existing := range temples {
+		if existing.ID == t.ID {
+			return temples
+		}
+	}
+	return append(temples, t)
+}
+
+// templeIDs 寺社IDの一覧を返します
+func templeIDs(temples []*ent.Temple) []int {
+	ids := make([]int, len(temples))
+	for i, t := range temples {
+		ids[i] = t.ID
+	}
+	return ids
+}
@@ -0,0 +1,126 @@
+package importer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/export"
+	"stamp-backend/internal/storage"
+)
+
+// newTestImporter メモリ上のクライアントに寺社を登録してインポーターを作成し、寺社IDを名前ごとに返します
+// 稲荷神社は離れた2か所に登録します
+func newTestImporter(t *testing.T) (*Importer, map[string][]int) {
+	t.Helper()
+
+	client := ent.NewClient()
+	ids := map[string][]int{}
+	for _, tf := range []struct {
+		name, nameEn string
+		lat, lng     float64
+	}{
+		{"浅草寺", "Senso-ji", 35.7148, 139.7967},
+		{"明治神宮", "Meiji Jingu", 35.6764, 139.6993},
+		{"稲荷神社", "Inari Shrine", 35.0, 135.0},
+		{"稲荷神社", "Inari Shrine", 34.0, 133.0},
+	} {
+		temple, err := client.Temple.Create().
+			SetName(tf.name).
+			SetNameEn(tf.nameEn).
+			SetPrefecture("東京都").
+			SetKind("temple").
+			SetLatitude(tf.lat).
+			SetLongitude(tf.lng).
+			SetActive(true).
+			Save(context.Background())
+		if err != nil {
+			t.Fatalf("failed to create temple %s: %v", tf.name, err)
+		}
+		ids[tf.name] = append(ids[tf.name], temple.ID)
+	}
+	return New(client, storage.NewLocal(t.TempDir(), "/uploads/")), ids
+}
+
+func TestImportRelinksTemples(t *testing.T) {
+	im, ids := newTestImporter(t)
+	sensoji, meiji := ids["浅草寺"][0], ids["明治神宮"][0]
+
+	entry := func(templeID int, snapshot *ent.Temple, collectedAt string) export.CollectionEntry {
+		return export.CollectionEntry{TempleID: templeID, Temple: snapshot, CollectedAt: collectedAt, Notes: "参拝"}
+	}
+	doc := &export.CollectionDocument{Version: export.CollectionDocumentVersion, Collections: []export.CollectionEntry{
+		// IDと寺社情報が一致します
+		entry(sensoji, &ent.Temple{Name: "浅草寺", Latitude: 35.7148, Longitude: 139.7967}, "2024-01-01T10:00:00+09:00"),
+		// 別のデータベースのIDで、座標が少しずれています
+		entry(999, &ent.Temple{Name: "浅草寺", Latitude: 35.7150, Longitude: 139.7965}, "2024-01-02T10:00:00+09:00"),
+		// IDはこのデータベースの別の寺社です
+		entry(meiji, &ent.Temple{Name: "浅草寺", NameEn: "Senso-ji", Latitude: 35.7148, Longitude: 139.7967}, "2024-01-03T10:00:00+09:00"),
+		// 座標がなく、英語名だけが一致します
+		entry(0, &ent.Temple{Name: "明治神宮 (旧表記)", NameEn: "Meiji Jingu"}, "2024-01-04T10:00:00+09:00"),
+		// 名前だけでは2か所に絞れません
+		entry(0, &ent.Temple{Name: "稲荷神社"}, "2024-01-05T10:00:00+09:00"),
+		entry(0, &ent.Temple{Name: "存在しない寺", Latitude: 43.0, Longitude: 141.0}, "2024-01-06T10:00:00+09:00"),
+		entry(sensoji, nil, "not a time"),
+	}}
+
+	report, err := im.Import(context.Background(), "user-1", doc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		Index      int
+		TempleID   int
+		MatchedBy  string
+		Reason     string
+		Candidates []int
+	}
+	summarize := func(items []Item) []result {
+		out := []result{}
+		for _, item := range items {
+			out = append(out, result{item.Index, item.TempleID, item.MatchedBy, item.Reason, item.Candidates})
+		}
+		return out
+	}
+
+	wantImported := []result{
+		{0, sensoji, "id", "", nil},
+		{1, sensoji, "name_coordinates", "", nil},
+		{2, sensoji, "name_coordinates", "", nil},
+		{3, meiji, "name", "", nil},
+	}
+	wantSkipped := []result{
+		{5, 0, "", "temple not found", []int{}},
+		{6, 0, "", "invalid collected_at", nil},
+	}
+	wantConflicts := []result{{4, 0, "", "ambiguous temple match", ids["稲荷神社"]}}
+	if got := summarize(report.Imported); !reflect.DeepEqual(got, wantImported) {
+		t.Errorf("imported = %+v; want %+v", got, wantImported)
+	}
+	if got := summarize(report.Skipped); !reflect.DeepEqual(got, wantSkipped) {
+		t.Errorf("skipped = %+v; want %+v", got, wantSkipped)
+	}
+	if got := summarize(report.Conflicts); !reflect.DeepEqual(got, wantConflicts) {
+		t.Errorf("conflicts = %+v; want %+v", got, wantConflicts)
+	}
+
+	// 同じデータをもう一度取り込んでも重複せず、メモが異なるものだけを競合にします
+	doc.Collections[1].Notes = "再訪"
+	again, err := im.Import(context.Background(), "user-1", doc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Imported) != 0 {
+		t.Errorf("imported again = %+v; want none", again.Imported)
+	}
+	var reasons []string
+	for _, item := range again.Conflicts {
+		reasons = append(reasons, item.Reason)
+	}
+	want := []string{"existing entry for the same temple and time has different notes", "ambiguous temple match"}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("conflict reasons = %q; want %q", reasons, want)
+	}
+}
@@ -0,0 +1,130 @@
+// Package proposals 新しい寺社の提案が既存の寺社や審査中の提案と重複していないか調べます
+package proposals
+
+import (
+	"context"
+	"sort"
+
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/fuzzy"
+	"stamp-backend/internal/geo"
+)
+
+// 重複候補の判定に使うしきい値（インポートの再リンク判定と同じ基準）
+const (
+	// searchRadiusKm 座標で候補を探す半径
+	searchRadiusKm = 1.0
+	// nameThreshold 名前が一致したとみなす類似度
+	nameThreshold = 0.8
+	// nearbyNameThreshold 座標がほぼ一致する場合に許容する類似度
+	nearbyNameThreshold = 0.5
+	// nearbyDistanceKm 座標がほぼ一致するとみなす距離
+	nearbyDistanceKm = 0.15
+	// maxCandidates 返す候補の上限
+	maxCandidates = 10
+)
+
+// Candidate 「もしかして」として提示する既存の寺社または審査中の提案
+type Candidate struct {
+	Temple   *ent.Temple         `json:"temple,omitempty"`
+	Proposal *ent.TempleProposal `json:"proposal,omitempty"`
+	// DistanceM 提案された座標からの距離（メートル）
+	DistanceM int `json:"distance_m"`
+	// Similarity 名前の類似度（0〜1）
+	Similarity float64 `json:"similarity"`
+}
+
+// Query 重複を調べる寺社の名前と座標
+type Query struct {
+	Name      string
+	NameEn    string
+	Latitude  float64
+	Longitude float64
+	// ExcludeProposalID 審査中の提案自身を候補から除きます
+	ExcludeProposalID int
+}
+
+// Candidates 近くにある名前の似た寺社・審査中の提案と、名前が一致する寺社を
+// 類似度の高い順（同じなら近い順）に返します
+func Candidates(ctx context.Context, client *ent.Client, q Query) ([]Candidate, error) {
+	candidates := []Candidate{}
+	seen := map[int]bool{}
+
+	minLat, minLng, maxLat, maxLng := geo.BoundingBox(q.Latitude, q.Longitude, searchRadiusKm)
+	bbox := &ent.BBox{MinLat: minLat, MinLng: minLng, MaxLat: maxLat, MaxLng: maxLng}
+
+	nearby, err := client.Temple.Query().Filter(ent.TempleFilter{BBox: bbox, IncludeInactive: true}).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range nearby {
+		if c, ok := q.match(t.Name, t.NameEn, t.Latitude, t.Longitude); ok {
+			c.Temple = t
+			candidates = append(candidates, c)
+			seen[t.ID] = true
+		}
+	}
+
+	// 座標が大きくずれている場合に備え、正規化した名前が一致する寺社も候補にする
+	named, err := client.Temple.Query().Filter(ent.TempleFilter{Search: q.Name, IncludeInactive: true}).All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range named {
+		if seen[t.ID] || fuzzy.Normalize(t.Name) != fuzzy.Normalize(q.Name) {
+			continue
+		}
+		candidates = append(candidates, Candidate{
+			Temple:     t,
+			DistanceM:  distanceM(q, t.Latitude, t.Longitude),
+			Similarity: 1,
+		})
+	}
+
+	pending, err := client.TempleProposal.List(ctx, ent.TempleProposalFilter{Status: ent.TempleProposalPending, BBox: bbox})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pending {
+		if p.ID == q.ExcludeProposalID {
+			continue
+		}
+		if c, ok := q.match(p.Name, p.NameEn, p.Latitude, p.Longitude); ok {
+			c.Proposal = p
+			candidates = append(candidates, c)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Similarity != candidates[j].Similarity {
+			return candidates[i].Similarity > candidates[j].Similarity
+		}
+		return candidates[i].DistanceM < candidates[j].DistanceM
+	})
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+	return candidates, nil
+}
+
+// match 名前と座標が提案と重複しているとみなせるか判定します
+func (q Query) match(name, nameEn string, lat, lng float64) (Candidate, bool) {
+	dist := geo.DistanceKm(q.Latitude, q.Longitude, lat, lng)
+	if dist > searchRadiusKm {
+		return Candidate{}, false
+	}
+
+	score := fuzzy.Similarity(q.Name, name)
+	if q.NameEn != "" && nameEn != "" {
+		score = max(score, fuzzy.Similarity(q.NameEn, nameEn))
+	}
+	if score < nameThreshold && (dist > nearbyDistanceKm || score < nearbyNameThreshold) {
+		return Candidate{}, false
+	}
+	return Candidate{DistanceM: int(dist * 1000), Similarity: score}, true
+}
+
+// distanceM 提案された座標からの距離をメートルで返します
+func distanceM(q Query, lat, lng float64) int {
+	return int(geo.DistanceKm(q.Latitude, q.Longitude, lat, lng) * 1000)
+}
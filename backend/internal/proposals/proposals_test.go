@@ -0,0 +1,218 @@
+package proposals
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/database"
+	"stamp-backend/internal/ent"
+)
+
+// testNow テストの現在時刻
+var testNow = time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	// マイグレーションのログでテストの出力が埋もれないようにします
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestCandidates(t *testing.T) {
+	client, err := database.OpenWithClock(map[string]string{"driver": "sqlite", "name": ":memory:"}, clock.Fixed(testNow))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name     string
+		lat, lng float64
+		active   bool
+	}{
+		{"護国寺", 35.7179, 139.7271, true},
+		// 一般的な呼称を除いた名前が一致すれば候補にします
+		{"護国神社", 35.7185, 139.7278, true},
+		// 近くても名前が似ていなければ候補にしません
+		{"椿山荘", 35.7126, 139.7253, true},
+		// 座標がずれていても正規化した名前が一致すれば、非アクティブでも候補にします
+		{"護国寺", 34.6937, 135.5023, false},
+	} {
+		_, err := client.Temple.Create().
+			SetName(tc.name).
+			SetPrefecture("東京都").
+			SetKind("temple").
+			SetLatitude(tc.lat).
+			SetLongitude(tc.lng).
+			SetActive(tc.active).
+			Save(ctx)
+		if err != nil {
+			t.Fatalf("failed to create temple: %v", err)
+		}
+	}
+
+	var proposalIDs []int
+	for _, name := range []string{"護国寺", "音羽堂"} {
+		p, err := client.TempleProposal.Create().
+			SetUserID("user-2").
+			SetName(name, "").
+			SetLocation(35.7190, 139.7271).
+			Save(ctx)
+		if err != nil {
+			t.Fatalf("failed to create proposal: %v", err)
+		}
+		proposalIDs = append(proposalIDs, p.ID)
+	}
+
+	// describe 候補を名前、提案かどうか、類似度、1km より遠いかで表します
+	type candidate struct {
+		Name       string
+		Proposal   bool
+		Similarity float64
+		Far        bool
+	}
+	describe := func(cs []Candidate) []candidate {
+		got := make([]candidate, len(cs))
+		for i, c := range cs {
+			if c.Proposal != nil {
+				got[i] = candidate{c.Proposal.Name, true, c.Similarity, c.DistanceM > 1000}
+			} else {
+				got[i] = candidate{c.Temple.Name, false, c.Similarity, c.DistanceM > 1000}
+			}
+		}
+		return got
+	}
+
+	cases := []struct {
+		name string
+		q    Query
+		want []candidate
+	}{
+		{
+			"duplicates",
+			Query{Name: "護国寺", Latitude: 35.7180, Longitude: 139.7272},
+			[]candidate{
+				{"護国寺", false, 1, false},
+				{"護国神社", false, 1, false},
+				{"護国寺", true, 1, false},
+				{"護国寺", false, 1, true},
+			},
+		},
+		{
+			"own proposal",
+			Query{Name: "護国寺", Latitude: 35.7180, Longitude: 139.7272, ExcludeProposalID: proposalIDs[0]},
+			[]candidate{
+				{"護国寺", false, 1, false},
+				{"護国神社", false, 1, false},
+				{"護国寺", false, 1, true},
+			},
+		},
+		{
+			"new temple",
+			Query{Name: "待乳山聖天", Latitude: 35.7171, Longitude: 139.8027},
+			[]candidate{},
+		},
+	}
+	for _, c := range cases {
+		got, err := Candidates(ctx, client, c.q)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if d := describe(got); !reflect.DeepEqual(d, c.want) {
+			t.Errorf("%s: Candidates = %+v; want %+v", c.name, d, c.want)
+		}
+	}
+}
+
+func TestReview(t *testing.T) {
+	client, err := database.OpenWithClock(map[string]string{"driver": "sqlite", "name": ":memory:"}, clock.Fixed(testNow))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	existing, err := client.Temple.Create().
+		SetName("護国寺").SetPrefecture("東京都").SetKind("temple").
+		SetLatitude(35.7179).SetLongitude(139.7271).SetActive(true).
+		Save(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// propose 提案と、提案者が記録した御朱印1件を作成します
+	propose := func(name string) *ent.TempleProposal {
+		t.Helper()
+		p, err := client.TempleProposal.Create().
+			SetUserID("user-2").SetName(name, "").SetLocation(35.7171, 139.8027).SetPrefecture("東京都").
+			Save(ctx)
+		if err != nil {
+			t.Fatalf("failed to create proposal: %v", err)
+		}
+		if _, err := client.TempleProposal.AddEntry(ctx, &ent.TempleProposalEntry{ProposalID: p.ID, UserID: "user-2", Notes: name}, time.Time{}); err != nil {
+			t.Fatalf("failed to add entry: %v", err)
+		}
+		return p
+	}
+
+	cases := []struct {
+		name       string
+		review     ent.TempleProposalReview
+		wantTemple string
+	}{
+		{"待乳山聖天", ent.TempleProposalReview{Status: ent.TempleProposalApproved, ReviewerID: "admin-1"}, "待乳山聖天"},
+		{"護国寺観音堂", ent.TempleProposalReview{Status: ent.TempleProposalMerged, ReviewerID: "admin-1", TempleID: existing.ID}, "護国寺"},
+		{"存在しない寺", ent.TempleProposalReview{Status: ent.TempleProposalRejected, ReviewerID: "admin-1"}, ""},
+	}
+	for _, c := range cases {
+		p := propose(c.name)
+		res, err := client.TempleProposal.Review(ctx, p.ID, c.review)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if res.Proposal.Status != c.review.Status {
+			t.Errorf("%s: status = %q; want %q", c.name, res.Proposal.Status, c.review.Status)
+		}
+		if _, err := client.TempleProposal.Review(ctx, p.ID, c.review); err != ent.ErrProposalAlreadyReviewed {
+			t.Errorf("%s: second review = %v; want %v", c.name, err, ent.ErrProposalAlreadyReviewed)
+		}
+
+		if c.wantTemple == "" {
+			if res.Temple != nil || len(res.Linked) != 0 {
+				t.Errorf("%s: result = %+v; want no temple", c.name, res)
+			}
+			entry := &ent.TempleProposalEntry{ProposalID: p.ID, UserID: "user-3"}
+			if _, err := client.TempleProposal.AddEntry(ctx, entry, time.Time{}); err != ent.ErrProposalRejected {
+				t.Errorf("%s: AddEntry = %v; want %v", c.name, err, ent.ErrProposalRejected)
+			}
+			continue
+		}
+
+		// 承認・マージした寺社に、記録済みの御朱印と後から記録した御朱印を登録します
+		if res.Temple == nil || res.Temple.Name != c.wantTemple || res.Proposal.TempleID != res.Temple.ID {
+			t.Fatalf("%s: result = %+v; want temple %s", c.name, res, c.wantTemple)
+		}
+		if c.review.Status == ent.TempleProposalApproved && res.Temple.ContributedBy != "user-2" {
+			t.Errorf("%s: contributed_by = %q; want user-2", c.name, res.Temple.ContributedBy)
+		}
+		later, err := client.TempleProposal.AddEntry(ctx, &ent.TempleProposalEntry{ProposalID: p.ID, UserID: "user-3"}, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range append(res.Linked, later) {
+			gc, err := client.GoshuinCollection.Get(ctx, e.CollectionID)
+			if err != nil || gc.TempleID != res.Temple.ID || gc.UserID != e.UserID {
+				t.Errorf("%s: entry %d collection = %+v, %v; want at temple %d", c.name, e.ID, gc, err, res.Temple.ID)
+			}
+		}
+		if len(res.Linked) != 1 {
+			t.Errorf("%s: linked %d entries; want 1", c.name, len(res.Linked))
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package quiz ガイドの節ごとのマナークイズを採点し、ガイドの修了状況をまとめます
+package quiz
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"stamp-backend/internal/ent"
+)
+
+// PassScore 合格とみなす得点（百分率）
+const PassScore = 80.0
+
+// QuestionResult 1問の採点結果
+type QuestionResult struct {
+	QuestionID int `json:"question_id"`
+	// Points 得点（0〜1）。並べ替え問題は正しい位置にある選択肢の割合で部分点になります
+	Points      float64 `json:"points"`
+	Correct     bool    `json:"correct"`
+	Answer      []int   `json:"answer"`
+	Explanation string  `json:"explanation,omitempty"`
+}
+
+// Result 節のクイズの採点結果
+type Result struct {
+	// Score 得点（百分率）
+	Score     float64          `json:"score"`
+	Passed    bool             `json:"passed"`
+	Questions []QuestionResult `json:"questions"`
+}
+
+// Grade 問題集に対する回答を採点します
+// 回答のない問題は0点で、問題集にない問題への回答はエラーになります
+func Grade(questions []*ent.QuizQuestion, answers []ent.QuizAnswer) (*Result, error) {
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("the quiz has no questions")
+	}
+	given := map[int][]int{}
+	for _, a := range answers {
+		given[a.QuestionID] = a.Choices
+	}
+	for id := range given {
+		found := false
+		for _, q := range questions {
+			found = found || q.ID == id
+		}
+		if !found {
+			return nil, fmt.Errorf("question %d is not part of this quiz", id)
+		}
+	}
+
+	result := &Result{Questions: []QuestionResult{}}
+	total := 0.0
+	for _, q := range questions {
+		points := score(q, given[q.ID])
+		total += points
+		result.Questions = append(result.Questions, QuestionResult{
+			QuestionID:  q.ID,
+			Points:      points,
+			Correct:     points == 1,
+			Answer:      q.Answer,
+			Explanation: q.Explanation,
+		})
+	}
+	result.Score = math.Round(total/float64(len(questions))*1000) / 10
+	result.Passed = result.Score >= PassScore
+	return result, nil
+}
+
+// score 1問を採点します
+func score(q *ent.QuizQuestion, choices []int) float64 {
+	switch q.Kind {
+	case ent.QuizKindChoice:
+		if len(choices) != len(q.Answer) {
+			return 0
+		}
+		correct := map[int]bool{}
+		for _, a := range q.Answer {
+			correct[a] = true
+		}
+		for _, c := range choices {
+			if !correct[c] {
+				return 0
+			}
+			delete(correct, c)
+		}
+		return 1
+	case ent.QuizKindOrder:
+		// 全ての選択肢を1回ずつ並べた回答だけを採点します
+		if len(choices) != len(q.Answer) {
+			return 0
+		}
+		seen := map[int]bool{}
+		inPlace := 0
+		for i, c := range choices {
+			if c < 0 || c >= len(q.Choices) || seen[c] {
+				return 0
+			}
+			seen[c] = true
+			if c == q.Answer[i] {
+				inPlace++
+			}
+		}
+		return float64(inPlace) / float64(len(q.Answer))
+	}
+	return 0
+}
+
+// SectionStatus 節ごとの進み具合
+type SectionStatus struct {
+	Slug      string  `json:"slug"`
+	Attempts  int     `json:"attempts"`
+	BestScore float64 `json:"best_score"`
+	Passed    bool    `json:"passed"`
+	PassedAt  string  `json:"passed_at,omitempty"`
+}
+
+// Status ガイドの修了状況
+// クイズのある公開中の節を全て合格すると修了になります
+type Status struct {
+	Completed   bool   `json:"completed"`
+	CompletedAt string `json:"completed_at,omitempty"`
+	Passed      int    `json:"passed"`
+	Total       int    `json:"total"`
+	// NextSection 次に受けるとよい、まだ合格していない節
+	NextSection string          `json:"next_section,omitempty"`
+	Sections    []SectionStatus `json:"sections"`
+}
+
+// UserStatus ユーザーのガイドの修了状況を返します
+func UserStatus(ctx context.Context, client *ent.Client, userID string) (*Status, error) {
+	slugs, err := client.Quiz.QuizzedSections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := client.Quiz.Progress(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	bySlug := map[string]*ent.QuizProgress{}
+	for _, p := range progress {
+		bySlug[p.SectionSlug] = p
+	}
+
+	status := &Status{Total: len(slugs), Sections: []SectionStatus{}}
+	for _, slug := range slugs {
+		s := SectionStatus{Slug: slug}
+		if p := bySlug[slug]; p != nil {
+			s.Attempts, s.BestScore, s.Passed, s.PassedAt = p.Attempts, p.BestScore, p.Passed, p.PassedAt
+		}
+		if s.Passed {
+			status.Passed++
+			// RFC 3339 の UTC 時刻なので文字列の比較で新しいものを選べます
+			if s.PassedAt > status.CompletedAt {
+				status.CompletedAt = s.PassedAt
+			}
+		} else if status.NextSection == "" {
+			status.NextSection = slug
+		}
+		status.Sections = append(status.Sections, s)
+	}
+
+	status.Completed = status.Total > 0 && status.Passed == status.Total
+	if !status.Completed {
+		status.CompletedAt = ""
+	}
+	return status, nil
+}
@@ -0,0 +1,149 @@
+package quiz
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/database"
+	"stamp-backend/internal/ent"
+)
+
+// testNow テストの現在時刻
+var testNow = time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	// マイグレーションのログでテストの出力が埋もれないようにします
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// answer 問題への回答を作ります
+func answer(questionID int, choices ...int) ent.QuizAnswer {
+	return ent.QuizAnswer{QuestionID: questionID, Choices: choices}
+}
+
+func TestGrade(t *testing.T) {
+	questions := []*ent.QuizQuestion{
+		{ID: 1, Kind: ent.QuizKindChoice, Choices: []string{"a", "b", "c"}, Answer: []int{1}},
+		{ID: 2, Kind: ent.QuizKindChoice, Choices: []string{"a", "b", "c", "d"}, Answer: []int{0, 2}},
+		{ID: 3, Kind: ent.QuizKindOrder, Choices: []string{"a", "b", "c", "d"}, Answer: []int{2, 0, 3, 1}},
+	}
+
+	cases := []struct {
+		name       string
+		answers    []ent.QuizAnswer
+		wantPoints []float64
+		wantScore  float64
+		wantPassed bool
+	}{
+		{
+			"all correct",
+			[]ent.QuizAnswer{answer(1, 1), answer(2, 2, 0), answer(3, 2, 0, 3, 1)},
+			[]float64{1, 1, 1}, 100, true,
+		},
+		{
+			// 並べ替え問題は正しい位置にある選択肢の割合で部分点になります
+			"partial order",
+			[]ent.QuizAnswer{answer(1, 1), answer(2, 0, 2), answer(3, 2, 0, 1, 3)},
+			[]float64{1, 1, 0.5}, 83.3, true,
+		},
+		{
+			// 複数選択は全ての正解を選んだ場合だけ得点になります
+			"missing choice",
+			[]ent.QuizAnswer{answer(1, 1), answer(2, 0), answer(3, 2, 0, 3, 1)},
+			[]float64{1, 0, 1}, 66.7, false,
+		},
+		{
+			// 回答のない問題と、選択肢を重複させた並べ替えは0点です
+			"unanswered",
+			[]ent.QuizAnswer{answer(3, 2, 2, 3, 1)},
+			[]float64{0, 0, 0}, 0, false,
+		},
+	}
+	for _, c := range cases {
+		got, err := Grade(questions, c.answers)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		points := make([]float64, len(got.Questions))
+		for i, q := range got.Questions {
+			points[i] = q.Points
+			if q.Correct != (q.Points == 1) || !reflect.DeepEqual(q.Answer, questions[i].Answer) {
+				t.Errorf("%s: question %d = %+v", c.name, q.QuestionID, q)
+			}
+		}
+		if !reflect.DeepEqual(points, c.wantPoints) || got.Score != c.wantScore || got.Passed != c.wantPassed {
+			t.Errorf("%s: Grade = %v, %v, %v; want %v, %v, %v", c.name, points, got.Score, got.Passed, c.wantPoints, c.wantScore, c.wantPassed)
+		}
+	}
+
+	if _, err := Grade(questions, []ent.QuizAnswer{answer(4, 0)}); err == nil {
+		t.Errorf("answer to another quiz was graded")
+	}
+	if _, err := Grade(nil, nil); err == nil {
+		t.Errorf("quiz without questions was graded")
+	}
+}
+
+func TestUserStatus(t *testing.T) {
+	client, err := database.OpenWithClock(map[string]string{"driver": "sqlite", "name": ":memory:"}, clock.Fixed(testNow))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	// attempt 指定した時刻に節のクイズを受けた記録を残します
+	attempt := func(slug string, score float64, at time.Time) {
+		t.Helper()
+		client.SetClock(clock.Fixed(at))
+		_, err := client.Quiz.RecordAttempt(ctx, &ent.QuizAttempt{
+			UserID: "user-1", SectionSlug: slug, Locale: "en", Answers: []ent.QuizAnswer{}, Score: score, Passed: score >= PassScore,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	status := func() *Status {
+		t.Helper()
+		s, err := UserStatus(ctx, client, "user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	// 初期データのクイズがある節をガイドの順に並べます
+	if got := status(); got.Total != 3 || got.NextSection != "what-is-goshuin" || got.Completed || len(got.Sections) != 3 {
+		t.Fatalf("initial status = %+v", got)
+	}
+
+	attempt("how-to-receive-goshuin", 100, testNow.Add(-2*time.Hour))
+	attempt("what-is-goshuin", 50, testNow.Add(-3*time.Hour))
+	attempt("what-is-goshuin", 100, testNow.Add(-time.Hour))
+	attempt("what-is-goshuin", 0, testNow)
+	got := status()
+	want := []SectionStatus{
+		{Slug: "what-is-goshuin", Attempts: 3, BestScore: 100, Passed: true, PassedAt: "2024-06-01T02:00:00Z"},
+		{Slug: "how-to-receive-goshuin", Attempts: 1, BestScore: 100, Passed: true, PassedAt: "2024-06-01T01:00:00Z"},
+		{Slug: "etiquette-and-manners"},
+	}
+	if !reflect.DeepEqual(got.Sections, want) {
+		t.Errorf("sections = %+v; want %+v", got.Sections, want)
+	}
+	if got.Completed || got.CompletedAt != "" || got.Passed != 2 || got.NextSection != "etiquette-and-manners" {
+		t.Errorf("status = %+v; want 2 of 3 passed, next etiquette-and-manners", got)
+	}
+
+	// 最後の節に合格した時刻が修了日時になります
+	attempt("etiquette-and-manners", 80, testNow.Add(time.Hour))
+	if got := status(); !got.Completed || got.CompletedAt != "2024-06-01T04:00:00Z" || got.Passed != 3 || got.NextSection != "" {
+		t.Errorf("status = %+v; want completed at 2024-06-01T04:00:00Z", got)
+	}
+}
@@ -0,0 +1,414 @@
+// Package regionpack 都道府県または範囲ごとに、オフラインで使う寺社・翻訳・ガイド・サムネイルをまとめた
+// バージョン付きの「地域パック」を作ります。内容が変わるたびにバージョンが上がり、
+// 前のバージョンとの差分だけをダウンロードできます
+package regionpack
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/storage"
+)
+
+// FormatVersion パックの形式のバージョン
+const FormatVersion = 1
+
+// MaxTemples 1つのパックに含められる寺社の上限
+const MaxTemples = 3000
+
+// maxSourceImageSize サムネイルにする元画像の上限サイズ
+const maxSourceImageSize = 20 << 20
+
+// ErrRegionTooLarge 範囲内の寺社が MaxTemples を超える場合のエラー
+var ErrRegionTooLarge = fmt.Errorf("region has more than %d temples; choose a smaller area", MaxTemples)
+
+// Region パックの対象の地域（都道府県または範囲のどちらか）
+type Region struct {
+	Prefecture string    `json:"prefecture,omitempty"`
+	BBox       *ent.BBox `json:"bbox,omitempty"`
+}
+
+// ParseRegion prefecture か bbox（minLng,minLat,maxLng,maxLat）から地域を作ります
+// 同じ範囲が同じパックになるよう、範囲は小数点以下4桁（約10m）に丸めます
+func ParseRegion(prefecture, bbox string) (Region, error) {
+	prefecture = strings.TrimSpace(prefecture)
+	switch {
+	case prefecture != "" && bbox != "":
+		return Region{}, fmt.Errorf("specify either prefecture or bbox, not both")
+	case prefecture != "":
+		return Region{Prefecture: prefecture}, nil
+	case bbox != "":
+		box, err := ent.ParseBBox(bbox)
+		if err != nil {
+			return Region{}, err
+		}
+		round := func(v float64) float64 { return math.Round(v*1e4) / 1e4 }
+		box.MinLng, box.MinLat, box.MaxLng, box.MaxLat = round(box.MinLng), round(box.MinLat), round(box.MaxLng), round(box.MaxLat)
+		return Region{BBox: box}, nil
+	}
+	return Region{}, fmt.Errorf("prefecture or bbox is required")
+}
+
+// Key パックのバージョンを管理する地域のキー
+func (r Region) Key() string {
+	if r.BBox != nil {
+		return fmt.Sprintf("bbox:%.4f,%.4f,%.4f,%.4f", r.BBox.MinLng, r.BBox.MinLat, r.BBox.MaxLng, r.BBox.MaxLat)
+	}
+	return "prefecture:" + r.Prefecture
+}
+
+// File パックに含まれるファイル
+type File struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// Manifest パックの目録。ZIP の manifest.json になります
+// 差分のパックでは Files は新しいバージョンの全ファイルで、ZIP には BaseVersion から変わったものだけが入ります
+type Manifest struct {
+	Format  int    `json:"format"`
+	Region  Region `json:"region"`
+	Key     string `json:"key"`
+	Version int    `json:"version"`
+	// ContentHash ファイルの一覧とハッシュから計算した、バージョンの内容のハッシュ
+	ContentHash string `json:"content_hash"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	Temples     int    `json:"temples"`
+	Files       []File `json:"files"`
+	Size        int    `json:"size"`
+
+	// 差分のパックでだけ設定されます
+	BaseVersion int      `json:"base_version,omitempty"`
+	Changed     []string `json:"changed,omitempty"`
+	Removed     []string `json:"removed,omitempty"`
+}
+
+// Pack 作成したパックの目録とファイルの内容
+type Pack struct {
+	Manifest Manifest
+	data     map[string][]byte
+}
+
+// add ファイルを追加します
+func (p *Pack) add(name string, data []byte) {
+	p.data[name] = data
+}
+
+// addJSON 値を JSON にしてファイルを追加します
+func (p *Pack) addJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", name, err)
+	}
+	p.add(name, data)
+	return nil
+}
+
+// packTemple temples/{id}.json の内容
+type packTemple struct {
+	*ent.Temple
+	// Translations 項目・言語ごとの翻訳
+	Translations map[string]map[string]string `json:"translations,omitempty"`
+	// Thumbnail パック内のサムネイルのパス
+	Thumbnail string `json:"thumbnail,omitempty"`
+}
+
+// packMedia ガイドの画像。File はパック内のサムネイルのパスです
+type packMedia struct {
+	ent.GuideMedia
+	File string `json:"file,omitempty"`
+}
+
+// packSection guide/sections/{slug}.{locale}.json の内容
+type packSection struct {
+	ID       int         `json:"id"`
+	Slug     string      `json:"slug"`
+	Locale   string      `json:"locale"`
+	Position int         `json:"position"`
+	Title    string      `json:"title"`
+	Body     string      `json:"body"`
+	Media    []packMedia `json:"media"`
+}
+
+// packTip guide/tips.{locale}.json の要素
+type packTip struct {
+	Slug     string `json:"slug"`
+	Position int    `json:"position"`
+	Text     string `json:"text"`
+}
+
+// Build 地域の最新の内容でパックを作ります
+// サムネイルは元画像ごとにストレージにキャッシュし、取得できない画像は含めません
+func Build(ctx context.Context, client *ent.Client, store storage.Storage, region Region) (*Pack, error) {
+	pack := &Pack{
+		Manifest: Manifest{Format: FormatVersion, Region: region, Key: region.Key()},
+		data:     map[string][]byte{},
+	}
+
+	temples, err := client.Temple.Query().
+		Filter(ent.TempleFilter{Prefecture: region.Prefecture, BBox: region.BBox}).
+		Limit(MaxTemples + 1).
+		All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(temples) > MaxTemples {
+		return nil, ErrRegionTooLarge
+	}
+	ids := make([]int, len(temples))
+	for i, t := range temples {
+		ids[i] = t.ID
+	}
+
+	translations, err := client.Translation.Load(ctx, ent.TypeTemple, ids, nil)
+	if err != nil {
+		return nil, err
+	}
+	photos, err := client.TempleProposal.Photos(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range temples {
+		entry := packTemple{Temple: t, Translations: translations[t.ID]}
+		if key, ok := photos[t.ID]; ok {
+			entry.Thumbnail = pack.addThumbnail(ctx, store, fmt.Sprintf("thumbnails/temples/%d.jpg", t.ID), key)
+		}
+		if err := pack.addJSON(fmt.Sprintf("temples/%d.json", t.ID), entry); err != nil {
+			return nil, err
+		}
+	}
+	pack.Manifest.Temples = len(temples)
+
+	if err := pack.addGuide(ctx, client, store); err != nil {
+		return nil, err
+	}
+
+	pack.seal()
+	return pack, nil
+}
+
+// addGuide 公開中のガイドを全ての言語で追加します
+func (p *Pack) addGuide(ctx context.Context, client *ent.Client, store storage.Storage) error {
+	published := ent.GuideFilter{Status: ent.GuideStatusPublished, Published: true}
+	sections, err := client.Guide.Sections(ctx, published)
+	if err != nil {
+		return err
+	}
+	tips, err := client.Guide.Tips(ctx, published)
+	if err != nil {
+		return err
+	}
+	header, err := client.Translation.Load(ctx, ent.TypeGuide, []int{1}, nil)
+	if err != nil {
+		return err
+	}
+	if err := p.addJSON("guide/guide.json", map[string]interface{}{"translations": header[1]}); err != nil {
+		return err
+	}
+
+	for _, s := range sections {
+		section := packSection{
+			ID: s.ID, Slug: s.Slug, Locale: s.Locale, Position: s.Position,
+			Title: s.Title, Body: s.Body, Media: []packMedia{},
+		}
+		for _, m := range s.Media {
+			media := packMedia{GuideMedia: m}
+			if m.Key != "" {
+				name := "thumbnails/guide/" + strings.TrimSuffix(path.Base(m.Key), path.Ext(m.Key)) + ".jpg"
+				media.File = p.addThumbnail(ctx, store, name, m.Key)
+			}
+			section.Media = append(section.Media, media)
+		}
+		if err := p.addJSON(fmt.Sprintf("guide/sections/%s.%s.json", s.Slug, s.Locale), section); err != nil {
+			return err
+		}
+	}
+
+	byLocale := map[string][]packTip{}
+	for _, t := range tips {
+		byLocale[t.Locale] = append(byLocale[t.Locale], packTip{Slug: t.Slug, Position: t.Position, Text: t.Body})
+	}
+	for locale, list := range byLocale {
+		if err := p.addJSON("guide/tips."+locale+".json", list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addThumbnail ストレージの画像のサムネイルを追加し、パック内のパスを返します
+// 作成できなかった場合は空文字を返します
+func (p *Pack) addThumbnail(ctx context.Context, store storage.Storage, name, key string) string {
+	if _, ok := p.data[name]; ok {
+		return name
+	}
+	data, err := thumbnail(ctx, store, key)
+	if err != nil {
+		log.Printf("region pack: skipping thumbnail of %s: %v", key, err)
+		return ""
+	}
+	p.add(name, data)
+	return name
+}
+
+// thumbnail 画像のサムネイルを返します
+// ストレージのキーは内容のハッシュなので、キーごとに packs/thumbnails にキャッシュします
+func thumbnail(ctx context.Context, store storage.Storage, key string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(key))
+	cacheKey := "packs/thumbnails/" + hex.EncodeToString(sum[:16]) + ".jpg"
+	if cached, err := readAll(ctx, store, cacheKey); err == nil {
+		return cached, nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+
+	source, err := readAll(ctx, store, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := Thumbnail(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Put(ctx, cacheKey, bytes.NewReader(data)); err != nil {
+		log.Printf("region pack: failed to cache thumbnail of %s: %v", key, err)
+	}
+	return data, nil
+}
+
+// readAll ストレージのファイルを上限サイズまで読み込みます
+func readAll(ctx context.Context, store storage.Storage, key string) ([]byte, error) {
+	rc, err := store.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxSourceImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSourceImageSize {
+		return nil, fmt.Errorf("image too large: %s", key)
+	}
+	return data, nil
+}
+
+// seal ファイルの一覧とハッシュ、内容のハッシュを目録に設定します
+func (p *Pack) seal() {
+	names := make([]string, 0, len(p.data))
+	for name := range p.data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	content := sha256.New()
+	p.Manifest.Files = make([]File, 0, len(names))
+	p.Manifest.Size = 0
+	for _, name := range names {
+		sum := sha256.Sum256(p.data[name])
+		f := File{Path: name, SHA256: hex.EncodeToString(sum[:]), Size: len(p.data[name])}
+		p.Manifest.Files = append(p.Manifest.Files, f)
+		p.Manifest.Size += f.Size
+		fmt.Fprintf(content, "%s\x00%s\n", f.Path, f.SHA256)
+	}
+	p.Manifest.ContentHash = hex.EncodeToString(content.Sum(nil))
+}
+
+// Publish パックのバージョンを記録し、目録にバージョンを設定します
+// 最新のバージョンと内容が同じであれば、そのバージョンのままです
+func Publish(ctx context.Context, client *ent.Client, pack *Pack) error {
+	files, err := json.Marshal(pack.Manifest.Files)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %v", err)
+	}
+	saved, err := client.RegionPack.Save(ctx, pack.Manifest.Key, pack.Manifest.ContentHash, string(files))
+	if err != nil {
+		return err
+	}
+	pack.Manifest.Version = saved.Version
+	pack.Manifest.CreatedAt = saved.CreatedAt
+	return nil
+}
+
+// Delta since のバージョンから変わったファイルのパスを返します
+// since のバージョンが記録されていない場合は ok が false で、全てのファイルが必要です
+func Delta(ctx context.Context, client *ent.Client, pack *Pack, since int) (changed, removed []string, ok bool, err error) {
+	base, err := client.RegionPack.Get(ctx, pack.Manifest.Key, since)
+	if err != nil || base == nil {
+		return nil, nil, false, err
+	}
+	var baseFiles []File
+	if err := json.Unmarshal([]byte(base.Manifest), &baseFiles); err != nil {
+		return nil, nil, false, fmt.Errorf("invalid manifest of version %d: %v", since, err)
+	}
+
+	previous := map[string]string{}
+	for _, f := range baseFiles {
+		previous[f.Path] = f.SHA256
+	}
+	changed, removed = []string{}, []string{}
+	for _, f := range pack.Manifest.Files {
+		if previous[f.Path] != f.SHA256 {
+			changed = append(changed, f.Path)
+		}
+		delete(previous, f.Path)
+	}
+	for name := range previous {
+		removed = append(removed, name)
+	}
+	sort.Strings(removed)
+	return changed, removed, true, nil
+}
+
+// WriteZIP パックを ZIP で書き出します。先頭の manifest.json に続けてファイルを格納します
+// only が nil でなければ、そのパスのファイルだけを含めます（差分のパック）
+func WriteZIP(w io.Writer, pack *Pack, manifest Manifest, only []string) error {
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+
+	names := only
+	if names == nil {
+		names = make([]string, len(pack.Manifest.Files))
+		for i, file := range pack.Manifest.Files {
+			names[i] = file.Path
+		}
+	}
+	for _, name := range names {
+		method := zip.Deflate
+		// JPEG はそれ以上圧縮できないのでそのまま格納します
+		if strings.HasSuffix(name, ".jpg") {
+			method = zip.Store
+		}
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(pack.data[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
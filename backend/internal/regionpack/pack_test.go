@@ -0,0 +1,153 @@
+package regionpack
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/database"
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/storage"
+)
+
+// testNow テストの現在時刻
+var testNow = time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	// マイグレーションのログでテストの出力が埋もれないようにします
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestParseRegion(t *testing.T) {
+	cases := []struct {
+		prefecture, bbox string
+		wantKey          string
+		wantErr          bool
+	}{
+		{" 東京都 ", "", "prefecture:東京都", false},
+		// 同じ範囲が同じキーになるよう小数点以下4桁に丸めます
+		{"", "139.700001,35.600049,139.8,35.8", "bbox:139.7000,35.6000,139.8000,35.8000", false},
+		{"東京都", "139.7,35.6,139.8,35.8", "", true},
+		{"", "139.7,35.6", "", true},
+		{"", "", "", true},
+	}
+	for _, c := range cases {
+		region, err := ParseRegion(c.prefecture, c.bbox)
+		if (err != nil) != c.wantErr {
+			t.Errorf("ParseRegion(%q, %q) error = %v; want error %v", c.prefecture, c.bbox, err, c.wantErr)
+			continue
+		}
+		if err == nil && region.Key() != c.wantKey {
+			t.Errorf("ParseRegion(%q, %q) key = %q; want %q", c.prefecture, c.bbox, region.Key(), c.wantKey)
+		}
+	}
+}
+
+func TestPublishAndDelta(t *testing.T) {
+	client, err := database.OpenWithClock(map[string]string{"driver": "sqlite", "name": ":memory:"}, clock.Fixed(testNow))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer client.Close()
+	store := storage.NewLocal(t.TempDir(), "http://localhost/uploads/")
+	ctx := context.Background()
+	region := Region{Prefecture: "東京都"}
+
+	// publish 地域の最新の内容でパックを作ってバージョンを記録します
+	publish := func() *Pack {
+		t.Helper()
+		pack, err := Build(ctx, client, store, region)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Publish(ctx, client, pack); err != nil {
+			t.Fatal(err)
+		}
+		return pack
+	}
+
+	first := publish()
+	if first.Manifest.Version != 1 || first.Manifest.Temples == 0 || first.Manifest.Key != "prefecture:東京都" {
+		t.Fatalf("manifest = %+v; want version 1 of the seeded temples", first.Manifest)
+	}
+	// 内容が変わらなければバージョンは上がりません
+	if again := publish(); again.Manifest.Version != 1 || again.Manifest.ContentHash != first.Manifest.ContentHash {
+		t.Errorf("unchanged manifest = %+v; want version 1", again.Manifest)
+	}
+
+	temple, err := client.Temple.Create().
+		SetName("護国寺").SetPrefecture("東京都").SetKind("temple").
+		SetLatitude(35.7179).SetLongitude(139.7271).SetActive(true).
+		Save(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := publish()
+	if err := client.Temple.DeleteOneID(temple.ID).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	removed := publish()
+	if added.Manifest.Version != 2 || removed.Manifest.Version != 3 {
+		t.Errorf("versions = %d, %d; want 2, 3", added.Manifest.Version, removed.Manifest.Version)
+	}
+
+	name := fmt.Sprintf("temples/%d.json", temple.ID)
+	cases := []struct {
+		pack        *Pack
+		since       int
+		wantOK      bool
+		wantChanged []string
+		wantRemoved []string
+	}{
+		{added, 1, true, []string{name}, []string{}},
+		{removed, 2, true, []string{}, []string{name}},
+		{removed, 1, true, []string{}, []string{}},
+		{removed, 9, false, nil, nil},
+	}
+	for _, c := range cases {
+		changed, removed, ok, err := Delta(ctx, client, c.pack, c.since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != c.wantOK || !reflect.DeepEqual(changed, c.wantChanged) || !reflect.DeepEqual(removed, c.wantRemoved) {
+			t.Errorf("Delta(v%d since %d) = %q, %q, %v; want %q, %q, %v",
+				c.pack.Manifest.Version, c.since, changed, removed, ok, c.wantChanged, c.wantRemoved, c.wantOK)
+		}
+	}
+
+	// 差分の ZIP には目録と変わったファイルだけを格納します
+	var buf bytes.Buffer
+	if err := WriteZIP(&buf, added, added.Manifest, []string{name}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if want := []string{"manifest.json", name}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("zip files = %q; want %q", names, want)
+	}
+	rc, err := zr.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var entry ent.Temple
+	if err := json.NewDecoder(rc).Decode(&entry); err != nil || entry.Name != "護国寺" {
+		t.Errorf("%s = %+v, %v; want 護国寺", name, entry, err)
+	}
+}
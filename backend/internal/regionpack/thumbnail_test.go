@@ -0,0 +1,74 @@
+package regionpack
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	cases := []struct {
+		name          string
+		width, height int
+		fill          color.Color
+		wantW, wantH  int
+	}{
+		{"wide", 640, 320, color.RGBA{R: 0xff, A: 0xff}, 320, 160},
+		{"tall", 300, 900, color.RGBA{G: 0xff, A: 0xff}, 106, 320},
+		// 小さい画像は拡大しません
+		{"small", 100, 50, color.RGBA{B: 0xff, A: 0xff}, 100, 50},
+		// 透過部分は白になります
+		{"transparent", 400, 400, color.Transparent, 320, 320},
+	}
+	for _, c := range cases {
+		src := image.NewRGBA(image.Rect(0, 0, c.width, c.height))
+		for y := 0; y < c.height; y++ {
+			for x := 0; x < c.width; x++ {
+				src.Set(x, y, c.fill)
+			}
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, src); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := Thumbnail(buf.Bytes())
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: thumbnail is not a JPEG: %v", c.name, err)
+			continue
+		}
+		if b := img.Bounds(); b.Dx() != c.wantW || b.Dy() != c.wantH {
+			t.Errorf("%s: size = %dx%d; want %dx%d", c.name, b.Dx(), b.Dy(), c.wantW, c.wantH)
+		}
+
+		// JPEG の誤差を許して中央の色を比べます
+		want := color.RGBAModel.Convert(c.fill).(color.RGBA)
+		if want.A == 0 {
+			want = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+		}
+		got := color.RGBAModel.Convert(img.At(c.wantW/2, c.wantH/2)).(color.RGBA)
+		if diff(got.R, want.R) > 8 || diff(got.G, want.G) > 8 || diff(got.B, want.B) > 8 {
+			t.Errorf("%s: color = %v; want %v", c.name, got, want)
+		}
+	}
+
+	if _, err := Thumbnail([]byte("not an image")); err == nil {
+		t.Errorf("Thumbnail accepted data that is not an image")
+	}
+}
+
+// diff 色の成分の差を返します
+func diff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
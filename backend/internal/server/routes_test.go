@@ -0,0 +1,385 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+// 寺社のID（fixtures.yaml の登録順）: 1 浅草寺, 2 明治神宮, 3 金閣寺（サンプル）,
+// 4 清水寺, 5 伏見稲荷大社, 6 東大寺, 7 休止中の寺
+// 御朱印のID: 1〜3 alice（清水寺・伏見稲荷大社・東大寺）, 4 bob（清水寺）
+
+var (
+	kyoto = url.QueryEscape("京都府")
+	nara  = url.QueryEscape("奈良県")
+)
+
+// repositoryCases 寺社と御朱印のリポジトリだけを使うルート
+// SQLite とメモリ上のリポジトリの両方で実行します
+var repositoryCases = []routeCase{
+	{name: "health", method: "GET", path: "/health", status: http.StatusOK},
+	{name: "cors_preflight", method: "OPTIONS", path: "/api/v1/temples", status: http.StatusOK},
+
+	// 寺社
+	{name: "temples_list", method: "GET", path: "/api/v1/temples", status: http.StatusOK},
+	{name: "temples_search", method: "GET", path: "/api/v1/temples?q=KIYOMIZU", status: http.StatusOK},
+	{name: "temples_filter_prefecture_kind", method: "GET", path: "/api/v1/temples?prefecture=" + kyoto + "&kind=shrine", status: http.StatusOK},
+	{name: "temples_filter_bbox", method: "GET", path: "/api/v1/temples?bbox=135.7,34.9,135.8,35.0", status: http.StatusOK},
+	{name: "temples_include_inactive", method: "GET", path: "/api/v1/temples?prefecture=" + nara + "&include_inactive=true", status: http.StatusOK},
+	{name: "temples_procedure_unknown", method: "GET", path: "/api/v1/temples?cash_only=true", status: http.StatusOK},
+	{name: "temples_bad_kind", method: "GET", path: "/api/v1/temples?kind=church", status: http.StatusBadRequest},
+	{name: "temples_bad_bbox", method: "GET", path: "/api/v1/temples?bbox=1,2,3", status: http.StatusBadRequest},
+	{name: "temples_bad_include_inactive", method: "GET", path: "/api/v1/temples?include_inactive=maybe", status: http.StatusBadRequest},
+	{name: "temple_get", method: "GET", path: "/api/v1/temples/4", status: http.StatusOK},
+	{name: "temple_get_bad_id", method: "GET", path: "/api/v1/temples/abc", status: http.StatusBadRequest},
+	{name: "temple_get_unknown", method: "GET", path: "/api/v1/temples/999", status: http.StatusNotFound},
+	{name: "temples_nearby", method: "GET", path: "/api/v1/temples/nearby?lat=35.71&lng=139.79", status: http.StatusOK},
+	{name: "temples_nearby_missing_location", method: "GET", path: "/api/v1/temples/nearby", status: http.StatusBadRequest},
+	{name: "temples_export_geojson", method: "GET", path: "/api/v1/temples/export?prefecture=" + kyoto, status: http.StatusOK},
+	{name: "temples_export_csv", method: "GET", path: "/api/v1/temples/export?format=csv&prefecture=" + nara, status: http.StatusOK},
+	{name: "temples_export_bad_format", method: "GET", path: "/api/v1/temples/export?format=xml", status: http.StatusBadRequest},
+
+	// 御朱印
+	{name: "goshuin_list_unauthenticated", method: "GET", path: "/api/v1/goshuin", status: http.StatusUnauthorized},
+	{name: "goshuin_list_bad_token", method: "GET", path: "/api/v1/goshuin", headers: map[string]string{"Authorization": "Bearer nope"}, status: http.StatusUnauthorized},
+	{name: "goshuin_list", user: "alice", method: "GET", path: "/api/v1/goshuin", status: http.StatusOK},
+	{name: "goshuin_list_other_user", user: "bob", method: "GET", path: "/api/v1/goshuin", status: http.StatusOK},
+	{name: "goshuin_list_tag", user: "alice", method: "GET", path: "/api/v1/goshuin?tag=KYOTO", status: http.StatusOK},
+	{name: "goshuin_list_tags_all", user: "alice", method: "GET", path: "/api/v1/goshuin?tag=kyoto,spring", status: http.StatusOK},
+	{name: "goshuin_list_min_rating", user: "alice", method: "GET", path: "/api/v1/goshuin?min_rating=4", status: http.StatusOK},
+	{name: "goshuin_list_bad_rating", user: "alice", method: "GET", path: "/api/v1/goshuin?rating=9", status: http.StatusBadRequest},
+	{name: "goshuin_get", user: "alice", method: "GET", path: "/api/v1/goshuin/1", status: http.StatusOK},
+	{name: "goshuin_get_other_user", user: "bob", method: "GET", path: "/api/v1/goshuin/1", status: http.StatusNotFound},
+	{name: "goshuin_get_bad_id", user: "alice", method: "GET", path: "/api/v1/goshuin/abc", status: http.StatusBadRequest},
+	{name: "goshuin_get_unknown", user: "alice", method: "GET", path: "/api/v1/goshuin/999", status: http.StatusNotFound},
+	{name: "goshuin_create", user: "alice", method: "POST", path: "/api/v1/goshuin",
+		body:   `{"client_id":"0b6e5c1a-3f2d-4e8a-9c7b-1a2b3c4d5e6f","temple_id":2,"notes":"**初詣**","tags":["Tokyo","  new year "],"rating":4,"fee_paid":500,"waiting_minutes":30,"hall_name":" 本殿 ","collected_at":"2024-05-20T08:00:00+09:00"}`,
+		status: http.StatusCreated},
+	{name: "goshuin_create_default_collected_at", user: "bob", method: "POST", path: "/api/v1/goshuin", body: `{"temple_id":6}`, status: http.StatusCreated},
+	{name: "goshuin_create_missing_temple", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"notes":"no temple"}`, status: http.StatusBadRequest},
+	{name: "goshuin_create_unknown_temple", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"temple_id":999}`, status: http.StatusBadRequest},
+	{name: "goshuin_create_bad_json", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"temple_id":`, status: http.StatusBadRequest},
+	{name: "goshuin_create_duplicate_client_id", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"client_id":"0b6e5c1a-3f2d-4e8a-9c7b-1a2b3c4d5e6f","temple_id":2}`, status: http.StatusConflict},
+	{name: "goshuin_create_bad_client_id", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"client_id":"not-a-uuid","temple_id":2}`, status: http.StatusBadRequest},
+	{name: "goshuin_create_bad_rating", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"temple_id":2,"rating":7}`, status: http.StatusBadRequest},
+	{name: "goshuin_create_future", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"temple_id":2,"collected_at":"2024-06-02T12:00:00+09:00"}`, status: http.StatusBadRequest},
+	{name: "goshuin_create_bad_collected_at", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"temple_id":2,"collected_at":"2024-05-20"}`, status: http.StatusBadRequest},
+	{name: "goshuin_create_unauthenticated", method: "POST", path: "/api/v1/goshuin", body: `{"temple_id":2}`, status: http.StatusUnauthorized},
+	{name: "goshuin_update", user: "alice", method: "PUT", path: "/api/v1/goshuin/5",
+		body:   `{"notes":"初詣（二回目）","tags":["tokyo","shrine"],"rating":5,"collected_at":"2024-05-21T07:30:00+09:00"}`,
+		status: http.StatusOK},
+	{name: "goshuin_update_clear_details", user: "alice", method: "PUT", path: "/api/v1/goshuin/5", body: `{"notes":"初詣（二回目）","rating":0,"hall_name":""}`, status: http.StatusOK},
+	{name: "goshuin_update_partial", user: "alice", method: "PUT", path: "/api/v1/goshuin/5", body: `{"rating":3}`, status: http.StatusOK},
+	{name: "goshuin_update_bad_rating", user: "alice", method: "PUT", path: "/api/v1/goshuin/5", body: `{"rating":-1}`, status: http.StatusBadRequest},
+	{name: "goshuin_update_bad_json", user: "alice", method: "PUT", path: "/api/v1/goshuin/5", body: `[]`, status: http.StatusBadRequest},
+	{name: "goshuin_update_other_user", user: "bob", method: "PUT", path: "/api/v1/goshuin/5", body: `{"notes":"mine"}`, status: http.StatusNotFound},
+	{name: "goshuin_update_bad_id", user: "alice", method: "PUT", path: "/api/v1/goshuin/abc", body: `{}`, status: http.StatusBadRequest},
+	{name: "goshuin_update_unknown", user: "alice", method: "PUT", path: "/api/v1/goshuin/999", body: `{}`, status: http.StatusNotFound},
+	{name: "goshuin_list_after_create", user: "alice", method: "GET", path: "/api/v1/goshuin", status: http.StatusOK},
+
+	// ゴミ箱
+	{name: "goshuin_delete", user: "alice", method: "DELETE", path: "/api/v1/goshuin/5", status: http.StatusOK},
+	{name: "goshuin_get_deleted", user: "alice", method: "GET", path: "/api/v1/goshuin/5", status: http.StatusNotFound},
+	{name: "goshuin_delete_deleted", user: "alice", method: "DELETE", path: "/api/v1/goshuin/5", status: http.StatusNotFound},
+	{name: "goshuin_delete_other_user", user: "bob", method: "DELETE", path: "/api/v1/goshuin/1", status: http.StatusNotFound},
+	{name: "goshuin_delete_bad_id", user: "alice", method: "DELETE", path: "/api/v1/goshuin/abc", status: http.StatusBadRequest},
+	{name: "trash_list", user: "alice", method: "GET", path: "/api/v1/me/trash", status: http.StatusOK},
+	{name: "trash_list_other_user", user: "bob", method: "GET", path: "/api/v1/me/trash", status: http.StatusOK},
+	{name: "goshuin_restore", user: "alice", method: "POST", path: "/api/v1/goshuin/5/restore", status: http.StatusOK},
+	{name: "goshuin_restore_not_in_trash", user: "alice", method: "POST", path: "/api/v1/goshuin/5/restore", status: http.StatusNotFound},
+	{name: "goshuin_restore_bad_id", user: "alice", method: "POST", path: "/api/v1/goshuin/abc/restore", status: http.StatusBadRequest},
+	{name: "goshuin_delete_again", user: "alice", method: "DELETE", path: "/api/v1/goshuin/5", status: http.StatusOK},
+	{name: "trash_purge_other_user", user: "bob", method: "DELETE", path: "/api/v1/me/trash/5", status: http.StatusNotFound},
+	{name: "trash_purge", user: "alice", method: "DELETE", path: "/api/v1/me/trash/5", status: http.StatusOK},
+	{name: "trash_purge_purged", user: "alice", method: "DELETE", path: "/api/v1/me/trash/5", status: http.StatusNotFound},
+	{name: "trash_purge_bad_id", user: "alice", method: "DELETE", path: "/api/v1/me/trash/abc", status: http.StatusBadRequest},
+	{name: "trash_list_after_purge", user: "alice", method: "GET", path: "/api/v1/me/trash", status: http.StatusOK},
+
+	// 寺社の削除
+	{name: "temple_delete_forbidden", user: "erika", method: "DELETE", path: "/api/v1/temples/3", status: http.StatusForbidden},
+	{name: "temple_delete_unauthenticated", method: "DELETE", path: "/api/v1/temples/3", status: http.StatusUnauthorized},
+	{name: "temple_delete", user: "admin", method: "DELETE", path: "/api/v1/temples/3", status: http.StatusOK},
+	{name: "temple_get_deleted", method: "GET", path: "/api/v1/temples/3", status: http.StatusNotFound},
+	{name: "temple_delete_deleted", user: "admin", method: "DELETE", path: "/api/v1/temples/3", status: http.StatusNotFound},
+	{name: "temple_delete_bad_id", user: "admin", method: "DELETE", path: "/api/v1/temples/abc", status: http.StatusBadRequest},
+	{name: "goshuin_create_deleted_temple", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"temple_id":3}`, status: http.StatusBadRequest},
+	{name: "temples_list_after_delete", method: "GET", path: "/api/v1/temples", status: http.StatusOK},
+	{name: "temple_restore", user: "admin", method: "POST", path: "/api/v1/temples/3/restore", status: http.StatusOK},
+	{name: "temple_restore_not_deleted", user: "admin", method: "POST", path: "/api/v1/temples/3/restore", status: http.StatusNotFound},
+	{name: "temple_restore_forbidden", user: "alice", method: "POST", path: "/api/v1/temples/3/restore", status: http.StatusForbidden},
+	{name: "temple_delete_with_collections", user: "admin", method: "DELETE", path: "/api/v1/temples/4", status: http.StatusOK},
+	{name: "goshuin_get_deleted_temple", user: "alice", method: "GET", path: "/api/v1/goshuin/1", status: http.StatusOK},
+	{name: "temple_restore_with_collections", user: "admin", method: "POST", path: "/api/v1/temples/4/restore", status: http.StatusOK},
+}
+
+// routeCases データベースが必要なルート。repositoryCases の後に SQLite で実行します
+var routeCases = []routeCase{
+	// 写真
+	{name: "photo_upload", user: "alice", method: "POST", path: "/api/v1/goshuin/1/photos", form: map[string]string{"kind": "stamp", "caption": "本堂の御朱印"}, file: "file", status: http.StatusCreated},
+	{name: "photo_link", user: "alice", method: "POST", path: "/api/v1/goshuin/1/photos", body: `{"url":"https://example.com/kiyomizu.jpg","kind":"scenery","caption":"舞台"}`, status: http.StatusCreated},
+	{name: "photo_link_missing_url", user: "alice", method: "POST", path: "/api/v1/goshuin/1/photos", body: `{"kind":"scenery"}`, status: http.StatusBadRequest},
+	{name: "photo_link_bad_kind", user: "alice", method: "POST", path: "/api/v1/goshuin/1/photos", body: `{"url":"https://example.com/a.jpg","kind":"selfie"}`, status: http.StatusBadRequest},
+	{name: "photo_add_other_user", user: "bob", method: "POST", path: "/api/v1/goshuin/1/photos", body: `{"url":"https://example.com/a.jpg"}`, status: http.StatusNotFound},
+	{name: "photos_list", user: "alice", method: "GET", path: "/api/v1/goshuin/1/photos", status: http.StatusOK},
+	{name: "photos_list_bad_id", user: "alice", method: "GET", path: "/api/v1/goshuin/abc/photos", status: http.StatusBadRequest},
+	{name: "photos_reorder", user: "alice", method: "PUT", path: "/api/v1/goshuin/1/photos/order", body: `{"photo_ids":[2,1]}`, status: http.StatusOK},
+	{name: "photos_reorder_incomplete", user: "alice", method: "PUT", path: "/api/v1/goshuin/1/photos/order", body: `{"photo_ids":[2]}`, status: http.StatusBadRequest},
+	{name: "photo_update", user: "alice", method: "PUT", path: "/api/v1/goshuin/1/photos/1", body: `{"caption":"清水寺の御朱印","cover":true}`, status: http.StatusOK},
+	{name: "photo_update_bad_photo_id", user: "alice", method: "PUT", path: "/api/v1/goshuin/1/photos/abc", body: `{}`, status: http.StatusBadRequest},
+	{name: "photo_update_unknown", user: "alice", method: "PUT", path: "/api/v1/goshuin/1/photos/999", body: `{}`, status: http.StatusNotFound},
+	{name: "photo_file", method: "GET", path: "/uploads/goshuin/alice/d0afbaf740ad2d35e78e6238ae16b5b1.png", status: http.StatusOK},
+	{name: "photo_delete", user: "alice", method: "DELETE", path: "/api/v1/goshuin/1/photos/2", status: http.StatusOK},
+	{name: "photo_delete_unknown", user: "alice", method: "DELETE", path: "/api/v1/goshuin/1/photos/2", status: http.StatusNotFound},
+	{name: "goshuin_get_with_photos", user: "alice", method: "GET", path: "/api/v1/goshuin/1", status: http.StatusOK},
+
+	// 集計・バッジ
+	{name: "me_tags", user: "alice", method: "GET", path: "/api/v1/me/tags", status: http.StatusOK},
+	{name: "me_stats", user: "alice", method: "GET", path: "/api/v1/me/stats", status: http.StatusOK},
+	{name: "me_stats_unauthenticated", method: "GET", path: "/api/v1/me/stats", status: http.StatusUnauthorized},
+	{name: "badges", method: "GET", path: "/api/v1/badges", status: http.StatusOK},
+	{name: "me_badges", user: "alice", method: "GET", path: "/api/v1/me/badges", status: http.StatusOK},
+
+	// 御朱印帳
+	{name: "book_create", user: "alice", method: "POST", path: "/api/v1/books", body: `{"title":"京都の御朱印帳","type":"temple","capacity":40,"started_on":"2024-04-01"}`, status: http.StatusCreated},
+	{name: "book_create_missing_title", user: "alice", method: "POST", path: "/api/v1/books", body: `{"capacity":40}`, status: http.StatusBadRequest},
+	{name: "books_list", user: "alice", method: "GET", path: "/api/v1/books", status: http.StatusOK},
+	{name: "book_stamps_move", user: "alice", method: "POST", path: "/api/v1/books/1/stamps", body: `{"collection_ids":[1,2]}`, status: http.StatusOK},
+	{name: "book_stamps_missing_ids", user: "alice", method: "POST", path: "/api/v1/books/1/stamps", body: `{}`, status: http.StatusBadRequest},
+	{name: "book_get", user: "alice", method: "GET", path: "/api/v1/books/1", status: http.StatusOK},
+	{name: "book_get_other_user", user: "bob", method: "GET", path: "/api/v1/books/1", status: http.StatusNotFound},
+	{name: "book_get_bad_id", user: "alice", method: "GET", path: "/api/v1/books/abc", status: http.StatusBadRequest},
+	{name: "book_update", user: "alice", method: "PUT", path: "/api/v1/books/1", body: `{"title":"京都・奈良の御朱印帳","type":"temple","capacity":48,"started_on":"2024-04-01","ended_on":"2024-05-31"}`, status: http.StatusOK},
+	{name: "book_update_unknown", user: "alice", method: "PUT", path: "/api/v1/books/999", body: `{"title":"x"}`, status: http.StatusNotFound},
+	{name: "book_delete", user: "alice", method: "DELETE", path: "/api/v1/books/1", status: http.StatusOK},
+	{name: "book_delete_unknown", user: "alice", method: "DELETE", path: "/api/v1/books/1", status: http.StatusNotFound},
+
+	// 一括操作
+	{name: "batch", user: "alice", method: "POST", path: "/api/v1/goshuin:batch",
+		body:   `{"operations":[{"op":"create","temple_id":5,"notes":"千本鳥居"},{"op":"update","id":2,"rating":5},{"op":"delete","id":999}]}`,
+		status: http.StatusOK},
+	{name: "batch_atomic_rollback", user: "alice", method: "POST", path: "/api/v1/goshuin:batch?atomic=true",
+		body:   `{"operations":[{"op":"update","id":2,"rating":1},{"op":"create","temple_id":999}]}`,
+		status: http.StatusBadRequest},
+	{name: "batch_empty", user: "alice", method: "POST", path: "/api/v1/goshuin:batch", body: `{"operations":[]}`, status: http.StatusBadRequest},
+	{name: "batch_bad_atomic", user: "alice", method: "POST", path: "/api/v1/goshuin:batch?atomic=maybe", body: `{"operations":[{"op":"delete","id":2}]}`, status: http.StatusBadRequest},
+
+	// 同期
+	{name: "sync_changes", user: "alice", method: "GET", path: "/api/v1/sync", status: http.StatusOK},
+	{name: "sync_changes_bad_since", user: "alice", method: "GET", path: "/api/v1/sync?since=abc", status: http.StatusBadRequest},
+	{name: "sync_push", user: "alice", method: "POST", path: "/api/v1/sync",
+		body:   `{"mutations":[{"id":"9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c01","client_id":"9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c02","op":"upsert","changed_at":"2024-05-30T10:00:00+09:00","temple_id":6,"fields":{"notes":"大仏殿","rating":4}}]}`,
+		status: http.StatusOK},
+	{name: "sync_push_replay", user: "alice", method: "POST", path: "/api/v1/sync",
+		body:   `{"mutations":[{"id":"9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c01","client_id":"9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c02","op":"upsert","changed_at":"2024-05-30T10:00:00+09:00","temple_id":6,"fields":{"notes":"大仏殿","rating":4}}]}`,
+		status: http.StatusOK},
+	{name: "sync_push_empty", user: "alice", method: "POST", path: "/api/v1/sync", body: `{"mutations":[]}`, status: http.StatusBadRequest},
+
+	// エクスポート・インポート
+	{name: "export_json", user: "alice", method: "GET", path: "/api/v1/me/goshuin/export", status: http.StatusOK},
+	{name: "export_csv", user: "alice", method: "GET", path: "/api/v1/me/goshuin/export?format=csv", status: http.StatusOK},
+	{name: "export_zip", user: "alice", method: "GET", path: "/api/v1/me/goshuin/export?format=zip", status: http.StatusOK},
+	{name: "export_pdf", user: "alice", method: "GET", path: "/api/v1/me/goshuin/export?format=pdf", status: http.StatusOK},
+	{name: "export_bad_format", user: "alice", method: "GET", path: "/api/v1/me/goshuin/export?format=xml", status: http.StatusBadRequest},
+	{name: "import", user: "bob", method: "POST", path: "/api/v1/me/goshuin/import",
+		body:   `{"version":1,"collections":[{"temple":{"id":5,"name":"伏見稲荷大社","latitude":34.9671,"longitude":135.7727},"notes":"お山めぐり","collected_at":"2024-04-10T08:00:00+09:00"}]}`,
+		status: http.StatusOK},
+	{name: "import_bad_body", user: "bob", method: "POST", path: "/api/v1/me/goshuin/import", body: `not json`, status: http.StatusBadRequest},
+
+	// 翻訳
+	{name: "translation_put", user: "erika", method: "PUT", path: "/api/v1/translations", body: `{"entity_type":"Temple","entity_id":4,"field":"description","locale":"zh-TW","value":" 以清水舞台聞名。 "}`, status: http.StatusOK},
+	{name: "translation_put_unknown_temple", user: "erika", method: "PUT", path: "/api/v1/translations", body: `{"entity_type":"Temple","entity_id":999,"field":"description","locale":"en","value":"x"}`, status: http.StatusNotFound},
+	{name: "translation_put_bad_locale", user: "erika", method: "PUT", path: "/api/v1/translations", body: `{"entity_type":"Temple","entity_id":4,"field":"description","locale":"??","value":"x"}`, status: http.StatusBadRequest},
+	{name: "translation_put_forbidden", user: "alice", method: "PUT", path: "/api/v1/translations", body: `{"entity_type":"Temple","entity_id":4,"field":"description","locale":"en","value":"x"}`, status: http.StatusForbidden},
+	{name: "translations_list", user: "erika", method: "GET", path: "/api/v1/translations?entity_type=Temple&entity_id=4", status: http.StatusOK},
+	{name: "temple_get_localized", method: "GET", path: "/api/v1/temples/4", headers: map[string]string{"Accept-Language": "zh-TW,zh;q=0.9"}, status: http.StatusOK},
+	{name: "translation_delete", user: "erika", method: "DELETE", path: "/api/v1/translations/1", status: http.StatusOK},
+	{name: "translation_delete_unknown", user: "erika", method: "DELETE", path: "/api/v1/translations/1", status: http.StatusNotFound},
+	{name: "translation_delete_bad_id", user: "erika", method: "DELETE", path: "/api/v1/translations/abc", status: http.StatusBadRequest},
+
+	// 修正提案
+	{name: "correction_create", user: "alice", method: "POST", path: "/api/v1/temples/4/corrections", body: `{"changes":{"phone":"075-551-1234","goshuin_fee":"500円"},"comment":"電話番号が変わりました"}`, status: http.StatusCreated},
+	{name: "correction_create_with_photo", user: "bob", method: "POST", path: "/api/v1/temples/5/corrections", form: map[string]string{"changes": `{"opening_hours":"24時間"}`, "comment": "看板の写真"}, file: "photo", status: http.StatusCreated},
+	{name: "correction_create_third", user: "bob", method: "POST", path: "/api/v1/temples/6/corrections", body: `{"changes":{"website":"https://www.todaiji.or.jp"}}`, status: http.StatusCreated},
+	{name: "correction_create_unknown_temple", user: "alice", method: "POST", path: "/api/v1/temples/999/corrections", body: `{"changes":{"phone":"x"}}`, status: http.StatusNotFound},
+	{name: "correction_create_bad_field", user: "alice", method: "POST", path: "/api/v1/temples/4/corrections", body: `{"changes":{"id":5}}`, status: http.StatusBadRequest},
+	{name: "correction_create_missing_changes", user: "alice", method: "POST", path: "/api/v1/temples/4/corrections", body: `{"comment":"?"}`, status: http.StatusBadRequest},
+	{name: "me_corrections", user: "alice", method: "GET", path: "/api/v1/me/corrections", status: http.StatusOK},
+	{name: "correction_queue_forbidden", user: "alice", method: "GET", path: "/api/v1/moderation/corrections", status: http.StatusForbidden},
+	{name: "correction_queue", user: "erika", method: "GET", path: "/api/v1/moderation/corrections?status=pending", status: http.StatusOK},
+	{name: "correction_get", user: "erika", method: "GET", path: "/api/v1/moderation/corrections/1", status: http.StatusOK},
+	{name: "correction_get_bad_id", user: "erika", method: "GET", path: "/api/v1/moderation/corrections/abc", status: http.StatusBadRequest},
+	{name: "correction_get_unknown", user: "erika", method: "GET", path: "/api/v1/moderation/corrections/999", status: http.StatusNotFound},
+	{name: "correction_approve", user: "erika", method: "POST", path: "/api/v1/moderation/corrections/1/approve", body: `{"note":"確認しました"}`, status: http.StatusOK},
+	{name: "correction_approve_again", user: "erika", method: "POST", path: "/api/v1/moderation/corrections/1/approve", body: `{}`, status: http.StatusConflict},
+	{name: "correction_merge", user: "erika", method: "POST", path: "/api/v1/moderation/corrections/2/merge", body: `{"fields":{"opening_hours":"終日"}}`, status: http.StatusOK},
+	{name: "correction_reject", user: "erika", method: "POST", path: "/api/v1/moderation/corrections/3/reject", body: `{"note":"公式サイトと異なります"}`, status: http.StatusOK},
+	{name: "correction_reject_forbidden", user: "alice", method: "POST", path: "/api/v1/moderation/corrections/3/reject", body: `{}`, status: http.StatusForbidden},
+	{name: "temple_get_corrected", method: "GET", path: "/api/v1/temples/4", status: http.StatusOK},
+
+	// 通知
+	{name: "notifications", user: "bob", method: "GET", path: "/api/v1/me/notifications", status: http.StatusOK},
+	{name: "notifications_read", user: "bob", method: "POST", path: "/api/v1/me/notifications/read", body: `{}`, status: http.StatusOK},
+	{name: "notifications_read_bad_json", user: "bob", method: "POST", path: "/api/v1/me/notifications/read", body: `{"ids":`, status: http.StatusBadRequest},
+	{name: "notifications_unread", user: "bob", method: "GET", path: "/api/v1/me/notifications?unread=true", status: http.StatusOK},
+
+	// 寺社の提案
+	{name: "proposal_check", user: "alice", method: "POST", path: "/api/v1/temple-proposals/check", body: `{"name":"清水寺","latitude":34.9950,"longitude":135.7851}`, status: http.StatusOK},
+	{name: "proposal_check_missing_fields", user: "alice", method: "POST", path: "/api/v1/temple-proposals/check", body: `{"name":"清水寺"}`, status: http.StatusBadRequest},
+	{name: "proposal_create_similar", user: "alice", method: "POST", path: "/api/v1/temple-proposals", body: `{"name":"清水寺","latitude":34.9950,"longitude":135.7851,"photo_url":"https://example.com/p.jpg"}`, status: http.StatusConflict},
+	{name: "proposal_create_missing_photo", user: "alice", method: "POST", path: "/api/v1/temple-proposals", body: `{"name":"八坂神社","latitude":35.0037,"longitude":135.7785}`, status: http.StatusBadRequest},
+	{name: "proposal_create", user: "alice", method: "POST", path: "/api/v1/temple-proposals",
+		body:   `{"name":"八坂神社","latitude":35.0037,"longitude":135.7785,"prefecture":"京都府","kind":"shrine","photo_url":"https://example.com/yasaka.jpg"}`,
+		status: http.StatusCreated},
+	{name: "proposal_create_multipart", user: "bob", method: "POST", path: "/api/v1/temple-proposals",
+		form:   map[string]string{"name": "興福寺", "latitude": "34.6830", "longitude": "135.8318", "prefecture": "奈良県", "kind": "temple", "confirm_new": "true"},
+		file:   "photo",
+		status: http.StatusCreated},
+	{name: "proposal_create_third", user: "bob", method: "POST", path: "/api/v1/temple-proposals", body: `{"name":"東大寺 大仏殿","latitude":34.6890,"longitude":135.8398,"photo_url":"https://example.com/daibutsu.jpg","confirm_new":true}`, status: http.StatusCreated},
+	{name: "proposal_entry", user: "alice", method: "POST", path: "/api/v1/temple-proposals/1/entries", body: `{"notes":"祇園さん","collected_at":"2024-05-25T15:00:00+09:00"}`, status: http.StatusCreated},
+	{name: "proposal_entry_unknown", user: "alice", method: "POST", path: "/api/v1/temple-proposals/999/entries", body: `{}`, status: http.StatusNotFound},
+	{name: "me_proposals", user: "alice", method: "GET", path: "/api/v1/me/temple-proposals", status: http.StatusOK},
+	{name: "proposal_queue_forbidden", user: "alice", method: "GET", path: "/api/v1/moderation/temple-proposals", status: http.StatusForbidden},
+	{name: "proposal_queue", user: "erika", method: "GET", path: "/api/v1/moderation/temple-proposals", status: http.StatusOK},
+	{name: "proposal_get", user: "erika", method: "GET", path: "/api/v1/moderation/temple-proposals/1", status: http.StatusOK},
+	{name: "proposal_get_bad_id", user: "erika", method: "GET", path: "/api/v1/moderation/temple-proposals/abc", status: http.StatusBadRequest},
+	{name: "proposal_approve", user: "erika", method: "POST", path: "/api/v1/moderation/temple-proposals/1/approve", body: `{"note":"確認しました"}`, status: http.StatusOK},
+	{name: "proposal_approve_again", user: "erika", method: "POST", path: "/api/v1/moderation/temple-proposals/1/approve", body: `{}`, status: http.StatusConflict},
+	{name: "proposal_merge_missing_temple", user: "erika", method: "POST", path: "/api/v1/moderation/temple-proposals/3/merge", body: `{}`, status: http.StatusBadRequest},
+	{name: "proposal_merge_unknown_temple", user: "erika", method: "POST", path: "/api/v1/moderation/temple-proposals/3/merge", body: `{"temple_id":999}`, status: http.StatusBadRequest},
+	{name: "proposal_merge", user: "erika", method: "POST", path: "/api/v1/moderation/temple-proposals/3/merge", body: `{"temple_id":6}`, status: http.StatusOK},
+	{name: "proposal_reject", user: "erika", method: "POST", path: "/api/v1/moderation/temple-proposals/2/reject", body: `{"note":"写真が不鮮明です"}`, status: http.StatusOK},
+	{name: "goshuin_list_after_proposals", user: "alice", method: "GET", path: "/api/v1/goshuin", status: http.StatusOK},
+
+	// ガイド
+	{name: "guide", method: "GET", path: "/api/v1/guide", status: http.StatusOK},
+	{name: "guide_ja", method: "GET", path: "/api/v1/guide?lang=ja", status: http.StatusOK},
+	{name: "guide_sections", user: "erika", method: "GET", path: "/api/v1/guide/sections", status: http.StatusOK},
+	{name: "guide_sections_forbidden", user: "alice", method: "GET", path: "/api/v1/guide/sections", status: http.StatusForbidden},
+	{name: "guide_section_create", user: "erika", method: "POST", path: "/api/v1/guide/sections", body: `{"slug":"temizu","locale":"en","title":"Temizu","body":"Rinse your **left** hand first."}`, status: http.StatusCreated},
+	{name: "guide_section_create_bad_locale", user: "erika", method: "POST", path: "/api/v1/guide/sections", body: `{"slug":"temizu","locale":"??","title":"Temizu"}`, status: http.StatusBadRequest},
+	{name: "guide_section_create_duplicate", user: "erika", method: "POST", path: "/api/v1/guide/sections", body: `{"slug":"temizu","locale":"en","title":"Temizu","body":"Again."}`, status: http.StatusConflict},
+	{name: "guide_section_get", user: "erika", method: "GET", path: "/api/v1/guide/sections/1", status: http.StatusOK},
+	{name: "guide_section_get_bad_id", user: "erika", method: "GET", path: "/api/v1/guide/sections/abc", status: http.StatusBadRequest},
+	{name: "guide_section_get_unknown", user: "erika", method: "GET", path: "/api/v1/guide/sections/999", status: http.StatusNotFound},
+	{name: "guide_section_update", user: "erika", method: "PUT", path: "/api/v1/guide/sections/1", body: `{"title":"What is goshuin?"}`, status: http.StatusOK},
+	{name: "guide_section_versions", user: "erika", method: "GET", path: "/api/v1/guide/sections/1/versions", status: http.StatusOK},
+	{name: "guide_section_rollback", user: "erika", method: "POST", path: "/api/v1/guide/sections/1/rollback", body: `{"version":1}`, status: http.StatusOK},
+	{name: "guide_section_rollback_missing_version", user: "erika", method: "POST", path: "/api/v1/guide/sections/1/rollback", body: `{}`, status: http.StatusBadRequest},
+	{name: "guide_section_unpublish", user: "erika", method: "POST", path: "/api/v1/guide/sections/1/unpublish", status: http.StatusOK},
+	{name: "guide_section_publish", user: "erika", method: "POST", path: "/api/v1/guide/sections/1/publish", status: http.StatusOK},
+	{name: "guide_tips", user: "erika", method: "GET", path: "/api/v1/guide/tips", status: http.StatusOK},
+	{name: "guide_tip_create", user: "erika", method: "POST", path: "/api/v1/guide/tips", body: `{"slug":"bring-coins","locale":"en","title":"Bring coins","body":"Many temples only accept cash.","publish":true}`, status: http.StatusCreated},
+	{name: "guide_tip_get", user: "erika", method: "GET", path: "/api/v1/guide/tips/6", status: http.StatusOK},
+	{name: "guide_tip_update", user: "erika", method: "PUT", path: "/api/v1/guide/tips/6", body: `{"body":"Many temples only accept **cash**."}`, status: http.StatusOK},
+	{name: "guide_tip_versions", user: "erika", method: "GET", path: "/api/v1/guide/tips/6/versions", status: http.StatusOK},
+	{name: "guide_tip_rollback", user: "erika", method: "POST", path: "/api/v1/guide/tips/6/rollback", body: `{"version":1}`, status: http.StatusOK},
+	{name: "guide_tip_rollback_unknown_version", user: "erika", method: "POST", path: "/api/v1/guide/tips/6/rollback", body: `{"version":99}`, status: http.StatusNotFound},
+	{name: "guide_tip_unpublish", user: "erika", method: "POST", path: "/api/v1/guide/tips/6/unpublish", status: http.StatusOK},
+	{name: "guide_tip_publish", user: "erika", method: "POST", path: "/api/v1/guide/tips/6/publish", status: http.StatusOK},
+	{name: "guide_tip_delete", user: "erika", method: "DELETE", path: "/api/v1/guide/tips/6", status: http.StatusOK},
+	{name: "guide_tip_get_deleted", user: "erika", method: "GET", path: "/api/v1/guide/tips/6", status: http.StatusNotFound},
+	{name: "guide_section_delete", user: "erika", method: "DELETE", path: "/api/v1/guide/sections/6", status: http.StatusOK},
+	{name: "guide_section_delete_forbidden", user: "alice", method: "DELETE", path: "/api/v1/guide/sections/1", status: http.StatusForbidden},
+	{name: "guide_media_upload", user: "erika", method: "POST", path: "/api/v1/guide/media", file: "file", status: http.StatusCreated},
+	{name: "guide_media_upload_forbidden", user: "alice", method: "POST", path: "/api/v1/guide/media", file: "file", status: http.StatusForbidden},
+
+	// クイズ
+	{name: "quizzes", method: "GET", path: "/api/v1/guide/quizzes", status: http.StatusOK},
+	{name: "quiz", method: "GET", path: "/api/v1/guide/quizzes/etiquette-and-manners", status: http.StatusOK},
+	{name: "quiz_unknown", method: "GET", path: "/api/v1/guide/quizzes/unknown", status: http.StatusNotFound},
+	{name: "quiz_attempt", user: "alice", method: "POST", path: "/api/v1/guide/quizzes/etiquette-and-manners/attempts",
+		body:   `{"locale":"en","answers":[{"question_id":3,"choices":[1,0,3,4,2]},{"question_id":4,"choices":[0,2]}]}`,
+		status: http.StatusOK},
+	{name: "quiz_attempt_unauthenticated", method: "POST", path: "/api/v1/guide/quizzes/etiquette-and-manners/attempts", body: `{"answers":[]}`, status: http.StatusUnauthorized},
+	{name: "quiz_attempt_bad_json", user: "alice", method: "POST", path: "/api/v1/guide/quizzes/etiquette-and-manners/attempts", body: `{"answers":`, status: http.StatusBadRequest},
+	{name: "questions", user: "erika", method: "GET", path: "/api/v1/guide/questions?section=etiquette-and-manners", status: http.StatusOK},
+	{name: "question_create", user: "erika", method: "POST", path: "/api/v1/guide/questions",
+		body:   `{"section_slug":"goshuin-book","locale":"en","kind":"choice","prompt":"Where should the stamp go?","choices":["Any free page","The cover"],"answer":[0]}`,
+		status: http.StatusCreated},
+	{name: "question_create_unknown_section", user: "erika", method: "POST", path: "/api/v1/guide/questions", body: `{"section_slug":"nope","locale":"en","kind":"choice","prompt":"?","choices":["a","b"],"answer":[0]}`, status: http.StatusBadRequest},
+	{name: "question_get", user: "erika", method: "GET", path: "/api/v1/guide/questions/1", status: http.StatusOK},
+	{name: "question_get_bad_id", user: "erika", method: "GET", path: "/api/v1/guide/questions/abc", status: http.StatusBadRequest},
+	{name: "question_update", user: "erika", method: "PUT", path: "/api/v1/guide/questions/1", body: `{"explanation":"Bow once before entering."}`, status: http.StatusOK},
+	{name: "question_delete", user: "erika", method: "DELETE", path: "/api/v1/guide/questions/5", status: http.StatusOK},
+	{name: "question_delete_unknown", user: "erika", method: "DELETE", path: "/api/v1/guide/questions/999", status: http.StatusNotFound},
+	{name: "me_guide", user: "alice", method: "GET", path: "/api/v1/me/guide", status: http.StatusOK},
+
+	// 地域パック
+	{name: "pack", method: "GET", path: "/api/v1/packs?prefecture=" + nara, status: http.StatusOK},
+	{name: "pack_missing_region", method: "GET", path: "/api/v1/packs", status: http.StatusBadRequest},
+	{name: "pack_download", method: "GET", path: "/api/v1/packs/download?prefecture=" + nara, status: http.StatusOK},
+	{name: "pack_download_bad_since", method: "GET", path: "/api/v1/packs/download?prefecture=" + nara + "&since=abc", status: http.StatusBadRequest},
+
+	// 冪等キー
+	{name: "idempotent_create", user: "alice", method: "POST", path: "/api/v1/books", body: `{"title":"予備"}`, headers: map[string]string{"Idempotency-Key": "book-1"}, status: http.StatusCreated},
+	{name: "idempotent_replay", user: "alice", method: "POST", path: "/api/v1/books", body: `{"title":"予備"}`, headers: map[string]string{"Idempotency-Key": "book-1"}, status: http.StatusCreated},
+	{name: "idempotent_key_reused", user: "alice", method: "POST", path: "/api/v1/books", body: `{"title":"別"}`, headers: map[string]string{"Idempotency-Key": "book-1"}, status: http.StatusUnprocessableEntity},
+
+	// 監査ログ
+	{name: "audit", user: "admin", method: "GET", path: "/api/v1/admin/audit?entity_type=temple", status: http.StatusOK},
+	{name: "audit_forbidden", user: "alice", method: "GET", path: "/api/v1/admin/audit", status: http.StatusForbidden},
+	{name: "audit_verify", user: "admin", method: "GET", path: "/api/v1/admin/audit/verify", status: http.StatusOK},
+}
+
+func TestRoutesSQLite(t *testing.T) {
+	ts := newTestServer(t, "sqlite")
+	ts.run(t, repositoryCases)
+	ts.run(t, routeCases)
+}
+
+// memoryCases データベースなしのデモモードだけのケース
+var memoryCases = []routeCase{
+	{name: "memory_tags", user: "alice", method: "GET", path: "/api/v1/me/tags", status: http.StatusOK},
+	{name: "memory_stats_unavailable", user: "alice", method: "GET", path: "/api/v1/me/stats", status: http.StatusNotImplemented},
+	{name: "memory_photo_unavailable", user: "alice", method: "POST", path: "/api/v1/goshuin/1/photos", body: `{"url":"https://example.com/a.jpg"}`, status: http.StatusNotImplemented},
+	{name: "memory_sync_unavailable", user: "alice", method: "GET", path: "/api/v1/sync", status: http.StatusNotImplemented},
+	{name: "memory_batch_atomic_unavailable", user: "alice", method: "POST", path: "/api/v1/goshuin:batch?atomic=true",
+		body: `{"operations":[{"op":"delete","id":2}]}`, status: http.StatusNotImplemented},
+	{name: "memory_idempotent_first", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"temple_id":5}`, headers: map[string]string{"Idempotency-Key": "memory-1"}, status: http.StatusCreated},
+	{name: "memory_idempotent_replay", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"temple_id":5}`, headers: map[string]string{"Idempotency-Key": "memory-1"}, status: http.StatusCreated},
+	{name: "memory_idempotent_key_reused", user: "alice", method: "POST", path: "/api/v1/goshuin", body: `{"temple_id":6}`, headers: map[string]string{"Idempotency-Key": "memory-1"}, status: http.StatusUnprocessableEntity},
+}
+
+// TestRoutesMemory メモリ上のリポジトリ（DB_DRIVER=memory のデモモード）でも同じように動くことを確認します
+// データベースが必要なルートは 501 を返します
+func TestRoutesMemory(t *testing.T) {
+	ts := newTestServer(t, "memory")
+	ts.run(t, repositoryCases)
+	ts.run(t, memoryCases)
+}
+
+// handleFuncPattern setupRoutes で登録するパターン
+var handleFuncPattern = regexp.MustCompile(`s\.mux\.HandleFunc\("([^"]+)"`)
+
+// TestRoutesCovered setupRoutes のすべてのルートにテストケースがあることを確認します
+func TestRoutesCovered(t *testing.T) {
+	src, err := os.ReadFile("server.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, "sqlite")
+	covered := map[string]bool{}
+	for _, cases := range [][]routeCase{repositoryCases, routeCases} {
+		for _, c := range cases {
+			_, pattern := ts.mux.Handler(httptest.NewRequest(c.method, c.path, nil))
+			covered[pattern] = true
+		}
+	}
+
+	var missing []string
+	for _, m := range handleFuncPattern.FindAllSubmatch(src, -1) {
+		if pattern := string(m[1]); !covered[pattern] {
+			missing = append(missing, pattern)
+		}
+	}
+	sort.Strings(missing)
+	for _, pattern := range missing {
+		t.Errorf("no test case for %s", pattern)
+	}
+}
@@ -2,28 +2,132 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
+	"stamp-backend/internal/audit"
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/badges"
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/config"
+	"stamp-backend/internal/delta"
 	"stamp-backend/internal/ent"
 	"stamp-backend/internal/handlers"
+	"stamp-backend/internal/idempotency"
+	"stamp-backend/internal/storage"
+	"stamp-backend/internal/trash"
 )
 
+// purgeInterval ゴミ箱の保持期間切れを確認する間隔
+const purgeInterval = time.Hour
+
 // Server HTTPサーバー構造体
 type Server struct {
 	client *ent.Client
+	store  storage.Storage
+	badges *badges.Engine
+	clock  clock.Clock
+	trash  *trash.Purger
+	audit  *audit.Logger
+	sync   *delta.Engine
+	idem   *idempotency.Store
 	mux    *http.ServeMux
 }
 
+// Option サーバーのオプション
+type Option func(*Server)
+
+// WithStorage 画像ストレージを指定します
+func WithStorage(store storage.Storage) Option {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// WithBadges バッジエンジンを指定します
+func WithBadges(engine *badges.Engine) Option {
+	return func(s *Server) {
+		s.badges = engine
+	}
+}
+
+// WithClock 現在時刻の取得元を指定します（テストで時刻を固定する場合など）
+func WithClock(c clock.Clock) Option {
+	return func(s *Server) {
+		s.clock = c
+	}
+}
+
+// WithPurger ゴミ箱の完全削除を行う Purger を指定します
+func WithPurger(p *trash.Purger) Option {
+	return func(s *Server) {
+		s.trash = p
+	}
+}
+
+// WithAudit 監査ロガーを指定します
+func WithAudit(l *audit.Logger) Option {
+	return func(s *Server) {
+		s.audit = l
+	}
+}
+
+// WithSync 御朱印の差分同期エンジンを指定します
+func WithSync(e *delta.Engine) Option {
+	return func(s *Server) {
+		s.sync = e
+	}
+}
+
+// WithIdempotency Idempotency-Key の応答を保存する Store を指定します
+func WithIdempotency(st *idempotency.Store) Option {
+	return func(s *Server) {
+		s.idem = st
+	}
+}
+
 // New 新しいサーバーインスタンスを作成します
-func New(client *ent.Client) *Server {
+func New(client *ent.Client, opts ...Option) *Server {
 	s := &Server{
 		client: client,
 		mux:    http.NewServeMux(),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.store == nil {
+		s.store = storage.New()
+	}
+	if s.clock == nil {
+		s.clock = clock.System
+	}
+	if s.badges == nil {
+		s.badges = badges.New(client, badges.DefaultDefinitions())
+	}
+	if s.trash == nil {
+		s.trash = trash.New(client, s.store, s.clock, config.GetTrashRetentionDays())
+	}
+	if s.audit == nil {
+		s.audit = audit.New(client, s.clock)
+	}
+	if s.sync == nil {
+		s.sync = delta.New(client, s.clock)
+	}
+	if s.idem == nil {
+		s.idem = idempotency.New(client, s.clock, config.GetIdempotencyRetentionHours())
+	}
+	client.SetClock(s.clock)
+	client.UseTx(s.audit.Hook(), s.sync.Hook())
+	if client.HasDatabase() {
+		// データベースなしではバッジを保存できないため、判定しません
+		client.Use(s.badges.Hook())
+	}
 	s.setupRoutes()
 	return s
 }
@@ -37,31 +141,233 @@ func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("GET /api/v1/temples", s.handleGetTemples)
 	s.mux.HandleFunc("GET /api/v1/temples/{id}", s.handleGetTemple)
 	s.mux.HandleFunc("GET /api/v1/temples/nearby", s.handleGetNearbyTemples)
+	s.mux.HandleFunc("GET /api/v1/temples/export", s.handleExportTemples)
+	s.mux.HandleFunc("GET /api/v1/packs", s.handleGetRegionPack)
+	s.mux.HandleFunc("GET /api/v1/packs/download", s.handleDownloadRegionPack)
+	s.mux.HandleFunc("DELETE /api/v1/temples/{id}", s.handleDeleteTemple)
+	s.mux.HandleFunc("POST /api/v1/temples/{id}/restore", s.handleRestoreTemple)
+	s.mux.HandleFunc("POST /api/v1/temples/{id}/corrections", s.handleCreateTempleCorrection)
+	s.mux.HandleFunc("POST /api/v1/temple-proposals", s.handleCreateTempleProposal)
+	s.mux.HandleFunc("POST /api/v1/temple-proposals/check", s.handleCheckTempleProposal)
+	s.mux.HandleFunc("POST /api/v1/temple-proposals/{id}/entries", s.handleAddTempleProposalEntry)
 	
 	s.mux.HandleFunc("GET /api/v1/goshuin", s.handleGetGoshuinCollections)
 	s.mux.HandleFunc("POST /api/v1/goshuin", s.handleCreateGoshuinCollection)
+	s.mux.HandleFunc("POST /api/v1/goshuin:batch", s.handleBatchGoshuinCollections)
 	s.mux.HandleFunc("GET /api/v1/goshuin/{id}", s.handleGetGoshuinCollection)
 	s.mux.HandleFunc("PUT /api/v1/goshuin/{id}", s.handleUpdateGoshuinCollection)
 	s.mux.HandleFunc("DELETE /api/v1/goshuin/{id}", s.handleDeleteGoshuinCollection)
+	s.mux.HandleFunc("POST /api/v1/goshuin/{id}/restore", s.handleRestoreGoshuinCollection)
+	s.mux.HandleFunc("GET /api/v1/goshuin/{id}/photos", s.handleGetGoshuinPhotos)
+	s.mux.HandleFunc("POST /api/v1/goshuin/{id}/photos", s.handleAddGoshuinPhoto)
+	s.mux.HandleFunc("PUT /api/v1/goshuin/{id}/photos/order", s.handleReorderGoshuinPhotos)
+	s.mux.HandleFunc("PUT /api/v1/goshuin/{id}/photos/{photoID}", s.handleUpdateGoshuinPhoto)
+	s.mux.HandleFunc("DELETE /api/v1/goshuin/{id}/photos/{photoID}", s.handleDeleteGoshuinPhoto)
+	s.mux.HandleFunc("GET /api/v1/sync", s.handleGetSyncChanges)
+	s.mux.HandleFunc("POST /api/v1/sync", s.handlePushSyncMutations)
+
+	s.mux.HandleFunc("GET /api/v1/books", s.handleGetGoshuinBooks)
+	s.mux.HandleFunc("POST /api/v1/books", s.handleCreateGoshuinBook)
+	s.mux.HandleFunc("GET /api/v1/books/{id}", s.handleGetGoshuinBook)
+	s.mux.HandleFunc("PUT /api/v1/books/{id}", s.handleUpdateGoshuinBook)
+	s.mux.HandleFunc("DELETE /api/v1/books/{id}", s.handleDeleteGoshuinBook)
+	s.mux.HandleFunc("POST /api/v1/books/{id}/stamps", s.handleMoveStampsToBook)
+
+	s.mux.HandleFunc("GET /api/v1/badges", s.handleGetBadges)
+	s.mux.HandleFunc("GET /api/v1/me/stats", s.handleGetMyStats)
+	s.mux.HandleFunc("GET /api/v1/me/badges", s.handleGetMyBadges)
+	s.mux.HandleFunc("GET /api/v1/me/tags", s.handleGetMyTags)
+	s.mux.HandleFunc("GET /api/v1/me/goshuin/export", s.handleExportGoshuinCollections)
+	s.mux.HandleFunc("POST /api/v1/me/goshuin/import", s.handleImportGoshuinCollections)
+	s.mux.HandleFunc("GET /api/v1/me/trash", s.handleGetTrash)
+	s.mux.HandleFunc("DELETE /api/v1/me/trash/{id}", s.handlePurgeGoshuinCollection)
+	s.mux.HandleFunc("GET /api/v1/me/corrections", s.handleGetMyTempleCorrections)
+	s.mux.HandleFunc("GET /api/v1/me/temple-proposals", s.handleGetMyTempleProposals)
+	s.mux.HandleFunc("GET /api/v1/me/notifications", s.handleGetMyNotifications)
+	s.mux.HandleFunc("POST /api/v1/me/notifications/read", s.handleMarkNotificationsRead)
+
+	s.mux.HandleFunc("GET /api/v1/moderation/corrections", s.handleGetTempleCorrectionQueue)
+	s.mux.HandleFunc("GET /api/v1/moderation/corrections/{id}", s.handleGetTempleCorrection)
+	s.mux.HandleFunc("POST /api/v1/moderation/corrections/{id}/approve", s.handleApproveTempleCorrection)
+	s.mux.HandleFunc("POST /api/v1/moderation/corrections/{id}/merge", s.handleMergeTempleCorrection)
+	s.mux.HandleFunc("POST /api/v1/moderation/corrections/{id}/reject", s.handleRejectTempleCorrection)
+	s.mux.HandleFunc("GET /api/v1/moderation/temple-proposals", s.handleGetTempleProposalQueue)
+	s.mux.HandleFunc("GET /api/v1/moderation/temple-proposals/{id}", s.handleGetTempleProposal)
+	s.mux.HandleFunc("POST /api/v1/moderation/temple-proposals/{id}/approve", s.handleApproveTempleProposal)
+	s.mux.HandleFunc("POST /api/v1/moderation/temple-proposals/{id}/merge", s.handleMergeTempleProposal)
+	s.mux.HandleFunc("POST /api/v1/moderation/temple-proposals/{id}/reject", s.handleRejectTempleProposal)
 	
 	s.mux.HandleFunc("GET /api/v1/guide", s.handleGetGuide)
+	s.mux.HandleFunc("GET /api/v1/guide/sections", s.handleListGuideSections)
+	s.mux.HandleFunc("POST /api/v1/guide/sections", s.handleCreateGuideSection)
+	s.mux.HandleFunc("GET /api/v1/guide/sections/{id}", s.handleGetGuideSection)
+	s.mux.HandleFunc("PUT /api/v1/guide/sections/{id}", s.handleUpdateGuideSection)
+	s.mux.HandleFunc("DELETE /api/v1/guide/sections/{id}", s.handleDeleteGuideSection)
+	s.mux.HandleFunc("POST /api/v1/guide/sections/{id}/publish", s.handlePublishGuideSection)
+	s.mux.HandleFunc("POST /api/v1/guide/sections/{id}/unpublish", s.handleUnpublishGuideSection)
+	s.mux.HandleFunc("GET /api/v1/guide/sections/{id}/versions", s.handleGetGuideSectionVersions)
+	s.mux.HandleFunc("POST /api/v1/guide/sections/{id}/rollback", s.handleRollbackGuideSection)
+	s.mux.HandleFunc("GET /api/v1/guide/tips", s.handleListGuideTips)
+	s.mux.HandleFunc("POST /api/v1/guide/tips", s.handleCreateGuideTip)
+	s.mux.HandleFunc("GET /api/v1/guide/tips/{id}", s.handleGetGuideTip)
+	s.mux.HandleFunc("PUT /api/v1/guide/tips/{id}", s.handleUpdateGuideTip)
+	s.mux.HandleFunc("DELETE /api/v1/guide/tips/{id}", s.handleDeleteGuideTip)
+	s.mux.HandleFunc("POST /api/v1/guide/tips/{id}/publish", s.handlePublishGuideTip)
+	s.mux.HandleFunc("POST /api/v1/guide/tips/{id}/unpublish", s.handleUnpublishGuideTip)
+	s.mux.HandleFunc("GET /api/v1/guide/tips/{id}/versions", s.handleGetGuideTipVersions)
+	s.mux.HandleFunc("POST /api/v1/guide/tips/{id}/rollback", s.handleRollbackGuideTip)
+	s.mux.HandleFunc("POST /api/v1/guide/media", s.handleUploadGuideMedia)
+	s.mux.HandleFunc("GET /api/v1/guide/quizzes", s.handleGetGuideQuizzes)
+	s.mux.HandleFunc("GET /api/v1/guide/quizzes/{slug}", s.handleGetGuideQuiz)
+	s.mux.HandleFunc("POST /api/v1/guide/quizzes/{slug}/attempts", s.handleSubmitQuizAttempt)
+	s.mux.HandleFunc("GET /api/v1/me/guide", s.handleGetMyGuideProgress)
+	s.mux.HandleFunc("GET /api/v1/guide/questions", s.handleGetQuizQuestions)
+	s.mux.HandleFunc("POST /api/v1/guide/questions", s.handleCreateQuizQuestion)
+	s.mux.HandleFunc("GET /api/v1/guide/questions/{id}", s.handleGetQuizQuestion)
+	s.mux.HandleFunc("PUT /api/v1/guide/questions/{id}", s.handleUpdateQuizQuestion)
+	s.mux.HandleFunc("DELETE /api/v1/guide/questions/{id}", s.handleDeleteQuizQuestion)
+
+	s.mux.HandleFunc("GET /api/v1/translations", s.handleGetTranslations)
+	s.mux.HandleFunc("PUT /api/v1/translations", s.handlePutTranslation)
+	s.mux.HandleFunc("DELETE /api/v1/translations/{id}", s.handleDeleteTranslation)
+
+	s.mux.HandleFunc("GET /api/v1/admin/audit", s.handleGetAuditLogs)
+	s.mux.HandleFunc("GET /api/v1/admin/audit/verify", s.handleVerifyAuditLogs)
+
+	// ローカルストレージの画像配信
+	if local, ok := s.store.(*storage.Local); ok && strings.HasPrefix(local.BaseURL(), "/") {
+		s.mux.Handle("GET "+local.BaseURL(), http.StripPrefix(local.BaseURL(), http.FileServer(http.Dir(local.Dir()))))
+	}
 
 	// CORS対応のミドルウェアを追加
 	s.mux.HandleFunc("OPTIONS /", s.handleCORS)
 }
 
 // Run サーバーを起動します
+// 保持期間を過ぎたゴミ箱の中身と Idempotency-Key は、起動中に定期的に削除されます
 func (s *Server) Run(addr string) error {
+	go s.trash.Run(context.Background(), purgeInterval)
+	go s.idem.Run(context.Background(), purgeInterval)
 	log.Printf("Server starting on %s", addr)
-	return http.ListenAndServe(addr, s.corsMiddleware(s.mux))
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// Handler ミドルウェアを含めたHTTPハンドラーを返します（Run が使うほか、テストで直接呼び出せます）
+func (s *Server) Handler() http.Handler {
+	return s.corsMiddleware(s.requestMiddleware(s.authMiddleware(s.databaseMiddleware(s.idem.Middleware(s.mux)))))
+}
+
+// memoryRoutes データベースなしのデモモード（DB_DRIVER=memory）でも提供する API のルート
+// 寺社と御朱印（ゴミ箱を含む）と、それらから求める値だけを扱います
+var memoryRoutes = map[string]bool{
+	"GET /api/v1/temples":               true,
+	"GET /api/v1/temples/{id}":          true,
+	"GET /api/v1/temples/nearby":        true,
+	"GET /api/v1/temples/export":        true,
+	"DELETE /api/v1/temples/{id}":       true,
+	"POST /api/v1/temples/{id}/restore": true,
+	"GET /api/v1/goshuin":               true,
+	"POST /api/v1/goshuin":              true,
+	"POST /api/v1/goshuin:batch":        true,
+	"GET /api/v1/goshuin/{id}":          true,
+	"PUT /api/v1/goshuin/{id}":          true,
+	"DELETE /api/v1/goshuin/{id}":       true,
+	"POST /api/v1/goshuin/{id}/restore": true,
+	"GET /api/v1/goshuin/{id}/photos":   true,
+	"GET /api/v1/badges":                true,
+	"GET /api/v1/me/tags":               true,
+	"GET /api/v1/me/trash":              true,
+	"DELETE /api/v1/me/trash/{id}":      true,
+}
+
+// databaseMiddleware データベースなしで動いている場合、memoryRoutes にない API に 501 を返します
+// 写真・御朱印帳・統計・同期などのデータはメモリ上に保持しないため、空の結果を返す代わりに断ります
+func (s *Server) databaseMiddleware(next http.Handler) http.Handler {
+	if s.client.HasDatabase() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := s.mux.Handler(r); strings.Contains(pattern, " /api/") && !memoryRoutes[pattern] {
+			s.writeError(w, http.StatusNotImplemented, "Not available without a database (DB_DRIVER=memory)")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestMiddleware リクエストIDとクライアントIPをコンテキストに設定します
+// X-Request-ID があれば引き継ぎ、なければ生成してレスポンスヘッダーで返します
+func (s *Server) requestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || len(requestID) > 64 {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		ctx := audit.WithRequest(r.Context(), requestID, clientIP(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newRequestID ランダムなリクエストIDを生成します
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// clientIP クライアントのIPアドレスを返します
+// TRUST_PROXY が有効な場合は X-Forwarded-For の先頭を使います
+func clientIP(r *http.Request) string {
+	if config.GetTrustProxy() {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			ip, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// authMiddleware Bearerトークンを検証し、ユーザーをコンテキストに設定します
+// トークンがない場合は未認証のまま通し、認証の要否は各ハンドラーで判定します
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			s.writeError(w, http.StatusUnauthorized, "Invalid authorization header")
+			return
+		}
+
+		user, err := auth.ParseToken(config.GetJWTSecret(), token)
+		if err != nil {
+			s.writeError(w, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	})
 }
 
 // corsMiddleware CORSミドルウェア
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, Accept-Language, Idempotency-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Content-Language, ETag, X-Pack-Version, Idempotent-Replayed")
 		
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -112,13 +418,30 @@ func (s *Server) handleGetNearbyTemples(w http.ResponseWriter, r *http.Request)
 	handlers.GetNearbyTemples(s.client)(w, r)
 }
 
+func (s *Server) handleExportTemples(w http.ResponseWriter, r *http.Request) {
+	handlers.ExportTemples(s.client)(w, r)
+}
+
+// 地域パック関連のハンドラー
+func (s *Server) handleGetRegionPack(w http.ResponseWriter, r *http.Request) {
+	handlers.GetRegionPack(s.client, s.store)(w, r)
+}
+
+func (s *Server) handleDownloadRegionPack(w http.ResponseWriter, r *http.Request) {
+	handlers.DownloadRegionPack(s.client, s.store)(w, r)
+}
+
 // 御朱印関連のハンドラー
 func (s *Server) handleGetGoshuinCollections(w http.ResponseWriter, r *http.Request) {
 	handlers.GetGoshuinCollections(s.client)(w, r)
 }
 
 func (s *Server) handleCreateGoshuinCollection(w http.ResponseWriter, r *http.Request) {
-	handlers.CreateGoshuinCollection(s.client)(w, r)
+	handlers.CreateGoshuinCollection(s.client, s.clock)(w, r)
+}
+
+func (s *Server) handleBatchGoshuinCollections(w http.ResponseWriter, r *http.Request) {
+	handlers.BatchGoshuinCollections(s.client, s.clock)(w, r)
 }
 
 func (s *Server) handleGetGoshuinCollection(w http.ResponseWriter, r *http.Request) {
@@ -126,14 +449,325 @@ func (s *Server) handleGetGoshuinCollection(w http.ResponseWriter, r *http.Reque
 }
 
 func (s *Server) handleUpdateGoshuinCollection(w http.ResponseWriter, r *http.Request) {
-	handlers.UpdateGoshuinCollection(s.client)(w, r)
+	handlers.UpdateGoshuinCollection(s.client, s.clock)(w, r)
 }
 
 func (s *Server) handleDeleteGoshuinCollection(w http.ResponseWriter, r *http.Request) {
 	handlers.DeleteGoshuinCollection(s.client)(w, r)
 }
 
+func (s *Server) handleRestoreGoshuinCollection(w http.ResponseWriter, r *http.Request) {
+	handlers.RestoreGoshuinCollection(s.client)(w, r)
+}
+
+func (s *Server) handleGetMyTags(w http.ResponseWriter, r *http.Request) {
+	handlers.GetMyTags(s.client)(w, r)
+}
+
+func (s *Server) handleGetMyStats(w http.ResponseWriter, r *http.Request) {
+	handlers.GetMyStats(s.client)(w, r)
+}
+
+// 同期関連のハンドラー
+
+func (s *Server) handleGetSyncChanges(w http.ResponseWriter, r *http.Request) {
+	handlers.GetSyncChanges(s.sync)(w, r)
+}
+
+func (s *Server) handlePushSyncMutations(w http.ResponseWriter, r *http.Request) {
+	handlers.PushSyncMutations(s.sync)(w, r)
+}
+
+// 御朱印の写真関連のハンドラー
+func (s *Server) handleGetGoshuinPhotos(w http.ResponseWriter, r *http.Request) {
+	handlers.GetGoshuinPhotos(s.client)(w, r)
+}
+
+func (s *Server) handleAddGoshuinPhoto(w http.ResponseWriter, r *http.Request) {
+	handlers.AddGoshuinPhoto(s.client, s.store)(w, r)
+}
+
+func (s *Server) handleReorderGoshuinPhotos(w http.ResponseWriter, r *http.Request) {
+	handlers.ReorderGoshuinPhotos(s.client)(w, r)
+}
+
+func (s *Server) handleUpdateGoshuinPhoto(w http.ResponseWriter, r *http.Request) {
+	handlers.UpdateGoshuinPhoto(s.client)(w, r)
+}
+
+func (s *Server) handleDeleteGoshuinPhoto(w http.ResponseWriter, r *http.Request) {
+	handlers.DeleteGoshuinPhoto(s.client, s.store)(w, r)
+}
+
+// 御朱印帳関連のハンドラー
+func (s *Server) handleGetGoshuinBooks(w http.ResponseWriter, r *http.Request) {
+	handlers.GetGoshuinBooks(s.client)(w, r)
+}
+
+func (s *Server) handleCreateGoshuinBook(w http.ResponseWriter, r *http.Request) {
+	handlers.CreateGoshuinBook(s.client)(w, r)
+}
+
+func (s *Server) handleGetGoshuinBook(w http.ResponseWriter, r *http.Request) {
+	handlers.GetGoshuinBook(s.client)(w, r)
+}
+
+func (s *Server) handleUpdateGoshuinBook(w http.ResponseWriter, r *http.Request) {
+	handlers.UpdateGoshuinBook(s.client)(w, r)
+}
+
+func (s *Server) handleDeleteGoshuinBook(w http.ResponseWriter, r *http.Request) {
+	handlers.DeleteGoshuinBook(s.client)(w, r)
+}
+
+func (s *Server) handleMoveStampsToBook(w http.ResponseWriter, r *http.Request) {
+	handlers.MoveStampsToBook(s.client)(w, r)
+}
+
+// バッジ関連のハンドラー
+func (s *Server) handleGetBadges(w http.ResponseWriter, r *http.Request) {
+	handlers.GetBadges(s.badges)(w, r)
+}
+
+func (s *Server) handleGetMyBadges(w http.ResponseWriter, r *http.Request) {
+	handlers.GetMyBadges(s.badges)(w, r)
+}
+
+func (s *Server) handleExportGoshuinCollections(w http.ResponseWriter, r *http.Request) {
+	handlers.ExportGoshuinCollections(s.client, s.store, s.clock)(w, r)
+}
+
+func (s *Server) handleImportGoshuinCollections(w http.ResponseWriter, r *http.Request) {
+	handlers.ImportGoshuinCollections(s.client, s.store)(w, r)
+}
+
+// ゴミ箱関連のハンドラー
+func (s *Server) handleGetTrash(w http.ResponseWriter, r *http.Request) {
+	handlers.GetTrash(s.client, s.trash)(w, r)
+}
+
+func (s *Server) handlePurgeGoshuinCollection(w http.ResponseWriter, r *http.Request) {
+	handlers.PurgeGoshuinCollection(s.client, s.store)(w, r)
+}
+
+func (s *Server) handleDeleteTemple(w http.ResponseWriter, r *http.Request) {
+	handlers.DeleteTemple(s.client)(w, r)
+}
+
+func (s *Server) handleRestoreTemple(w http.ResponseWriter, r *http.Request) {
+	handlers.RestoreTemple(s.client)(w, r)
+}
+
+// 修正提案・通知関連のハンドラー
+func (s *Server) handleCreateTempleCorrection(w http.ResponseWriter, r *http.Request) {
+	handlers.CreateTempleCorrection(s.client, s.store)(w, r)
+}
+
+func (s *Server) handleGetMyTempleCorrections(w http.ResponseWriter, r *http.Request) {
+	handlers.GetMyTempleCorrections(s.client)(w, r)
+}
+
+func (s *Server) handleGetTempleCorrectionQueue(w http.ResponseWriter, r *http.Request) {
+	handlers.GetTempleCorrectionQueue(s.client)(w, r)
+}
+
+func (s *Server) handleGetTempleCorrection(w http.ResponseWriter, r *http.Request) {
+	handlers.GetTempleCorrection(s.client)(w, r)
+}
+
+func (s *Server) handleApproveTempleCorrection(w http.ResponseWriter, r *http.Request) {
+	handlers.ReviewTempleCorrection(s.client, ent.TempleCorrectionApproved)(w, r)
+}
+
+func (s *Server) handleMergeTempleCorrection(w http.ResponseWriter, r *http.Request) {
+	handlers.ReviewTempleCorrection(s.client, ent.TempleCorrectionMerged)(w, r)
+}
+
+func (s *Server) handleRejectTempleCorrection(w http.ResponseWriter, r *http.Request) {
+	handlers.ReviewTempleCorrection(s.client, ent.TempleCorrectionRejected)(w, r)
+}
+
+// 寺社の提案関連のハンドラー
+func (s *Server) handleCheckTempleProposal(w http.ResponseWriter, r *http.Request) {
+	handlers.CheckTempleProposal(s.client)(w, r)
+}
+
+func (s *Server) handleCreateTempleProposal(w http.ResponseWriter, r *http.Request) {
+	handlers.CreateTempleProposal(s.client, s.store)(w, r)
+}
+
+func (s *Server) handleAddTempleProposalEntry(w http.ResponseWriter, r *http.Request) {
+	handlers.AddTempleProposalEntry(s.client, s.clock)(w, r)
+}
+
+func (s *Server) handleGetMyTempleProposals(w http.ResponseWriter, r *http.Request) {
+	handlers.GetMyTempleProposals(s.client)(w, r)
+}
+
+func (s *Server) handleGetTempleProposalQueue(w http.ResponseWriter, r *http.Request) {
+	handlers.GetTempleProposalQueue(s.client)(w, r)
+}
+
+func (s *Server) handleGetTempleProposal(w http.ResponseWriter, r *http.Request) {
+	handlers.GetTempleProposal(s.client)(w, r)
+}
+
+func (s *Server) handleApproveTempleProposal(w http.ResponseWriter, r *http.Request) {
+	handlers.ReviewTempleProposal(s.client, ent.TempleProposalApproved)(w, r)
+}
+
+func (s *Server) handleMergeTempleProposal(w http.ResponseWriter, r *http.Request) {
+	handlers.ReviewTempleProposal(s.client, ent.TempleProposalMerged)(w, r)
+}
+
+func (s *Server) handleRejectTempleProposal(w http.ResponseWriter, r *http.Request) {
+	handlers.ReviewTempleProposal(s.client, ent.TempleProposalRejected)(w, r)
+}
+
+func (s *Server) handleGetMyNotifications(w http.ResponseWriter, r *http.Request) {
+	handlers.GetMyNotifications(s.client)(w, r)
+}
+
+func (s *Server) handleMarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	handlers.MarkNotificationsRead(s.client)(w, r)
+}
+
+// 監査ログ関連のハンドラー
+func (s *Server) handleGetAuditLogs(w http.ResponseWriter, r *http.Request) {
+	handlers.GetAuditLogs(s.client)(w, r)
+}
+
+func (s *Server) handleVerifyAuditLogs(w http.ResponseWriter, r *http.Request) {
+	handlers.VerifyAuditLogs(s.client)(w, r)
+}
+
 // ガイド関連のハンドラー
 func (s *Server) handleGetGuide(w http.ResponseWriter, r *http.Request) {
 	handlers.GetGuide(s.client)(w, r)
 }
+
+func (s *Server) handleListGuideSections(w http.ResponseWriter, r *http.Request) {
+	handlers.ListGuideContent(s.client, ent.TypeGuideSection)(w, r)
+}
+
+func (s *Server) handleCreateGuideSection(w http.ResponseWriter, r *http.Request) {
+	handlers.CreateGuideContent(s.client, ent.TypeGuideSection)(w, r)
+}
+
+func (s *Server) handleGetGuideSection(w http.ResponseWriter, r *http.Request) {
+	handlers.GetGuideContent(s.client, ent.TypeGuideSection)(w, r)
+}
+
+func (s *Server) handleUpdateGuideSection(w http.ResponseWriter, r *http.Request) {
+	handlers.UpdateGuideContent(s.client, ent.TypeGuideSection)(w, r)
+}
+
+func (s *Server) handleDeleteGuideSection(w http.ResponseWriter, r *http.Request) {
+	handlers.DeleteGuideContent(s.client, ent.TypeGuideSection)(w, r)
+}
+
+func (s *Server) handlePublishGuideSection(w http.ResponseWriter, r *http.Request) {
+	handlers.PublishGuideContent(s.client, ent.TypeGuideSection)(w, r)
+}
+
+func (s *Server) handleUnpublishGuideSection(w http.ResponseWriter, r *http.Request) {
+	handlers.UnpublishGuideContent(s.client, ent.TypeGuideSection)(w, r)
+}
+
+func (s *Server) handleGetGuideSectionVersions(w http.ResponseWriter, r *http.Request) {
+	handlers.GetGuideVersions(s.client, ent.TypeGuideSection)(w, r)
+}
+
+func (s *Server) handleRollbackGuideSection(w http.ResponseWriter, r *http.Request) {
+	handlers.RollbackGuideContent(s.client, ent.TypeGuideSection)(w, r)
+}
+
+func (s *Server) handleListGuideTips(w http.ResponseWriter, r *http.Request) {
+	handlers.ListGuideContent(s.client, ent.TypeGuideTip)(w, r)
+}
+
+func (s *Server) handleCreateGuideTip(w http.ResponseWriter, r *http.Request) {
+	handlers.CreateGuideContent(s.client, ent.TypeGuideTip)(w, r)
+}
+
+func (s *Server) handleGetGuideTip(w http.ResponseWriter, r *http.Request) {
+	handlers.GetGuideContent(s.client, ent.TypeGuideTip)(w, r)
+}
+
+func (s *Server) handleUpdateGuideTip(w http.ResponseWriter, r *http.Request) {
+	handlers.UpdateGuideContent(s.client, ent.TypeGuideTip)(w, r)
+}
+
+func (s *Server) handleDeleteGuideTip(w http.ResponseWriter, r *http.Request) {
+	handlers.DeleteGuideContent(s.client, ent.TypeGuideTip)(w, r)
+}
+
+func (s *Server) handlePublishGuideTip(w http.ResponseWriter, r *http.Request) {
+	handlers.PublishGuideContent(s.client, ent.TypeGuideTip)(w, r)
+}
+
+func (s *Server) handleUnpublishGuideTip(w http.ResponseWriter, r *http.Request) {
+	handlers.UnpublishGuideContent(s.client, ent.TypeGuideTip)(w, r)
+}
+
+func (s *Server) handleGetGuideTipVersions(w http.ResponseWriter, r *http.Request) {
+	handlers.GetGuideVersions(s.client, ent.TypeGuideTip)(w, r)
+}
+
+func (s *Server) handleRollbackGuideTip(w http.ResponseWriter, r *http.Request) {
+	handlers.RollbackGuideContent(s.client, ent.TypeGuideTip)(w, r)
+}
+
+func (s *Server) handleUploadGuideMedia(w http.ResponseWriter, r *http.Request) {
+	handlers.UploadGuideMedia(s.store)(w, r)
+}
+
+// マナークイズ関連のハンドラー
+func (s *Server) handleGetGuideQuizzes(w http.ResponseWriter, r *http.Request) {
+	handlers.GetGuideQuizzes(s.client)(w, r)
+}
+
+func (s *Server) handleGetGuideQuiz(w http.ResponseWriter, r *http.Request) {
+	handlers.GetGuideQuiz(s.client)(w, r)
+}
+
+func (s *Server) handleSubmitQuizAttempt(w http.ResponseWriter, r *http.Request) {
+	handlers.SubmitQuizAttempt(s.client)(w, r)
+}
+
+func (s *Server) handleGetMyGuideProgress(w http.ResponseWriter, r *http.Request) {
+	handlers.GetMyGuideProgress(s.client)(w, r)
+}
+
+func (s *Server) handleGetQuizQuestions(w http.ResponseWriter, r *http.Request) {
+	handlers.GetQuizQuestions(s.client)(w, r)
+}
+
+func (s *Server) handleCreateQuizQuestion(w http.ResponseWriter, r *http.Request) {
+	handlers.CreateQuizQuestion(s.client)(w, r)
+}
+
+func (s *Server) handleGetQuizQuestion(w http.ResponseWriter, r *http.Request) {
+	handlers.GetQuizQuestion(s.client)(w, r)
+}
+
+func (s *Server) handleUpdateQuizQuestion(w http.ResponseWriter, r *http.Request) {
+	handlers.UpdateQuizQuestion(s.client)(w, r)
+}
+
+func (s *Server) handleDeleteQuizQuestion(w http.ResponseWriter, r *http.Request) {
+	handlers.DeleteQuizQuestion(s.client)(w, r)
+}
+
+// 翻訳関連のハンドラー
+func (s *Server) handleGetTranslations(w http.ResponseWriter, r *http.Request) {
+	handlers.GetTranslations(s.client)(w, r)
+}
+
+func (s *Server) handlePutTranslation(w http.ResponseWriter, r *http.Request) {
+	handlers.PutTranslation(s.client)(w, r)
+}
+
+func (s *Server) handleDeleteTranslation(w http.ResponseWriter, r *http.Request) {
+	handlers.DeleteTranslation(s.client)(w, r)
+}
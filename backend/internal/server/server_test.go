@@ -0,0 +1,335 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"stamp-backend/internal/auth"
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/config"
+	"stamp-backend/internal/database"
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/storage"
+)
+
+// update ゴールデンファイルを実際のレスポンスで書き換えます（go test ./internal/server -update）
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// testNow テストのサーバーの現在時刻
+var testNow = time.Date(2024, 6, 1, 12, 0, 0, 0, time.FixedZone("", 9*60*60))
+
+// testPNG 写真のアップロードに使う最小のPNG
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89\x00\x00\x00\rIDATx\x9cc\xf8\x0f\x00\x00\x01\x01\x00\x05\x18\xd8N\x00\x00\x00\x00IEND\xaeB`\x82")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	// マイグレーションなどのログでテストの出力が埋もれないようにします
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fixtures testdata/fixtures.yaml の初期データ
+type fixtures struct {
+	// Users ユーザーIDとロール
+	Users       map[string]string   `yaml:"users"`
+	Temples     []templeFixture     `yaml:"temples"`
+	Collections []collectionFixture `yaml:"collections"`
+}
+
+type templeFixture struct {
+	// Key 御朱印の fixture から寺社を参照する名前
+	Key         string  `yaml:"key"`
+	Name        string  `yaml:"name"`
+	NameEn      string  `yaml:"name_en"`
+	Description string  `yaml:"description"`
+	Prefecture  string  `yaml:"prefecture"`
+	Kind        string  `yaml:"kind"`
+	Latitude    float64 `yaml:"latitude"`
+	Longitude   float64 `yaml:"longitude"`
+	Inactive    bool    `yaml:"inactive"`
+}
+
+type collectionFixture struct {
+	User     string `yaml:"user"`
+	ClientID string `yaml:"client_id"`
+	// Temple 寺社の fixture の key
+	Temple         string    `yaml:"temple"`
+	Notes          string    `yaml:"notes"`
+	Tags           []string  `yaml:"tags"`
+	Rating         int       `yaml:"rating"`
+	FeePaid        int       `yaml:"fee_paid"`
+	WaitingMinutes int       `yaml:"waiting_minutes"`
+	HallName       string    `yaml:"hall_name"`
+	CollectedAt    time.Time `yaml:"collected_at"`
+}
+
+// testServer fixture を登録したサーバー
+type testServer struct {
+	*Server
+	handler http.Handler
+	users   map[string]string
+	// golden ゴールデンファイルのディレクトリ
+	golden string
+}
+
+// newTestServer driver（sqlite または memory）のデータベースでサーバーを作成し、fixture を登録します
+// sqlite はテストごとに別のメモリ上のデータベースを使います
+func newTestServer(t *testing.T, driver string) *testServer {
+	t.Helper()
+
+	client, err := database.OpenWithClock(map[string]string{"driver": driver, "name": ":memory:"}, clock.Fixed(testNow))
+	if err != nil {
+		t.Fatalf("failed to open %s database: %v", driver, err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	s := New(client,
+		WithStorage(storage.NewLocal(t.TempDir(), "/uploads/")),
+		WithClock(clock.Fixed(testNow)),
+	)
+	ts := &testServer{
+		Server:  s,
+		handler: s.Handler(),
+		golden:  filepath.Join("testdata", "golden", driver),
+	}
+	ts.users = loadFixtures(t, client)
+	return ts
+}
+
+// loadFixtures testdata/fixtures.yaml の寺社と御朱印を登録し、ユーザーのロールを返します
+func loadFixtures(t *testing.T, client *ent.Client) map[string]string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "fixtures.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read fixtures: %v", err)
+	}
+	var f fixtures
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		t.Fatalf("failed to parse fixtures: %v", err)
+	}
+
+	ctx := context.Background()
+	temples := map[string]int{}
+	for _, tf := range f.Temples {
+		temple, err := client.Temple.Create().
+			SetName(tf.Name).
+			SetNameEn(tf.NameEn).
+			SetDescription(tf.Description).
+			SetPrefecture(tf.Prefecture).
+			SetKind(tf.Kind).
+			SetLatitude(tf.Latitude).
+			SetLongitude(tf.Longitude).
+			SetActive(!tf.Inactive).
+			Save(ctx)
+		if err != nil {
+			t.Fatalf("failed to create temple %s: %v", tf.Key, err)
+		}
+		temples[tf.Key] = temple.ID
+	}
+
+	for _, cf := range f.Collections {
+		templeID, ok := temples[cf.Temple]
+		if !ok {
+			t.Fatalf("unknown temple %q in collection fixture", cf.Temple)
+		}
+		_, err := client.GoshuinCollection.Create().
+			SetUserID(cf.User).
+			SetClientID(cf.ClientID).
+			SetTempleID(templeID).
+			SetNotes(cf.Notes).
+			SetTags(cf.Tags).
+			SetDetails(cf.Rating, cf.FeePaid, cf.WaitingMinutes, cf.HallName).
+			SetCollectedAt(cf.CollectedAt).
+			Save(ctx)
+		if err != nil {
+			t.Fatalf("failed to create collection %s: %v", cf.ClientID, err)
+		}
+	}
+	return f.Users
+}
+
+// routeCase リクエスト1件と、期待するステータス
+// レスポンスは testdata/golden/<driver>/<name>.json と比較します
+type routeCase struct {
+	name   string
+	user   string
+	method string
+	path   string
+	body   string
+	// form multipart/form-data で送る値。file を指定すると testPNG を添付します
+	form    map[string]string
+	file    string
+	headers map[string]string
+	status  int
+}
+
+// request リクエストを組み立てます。user は fixture のユーザーとして認証します
+func (ts *testServer) request(t *testing.T, c routeCase) *http.Request {
+	t.Helper()
+
+	var body io.Reader = strings.NewReader(c.body)
+	contentType := ""
+	if c.body != "" {
+		contentType = "application/json"
+	}
+	if c.form != nil || c.file != "" {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for k, v := range c.form {
+			mw.WriteField(k, v)
+		}
+		if c.file != "" {
+			fw, err := mw.CreateFormFile(c.file, "photo.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(testPNG)
+		}
+		mw.Close()
+		body, contentType = &buf, mw.FormDataContentType()
+	}
+
+	r := httptest.NewRequest(c.method, c.path, body)
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	r.Header.Set("X-Request-ID", c.name)
+	for k, v := range c.headers {
+		r.Header.Set(k, v)
+	}
+	if c.user != "" {
+		role, ok := ts.users[c.user]
+		if !ok {
+			t.Fatalf("unknown user %q", c.user)
+		}
+		token, err := auth.NewToken(config.GetJWTSecret(), auth.User{ID: c.user, Role: role}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+// run 順にリクエストを送り、ステータスとゴールデンファイルを確認します
+// 前のリクエストの結果を後のリクエストが使うため、サブテストは並列にしません
+func (ts *testServer) run(t *testing.T, cases []routeCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ts.handler.ServeHTTP(rec, ts.request(t, c))
+
+			if rec.Code != c.status {
+				t.Errorf("status = %d, want %d; body: %s", rec.Code, c.status, rec.Body.String())
+			}
+			ts.compareGolden(t, c.name, goldenResponse(t, rec))
+		})
+	}
+}
+
+// compareGolden レスポンスをゴールデンファイルと比較します。-update の場合は書き換えます
+func (ts *testServer) compareGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join(ts.golden, name+".json")
+	if *update {
+		if err := os.MkdirAll(ts.golden, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("response differs from %s (run with -update to accept it)\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// goldenResponse ステータスと本文を、実行ごとに変わる値を置き換えた JSON にします
+// JSON 以外の本文はテキストならそのまま、バイナリなら Content-Type だけを記録します
+func goldenResponse(t *testing.T, rec *httptest.ResponseRecorder) []byte {
+	t.Helper()
+
+	out := map[string]interface{}{"status": rec.Code}
+	contentType := rec.Header().Get("Content-Type")
+	if contentType != "application/json" {
+		out["content_type"] = contentType
+	}
+
+	raw := rec.Body.Bytes()
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var body interface{}
+	switch {
+	case len(raw) == 0:
+	case dec.Decode(&body) == nil:
+		out["body"] = normalize(body)
+	case utf8.Valid(raw):
+		out["body"] = string(raw)
+	default:
+		out["body"] = fmt.Sprintf("<%d bytes>", len(raw))
+		if strings.HasPrefix(contentType, "application/zip") || strings.HasPrefix(contentType, "application/pdf") {
+			// ZIP と PDF は作成日時を含むため、サイズも記録しません
+			out["body"] = "<binary>"
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// uuidPattern サーバーが生成した UUID
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// normalize 実行ごとに変わる値を置き換えます
+// サーバーが生成した UUID は <uuid> になります
+// 日時はデータベースもサーバーも固定した時計から取るため、日時を含むハッシュも含めてそのまま残ります
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = normalize(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+		return v
+	case string:
+		if uuidPattern.MatchString(v) {
+			return "<uuid>"
+		}
+	}
+	return v
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"stamp-backend/internal/config"
+)
+
+// ErrNotFound オブジェクトが存在しない場合のエラー
+var ErrNotFound = errors.New("object not found")
+
+// Storage 画像などのファイルを保存するバックエンド
+type Storage interface {
+	// Put keyにファイルを保存します
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Open keyのファイルを開きます
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete keyのファイルを削除します
+	Delete(ctx context.Context, key string) error
+	// URL keyの公開URLを返します
+	URL(key string) string
+	// KeyFromURL 公開URLからkeyを逆引きします
+	KeyFromURL(url string) (string, bool)
+}
+
+// New 設定からストレージを作成します
+func New() Storage {
+	cfg := config.GetStorageConfig()
+	return NewLocal(cfg["dir"], cfg["base_url"])
+}
+
+// Local ローカルディスクに保存するストレージ
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocal dir配下に保存し、baseURLで公開するストレージを作成します
+func NewLocal(dir, baseURL string) *Local {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &Local{dir: dir, baseURL: baseURL}
+}
+
+// Dir 保存先ディレクトリを返します
+func (l *Local) Dir() string {
+	return l.dir
+}
+
+// BaseURL 公開URLのプレフィックスを返します
+func (l *Local) BaseURL() string {
+	return l.baseURL
+}
+
+// path keyをディレクトリトラバーサルを防いだファイルパスに変換します
+func (l *Local) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(clean)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, r io.Reader) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("failed to create storage directory: %v", err)
+	}
+
+	// 書き込み途中のファイルを公開しないよう一時ファイル経由で置き換える
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write object: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write object: %v", err)
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (l *Local) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.baseURL + strings.TrimPrefix(key, "/")
+}
+
+func (l *Local) KeyFromURL(url string) (string, bool) {
+	if !strings.HasPrefix(url, l.baseURL) {
+		return "", false
+	}
+	key := strings.TrimPrefix(url, l.baseURL)
+	return key, key != ""
+}
+
+// PutHashed 内容のSHA-256をファイル名にして dir 配下に保存し、keyを返します
+// 同じ内容は同じkeyに上書きされるため、重複して保存されません
+func PutHashed(ctx context.Context, st Storage, dir string, data []byte, ext string) (string, error) {
+	sum := sha256.Sum256(data)
+	key := path.Join(dir, hex.EncodeToString(sum[:16])+ext)
+	if err := st.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// ErrExternalURL ストレージ外のURLを読もうとした場合のエラー
+var ErrExternalURL = errors.New("image is not stored on this server")
+
+// Fetch 画像URLの内容をストレージから読み込みます
+// ユーザーが指定した外部URLへサーバーから接続しないよう、ストレージ外のURLは ErrExternalURL になります
+func Fetch(ctx context.Context, st Storage, url string) (io.ReadCloser, error) {
+	key, ok := st.KeyFromURL(url)
+	if !ok {
+		return nil, ErrExternalURL
+	}
+	return st.Open(ctx, key)
+}
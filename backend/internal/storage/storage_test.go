@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// read keyの内容を読み込みます
+func read(t *testing.T, st Storage, key string) string {
+	t.Helper()
+
+	rc, err := st.Open(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Open(%q): %v", key, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := NewLocal(dir, "http://localhost/uploads")
+
+	if err := st.Put(ctx, "goshuin/a.png", strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Put(ctx, "goshuin/a.png", strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, st, "goshuin/a.png"); got != "second" {
+		t.Errorf("content = %q; want second", got)
+	}
+
+	// 一時ファイルが残っていないことを確かめます
+	entries, err := os.ReadDir(filepath.Join(dir, "goshuin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("files = %d; want 1", len(entries))
+	}
+
+	if err := st.Delete(ctx, "goshuin/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Open(ctx, "goshuin/a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after delete: %v; want ErrNotFound", err)
+	}
+	// 存在しないファイルの削除はエラーにしません
+	if err := st.Delete(ctx, "goshuin/a.png"); err != nil {
+		t.Errorf("Delete of missing key: %v", err)
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	dir := t.TempDir()
+	st := NewLocal(dir, "/uploads/")
+
+	// ディレクトリトラバーサルは保存先ディレクトリの中に閉じ込めます
+	for _, key := range []string{"../x", "a/../../x", "/x"} {
+		p, err := st.path(key)
+		if err != nil {
+			t.Errorf("path(%q): %v", key, err)
+			continue
+		}
+		if want := filepath.Join(dir, "x"); p != want {
+			t.Errorf("path(%q) = %q; want %q", key, p, want)
+		}
+	}
+	for _, key := range []string{"", "/", ".."} {
+		if _, err := st.path(key); err == nil {
+			t.Errorf("path(%q) returned no error", key)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	st := NewLocal(t.TempDir(), "http://localhost/uploads")
+
+	url := st.URL("/goshuin/a.png")
+	if url != "http://localhost/uploads/goshuin/a.png" {
+		t.Errorf("URL = %q", url)
+	}
+	if key, ok := st.KeyFromURL(url); !ok || key != "goshuin/a.png" {
+		t.Errorf("KeyFromURL(%q) = %q, %v", url, key, ok)
+	}
+	for _, url := range []string{"http://example.com/uploads/a.png", "http://localhost/uploads/", "http://localhost/other/a.png"} {
+		if key, ok := st.KeyFromURL(url); ok {
+			t.Errorf("KeyFromURL(%q) = %q; want false", url, key)
+		}
+	}
+}
+
+func TestPutHashed(t *testing.T) {
+	ctx := context.Background()
+	st := NewLocal(t.TempDir(), "/uploads/")
+
+	a, err := PutHashed(ctx, st, "guide", []byte("image"), ".png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := PutHashed(ctx, st, "guide", []byte("image"), ".png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := PutHashed(ctx, st, "guide", []byte("other"), ".png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同じ内容は同じkeyになります
+	if a != b || a == c {
+		t.Errorf("keys = %q, %q, %q; want the same key for the same content", a, b, c)
+	}
+	if !strings.HasPrefix(a, "guide/") || !strings.HasSuffix(a, ".png") || len(a) != len("guide/")+32+len(".png") {
+		t.Errorf("key = %q", a)
+	}
+	if got := read(t, st, a); got != "image" {
+		t.Errorf("content = %q; want image", got)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ctx := context.Background()
+	st := NewLocal(t.TempDir(), "http://localhost/uploads/")
+	if err := st.Put(ctx, "a.png", strings.NewReader("image")); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := Fetch(ctx, st, "http://localhost/uploads/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.Close()
+	if _, err := Fetch(ctx, st, "http://localhost/uploads/missing.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Fetch of missing image: %v; want ErrNotFound", err)
+	}
+	// 外部のURLにはサーバーから接続しません
+	if _, err := Fetch(ctx, st, "http://169.254.169.254/latest/meta-data"); !errors.Is(err, ErrExternalURL) {
+		t.Errorf("Fetch of external URL: %v; want ErrExternalURL", err)
+	}
+}
@@ -0,0 +1,129 @@
+// Package trash ゴミ箱に入れた御朱印の完全削除と、削除された寺社の掃除を行います
+package trash
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/ent"
+	"stamp-backend/internal/storage"
+)
+
+// DefaultRetentionDays ゴミ箱に残す日数の既定値
+const DefaultRetentionDays = 30
+
+// Purger 保持期間を過ぎたゴミ箱の中身を完全に削除します
+type Purger struct {
+	client    *ent.Client
+	store     storage.Storage
+	clock     clock.Clock
+	retention time.Duration
+}
+
+// New 保持期間（日）を指定して Purger を作成します
+func New(client *ent.Client, store storage.Storage, clk clock.Clock, retentionDays int) *Purger {
+	if retentionDays <= 0 {
+		retentionDays = DefaultRetentionDays
+	}
+	return &Purger{
+		client:    client,
+		store:     store,
+		clock:     clk,
+		retention: time.Duration(retentionDays) * 24 * time.Hour,
+	}
+}
+
+// PurgeAt ゴミ箱に入れた時刻（RFC3339）から完全に削除される時刻を返します
+func (p *Purger) PurgeAt(deletedAt string) string {
+	t, err := time.Parse(time.RFC3339, deletedAt)
+	if err != nil {
+		return ""
+	}
+	return t.Add(p.retention).UTC().Format(time.RFC3339)
+}
+
+// Purge 保持期間を過ぎた御朱印と、参照されなくなった削除済みの寺社を完全に削除します
+// 削除した御朱印の件数を返します
+func (p *Purger) Purge(ctx context.Context) (int, error) {
+	cutoff := p.clock.Now().Add(-p.retention)
+
+	expired, err := p.client.GoshuinCollection.Query().
+		Filter(ent.GoshuinCollectionFilter{Trashed: true, DeletedBefore: cutoff}).
+		All(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, collection := range expired {
+		if err := PurgeCollection(ctx, p.client, p.store, collection.ID); err != nil {
+			log.Printf("Failed to purge goshuin collection %d: %v", collection.ID, err)
+			continue
+		}
+		purged++
+	}
+
+	temples, err := p.client.Temple.PurgeDeleted(ctx, cutoff)
+	if err != nil {
+		return purged, err
+	}
+	if purged > 0 || temples > 0 {
+		log.Printf("Purged %d goshuin collections and %d temples from the trash", purged, temples)
+	}
+	return purged, nil
+}
+
+// Run 指定間隔で Purge を実行します。ctx が終了するまで戻りません
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.Purge(ctx); err != nil {
+			log.Printf("Failed to purge trash: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeCollection ゴミ箱の御朱印を完全に削除し、どこからも参照されなくなった写真ファイルを削除します
+func PurgeCollection(ctx context.Context, client *ent.Client, store storage.Storage, id int) error {
+	photos, err := client.GoshuinPhoto.ListByCollection(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := client.GoshuinCollection.Purge(ctx, id); err != nil {
+		return err
+	}
+
+	for _, photo := range photos {
+		ReleasePhotoFile(ctx, client, store, photo)
+	}
+	return nil
+}
+
+// ReleasePhotoFile 削除した写真のファイルを、他の写真や御朱印から参照されていない場合のみ削除します
+func ReleasePhotoFile(ctx context.Context, client *ent.Client, store storage.Storage, photo *ent.GoshuinPhoto) {
+	key := photo.StorageKey
+	if key == "" {
+		key, _ = store.KeyFromURL(photo.URL)
+	}
+	if key == "" {
+		return
+	}
+
+	inUse, err := client.GoshuinPhoto.KeyInUse(ctx, key, photo.URL)
+	if err == nil && !inUse {
+		err = store.Delete(ctx, key)
+	}
+	if err != nil {
+		log.Printf("failed to delete photo file %s: %v", key, err)
+	}
+}
@@ -0,0 +1,161 @@
+package trash
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"stamp-backend/internal/clock"
+	"stamp-backend/internal/database"
+	"stamp-backend/internal/storage"
+)
+
+// testNow テストの現在時刻
+var testNow = time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	// マイグレーションのログでテストの出力が埋もれないようにします
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestPurgeAt(t *testing.T) {
+	cases := []struct {
+		days      int
+		deletedAt string
+		want      string
+	}{
+		{7, "2024-06-01T03:00:00Z", "2024-06-08T03:00:00Z"},
+		{0, "2024-06-01T12:00:00+09:00", "2024-07-01T03:00:00Z"},
+		{30, "2024-06-01", ""},
+	}
+	for _, c := range cases {
+		p := New(nil, nil, clock.Fixed(testNow), c.days)
+		if got := p.PurgeAt(c.deletedAt); got != c.want {
+			t.Errorf("PurgeAt(%q) with %d days = %q; want %q", c.deletedAt, c.days, got, c.want)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	client, err := database.OpenWithClock(map[string]string{"driver": "sqlite", "name": ":memory:"}, clock.Fixed(testNow))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer client.Close()
+	dir := t.TempDir()
+	store := storage.NewLocal(dir, "http://localhost/uploads/")
+	ctx := context.Background()
+
+	// at client の時計を指定した日数前に合わせます
+	at := func(daysAgo int) {
+		client.SetClock(clock.Fixed(testNow.AddDate(0, 0, -daysAgo)))
+	}
+	newTemple := func(name string) int {
+		temple, err := client.Temple.Create().
+			SetName(name).
+			SetPrefecture("東京都").
+			SetKind("temple").
+			SetLatitude(35.7148).
+			SetLongitude(139.7967).
+			SetActive(true).
+			Save(ctx)
+		if err != nil {
+			t.Fatalf("failed to create temple: %v", err)
+		}
+		return temple.ID
+	}
+	newCollection := func(templeID int, keys ...string) int {
+		gc, err := client.GoshuinCollection.Create().SetUserID("user-1").SetTempleID(templeID).Save(ctx)
+		if err != nil {
+			t.Fatalf("failed to create collection: %v", err)
+		}
+		for _, key := range keys {
+			if err := store.Put(ctx, key, strings.NewReader(key)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.GoshuinPhoto.Create().SetCollectionID(gc.ID).SetFile(key, store.URL(key)).Save(ctx); err != nil {
+				t.Fatalf("failed to create photo: %v", err)
+			}
+		}
+		return gc.ID
+	}
+
+	at(40)
+	oldTemple, recentTemple, liveTemple := newTemple("古い寺"), newTemple("最近の寺"), newTemple("残る寺")
+	expired := newCollection(oldTemple, "photos/expired.jpg", "photos/shared.jpg")
+	recent := newCollection(recentTemple, "photos/recent.jpg")
+	live := newCollection(liveTemple, "photos/shared.jpg")
+	for _, id := range []int{oldTemple, recentTemple} {
+		if err := client.Temple.DeleteOneID(id).Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.GoshuinCollection.DeleteOneID(expired).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	at(10)
+	if err := client.GoshuinCollection.DeleteOneID(recent).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	at(0)
+
+	purged, err := New(client, store, clock.Fixed(testNow), 30).Purge(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("purged = %d; want 1", purged)
+	}
+
+	// 保持期間を過ぎた御朱印だけを完全に削除します
+	for _, c := range []struct {
+		name    string
+		id      int
+		trashed bool
+	}{
+		{"expired", expired, false},
+		{"recent", recent, true},
+	} {
+		if _, err := client.GoshuinCollection.GetTrashed(ctx, c.id); (err == nil) != c.trashed {
+			t.Errorf("%s collection in trash = %v; want %v", c.name, err == nil, c.trashed)
+		}
+	}
+	if _, err := client.GoshuinCollection.Get(ctx, live); err != nil {
+		t.Errorf("live collection: %v", err)
+	}
+
+	// 他の写真から参照されているファイルは残します
+	for _, c := range []struct {
+		key  string
+		kept bool
+	}{
+		{"photos/expired.jpg", false},
+		{"photos/shared.jpg", true},
+		{"photos/recent.jpg", true},
+	} {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(c.key)))
+		if (err == nil) != c.kept {
+			t.Errorf("%s kept = %v; want %v", c.key, err == nil, c.kept)
+		}
+	}
+
+	// 削除済みの寺社は、ゴミ箱の御朱印から参照されている間は残します
+	for _, c := range []struct {
+		name string
+		id   int
+		kept bool
+	}{
+		{"old", oldTemple, false},
+		{"recent", recentTemple, true},
+	} {
+		if _, err := client.Temple.Restore(ctx, c.id); (err == nil) != c.kept {
+			t.Errorf("%s temple kept = %v; want %v", c.name, err == nil, c.kept)
+		}
+	}
+}